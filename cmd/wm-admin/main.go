@@ -0,0 +1,354 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// wm-admin gives read access to the WM server information and enumeration data, the same data the client caches.
+//
+// Usage:
+//
+//	wm-admin [flags] info
+//	wm-admin [flags] makes
+//	wm-admin [flags] models <brand>
+//	wm-admin [flags] oses
+//	wm-admin [flags] os-versions <os>
+//	wm-admin [flags] flush-cache-check [ltime]
+//
+// flush-cache-check prints the time WM server has loaded its WURFL file. If the ltime of a previous check is given, it
+// also tells whether a later file has been loaded since then, which makes the clients flush their caches.
+//
+// Results are printed as a table, or as JSON with -output json. The exit code tells why a command failed, so that
+// wm-admin can be used in scripts and health checks:
+//
+//	0 success
+//	1 other errors
+//	2 wrong usage
+//	3 brand or OS not found
+//	4 WM server cannot be reached
+//	5 timeout
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/wurfl/wurfl-microservice-client-golang/v2/scientiamobile/wmclient"
+)
+
+// exit codes
+const (
+	exitOK         = 0
+	exitError      = 1
+	exitUsage      = 2
+	exitNotFound   = 3
+	exitServerDown = 4
+	exitTimeout    = 5
+)
+
+// retryDelay is the pause between the attempts of a command that failed because of a timeout or an unreachable server
+const retryDelay = time.Second
+
+// errNotFound is returned when the brand or OS given to a command is unknown to WM server
+var errNotFound = errors.New("not found")
+
+// usageError is returned for wrong commands or arguments
+type usageError struct {
+	message string
+}
+
+func (e *usageError) Error() string {
+	return e.message
+}
+
+// result is the output of a command: data is printed with -output json, header and rows with -output table
+type result struct {
+	data   interface{}
+	header []string
+	rows   [][]string
+}
+
+func main() {
+	os.Exit(runCLI(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// runCLI parses the given command line, executes the command writing its result to stdout and returns the exit code
+func runCLI(arguments []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("wm-admin", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	scheme := flags.String("scheme", "http", "WM server scheme")
+	host := flags.String("host", "localhost", "WM server host")
+	port := flags.String("port", "8080", "WM server port")
+	baseURI := flags.String("base-uri", "", "WM server base URI")
+	serverURL := flags.String("url", "", "WM server URL, ie: https://wm.internal:8443/wm, overriding scheme, host, port and base URI")
+	timeout := flags.Duration("timeout", 30*time.Second, "timeout of each attempt of the command")
+	retries := flags.Int("retries", 0, "number of times the command is retried on timeouts and unreachable server")
+	output := flags.String("output", "table", "output format, json or table")
+	flags.Usage = func() {
+		usage(flags)
+	}
+	if err := flags.Parse(arguments); err != nil {
+		return exitUsage
+	}
+
+	if flags.NArg() == 0 || (*output != "json" && *output != "table") {
+		usage(flags)
+		return exitUsage
+	}
+
+	var res *result
+	var err error
+	for attempt := 0; ; attempt++ {
+		res, err = attemptCommand(*serverURL, *scheme, *host, *port, *baseURI, *timeout, flags.Arg(0), flags.Args()[1:])
+		code := exitCode(err)
+		if attempt >= *retries || (code != exitServerDown && code != exitTimeout) {
+			break
+		}
+		time.Sleep(retryDelay)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "wm-admin:", err)
+		return exitCode(err)
+	}
+
+	if *output == "json" {
+		err = printJSON(stdout, res)
+	} else {
+		err = printTable(stdout, res)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "wm-admin:", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func usage(flags *flag.FlagSet) {
+	fmt.Fprintf(flags.Output(), "Usage: %s [flags] <command> [arguments]\n\n", flags.Name())
+	fmt.Fprintln(flags.Output(), "Commands: info, makes, models <brand>, oses, os-versions <os>, flush-cache-check [ltime]")
+	fmt.Fprintln(flags.Output(), "\nFlags:")
+	flags.PrintDefaults()
+}
+
+// exitCode returns the exit code for the given command error
+func exitCode(err error) int {
+	var usageErr *usageError
+	var urlErr *url.Error
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usageErr):
+		return exitUsage
+	case errors.Is(err, errNotFound):
+		return exitNotFound
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &urlErr) && urlErr.Timeout():
+		return exitTimeout
+	case errors.As(err, &urlErr):
+		// the request has not been completed, WM server is down or not reachable
+		return exitServerDown
+	default:
+		return exitError
+	}
+}
+
+// attemptCommand connects to WM server, at the given URL if not empty, and executes the given command
+func attemptCommand(serverURL, scheme, host, port, baseURI string, timeout time.Duration, command string, args []string) (*result, error) {
+	// the connection check done when the client is created is bound by the command timeout as well
+	timeoutOpt := wmclient.WithHTTPTimeout(timeout, timeout)
+	var client *wmclient.WmClient
+	var err error
+	if serverURL != "" {
+		client, err = wmclient.CreateFromURL(serverURL, timeoutOpt)
+	} else {
+		client, err = wmclient.CreateWithOptions(wmclient.WithServer(scheme, host, port), wmclient.WithBaseURI(baseURI), timeoutOpt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return run(ctx, client, command, args)
+}
+
+// run executes the given command
+func run(ctx context.Context, client *wmclient.WmClient, command string, args []string) (*result, error) {
+	switch command {
+	case "info":
+		if err := checkArgs(command, args, 0); err != nil {
+			return nil, err
+		}
+		info, err := client.GetInfoContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &result{
+			data:   info,
+			header: []string{"PROPERTY", "VALUE"},
+			rows: [][]string{
+				{"WM server version", info.WmVersion},
+				{"WURFL API version", info.WurflAPIVersion},
+				{"WURFL info", info.WurflInfo},
+				{"WURFL load time", info.Ltime},
+				{"Important headers", strings.Join(info.ImportantHeaders, ", ")},
+				{"Static capabilities", fmt.Sprint(len(info.StaticCaps))},
+				{"Virtual capabilities", fmt.Sprint(len(info.VirtualCaps))},
+			},
+		}, nil
+
+	case "makes":
+		if err := checkArgs(command, args, 0); err != nil {
+			return nil, err
+		}
+		makes, err := client.GetAllDeviceMakesContext(ctx)
+		return sortedResult("BRAND", makes, err)
+
+	case "models":
+		if err := checkArgs(command, args, 1); err != nil {
+			return nil, err
+		}
+		devices, err := client.GetAllDevicesForMakeContext(ctx, args[0])
+		if err != nil {
+			return nil, notFoundError("brand", err)
+		}
+		// devices may be shared with the client caches, they are sorted in a copy
+		sorted := append([]wmclient.JSONModelMktName(nil), devices...)
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i].ModelName < sorted[j].ModelName
+		})
+		res := &result{data: sorted, header: []string{"MODEL", "MARKETING NAME"}}
+		for _, device := range sorted {
+			res.rows = append(res.rows, []string{device.ModelName, device.MarketingName})
+		}
+		return res, nil
+
+	case "oses":
+		if err := checkArgs(command, args, 0); err != nil {
+			return nil, err
+		}
+		oses, err := client.GetAllOSesContext(ctx)
+		return sortedResult("OS", oses, err)
+
+	case "os-versions":
+		if err := checkArgs(command, args, 1); err != nil {
+			return nil, err
+		}
+		versions, err := client.GetAllVersionsForOSContext(ctx, args[0])
+		if err != nil {
+			return nil, notFoundError("OS", err)
+		}
+		return sortedResult("VERSION", versions, nil)
+
+	case "flush-cache-check":
+		if len(args) > 1 {
+			return nil, &usageError{fmt.Sprintf("%s takes at most 1 argument", command)}
+		}
+		info, err := client.GetInfoContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		check := struct {
+			Ltime    string `json:"ltime"`
+			Reloaded *bool  `json:"reloaded,omitempty"` // set only if a previous ltime is given
+		}{Ltime: info.Ltime}
+		res := &result{data: &check, header: []string{"PROPERTY", "VALUE"}, rows: [][]string{{"WURFL load time", info.Ltime}}}
+		if len(args) == 1 {
+			reloaded := reloadedSince(args[0], info.Ltime)
+			check.Reloaded = &reloaded
+			if reloaded {
+				res.rows = append(res.rows, []string{"Cache", "WURFL file reloaded since " + args[0] + ": client caches will be flushed"})
+			} else {
+				res.rows = append(res.rows, []string{"Cache", "WURFL file not reloaded: client caches are valid"})
+			}
+		}
+		return res, nil
+
+	default:
+		return nil, &usageError{fmt.Sprintf("unknown command %q", command)}
+	}
+}
+
+// checkArgs returns an error if the number of arguments of the given command is not the expected one
+func checkArgs(command string, args []string, expected int) error {
+	if len(args) != expected {
+		return &usageError{fmt.Sprintf("%s takes %d argument(s), %d given", command, expected, len(args))}
+	}
+	return nil
+}
+
+// notFoundError converts the error returned by the client for an unknown brand or OS to one matching errNotFound, keeping
+// the suggested name, if any. Other errors are returned unchanged
+func notFoundError(kind string, err error) error {
+	var unknown *wmclient.UnknownNameError
+	if !errors.As(err, &unknown) {
+		return err
+	}
+	if unknown.Suggestion != "" {
+		return fmt.Errorf("%s %s (did you mean %q?): %w", kind, unknown.Name, unknown.Suggestion, errNotFound)
+	}
+	return fmt.Errorf("%s %s: %w", kind, unknown.Name, errNotFound)
+}
+
+// reloadedSince tells whether the given WURFL file load time makes the clients flush their caches, when they hold data
+// loaded at the previous one: as the clients do, load times earlier than the previous one are not reloads
+func reloadedSince(previous string, ltime string) bool {
+	previousTime, perr := wmclient.ParseLtime(previous)
+	loaded, err := wmclient.ParseLtime(ltime)
+	if perr != nil || err != nil {
+		return previous != ltime
+	}
+	return loaded.After(previousTime)
+}
+
+// sortedResult returns a single column result holding the given values in lexical order
+func sortedResult(header string, values []string, err error) (*result, error) {
+	if err != nil {
+		return nil, err
+	}
+	// values may be shared with the client caches, they are sorted in a copy
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	res := &result{data: sorted, header: []string{header}}
+	for _, value := range sorted {
+		res.rows = append(res.rows, []string{value})
+	}
+	return res, nil
+}
+
+// printJSON writes the result data as indented JSON
+func printJSON(w io.Writer, res *result) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(res.data)
+}
+
+// printTable writes the result rows in aligned columns
+func printTable(w io.Writer, res *result) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(res.header, "\t"))
+	for _, row := range res.rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wurfl/wurfl-microservice-client-golang/v2/scientiamobile/wmclient"
+)
+
+const testLtime = "2020-01-01 10:00:00"
+
+// newTestServer returns a minimal WM server knowing a single brand and OS. Its responses are delayed by the given time
+func newTestServer(delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		var data interface{}
+		switch r.URL.Path {
+		case "/v2/getinfo/json":
+			data = wmclient.JSONInfoData{WmVersion: "2.1.0", WurflAPIVersion: "1.12", WurflInfo: "wurfl.zip", Ltime: testLtime,
+				ImportantHeaders: []string{"User-Agent"}, StaticCaps: []string{"brand_name"}, VirtualCaps: []string{"is_mobile"}}
+		case "/v2/alldevices/json":
+			data = []wmclient.JSONMakeModel{
+				{BrandName: "Apple", ModelName: "iPhone", MarketingName: "iPhone"},
+				{BrandName: "Apple", ModelName: "iPad", MarketingName: "iPad"},
+			}
+		case "/v2/alldeviceosversions/json":
+			data = []wmclient.JSONDeviceOsVersions{{OsName: "iOS", OsVersion: "14.0"}}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(data)
+	}))
+}
+
+// runTest runs wm-admin with the given arguments and returns its exit code and output
+func runTest(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := runCLI(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestExitCodes(t *testing.T) {
+	server := newTestServer(0)
+	defer server.Close()
+
+	code, stdout, _ := runTest("-url", server.URL, "models", "Apple")
+	require.Equal(t, exitOK, code)
+	require.Equal(t, "MODEL   MARKETING NAME\niPad    iPad\niPhone  iPhone\n", stdout)
+
+	code, _, stderr := runTest("-url", server.URL, "models", "Aple")
+	require.Equal(t, exitNotFound, code)
+	require.Contains(t, stderr, `did you mean "Apple"?`)
+
+	code, _, _ = runTest("-url", server.URL, "os-versions", "Symbian")
+	require.Equal(t, exitNotFound, code)
+
+	code, _, _ = runTest("-url", server.URL, "models")
+	require.Equal(t, exitUsage, code)
+	code, _, _ = runTest("-url", server.URL, "unknown")
+	require.Equal(t, exitUsage, code)
+	code, _, _ = runTest("-output", "xml", "info")
+	require.Equal(t, exitUsage, code)
+	code, _, _ = runTest("-unknown-flag", "info")
+	require.Equal(t, exitUsage, code)
+
+	closed := newTestServer(0)
+	closed.Close()
+	code, _, _ = runTest("-url", closed.URL, "info")
+	require.Equal(t, exitServerDown, code)
+}
+
+func TestExitCodeTimeout(t *testing.T) {
+	server := newTestServer(time.Second)
+	defer server.Close()
+
+	// the connection check done when the client is created is bound by the timeout
+	start := time.Now()
+	code, _, _ := runTest("-url", server.URL, "-timeout", "100ms", "info")
+	require.Equal(t, exitTimeout, code)
+	require.True(t, time.Since(start) < time.Second)
+
+	host, port := splitTestServerURL(t, server)
+	code, _, _ = runTest("-host", host, "-port", port, "-timeout", "100ms", "info")
+	require.Equal(t, exitTimeout, code)
+}
+
+func TestOutputJSON(t *testing.T) {
+	server := newTestServer(0)
+	defer server.Close()
+
+	code, stdout, _ := runTest("-url", server.URL, "-output", "json", "makes")
+	require.Equal(t, exitOK, code)
+	var makes []string
+	require.Nil(t, json.Unmarshal([]byte(stdout), &makes))
+	require.Equal(t, []string{"Apple"}, makes)
+
+	code, stdout, _ = runTest("-url", server.URL, "-output", "json", "info")
+	require.Equal(t, exitOK, code)
+	var info wmclient.JSONInfoData
+	require.Nil(t, json.Unmarshal([]byte(stdout), &info))
+	require.Equal(t, "2.1.0", info.WmVersion)
+	require.Equal(t, testLtime, info.Ltime)
+}
+
+func TestFlushCacheCheck(t *testing.T) {
+	server := newTestServer(0)
+	defer server.Close()
+
+	code, stdout, _ := runTest("-url", server.URL, "-output", "json", "flush-cache-check")
+	require.Equal(t, exitOK, code)
+	require.JSONEq(t, `{"ltime": "`+testLtime+`"}`, stdout)
+
+	code, stdout, _ = runTest("-url", server.URL, "-output", "json", "flush-cache-check", "2019-12-31 10:00:00")
+	require.Equal(t, exitOK, code)
+	require.JSONEq(t, `{"ltime": "`+testLtime+`", "reloaded": true}`, stdout)
+
+	code, stdout, _ = runTest("-url", server.URL, "-output", "json", "flush-cache-check", testLtime)
+	require.Equal(t, exitOK, code)
+	require.JSONEq(t, `{"ltime": "`+testLtime+`", "reloaded": false}`, stdout)
+
+	code, stdout, _ = runTest("-url", server.URL, "flush-cache-check", testLtime)
+	require.Equal(t, exitOK, code)
+	require.Contains(t, stdout, "WURFL file not reloaded")
+
+	code, _, _ = runTest("-url", server.URL, "flush-cache-check", testLtime, testLtime)
+	require.Equal(t, exitUsage, code)
+}
+
+// splitTestServerURL returns the host and port of the given test server
+func splitTestServerURL(t *testing.T, server *httptest.Server) (string, string) {
+	u, err := url.Parse(server.URL)
+	require.Nil(t, err)
+	return u.Hostname(), u.Port()
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// wm-capgen generates a Go file with a constant for each capability supported by a WM server, such as the one of the
+// wmclient/capabilities package, so that capability names are checked by the compiler.
+//
+// Usage:
+//
+//	wm-capgen [-scheme http] [-host localhost] [-port 8080] [-base-uri uri] [-package capabilities] [-o file]
+//	wm-capgen -info getinfo.json [-package capabilities] [-o file]
+//
+// Capabilities are read from the WM server, or from a file holding its /v2/getinfo/json response
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/wurfl/wurfl-microservice-client-golang/v2/scientiamobile/wmclient"
+)
+
+// initialisms are the capability name words written in upper case, or with a specific case, in constant names
+var initialisms = map[string]string{
+	"3gpp": "3GPP", "aac": "AAC", "amr": "AMR", "api": "API", "css": "CSS", "dom": "DOM", "dtd": "DTD", "gif": "GIF",
+	"gps": "GPS", "html": "HTML", "http": "HTTP", "https": "HTTPS", "id": "ID", "ios": "IOS", "jpg": "JPG", "mms": "MMS",
+	"mp3": "MP3", "mp4": "MP4", "nfc": "NFC", "oma": "OMA", "os": "OS", "pdf": "PDF", "png": "PNG", "rss": "RSS",
+	"sms": "SMS", "smarttv": "SmartTV", "svgt": "SVGT", "tv": "TV", "ua": "UA", "uaprof": "UAProf", "ui": "UI",
+	"uri": "URI", "url": "URL", "wap": "WAP", "webm": "WebM", "wml": "WML", "wmv": "WMV", "xhr": "XHR",
+	"xhtml": "XHTML", "xhtmlmp": "XHTMLMP",
+}
+
+func main() {
+	scheme := flag.String("scheme", "http", "WM server scheme")
+	host := flag.String("host", "localhost", "WM server host")
+	port := flag.String("port", "8080", "WM server port")
+	baseURI := flag.String("base-uri", "", "WM server base URI")
+	infoFile := flag.String("info", "", "file holding a /v2/getinfo/json response, used instead of the WM server")
+	packageName := flag.String("package", "capabilities", "package of the generated file")
+	output := flag.String("o", "", "output file, the standard output if empty")
+	flag.Parse()
+
+	info, err := readInfo(*infoFile, *scheme, *host, *port, *baseURI)
+	if err != nil {
+		fail(err)
+	}
+	source, err := generate(*packageName, info)
+	if err != nil {
+		fail(err)
+	}
+	if *output == "" {
+		_, err = os.Stdout.Write(source)
+	} else {
+		err = ioutil.WriteFile(*output, source, 0644)
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "wm-capgen:", err)
+	os.Exit(1)
+}
+
+// readInfo returns the WM server info read from the given file or, if empty, from the WM server
+func readInfo(infoFile, scheme, host, port, baseURI string) (*wmclient.JSONInfoData, error) {
+	if infoFile == "" {
+		client, err := wmclient.Create(scheme, host, port, baseURI)
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
+		return client.GetInfo()
+	}
+
+	data, err := ioutil.ReadFile(infoFile)
+	if err != nil {
+		return nil, err
+	}
+	info := &wmclient.JSONInfoData{}
+	if err = json.Unmarshal(data, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// generate returns the formatted source of the constants file
+func generate(packageName string, info *wmclient.JSONInfoData) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "// Code generated by wm-capgen; DO NOT EDIT.")
+	if info.WurflInfo != "" {
+		fmt.Fprintf(&b, "// Capabilities of %s, WM server %s.\n", info.WurflInfo, info.WmVersion)
+	}
+	fmt.Fprintf(&b, "\npackage %s\n", packageName)
+
+	static := sortedCopy(info.StaticCaps)
+	virtual := sortedCopy(info.VirtualCaps)
+	writeConstants(&b, "Static capabilities", static)
+	writeConstants(&b, "Virtual capabilities, computed by WM server", virtual)
+	writeList(&b, "Static", "Static holds the names of all the static capabilities", static)
+	writeList(&b, "Virtual", "Virtual holds the names of all the virtual capabilities", virtual)
+	return format.Source(b.Bytes())
+}
+
+func writeConstants(b *bytes.Buffer, comment string, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n// %s\nconst (\n", comment)
+	for _, name := range names {
+		fmt.Fprintf(b, "%s = %q\n", constantName(name), name)
+	}
+	fmt.Fprintln(b, ")")
+}
+
+func writeList(b *bytes.Buffer, variable string, comment string, names []string) {
+	fmt.Fprintf(b, "\n// %s\nvar %s = []string{\n", comment, variable)
+	for _, name := range names {
+		fmt.Fprintf(b, "%s,\n", constantName(name))
+	}
+	fmt.Fprintln(b, "}")
+}
+
+// constantName returns the exported Go name of the given capability, ie: IsSmartTV for is_smarttv
+func constantName(capability string) string {
+	var name strings.Builder
+	for _, word := range strings.Split(capability, "_") {
+		if word == "" {
+			continue
+		}
+		if initialism, ok := initialisms[word]; ok {
+			name.WriteString(initialism)
+		} else {
+			name.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	if name.Len() == 0 || !unicode.IsLetter(rune(name.String()[0])) {
+		return "Cap" + name.String()
+	}
+	return name.String()
+}
+
+// sortedCopy returns the given names sorted, without duplicates
+func sortedCopy(names []string) []string {
+	sorted := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			sorted = append(sorted, name)
+		}
+	}
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateMatchesCapabilitiesPackage(t *testing.T) {
+	// testdata/getinfo.json holds a WM server response listing the capabilities of the capabilities package
+	info, err := readInfo("testdata/getinfo.json", "", "", "", "")
+	require.Nil(t, err)
+	source, err := generate("capabilities", info)
+	require.Nil(t, err)
+	committed, err := ioutil.ReadFile("../../scientiamobile/wmclient/capabilities/capabilities.go")
+	require.Nil(t, err)
+	require.Equal(t, string(committed), string(source), "capabilities.go is not the output of wm-capgen, regenerate it")
+}
+
+func TestGenerateHeader(t *testing.T) {
+	info, err := readInfo("testdata/getinfo.json", "", "", "", "")
+	require.Nil(t, err)
+	info.WurflInfo = "wurfl.zip"
+	info.StaticCaps = []string{"model_name", "brand_name", "brand_name"}
+	info.VirtualCaps = nil
+	source, err := generate("caps", info)
+	require.Nil(t, err)
+	require.Equal(t, `// Code generated by wm-capgen; DO NOT EDIT.
+// Capabilities of wurfl.zip, WM server 2.1.0.
+
+package caps
+
+// Static capabilities
+const (
+	BrandName = "brand_name"
+	ModelName = "model_name"
+)
+
+// Static holds the names of all the static capabilities
+var Static = []string{
+	BrandName,
+	ModelName,
+}
+
+// Virtual holds the names of all the virtual capabilities
+var Virtual = []string{}
+`, string(source))
+}
+
+func TestConstantName(t *testing.T) {
+	names := map[string]string{
+		"brand_name":                "BrandName",
+		"is_smarttv":                "IsSmartTV",
+		"pointing_method":           "PointingMethod",
+		"is_ios":                    "IsIOS",
+		"advertised_device_os":      "AdvertisedDeviceOS",
+		"xhtml_support_level":       "XHTMLSupportLevel",
+		"ajax_preferred_geoloc_api": "AjaxPreferredGeolocAPI",
+		"playback_3gpp":             "Playback3GPP",
+		"uaprof":                    "UAProf",
+		"is_html_preferred":         "IsHTMLPreferred",
+		"webm":                      "WebM",
+		"double__underscore_":       "DoubleUnderscore",
+		"3d_support":                "Cap3dSupport",
+		"_":                         "Cap",
+	}
+	for capability, expected := range names {
+		require.Equal(t, expected, constantName(capability), capability)
+	}
+}
+
+func TestReadInfoErrors(t *testing.T) {
+	_, err := readInfo("testdata/missing.json", "", "", "", "")
+	require.NotNil(t, err)
+	_, err = readInfo("main.go", "", "", "", "")
+	require.NotNil(t, err)
+}
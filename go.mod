@@ -5,4 +5,6 @@ go 1.13
 require (
 	github.com/golang/groupcache v0.0.0-20190702054246-869f871628b6
 	github.com/stretchr/testify v1.4.0
+	go.uber.org/goleak v1.1.10
+	gopkg.in/yaml.v2 v2.2.2
 )
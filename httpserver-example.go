@@ -43,9 +43,9 @@ func main() {
 
 	http.HandleFunc("/detect", func(w http.ResponseWriter, r *http.Request) {
 
-		JsonDeviceData, callerr := ClientConn.LookupRequest(*r)
+		JsonDeviceData, callerr := ClientConn.LookupRequestContext(r.Context(), r)
 		if callerr != nil {
-			log.Fatal("wmclient.LookupRequest returned :", callerr.Error())
+			log.Fatal("wmclient.LookupRequestContext returned :", callerr.Error())
 		}
 
 		w.Header().Set("Content-Type", "application/json")
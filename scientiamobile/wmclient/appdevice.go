@@ -0,0 +1,92 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Platforms of the devices described by AppDevice
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+)
+
+// AppDevice describes a device with the identifiers available to native mobile apps
+type AppDevice struct {
+	Platform  string // PlatformIOS or PlatformAndroid
+	Model     string // iOS machine code (ie: "iPhone14,2") or Android Build.MODEL (ie: "SM-G991B")
+	OSVersion string // optional OS version, ie: "16.1" or "13"
+}
+
+// modelReplacer removes from model identifiers the characters that would break the user-agent structure
+var modelReplacer = strings.NewReplacer(";", " ", "(", " ", ")", " ")
+
+// AppDeviceUserAgent returns the user-agent that LookupAppDevice builds for the given device: the Dalvik user-agent of
+// Android apps, which carries Build.MODEL, or, on iOS, the in-app browser user-agent, which carries the machine code in the
+// FBDV token
+func AppDeviceUserAgent(device AppDevice) (string, error) {
+	model := strings.Join(strings.Fields(modelReplacer.Replace(device.Model)), " ")
+	if model == "" {
+		return "", fmt.Errorf("missing model of %s device", device.Platform)
+	}
+
+	switch device.Platform {
+	case PlatformAndroid:
+		return fmt.Sprintf("Dalvik/2.1.0 (Linux; U; Android%s; %s)", prefixIfSet(" ", device.OSVersion), model), nil
+	case PlatformIOS:
+		version := strings.Replace(device.OSVersion, ".", "_", -1)
+		var platform string
+		switch {
+		case strings.HasPrefix(model, "iPhone"):
+			platform = "iPhone; CPU iPhone OS" + prefixIfSet(" ", version)
+		case strings.HasPrefix(model, "iPad"):
+			platform = "iPad; CPU OS" + prefixIfSet(" ", version)
+		case strings.HasPrefix(model, "iPod"):
+			platform = "iPod touch; CPU iPhone OS" + prefixIfSet(" ", version)
+		default:
+			return "", fmt.Errorf("unsupported iOS machine code %s", model)
+		}
+		return fmt.Sprintf("Mozilla/5.0 (%s like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 [FBDV/%s;FBSN/iOS%s]",
+			platform, model, prefixIfSet(";FBSV/", device.OSVersion)), nil
+	default:
+		return "", fmt.Errorf("unsupported platform %q", device.Platform)
+	}
+}
+
+// prefixIfSet returns the given value with the given prefix, or an empty string if the value is empty
+func prefixIfSet(prefix string, value string) string {
+	if value == "" {
+		return ""
+	}
+	return prefix + value
+}
+
+// LookupAppDevice - detects, on a best-effort basis, a device from the identifiers available to native mobile apps, which do
+// not send the user-agent of a browser. The device is looked up using the user-agent returned by AppDeviceUserAgent, then it
+// is cached in the UA cache by platform, model and OS version
+func (c *WmClient) LookupAppDevice(ctx context.Context, device AppDevice) (*JSONDeviceData, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	userAgent, err := AppDeviceUserAgent(device)
+	if err != nil {
+		return nil, err
+	}
+	return c.LookupUserAgent(ctx, userAgent)
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppDeviceUserAgent(t *testing.T) {
+	tests := []struct {
+		device    AppDevice
+		userAgent string
+	}{
+		{AppDevice{PlatformAndroid, "SM-G991B", "13"}, "Dalvik/2.1.0 (Linux; U; Android 13; SM-G991B)"},
+		{AppDevice{PlatformAndroid, "Pixel 7 (2022)", ""}, "Dalvik/2.1.0 (Linux; U; Android; Pixel 7 2022)"},
+		{AppDevice{PlatformIOS, "iPhone14,2", "16.1"}, "Mozilla/5.0 (iPhone; CPU iPhone OS 16_1 like Mac OS X) AppleWebKit/605.1.15 " +
+			"(KHTML, like Gecko) Mobile/15E148 [FBDV/iPhone14,2;FBSN/iOS;FBSV/16.1]"},
+		{AppDevice{PlatformIOS, "iPad13,4", ""}, "Mozilla/5.0 (iPad; CPU OS like Mac OS X) AppleWebKit/605.1.15 " +
+			"(KHTML, like Gecko) Mobile/15E148 [FBDV/iPad13,4;FBSN/iOS]"},
+	}
+	for _, test := range tests {
+		userAgent, err := AppDeviceUserAgent(test.device)
+		require.Nil(t, err)
+		require.Equal(t, test.userAgent, userAgent)
+	}
+
+	for _, device := range []AppDevice{{PlatformIOS, "Watch6,1", ""}, {PlatformAndroid, " ", ""}, {"windows", "Lumia", ""}} {
+		_, err := AppDeviceUserAgent(device)
+		require.NotNil(t, err)
+	}
+}
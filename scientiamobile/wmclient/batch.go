@@ -0,0 +1,192 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// lookupUserAgentBatchPath is the WM server endpoint that detects many user agents with a single request. Servers that do not
+// support it reply with one of the statuses in endpointUnsupported
+const lookupUserAgentBatchPath = "/v2/lookupuseragentbatch/json"
+
+// maxBatchSize is the maximum number of user agents sent in a single batch request
+const maxBatchSize = 500
+
+// BatchResult is the result of the detection of one of the user agents given to LookupUserAgentBatch
+type BatchResult struct {
+	UserAgent string
+	Device    *JSONDeviceData // nil if Err is not nil
+	Err       error
+}
+
+// LookupUserAgentBatch detects the devices of the given user agents, using up to concurrency parallel requests to WM server.
+// User agents are sent in batches if WM server supports it, otherwise they are looked up one by one as with LookupUserAgent.
+// Results are in the same order as the user agents: each one holds either the device or the error of its lookup. The UA
+// cache is used, if enabled, and user agents that are not detected because ctx is done get ctx error
+func (c *WmClient) LookupUserAgentBatch(ctx context.Context, userAgents []string, concurrency int) []BatchResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]BatchResult, len(userAgents))
+	misses := make([]int, 0, len(userAgents))
+	for i, userAgent := range userAgents {
+		results[i].UserAgent = userAgent
+		if c.userAgentCache != nil && !bypassesCache(ctx) {
+			headers := c.userAgentLookupHeaders(userAgent)
+			if jdd, ok, err := c.getFromUserAgentCache(c.getUserAgentCacheKey(headers)); ok {
+				results[i].Device, results[i].Err = jdd, err
+				c.mirrorLookup(lookupUserAgentPath, headers)
+				c.recordTelemetry(jdd, err)
+				continue
+			}
+		}
+		misses = append(misses, i)
+	}
+	if len(misses) == 0 {
+		return results
+	}
+
+	// misses are split in chunks, so that all the workers are busy: when batches are not supported each chunk is looked up
+	// one user agent at a time
+	chunkSize := 1
+	if atomic.LoadInt32(&c.batchEndpointFallback) == 0 {
+		chunkSize = (len(misses) + concurrency - 1) / concurrency
+		if chunkSize > maxBatchSize {
+			chunkSize = maxBatchSize
+		}
+	}
+
+	chunks := make(chan []int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range chunks {
+				c.lookupUserAgentChunk(ctx, chunk, results)
+			}
+		}()
+	}
+	for start := 0; start < len(misses); start += chunkSize {
+		end := start + chunkSize
+		if end > len(misses) {
+			end = len(misses)
+		}
+		chunks <- misses[start:end]
+	}
+	close(chunks)
+	wg.Wait()
+	return results
+}
+
+// lookupUserAgentChunk detects the user agents of the results at the given indexes, with a batch request if supported
+func (c *WmClient) lookupUserAgentChunk(ctx context.Context, chunk []int, results []BatchResult) {
+	if err := ctx.Err(); err != nil {
+		setBatchError(chunk, results, err)
+		return
+	}
+
+	if atomic.LoadInt32(&c.batchEndpointFallback) == 0 && c.lookupUserAgentBatch(ctx, chunk, results) {
+		for _, i := range chunk {
+			c.mirrorLookup(lookupUserAgentPath, c.userAgentLookupHeaders(results[i].UserAgent))
+			c.recordTelemetry(results[i].Device, results[i].Err)
+		}
+		return
+	}
+	for _, i := range chunk {
+		results[i].Device, results[i].Err = c.lookupUserAgent(ctx, results[i].UserAgent, true)
+	}
+}
+
+// lookupUserAgentBatch detects the user agents of the results at the given indexes with a single request. It returns false,
+// without setting the results, if WM server does not support batch requests
+func (c *WmClient) lookupUserAgentBatch(ctx context.Context, chunk []int, results []BatchResult) bool {
+	request := BatchRequest{Requests: make([]Request, len(chunk))}
+	for j, i := range chunk {
+		request.Requests[j] = Request{
+			LookupHeaders:  c.userAgentLookupHeaders(results[i].UserAgent),
+			RequestedCaps:  c.requestedStaticCaps,
+			RequestedVCaps: c.requestedVirtualCaps,
+		}
+	}
+
+	res, resbody, err := c.postLookup(ctx, lookupUserAgentBatchPath, func(legacy bool) interface{} {
+		if !legacy {
+			return request
+		}
+		payload := legacyBatchRequest{Requests: make([]legacyRequest, len(request.Requests))}
+		for j := range request.Requests {
+			payload.Requests[j] = legacyRequest(request.Requests[j])
+		}
+		return payload
+	})
+	if err != nil {
+		// server cannot be reached, last resort is the device snapshot (if loaded)
+		for _, i := range chunk {
+			if jdd, ok := c.getFromSnapshot(results[i].UserAgent, ""); ok {
+				results[i].Device = jdd
+			} else {
+				results[i].Err = err
+			}
+		}
+		return true
+	}
+	if endpointUnsupported[res.StatusCode] {
+		atomic.StoreInt32(&c.batchEndpointFallback, 1)
+		return false
+	}
+
+	response := BatchResponse{}
+	if err = c.decodeResponse(res, resbody, &response); err != nil {
+		setBatchError(chunk, results, err)
+		return true
+	}
+	if len(response.Devices) != len(chunk) {
+		setBatchError(chunk, results, fmt.Errorf("WM server returned %d devices for %d user agents", len(response.Devices), len(chunk)))
+		return true
+	}
+
+	metadata := c.getResponseMetadata(res.Header)
+	for j, i := range chunk {
+		deviceData := &response.Devices[j]
+		deviceData.Metadata = metadata
+		c.setDeviceID(deviceData)
+		if len(deviceData.Error) > 0 {
+			results[i].Err = newServerError(deviceData, res.StatusCode, false)
+			continue
+		}
+
+		// check if server WURFL.xml has been updated and, if so, clear caches
+		c.clearCachesIfNeeded(deviceData.Ltime)
+		if c.userAgentCache != nil && !bypassesCache(ctx) {
+			c.addLookupToUserAgentCache(ctx, request.Requests[j].LookupHeaders, lookupUserAgentPath, deviceData)
+		}
+		results[i].Device = deviceData
+	}
+	return true
+}
+
+// setBatchError sets the given error in the results at the given indexes
+func setBatchError(chunk []int, results []BatchResult, err error) {
+	for _, i := range chunk {
+		results[i].Err = err
+	}
+}
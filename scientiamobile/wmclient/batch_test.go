@@ -0,0 +1,128 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// batchTestDevice returns the device data the test server detects for the given user agent
+func batchTestDevice(userAgent string) JSONDeviceData {
+	if userAgent == "unknown" {
+		return JSONDeviceData{Error: "cannot detect device"}
+	}
+	return JSONDeviceData{Capabilities: map[string]string{"wurfl_id": "id_" + userAgent}, Ltime: "2019-01-01"}
+}
+
+// newBatchTestHandler returns a WM server handler detecting the devices of batchTestDevice, with batch lookups if batch is
+// set, and counting the requests by path
+func newBatchTestHandler(batch bool, requests map[string]int) http.Handler {
+	var mutex sync.Mutex
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests[r.URL.Path]++
+		mutex.Unlock()
+		switch {
+		case batch && r.URL.Path == lookupUserAgentBatchPath:
+			request := BatchRequest{}
+			json.NewDecoder(r.Body).Decode(&request)
+			response := BatchResponse{}
+			for _, req := range request.Requests {
+				response.Devices = append(response.Devices, batchTestDevice(req.LookupHeaders[userAgentHeader]))
+			}
+			json.NewEncoder(w).Encode(response)
+		case r.URL.Path == lookupUserAgentPath:
+			request := Request{}
+			json.NewDecoder(r.Body).Decode(&request)
+			json.NewEncoder(w).Encode(batchTestDevice(request.LookupHeaders[userAgentHeader]))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func checkBatchResults(t *testing.T, userAgents []string, results []BatchResult) {
+	require.Len(t, results, len(userAgents))
+	for i, result := range results {
+		require.Equal(t, userAgents[i], result.UserAgent)
+		if result.UserAgent == "unknown" {
+			require.Nil(t, result.Device)
+			require.True(t, isServerError(result.Err))
+			continue
+		}
+		require.Nil(t, result.Err)
+		require.Equal(t, "id_"+result.UserAgent, result.Device.DeviceID)
+	}
+}
+
+func TestLookupUserAgentBatch(t *testing.T) {
+	requests := make(map[string]int)
+	server := httptest.NewServer(newBatchTestHandler(true, requests))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.ImportantHeaders = []string{userAgentHeader}
+	client.SetCacheSize(100)
+
+	userAgents := []string{"ua1", "ua2", "unknown", "ua3", "ua4", "ua5", "ua6"}
+	checkBatchResults(t, userAgents, client.LookupUserAgentBatch(context.Background(), userAgents, 3))
+	require.Equal(t, 3, requests[lookupUserAgentBatchPath])
+	require.Equal(t, 0, requests[lookupUserAgentPath])
+
+	// detected user agents are read from the cache
+	checkBatchResults(t, userAgents, client.LookupUserAgentBatch(context.Background(), userAgents, 3))
+	require.Equal(t, 4, requests[lookupUserAgentBatchPath])
+}
+
+func TestLookupUserAgentBatchFallsBackToSingleLookups(t *testing.T) {
+	requests := make(map[string]int)
+	server := httptest.NewServer(newBatchTestHandler(false, requests))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.ImportantHeaders = []string{userAgentHeader}
+
+	userAgents := []string{"ua1", "ua2", "unknown", "ua3", "ua4"}
+	checkBatchResults(t, userAgents, client.LookupUserAgentBatch(context.Background(), userAgents, 2))
+	require.Equal(t, len(userAgents), requests[lookupUserAgentPath])
+
+	// once the server is known not to support batches, they are not sent anymore
+	checkBatchResults(t, userAgents, client.LookupUserAgentBatch(context.Background(), userAgents, 2))
+	require.Equal(t, 2, requests[lookupUserAgentBatchPath])
+	require.Equal(t, 2*len(userAgents), requests[lookupUserAgentPath])
+}
+
+func TestLookupUserAgentBatchRespectsContext(t *testing.T) {
+	requests := make(map[string]int)
+	server := httptest.NewServer(newBatchTestHandler(true, requests))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.ImportantHeaders = []string{userAgentHeader}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := client.LookupUserAgentBatch(ctx, []string{"ua1", "ua2"}, 1)
+	for _, result := range results {
+		require.True(t, errors.Is(result.Err, context.Canceled))
+	}
+	require.Equal(t, 0, requests[lookupUserAgentBatchPath])
+}
@@ -0,0 +1,36 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import "context"
+
+// cacheBypassKey is the context key of the cache bypass option
+type cacheBypassKey struct{}
+
+// WithCacheBypass returns a context that makes the lookups it is passed to skip both the client caches and, if WM server
+// supports it, the server cache, by sending the request with a "Cache-Control: no-cache" header. WM server versions that do
+// not support it ignore the header and may still reply from their cache.
+// It is meant for diagnostics only, ie: to check if a detection discrepancy is due to stale cached data, since every lookup
+// made with it costs a full detection on WM server
+func WithCacheBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheBypassKey{}, true)
+}
+
+// bypassesCache returns true if the given context has been created by WithCacheBypass
+func bypassesCache(ctx context.Context) bool {
+	bypass, _ := ctx.Value(cacheBypassKey{}).(bool)
+	return bypass
+}
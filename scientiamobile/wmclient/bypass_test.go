@@ -0,0 +1,54 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithCacheBypass(t *testing.T) {
+	var cacheControl []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cacheControl = append(cacheControl, r.Header.Get("Cache-Control"))
+		json.NewEncoder(w).Encode(JSONDeviceData{Capabilities: map[string]string{"wurfl_id": "generic"}})
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.ImportantHeaders = []string{userAgentHeader}
+	client.SetCacheSize(100)
+
+	_, err := client.LookupUserAgent(context.Background(), "ua")
+	require.Nil(t, err)
+	_, err = client.LookupUserAgent(context.Background(), "ua")
+	require.Nil(t, err)
+	require.Equal(t, []string{""}, cacheControl)
+
+	// the cached device is not used, and the server is asked not to use its own cache
+	ctx := WithCacheBypass(context.Background())
+	_, err = client.LookupUserAgent(ctx, "ua")
+	require.Nil(t, err)
+	_, err = client.LookupDeviceID(ctx, "generic")
+	require.Nil(t, err)
+	_, err = client.LookupDeviceID(ctx, "generic")
+	require.Nil(t, err)
+	require.Equal(t, []string{"", "no-cache", "no-cache", "no-cache"}, cacheControl)
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import "github.com/golang/groupcache/lru"
+
+// CacheClearReason tells why the client caches have been cleared. Its values are suitable as metric labels
+type CacheClearReason string
+
+// Reasons of cache clears
+const (
+	// CacheClearLtimeChange is the reason of the clears due to WM server loading a new WURFL file
+	CacheClearLtimeChange CacheClearReason = "ltime_change"
+	// CacheClearCapabilitiesChange is the reason of the clears due to a change of the requested capabilities
+	CacheClearCapabilitiesChange CacheClearReason = "capabilities_change"
+	// CacheClearManual is the reason of the clears requested with FlushCache
+	CacheClearManual CacheClearReason = "manual"
+	// CacheClearResize is the reason of the clears due to the caches being replaced by caches of a different size
+	CacheClearResize CacheClearReason = "resize"
+	// CacheClearClose is the reason of the clear done when the client is closed
+	CacheClearClose CacheClearReason = "close"
+)
+
+// CacheClearEvent is sent to the stats hook every time the UA and device caches are cleared. The other client caches (TAC,
+// memo and enumeration data) are cleared together with them
+type CacheClearEvent struct {
+	Reason    CacheClearReason
+	UserAgent int    // number of UA cache entries removed
+	Device    int    // number of device cache entries removed
+	Ltime     string // WURFL file load time known by the client when the caches have been cleared
+}
+
+// FlushCache removes all entries from the client caches, ie: to force the lookups to be done again by WM server
+func (c *WmClient) FlushCache() {
+	if c == nil {
+		return
+	}
+	c.clearCache(CacheClearManual)
+}
+
+// GetCacheClearCounts returns the number of cache clears since the client creation, by reason
+func (c *WmClient) GetCacheClearCounts() map[CacheClearReason]uint64 {
+	if c == nil {
+		return nil
+	}
+	c.cacheClearMutex.Lock()
+	defer c.cacheClearMutex.Unlock()
+	counts := make(map[CacheClearReason]uint64, len(c.cacheClears))
+	for reason, count := range c.cacheClears {
+		counts[reason] = count
+	}
+	return counts
+}
+
+// recordCacheClear counts a cache clear and sends its event to the stats hook. The given caches are the cleared ones, nil if
+// they were already empty. They must no longer be used by the client
+func (c *WmClient) recordCacheClear(reason CacheClearReason, userAgentCache *lru.Cache, deviceCache *lru.Cache) {
+	event := CacheClearEvent{Reason: reason}
+	if userAgentCache != nil {
+		event.UserAgent = userAgentCache.Len()
+	}
+	if deviceCache != nil {
+		event.Device = deviceCache.Len()
+	}
+	c.ltimeMutex.Lock()
+	event.Ltime = c.clientLtime
+	c.ltimeMutex.Unlock()
+
+	c.cacheClearMutex.Lock()
+	if c.cacheClears == nil {
+		c.cacheClears = make(map[CacheClearReason]uint64)
+	}
+	c.cacheClears[reason]++
+	c.cacheClearMutex.Unlock()
+
+	c.emitStats(event)
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheClearEvents(t *testing.T) {
+	var events []CacheClearEvent
+	client := &WmClient{StaticCaps: []string{"brand_name"}}
+	client.SetStatsHook(func(event interface{}) {
+		if clear, ok := event.(CacheClearEvent); ok {
+			events = append(events, clear)
+		}
+	})
+
+	// caching disabled, nothing to clear
+	client.FlushCache()
+	require.Empty(t, events)
+
+	// the first cache size does not clear anything
+	client.SetCacheSize(10)
+	require.Empty(t, events)
+
+	client.addToUserAgentCache("ua", &JSONDeviceData{})
+	client.addToDeviceCache("generic", &JSONDeviceData{})
+	client.FlushCache()
+	require.Equal(t, []CacheClearEvent{{Reason: CacheClearManual, UserAgent: 1, Device: 1}}, events)
+
+	client.addToUserAgentCache("ua", &JSONDeviceData{})
+	client.clearCachesIfNeeded("2020-01-01 10:00:00")
+	require.Equal(t, CacheClearEvent{Reason: CacheClearLtimeChange, UserAgent: 1, Ltime: "2020-01-01 10:00:00"}, events[1])
+
+	client.SetRequestedStaticCapabilities([]string{"brand_name"})
+	require.Equal(t, CacheClearCapabilitiesChange, events[2].Reason)
+
+	client.addToUserAgentCache("ua", &JSONDeviceData{})
+	client.SetCacheSize(20)
+	require.Equal(t, CacheClearEvent{Reason: CacheClearResize, UserAgent: 1, Ltime: "2020-01-01 10:00:00"}, events[3])
+
+	require.Nil(t, client.Close())
+	require.Equal(t, CacheClearClose, events[4].Reason)
+
+	require.Equal(t, map[CacheClearReason]uint64{
+		CacheClearManual:             1,
+		CacheClearLtimeChange:        1,
+		CacheClearCapabilitiesChange: 1,
+		CacheClearResize:             1,
+		CacheClearClose:              1,
+	}, client.GetCacheClearCounts())
+}
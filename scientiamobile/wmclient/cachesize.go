@@ -0,0 +1,253 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// estimated memory footprint of a cached device, not counting its capabilities
+const cacheEntryBaseSize = 512
+
+// estimated memory footprint of a single capability name/value pair in a cached device
+const cacheEntryCapSize = 96
+
+// cgroup v1 reports "no limit" as a huge page-aligned value, anything above this is considered unlimited
+const cgroupUnlimitedThreshold = int64(1) << 60
+
+// UA cache auto-tuning parameters: the cache is grown when the hit ratio is below autoTuneTargetHitRatio and most misses
+// cause an eviction (churn), it is shrunk when less than half of it is used
+const autoTuneTargetHitRatio = 0.95
+const autoTuneChurnThreshold = 0.5
+const autoTuneGrowthFactor = 1.25
+
+// memoryLimitFiles lists the files that are read, in order, to detect the memory limit of the running process:
+// the first one is used by cgroup v2, the second one by cgroup v1
+var memoryLimitFiles = []string{
+	"/sys/fs/cgroup/memory.max",
+	"/sys/fs/cgroup/memory/memory.limit_in_bytes",
+}
+
+// SetCacheSizeFromMemory sets the UA and device cache sizes so that they use, approximately, the given percentage of the
+// memory limit detected for the running process (ie: the cgroup memory limit of a container).
+// The number of entries is estimated using the number of requested capabilities, so this function should be called after the
+// SetRequested[...]Capabilities ones. An error is returned, and caches are left untouched, if no memory limit can be detected.
+func (c *WmClient) SetCacheSizeFromMemory(percent float64) error {
+	if c == nil {
+		return ErrNilClient
+	}
+	if percent <= 0 || percent > 100 {
+		return fmt.Errorf("invalid memory percentage %.2f: it must be greater than 0 and less than or equal to 100", percent)
+	}
+
+	limit, err := detectMemoryLimit()
+	if err != nil {
+		return err
+	}
+
+	budget := int64(float64(limit) * percent / 100)
+	uaEntries := int(budget / c.estimatedCacheEntrySize())
+	if uaEntries <= 0 {
+		return fmt.Errorf("memory limit of %d bytes is too small to hold any cache entry", limit)
+	}
+
+	deviceEntries := deviceDefaultCacheSize
+	if uaEntries < deviceEntries {
+		deviceEntries = uaEntries
+	}
+	c.setCacheSizes(uaEntries, deviceEntries)
+	return nil
+}
+
+// estimatedCacheEntrySize returns an estimate of the memory used by a single cached device, based on the number of
+// capabilities that the WM server returns for each lookup
+func (c *WmClient) estimatedCacheEntrySize() int64 {
+	capsCount := len(c.requestedStaticCaps) + len(c.requestedVirtualCaps)
+	if capsCount == 0 {
+		// no requested capabilities means that the server returns all of them
+		capsCount = len(c.StaticCaps) + len(c.VirtualCaps)
+	}
+	// wurfl_id is always returned
+	capsCount++
+	return cacheEntryBaseSize + int64(capsCount)*cacheEntryCapSize
+}
+
+// detectMemoryLimit returns the memory limit, in bytes, of the running process
+func detectMemoryLimit() (int64, error) {
+	for _, file := range memoryLimitFiles {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+
+		limit, ok, perr := parseMemoryLimit(string(content))
+		if perr != nil {
+			return 0, perr
+		}
+		if ok {
+			return limit, nil
+		}
+	}
+	return 0, errors.New("unable to detect a memory limit for the running process")
+}
+
+// parseMemoryLimit parses the content of a cgroup memory limit file. The returned bool is false when no limit is set
+func parseMemoryLimit(content string) (int64, bool, error) {
+	value := strings.TrimSpace(content)
+	if value == "" || value == "max" {
+		return 0, false, nil
+	}
+
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid memory limit value %q: %s", value, err.Error())
+	}
+
+	if limit <= 0 || limit >= cgroupUnlimitedThreshold {
+		return 0, false, nil
+	}
+	return limit, true, nil
+}
+
+// EnableCacheAutoTuning starts a goroutine that, every interval, grows or shrinks the UA cache within the given bounds, based on
+// the hit ratio and evictions observed since the previous evaluation. Every evaluation is sent to the stats hook as a CacheTuningEvent.
+// Cache must be enabled with SetCacheSize (or SetCacheSizeFromMemory) before calling this function.
+// Auto-tuning is stopped by DisableCacheAutoTuning, Close and DestroyConnection
+func (c *WmClient) EnableCacheAutoTuning(minEntries int, maxEntries int, interval time.Duration) error {
+	if c == nil {
+		return ErrNilClient
+	}
+	if minEntries <= 0 || maxEntries < minEntries {
+		return fmt.Errorf("invalid cache auto-tuning bounds [%d, %d]", minEntries, maxEntries)
+	}
+	if interval <= 0 {
+		return errors.New("cache auto-tuning interval must be greater than 0")
+	}
+
+	c.lruUserAgentCS.Lock()
+	cacheEnabled := c.userAgentCache != nil
+	c.lruUserAgentCS.Unlock()
+	if !cacheEnabled {
+		return errors.New("cache auto-tuning requires the cache to be enabled with SetCacheSize")
+	}
+
+	tasks := c.getTasks()
+	c.tasksMutex.Lock()
+	defer c.tasksMutex.Unlock()
+	c.stopCacheAutoTuning()
+	cancel, err := tasks.goTask(func(ctx context.Context) error {
+		c.runCacheAutoTuning(ctx, minEntries, maxEntries, interval)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	c.stopTuning = cancel
+	return nil
+}
+
+// DisableCacheAutoTuning stops the cache auto-tuning, if running. UA cache keeps its current size
+func (c *WmClient) DisableCacheAutoTuning() {
+	if c == nil {
+		return
+	}
+	c.tasksMutex.Lock()
+	defer c.tasksMutex.Unlock()
+	c.stopCacheAutoTuning()
+}
+
+// stopCacheAutoTuning stops the cache auto-tuning task, if running. It must be called holding tasksMutex
+func (c *WmClient) stopCacheAutoTuning() {
+	if c.stopTuning != nil {
+		c.stopTuning()
+		c.stopTuning = nil
+	}
+}
+
+func (c *WmClient) runCacheAutoTuning(ctx context.Context, minEntries int, maxEntries int, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := c.GetCacheStats()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			last = c.tuneUserAgentCache(minEntries, maxEntries, last)
+		}
+	}
+}
+
+// tuneUserAgentCache resizes the UA cache using the counters collected since the last evaluation, and returns the current counters
+func (c *WmClient) tuneUserAgentCache(minEntries int, maxEntries int, last CacheStats) CacheStats {
+	c.lruUserAgentCS.Lock()
+	cache := c.userAgentCache
+	if cache == nil {
+		c.lruUserAgentCS.Unlock()
+		return last
+	}
+
+	event := CacheTuningEvent{
+		PreviousSize: cache.MaxEntries,
+		Entries:      cache.Len(),
+		Hits:         c.uaCacheHits - last.Hits,
+		Misses:       c.uaCacheMisses - last.Misses,
+		Evictions:    c.uaCacheEvictions - last.Evictions,
+	}
+	if lookups := event.Hits + event.Misses; lookups > 0 {
+		event.HitRatio = float64(event.Hits) / float64(lookups)
+	}
+
+	event.NewSize = nextCacheSize(event, minEntries, maxEntries)
+	cache.MaxEntries = event.NewSize
+	for cache.Len() > event.NewSize {
+		cache.RemoveOldest()
+	}
+
+	// counters are taken after shrinking, so that removed entries are not considered churn in the next evaluation
+	current := CacheStats{Hits: c.uaCacheHits, Misses: c.uaCacheMisses, Evictions: c.uaCacheEvictions}
+	c.lruUserAgentCS.Unlock()
+
+	c.emitStats(event)
+	return current
+}
+
+// nextCacheSize computes the new UA cache size, within the given bounds, for the usage described by the given event
+func nextCacheSize(event CacheTuningEvent, minEntries int, maxEntries int) int {
+	size := event.PreviousSize
+	switch {
+	case event.Evictions > 0 && event.HitRatio < autoTuneTargetHitRatio &&
+		float64(event.Evictions) >= autoTuneChurnThreshold*float64(event.Misses):
+		size = int(float64(size)*autoTuneGrowthFactor) + 1
+	case event.Evictions == 0 && event.Entries < size/2:
+		size = int(float64(event.Entries) * autoTuneGrowthFactor)
+	}
+
+	if size < minEntries {
+		return minEntries
+	}
+	if size > maxEntries {
+		return maxEntries
+	}
+	return size
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMemoryLimit(t *testing.T) {
+	limit, ok, err := parseMemoryLimit("536870912\n")
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(536870912), limit)
+
+	// cgroup v2 unlimited value
+	_, ok, err = parseMemoryLimit("max\n")
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	// cgroup v1 unlimited value
+	_, ok, err = parseMemoryLimit("9223372036854771712")
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	_, _, err = parseMemoryLimit("not a number")
+	require.NotNil(t, err)
+}
+
+func TestSetCacheSizeFromMemory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wmclient")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	limitFile := filepath.Join(dir, "memory.max")
+	// 512 MB
+	require.Nil(t, ioutil.WriteFile(limitFile, []byte("536870912"), 0644))
+
+	oldFiles := memoryLimitFiles
+	memoryLimitFiles = []string{filepath.Join(dir, "missing"), limitFile}
+	defer func() { memoryLimitFiles = oldFiles }()
+
+	// the nil check is done before the percentage and the memory limit are validated
+	var nilClient *WmClient
+	require.Equal(t, ErrNilClient, nilClient.SetCacheSizeFromMemory(10))
+
+	client := &WmClient{StaticCaps: []string{"brand_name", "model_name"}, VirtualCaps: []string{"form_factor"}}
+	require.NotNil(t, client.SetCacheSizeFromMemory(0))
+	require.NotNil(t, client.SetCacheSizeFromMemory(101))
+
+	require.Nil(t, client.SetCacheSizeFromMemory(10))
+	expected := int(536870912 / 10 / client.estimatedCacheEntrySize())
+	require.Equal(t, expected, client.userAgentCache.MaxEntries)
+	require.Equal(t, deviceDefaultCacheSize, client.deviceCache.MaxEntries)
+
+	// no detectable limit: caches must be left untouched
+	require.Nil(t, (&WmClient{}).SetCacheSizeFromMemory(10))
+	require.Nil(t, ioutil.WriteFile(limitFile, []byte("max"), 0644))
+	require.NotNil(t, client.SetCacheSizeFromMemory(10))
+	require.Equal(t, expected, client.userAgentCache.MaxEntries)
+}
+
+func TestNextCacheSize(t *testing.T) {
+	// high churn and low hit ratio: cache grows
+	event := CacheTuningEvent{PreviousSize: 1000, Entries: 1000, Hits: 100, Misses: 900, Evictions: 900, HitRatio: 0.1}
+	require.Equal(t, 1251, nextCacheSize(event, 100, 5000))
+	// growth is bounded
+	require.Equal(t, 1100, nextCacheSize(event, 100, 1100))
+
+	// half empty cache: it shrinks, but not below the lower bound
+	event = CacheTuningEvent{PreviousSize: 1000, Entries: 200, Hits: 900, Misses: 200, HitRatio: 0.82}
+	require.Equal(t, 250, nextCacheSize(event, 100, 5000))
+	require.Equal(t, 300, nextCacheSize(event, 300, 5000))
+
+	// good hit ratio: size is unchanged
+	event = CacheTuningEvent{PreviousSize: 1000, Entries: 1000, Hits: 990, Misses: 10, Evictions: 10, HitRatio: 0.99}
+	require.Equal(t, 1000, nextCacheSize(event, 100, 5000))
+}
+
+func TestTuneUserAgentCache(t *testing.T) {
+	client := &WmClient{}
+	client.SetCacheSize(10)
+
+	var events []CacheTuningEvent
+	client.SetStatsHook(func(event interface{}) {
+		if e, ok := event.(CacheTuningEvent); ok {
+			events = append(events, e)
+		}
+	})
+
+	// fill the cache and overflow it, every lookup is a miss
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprintf("ua-%d", i)
+		_, ok, _ := client.getFromUserAgentCache(key)
+		require.False(t, ok)
+		client.addToUserAgentCache(key, &JSONDeviceData{})
+	}
+
+	last := client.tuneUserAgentCache(5, 100, CacheStats{})
+	require.Equal(t, 1, len(events))
+	require.Equal(t, 10, events[0].PreviousSize)
+	require.Equal(t, 13, events[0].NewSize)
+	require.Equal(t, uint64(30), events[0].Misses)
+	require.Equal(t, uint64(20), events[0].Evictions)
+	require.Equal(t, CacheStats{Misses: 30, Evictions: 20}, last)
+
+	// no traffic and a partially used cache: it shrinks, removing the oldest entries
+	client.clearCache(CacheClearManual)
+	client.addToUserAgentCache("ua-1", &JSONDeviceData{})
+	client.tuneUserAgentCache(5, 100, last)
+	require.Equal(t, 2, len(events))
+	require.Equal(t, 5, events[1].NewSize)
+	_, uaSize := client.GetActualCacheSizes()
+	require.Equal(t, 1, uaSize)
+
+	require.NotNil(t, client.EnableCacheAutoTuning(0, 10, time.Second))
+	require.NotNil(t, (&WmClient{}).EnableCacheAutoTuning(1, 10, time.Second))
+	require.Nil(t, client.EnableCacheAutoTuning(1, 10, time.Second))
+	client.DisableCacheAutoTuning()
+	require.Nil(t, client.stopTuning)
+
+	// auto-tuning can be enabled and disabled concurrently, ie: by a configuration reload
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.Nil(t, client.EnableCacheAutoTuning(1, 10, time.Second))
+			client.DisableCacheAutoTuning()
+		}()
+	}
+	wg.Wait()
+	require.Nil(t, client.stopTuning)
+	require.Nil(t, client.Close())
+}
+
+func TestClearCacheKeepsSizes(t *testing.T) {
+	client := &WmClient{}
+	client.setCacheSizes(10, 20)
+	client.SetMemoCacheSize(30)
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("ua-%d", i)
+		client.addToUserAgentCache(key, &JSONDeviceData{})
+		client.addToDeviceCache(key, &JSONDeviceData{})
+	}
+
+	oldDeviceCache := client.deviceCache
+	client.clearCachesIfNeeded("2020-01-01 10:00:00")
+	dSize, uaSize := client.GetActualCacheSizes()
+	require.Equal(t, 0, dSize)
+	require.Equal(t, 0, uaSize)
+	// caches are swapped, not cleared in place, and keep their sizes
+	require.Equal(t, 5, oldDeviceCache.Len())
+	require.Equal(t, 10, client.userAgentCache.MaxEntries)
+	require.Equal(t, 20, client.deviceCache.MaxEntries)
+	require.Equal(t, 30, client.memoCache.MaxEntries)
+	require.Equal(t, uint64(0), client.GetCacheStats().Evictions)
+
+	// caches are not cleared again for the same ltime
+	client.addToDeviceCache("generic", &JSONDeviceData{})
+	client.clearCachesIfNeeded("2020-01-01 10:00:00")
+	dSize, _ = client.GetActualCacheSizes()
+	require.Equal(t, 1, dSize)
+}
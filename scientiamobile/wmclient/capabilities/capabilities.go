@@ -0,0 +1,299 @@
+// Code generated by wm-capgen; DO NOT EDIT.
+
+package capabilities
+
+// Static capabilities
+const (
+	AAC                       = "aac"
+	AjaxManipulateCSS         = "ajax_manipulate_css"
+	AjaxManipulateDOM         = "ajax_manipulate_dom"
+	AjaxPreferredGeolocAPI    = "ajax_preferred_geoloc_api"
+	AjaxSupportEventListener  = "ajax_support_event_listener"
+	AjaxSupportEvents         = "ajax_support_events"
+	AjaxSupportGetelementbyid = "ajax_support_getelementbyid"
+	AjaxSupportInnerHTML      = "ajax_support_inner_html"
+	AjaxSupportJavascript     = "ajax_support_javascript"
+	AjaxXHRType               = "ajax_xhr_type"
+	AMR                       = "amr"
+	BrandName                 = "brand_name"
+	CanAssignPhoneNumber      = "can_assign_phone_number"
+	CanSkipAlignedLinkRow     = "can_skip_aligned_link_row"
+	CanvasSupport             = "canvas_support"
+	Columns                   = "columns"
+	CSSBorderImage            = "css_border_image"
+	CSSGradient               = "css_gradient"
+	CSSRoundedCorners         = "css_rounded_corners"
+	CSSSpriting               = "css_spriting"
+	DensityClass              = "density_class"
+	DeviceClaimsWebSupport    = "device_claims_web_support"
+	DeviceOS                  = "device_os"
+	DeviceOSVersion           = "device_os_version"
+	DualOrientation           = "dual_orientation"
+	FlashLiteVersion          = "flash_lite_version"
+	FullFlashSupport          = "full_flash_support"
+	GIF                       = "gif"
+	HasQwertyKeyboard         = "has_qwerty_keyboard"
+	HTMLWeb32                 = "html_web_3_2"
+	HTMLWeb40                 = "html_web_4_0"
+	HTMLWiImodeCompactGeneric = "html_wi_imode_compact_generic"
+	HTMLWiOMAXHTMLMP10        = "html_wi_oma_xhtmlmp_1_0"
+	HTMLWiW3Xhtmlbasic        = "html_wi_w3_xhtmlbasic"
+	HTTPSSupport              = "https_support"
+	ImageInlining             = "image_inlining"
+	IsSmartTV                 = "is_smarttv"
+	IsTablet                  = "is_tablet"
+	IsTranscoder              = "is_transcoder"
+	IsWirelessDevice          = "is_wireless_device"
+	JPG                       = "jpg"
+	MarketingName             = "marketing_name"
+	MaxDataRate               = "max_data_rate"
+	MaxDeckSize               = "max_deck_size"
+	MaxImageHeight            = "max_image_height"
+	MaxImageWidth             = "max_image_width"
+	MaxURLLengthBookmark      = "max_url_length_bookmark"
+	MaxURLLengthInRequests    = "max_url_length_in_requests"
+	MidiMonophonic            = "midi_monophonic"
+	MidiPolyphonic            = "midi_polyphonic"
+	MobileBrowser             = "mobile_browser"
+	MobileBrowserVersion      = "mobile_browser_version"
+	ModelExtraInfo            = "model_extra_info"
+	ModelName                 = "model_name"
+	MP3                       = "mp3"
+	NFCSupport                = "nfc_support"
+	NokiaEdition              = "nokia_edition"
+	NokiaSeries               = "nokia_series"
+	PDFSupport                = "pdf_support"
+	PhysicalScreenHeight      = "physical_screen_height"
+	PhysicalScreenWidth       = "physical_screen_width"
+	Playback3GPP              = "playback_3gpp"
+	PlaybackAcodecAAC         = "playback_acodec_aac"
+	PlaybackAcodecAMR         = "playback_acodec_amr"
+	PlaybackMov               = "playback_mov"
+	PlaybackMP4               = "playback_mp4"
+	PlaybackOMASizeLimit      = "playback_oma_size_limit"
+	PlaybackRealMedia         = "playback_real_media"
+	PlaybackVcodecH2630       = "playback_vcodec_h263_0"
+	PlaybackVcodecH264Bp      = "playback_vcodec_h264_bp"
+	PlaybackVcodecMpeg4Sp     = "playback_vcodec_mpeg4_sp"
+	PlaybackWebM              = "playback_webm"
+	PlaybackWMV               = "playback_wmv"
+	PNG                       = "png"
+	PointingMethod            = "pointing_method"
+	PreferredMarkup           = "preferred_markup"
+	ReleaseDate               = "release_date"
+	ResolutionHeight          = "resolution_height"
+	ResolutionWidth           = "resolution_width"
+	Rows                      = "rows"
+	RSSSupport                = "rss_support"
+	SMSEnabled                = "sms_enabled"
+	Streaming3GPP             = "streaming_3gpp"
+	StreamingMP4              = "streaming_mp4"
+	StreamingRealMedia        = "streaming_real_media"
+	StreamingVideo            = "streaming_video"
+	SVGT11                    = "svgt_1_1"
+	SVGT11Plus                = "svgt_1_1_plus"
+	TranscoderUAHeader        = "transcoder_ua_header"
+	UAProf                    = "uaprof"
+	Uaprof2                   = "uaprof2"
+	Uaprof3                   = "uaprof3"
+	Unique                    = "unique"
+	UnuniquenessHandler       = "ununiqueness_handler"
+	UxFullDesktop             = "ux_full_desktop"
+	ViewportInitialScale      = "viewport_initial_scale"
+	ViewportMaximumScale      = "viewport_maximum_scale"
+	ViewportMinimumScale      = "viewport_minimum_scale"
+	ViewportSupported         = "viewport_supported"
+	ViewportUserscalable      = "viewport_userscalable"
+	ViewportWidth             = "viewport_width"
+	Wav                       = "wav"
+	WebpLosslessSupport       = "webp_lossless_support"
+	WebpLossySupport          = "webp_lossy_support"
+	Wifi                      = "wifi"
+	WML11                     = "wml_1_1"
+	WML12                     = "wml_1_2"
+	WML13                     = "wml_1_3"
+	XHTMLCanEmbedVideo        = "xhtml_can_embed_video"
+	XHTMLFileUpload           = "xhtml_file_upload"
+	XHTMLMakePhoneCallString  = "xhtml_make_phone_call_string"
+	XHTMLPreferredCharset     = "xhtml_preferred_charset"
+	XHTMLSendMMSString        = "xhtml_send_mms_string"
+	XHTMLSendSMSString        = "xhtml_send_sms_string"
+	XHTMLSupportLevel         = "xhtml_support_level"
+	XHTMLSupportsFormsInTable = "xhtml_supports_forms_in_table"
+	XHTMLTableSupport         = "xhtml_table_support"
+)
+
+// Virtual capabilities, computed by WM server
+const (
+	AdvertisedAppName         = "advertised_app_name"
+	AdvertisedBrowser         = "advertised_browser"
+	AdvertisedBrowserVersion  = "advertised_browser_version"
+	AdvertisedDeviceOS        = "advertised_device_os"
+	AdvertisedDeviceOSVersion = "advertised_device_os_version"
+	CompleteDeviceName        = "complete_device_name"
+	DeviceName                = "device_name"
+	FormFactor                = "form_factor"
+	IsAndroid                 = "is_android"
+	IsApp                     = "is_app"
+	IsAppWebview              = "is_app_webview"
+	IsFullDesktop             = "is_full_desktop"
+	IsHTMLPreferred           = "is_html_preferred"
+	IsIOS                     = "is_ios"
+	IsLargescreen             = "is_largescreen"
+	IsMobile                  = "is_mobile"
+	IsPhone                   = "is_phone"
+	IsRobot                   = "is_robot"
+	IsSmartphone              = "is_smartphone"
+	IsTouchscreen             = "is_touchscreen"
+	IsWindowsPhone            = "is_windows_phone"
+	IsWMLPreferred            = "is_wml_preferred"
+	IsXHTMLMPPreferred        = "is_xhtmlmp_preferred"
+)
+
+// Static holds the names of all the static capabilities
+var Static = []string{
+	AAC,
+	AjaxManipulateCSS,
+	AjaxManipulateDOM,
+	AjaxPreferredGeolocAPI,
+	AjaxSupportEventListener,
+	AjaxSupportEvents,
+	AjaxSupportGetelementbyid,
+	AjaxSupportInnerHTML,
+	AjaxSupportJavascript,
+	AjaxXHRType,
+	AMR,
+	BrandName,
+	CanAssignPhoneNumber,
+	CanSkipAlignedLinkRow,
+	CanvasSupport,
+	Columns,
+	CSSBorderImage,
+	CSSGradient,
+	CSSRoundedCorners,
+	CSSSpriting,
+	DensityClass,
+	DeviceClaimsWebSupport,
+	DeviceOS,
+	DeviceOSVersion,
+	DualOrientation,
+	FlashLiteVersion,
+	FullFlashSupport,
+	GIF,
+	HasQwertyKeyboard,
+	HTMLWeb32,
+	HTMLWeb40,
+	HTMLWiImodeCompactGeneric,
+	HTMLWiOMAXHTMLMP10,
+	HTMLWiW3Xhtmlbasic,
+	HTTPSSupport,
+	ImageInlining,
+	IsSmartTV,
+	IsTablet,
+	IsTranscoder,
+	IsWirelessDevice,
+	JPG,
+	MarketingName,
+	MaxDataRate,
+	MaxDeckSize,
+	MaxImageHeight,
+	MaxImageWidth,
+	MaxURLLengthBookmark,
+	MaxURLLengthInRequests,
+	MidiMonophonic,
+	MidiPolyphonic,
+	MobileBrowser,
+	MobileBrowserVersion,
+	ModelExtraInfo,
+	ModelName,
+	MP3,
+	NFCSupport,
+	NokiaEdition,
+	NokiaSeries,
+	PDFSupport,
+	PhysicalScreenHeight,
+	PhysicalScreenWidth,
+	Playback3GPP,
+	PlaybackAcodecAAC,
+	PlaybackAcodecAMR,
+	PlaybackMov,
+	PlaybackMP4,
+	PlaybackOMASizeLimit,
+	PlaybackRealMedia,
+	PlaybackVcodecH2630,
+	PlaybackVcodecH264Bp,
+	PlaybackVcodecMpeg4Sp,
+	PlaybackWebM,
+	PlaybackWMV,
+	PNG,
+	PointingMethod,
+	PreferredMarkup,
+	ReleaseDate,
+	ResolutionHeight,
+	ResolutionWidth,
+	Rows,
+	RSSSupport,
+	SMSEnabled,
+	Streaming3GPP,
+	StreamingMP4,
+	StreamingRealMedia,
+	StreamingVideo,
+	SVGT11,
+	SVGT11Plus,
+	TranscoderUAHeader,
+	UAProf,
+	Uaprof2,
+	Uaprof3,
+	Unique,
+	UnuniquenessHandler,
+	UxFullDesktop,
+	ViewportInitialScale,
+	ViewportMaximumScale,
+	ViewportMinimumScale,
+	ViewportSupported,
+	ViewportUserscalable,
+	ViewportWidth,
+	Wav,
+	WebpLosslessSupport,
+	WebpLossySupport,
+	Wifi,
+	WML11,
+	WML12,
+	WML13,
+	XHTMLCanEmbedVideo,
+	XHTMLFileUpload,
+	XHTMLMakePhoneCallString,
+	XHTMLPreferredCharset,
+	XHTMLSendMMSString,
+	XHTMLSendSMSString,
+	XHTMLSupportLevel,
+	XHTMLSupportsFormsInTable,
+	XHTMLTableSupport,
+}
+
+// Virtual holds the names of all the virtual capabilities
+var Virtual = []string{
+	AdvertisedAppName,
+	AdvertisedBrowser,
+	AdvertisedBrowserVersion,
+	AdvertisedDeviceOS,
+	AdvertisedDeviceOSVersion,
+	CompleteDeviceName,
+	DeviceName,
+	FormFactor,
+	IsAndroid,
+	IsApp,
+	IsAppWebview,
+	IsFullDesktop,
+	IsHTMLPreferred,
+	IsIOS,
+	IsLargescreen,
+	IsMobile,
+	IsPhone,
+	IsRobot,
+	IsSmartphone,
+	IsTouchscreen,
+	IsWindowsPhone,
+	IsWMLPreferred,
+	IsXHTMLMPPreferred,
+}
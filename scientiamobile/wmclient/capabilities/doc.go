@@ -0,0 +1,27 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package capabilities holds the names of the WURFL capabilities as constants, so that the capability lists given to the
+// client are checked by the compiler, ie:
+//
+//	client.SetRequestedCapabilities([]string{capabilities.BrandName, capabilities.IsSmartTV, capabilities.FormFactor})
+//
+// The constants are generated by cmd/wm-capgen. A WM server may not support all of them, depending on its version and on
+// its WURFL file: regenerate the constants from your WM server with go generate, or check them with
+// WmClient.HasStaticCapability and WmClient.HasVirtualCapability
+package capabilities
+
+//go:generate go run ../../../cmd/wm-capgen -host localhost -port 8080 -o capabilities.go
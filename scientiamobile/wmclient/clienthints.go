@@ -0,0 +1,197 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// highEntropyClientHints are the client hints that browsers send only to the sites asking for them with Accept-CH. The
+// model, platform version and full version list make the difference between detecting a device from a reduced UA or not
+var highEntropyClientHints = []string{
+	"Sec-CH-UA-Model",
+	"Sec-CH-UA-Platform-Version",
+	"Sec-CH-UA-Full-Version-List",
+	"Sec-CH-UA-Arch",
+	"Sec-CH-UA-Bitness",
+}
+
+// ClientHints holds the User-Agent Client Hints sent by browsers together with, or instead of, the reduced User-Agent.
+// Values are the raw header values, ie: `"Chromium";v="110", "Google Chrome";v="110"` for Brands or "?1" for Mobile.
+// Empty values are not sent
+type ClientHints struct {
+	UserAgent       string // User-Agent
+	Brands          string // Sec-CH-UA
+	FullVersionList string // Sec-CH-UA-Full-Version-List
+	Mobile          string // Sec-CH-UA-Mobile
+	Model           string // Sec-CH-UA-Model
+	Platform        string // Sec-CH-UA-Platform
+	PlatformVersion string // Sec-CH-UA-Platform-Version
+	Arch            string // Sec-CH-UA-Arch
+	Bitness         string // Sec-CH-UA-Bitness
+}
+
+// headers returns the client hints as lookup headers
+func (h ClientHints) headers() map[string]string {
+	headers := map[string]string{
+		userAgentHeader:               h.UserAgent,
+		"Sec-CH-UA":                   h.Brands,
+		"Sec-CH-UA-Full-Version-List": h.FullVersionList,
+		"Sec-CH-UA-Mobile":            h.Mobile,
+		"Sec-CH-UA-Model":             h.Model,
+		"Sec-CH-UA-Platform":          h.Platform,
+		"Sec-CH-UA-Platform-Version":  h.PlatformVersion,
+		"Sec-CH-UA-Arch":              h.Arch,
+		"Sec-CH-UA-Bitness":           h.Bitness,
+	}
+	for name, value := range headers {
+		if value == "" {
+			delete(headers, name)
+		}
+	}
+	return headers
+}
+
+// LookupClientHints - detects a device from its User-Agent Client Hints. Like the other header lookups, only the hints
+// that WM server reports as important headers are sent: WM server versions that do not support client hints detect the
+// device from the User-Agent only
+func (c *WmClient) LookupClientHints(ctx context.Context, hints ClientHints) (*JSONDeviceData, error) {
+	return c.lookupHeaders(ctx, hints.headers(), true)
+}
+
+// ClientHintsFromRequest returns the User-Agent and the client hints of the given request
+func ClientHintsFromRequest(request *http.Request) ClientHints {
+	return ClientHints{
+		UserAgent:       request.Header.Get(userAgentHeader),
+		Brands:          request.Header.Get("Sec-CH-UA"),
+		FullVersionList: request.Header.Get("Sec-CH-UA-Full-Version-List"),
+		Mobile:          request.Header.Get("Sec-CH-UA-Mobile"),
+		Model:           request.Header.Get("Sec-CH-UA-Model"),
+		Platform:        request.Header.Get("Sec-CH-UA-Platform"),
+		PlatformVersion: request.Header.Get("Sec-CH-UA-Platform-Version"),
+		Arch:            request.Header.Get("Sec-CH-UA-Arch"),
+		Bitness:         request.Header.Get("Sec-CH-UA-Bitness"),
+	}
+}
+
+// AddAcceptCH asks browsers to send the high entropy client hints (Sec-CH-UA-Model, Sec-CH-UA-Platform-Version,
+// Sec-CH-UA-Full-Version-List, Sec-CH-UA-Arch and Sec-CH-UA-Bitness) by adding them to the Accept-CH header of the given
+// response headers, and to its Vary header, since responses built from the detected device depend on them.
+// Browsers send the hints only over HTTPS and only from the request following the first response with Accept-CH: set
+// the same names in the Critical-CH header too if the first request must also be detected with them, at the cost of a
+// retry of that request by the browser
+func AddAcceptCH(header http.Header) {
+	addHeaderList(header, "Accept-CH", highEntropyClientHints)
+	addHeaderList(header, "Vary", highEntropyClientHints)
+}
+
+// LookupRequestWithClientHints - detects the device of a request sent by a browser with a reduced (frozen) User-Agent,
+// which always reports the same Android version and model, using the client hints of the request too. Hints that WM
+// server reports as important headers are sent as they are; if the model or the platform version are not, they are
+// merged into the User-Agent, see ExpandReducedUserAgent, so that WM server versions that only read the User-Agent
+// can detect the device as well. The other important headers of the request are sent as with LookupRequestContext.
+// Use AddAcceptCH in the responses, so that browsers send the high entropy hints
+func (c *WmClient) LookupRequestWithClientHints(ctx context.Context, request *http.Request) (*JSONDeviceData, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	headers := flattenHeaders(request.Header)
+	if !c.isImportantHeader("Sec-CH-UA-Model") || !c.isImportantHeader("Sec-CH-UA-Platform-Version") {
+		hints := ClientHintsFromRequest(request)
+		headers[strings.ToLower(userAgentHeader)] = ExpandReducedUserAgent(hints.UserAgent, hints)
+	}
+	return c.lookupHeaders(ctx, headers, true)
+}
+
+// isImportantHeader returns true if WM server reports the given header as important, comparing names case insensitively
+func (c *WmClient) isImportantHeader(name string) bool {
+	for _, important := range c.ImportantHeaders {
+		if strings.EqualFold(important, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpandReducedUserAgent returns the given user agent with the values frozen by the User-Agent reduction replaced by the
+// ones of the given client hints: the Android version and model ("Android 10; K"), the macOS version ("Mac OS X 10_15_7")
+// and the Chrome minor version ("Chrome/110.0.0.0"). User agents that are not reduced, or values that have no hint,
+// are left unchanged
+func ExpandReducedUserAgent(userAgent string, hints ClientHints) string {
+	model := hintValue(hints.Model)
+	platformVersion := hintValue(hints.PlatformVersion)
+
+	if strings.Contains(userAgent, "; Android 10; K)") && (model != "" || platformVersion != "") {
+		android := "Android 10"
+		if platformVersion != "" {
+			android = "Android " + trimVersion(platformVersion)
+		}
+		if model == "" {
+			model = "K"
+		}
+		userAgent = strings.Replace(userAgent, "; Android 10; K)", "; "+android+"; "+model+")", 1)
+	}
+	if strings.Contains(userAgent, "Mac OS X 10_15_7") && platformVersion != "" && hintValue(hints.Platform) == "macOS" {
+		userAgent = strings.Replace(userAgent, "Mac OS X 10_15_7", "Mac OS X "+strings.Replace(platformVersion, ".", "_", -1), 1)
+	}
+
+	if start := strings.Index(userAgent, "Chrome/"); start >= 0 {
+		start += len("Chrome/")
+		end := start + strings.IndexAny(userAgent[start:]+" ", " ;)")
+		reduced := userAgent[start:end]
+		major := strings.TrimSuffix(reduced, ".0.0.0")
+		if major != reduced {
+			for _, brand := range []string{"Google Chrome", "Chromium"} {
+				if full := brandVersion(hints.FullVersionList, brand); strings.HasPrefix(full, major+".") {
+					userAgent = userAgent[:start] + full + userAgent[end:]
+					break
+				}
+			}
+		}
+	}
+	return userAgent
+}
+
+// hintValue returns the value of a client hint holding a structured field string, ie: "SM-G991B" for `"SM-G991B"`
+func hintValue(hint string) string {
+	return strings.Trim(strings.TrimSpace(hint), `"`)
+}
+
+// trimVersion removes the trailing zero components of the given version, ie: 13 for 13.0.0
+func trimVersion(version string) string {
+	for strings.HasSuffix(version, ".0") {
+		version = strings.TrimSuffix(version, ".0")
+	}
+	return version
+}
+
+// brandVersion returns the version of the given brand in a Sec-CH-UA or Sec-CH-UA-Full-Version-List header value,
+// ie: `"Chromium";v="110.0.5481.153", "Google Chrome";v="110.0.5481.153"`, or an empty string if the brand is not in it
+func brandVersion(brands string, brand string) string {
+	for _, entry := range strings.Split(brands, ",") {
+		parts := strings.SplitN(entry, ";", 2)
+		if len(parts) != 2 || hintValue(parts[0]) != brand {
+			continue
+		}
+		version := strings.TrimSpace(parts[1])
+		if strings.HasPrefix(version, "v=") {
+			return hintValue(version[len("v="):])
+		}
+	}
+	return ""
+}
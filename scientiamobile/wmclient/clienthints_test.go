@@ -0,0 +1,148 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientHintsLookups(t *testing.T) {
+	var received map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+		received = request.LookupHeaders
+		w.Write([]byte(`{"capabilities":{"wurfl_id":"generic"}}`))
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.ImportantHeaders = []string{"User-Agent", "Sec-CH-UA", "Sec-CH-UA-Mobile", "Sec-CH-UA-Model", "Sec-CH-UA-Platform"}
+
+	reducedUA := "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/110.0.0.0 Mobile Safari/537.36"
+	hints := ClientHints{
+		UserAgent:       reducedUA,
+		Brands:          `"Chromium";v="110", "Google Chrome";v="110"`,
+		Mobile:          "?1",
+		Model:           `"SM-G991B"`,
+		Platform:        `"Android"`,
+		PlatformVersion: `"13.0.0"`,
+	}
+	_, err := client.LookupClientHints(context.Background(), hints)
+	require.Nil(t, err)
+	// Sec-CH-UA-Platform-Version is not an important header
+	expected := map[string]string{
+		"User-Agent":         reducedUA,
+		"Sec-CH-UA":          hints.Brands,
+		"Sec-CH-UA-Mobile":   "?1",
+		"Sec-CH-UA-Model":    `"SM-G991B"`,
+		"Sec-CH-UA-Platform": `"Android"`,
+	}
+	require.Equal(t, expected, received)
+
+	// LookupRequest forwards the important client hints too, whatever the case of their names
+	request, err := http.NewRequest("GET", "http://mysite.com/", nil)
+	require.Nil(t, err)
+	request.Header.Set("User-Agent", reducedUA)
+	request.Header.Set("sec-ch-ua", hints.Brands)
+	request.Header.Set("Sec-Ch-Ua-Mobile", "?1")
+	request.Header.Set("SEC-CH-UA-MODEL", `"SM-G991B"`)
+	request.Header.Set("Sec-CH-UA-Platform", `"Android"`)
+	_, err = client.LookupRequestContext(context.Background(), request)
+	require.Nil(t, err)
+	require.Equal(t, expected, received)
+}
+
+func TestExpandReducedUserAgent(t *testing.T) {
+	androidUA := "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/110.0.0.0 Mobile Safari/537.36"
+	macUA := "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/110.0.0.0 Safari/537.36"
+	fullVersions := `"Chromium";v="110.0.5481.153", "Not A(Brand";v="24.0.0.0", "Google Chrome";v="110.0.5481.153"`
+
+	tests := []struct {
+		userAgent string
+		hints     ClientHints
+		expected  string
+	}{
+		{androidUA, ClientHints{Model: `"SM-G991B"`, PlatformVersion: `"13.0.0"`, FullVersionList: fullVersions},
+			"Mozilla/5.0 (Linux; Android 13; SM-G991B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/110.0.5481.153 Mobile Safari/537.36"},
+		{androidUA, ClientHints{Model: `"Pixel 7"`},
+			"Mozilla/5.0 (Linux; Android 10; Pixel 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/110.0.0.0 Mobile Safari/537.36"},
+		{androidUA, ClientHints{PlatformVersion: `"12.1.0"`},
+			"Mozilla/5.0 (Linux; Android 12.1; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/110.0.0.0 Mobile Safari/537.36"},
+		{macUA, ClientHints{Platform: `"macOS"`, PlatformVersion: `"14.1.0"`},
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_1_0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/110.0.0.0 Safari/537.36"},
+		// the full version of another major version is not used
+		{macUA, ClientHints{FullVersionList: `"Google Chrome";v="111.0.5563.64"`}, macUA},
+		{androidUA, ClientHints{}, androidUA},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 16_4 like Mac OS X)", ClientHints{Model: `"iPhone"`}, "Mozilla/5.0 (iPhone; CPU iPhone OS 16_4 like Mac OS X)"},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.expected, ExpandReducedUserAgent(test.userAgent, test.hints))
+	}
+}
+
+func TestLookupRequestWithClientHints(t *testing.T) {
+	var received map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+		received = request.LookupHeaders
+		w.Write([]byte(`{"capabilities":{"wurfl_id":"generic"}}`))
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.ImportantHeaders = []string{"User-Agent", "Sec-CH-UA-Model", "Device-Stock-UA"}
+
+	reducedUA := "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/110.0.0.0 Mobile Safari/537.36"
+	request, err := http.NewRequest("GET", "http://mysite.com/", nil)
+	require.Nil(t, err)
+	request.Header.Set("User-Agent", reducedUA)
+	request.Header.Set("Sec-CH-UA-Model", `"SM-G991B"`)
+	request.Header.Set("Sec-CH-UA-Platform-Version", `"13.0.0"`)
+	request.Header.Set("Device-Stock-UA", "stock")
+
+	// the platform version is not an important header, it is merged into the User-Agent
+	_, err = client.LookupRequestWithClientHints(context.Background(), request)
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{
+		"User-Agent":      "Mozilla/5.0 (Linux; Android 13; SM-G991B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/110.0.0.0 Mobile Safari/537.36",
+		"Sec-CH-UA-Model": `"SM-G991B"`,
+		"Device-Stock-UA": "stock",
+	}, received)
+
+	// the reduced User-Agent is sent as it is to servers reading the hints
+	client.ImportantHeaders = append(client.ImportantHeaders, "Sec-CH-UA-Platform-Version")
+	_, err = client.LookupRequestWithClientHints(context.Background(), request)
+	require.Nil(t, err)
+	require.Equal(t, reducedUA, received["User-Agent"])
+	require.Equal(t, `"13.0.0"`, received["Sec-CH-UA-Platform-Version"])
+}
+
+func TestAddAcceptCH(t *testing.T) {
+	header := http.Header{}
+	header.Set("Accept-CH", "Sec-CH-UA-Model, DPR")
+	header.Set("Vary", "Accept-Encoding")
+	AddAcceptCH(header)
+	require.Equal(t, "Sec-CH-UA-Model, DPR, Sec-CH-UA-Platform-Version, Sec-CH-UA-Full-Version-List, Sec-CH-UA-Arch, Sec-CH-UA-Bitness",
+		header.Get("Accept-CH"))
+	require.Equal(t, "Accept-Encoding, Sec-CH-UA-Model, Sec-CH-UA-Platform-Version, Sec-CH-UA-Full-Version-List, Sec-CH-UA-Arch, Sec-CH-UA-Bitness",
+		header.Get("Vary"))
+}
@@ -0,0 +1,291 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Option configures a client created with CreateWithOptions. Unlike LookupOption, it applies to all the client lookups
+type Option func(options *clientOptions)
+
+// clientOptions holds the options of CreateWithOptions
+type clientOptions struct {
+	scheme          string
+	host            string
+	port            string
+	baseURI         string
+	connTimeout     time.Duration
+	transferTimeout time.Duration
+	tlsConfig       *tls.Config
+	tlsSet          bool
+	httpClient      *http.Client
+	cacheSize       int
+	deviceCacheSize int
+	decorators      []RequestDecorator
+	capabilities    []string
+	infoValidation  InfoValidation
+	retryPolicy     *RetryPolicy
+	maxIdleTime     time.Duration
+	sharedCache     SharedCache
+	proxyURL        *url.URL
+	proxyEnv        bool
+	requestMirror   *RequestMirror
+	serverVersion   *VersionConstraint
+	err             error // first error found applying the options
+}
+
+// WithServer sets the scheme, host and port of WM server, http://localhost:8080 by default. An empty scheme is http
+func WithServer(scheme string, host string, port string) Option {
+	return func(options *clientOptions) {
+		options.scheme = scheme
+		options.host = host
+		options.port = port
+	}
+}
+
+// WithBaseURI sets the path prefix of the WM server endpoints, ie: when WM server is exposed behind a reverse proxy
+func WithBaseURI(baseURI string) Option {
+	return func(options *clientOptions) {
+		options.baseURI = baseURI
+	}
+}
+
+// WithHTTPTimeout sets the connection and transfer timeouts, as SetHTTPTimeout does. Values <= 0 keep the defaults, 10 and
+// 60 seconds. It is not named WithTimeout, which is the lookup option bounding a single lookup
+func WithHTTPTimeout(connection time.Duration, transfer time.Duration) Option {
+	return func(options *clientOptions) {
+		options.connTimeout = connection
+		options.transferTimeout = transfer
+	}
+}
+
+// WithTLS makes the client connect to WM server using the https scheme and the given TLS configuration, replacing the one
+// built by the previous TLS options, ie: WithCAFile. A nil config uses the system defaults. The config is copied, so that the
+// following TLS options do not change it. It cannot be used with WithHTTPClient
+func WithTLS(config *tls.Config) Option {
+	return func(options *clientOptions) {
+		options.tlsConfig = nil
+		if config != nil {
+			options.tlsConfig = config.Clone()
+		}
+		options.tlsSet = true
+	}
+}
+
+// WithHTTPClient makes the client send its requests with the given http.Client, ie: one shared with other services or
+// instrumented for tracing. Its timeouts and transport are used as they are: WithHTTPTimeout, WithTLS, connection statistics,
+// WithMaxIdleTime, public key pinning and proxies do not apply to it
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(options *clientOptions) {
+		options.httpClient = httpClient
+	}
+}
+
+// WithCache enables the client caches, with the given maximum number of entries in the UA cache, as SetCacheSize does
+func WithCache(uaMaxEntries int) Option {
+	return func(options *clientOptions) {
+		options.cacheSize = uaMaxEntries
+	}
+}
+
+// WithCacheSizes enables the client caches, with the given maximum number of entries in the UA and device caches. A device
+// cache size <= 0 keeps the default, 20000 entries
+func WithCacheSizes(uaMaxEntries int, deviceMaxEntries int) Option {
+	return func(options *clientOptions) {
+		options.cacheSize = uaMaxEntries
+		options.deviceCacheSize = deviceMaxEntries
+	}
+}
+
+// WithRetryPolicy sets the policy used to retry the failed requests to WM server, as SetRetryPolicy does. It also applies to
+// the connection check done when the client is created
+func WithRetryPolicy(policy *RetryPolicy) Option {
+	return func(options *clientOptions) {
+		options.retryPolicy = policy
+	}
+}
+
+// WithAuth sets the Authorization header of every request sent to WM server to the given value, ie: "Bearer <token>",
+// as required by deployments behind an authenticating gateway
+func WithAuth(authorization string) Option {
+	return WithRequestDecorator(HeadersDecorator(map[string]string{"Authorization": authorization}))
+}
+
+// WithRequestDecorator adds a decorator applied to all the requests sent to WM server, see SetRequestDecorator. Decorators
+// given with more than one option, WithAuth included, are applied in order
+func WithRequestDecorator(decorator RequestDecorator) Option {
+	return func(options *clientOptions) {
+		options.decorators = append(options.decorators, decorator)
+	}
+}
+
+// WithRequestedCapabilities sets the static and virtual capabilities returned by lookups, as SetRequestedCapabilities does
+// once the client has read the capabilities known by WM server
+func WithRequestedCapabilities(capNames ...string) Option {
+	return func(options *clientOptions) {
+		options.capabilities = capNames
+	}
+}
+
+// CreateWithOptions creates a client configured with the given options and checks that WM server can be reached, reading
+// the headers and capabilities it supports
+func CreateWithOptions(opts ...Option) (*WmClient, error) {
+	options := clientOptions{scheme: "http", host: "localhost", port: "8080"}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.err != nil {
+		return nil, options.err
+	}
+	if options.scheme == "" {
+		options.scheme = "http"
+	}
+	if options.tlsSet {
+		if options.httpClient != nil {
+			return nil, errors.New("WithTLS and the other TLS options cannot be used with WithHTTPClient")
+		}
+		if options.scheme != "http" && options.scheme != "https" {
+			return nil, fmt.Errorf("TLS options cannot be used with the %s scheme", options.scheme)
+		}
+		options.scheme = "https"
+	}
+	if (options.proxyURL != nil || options.proxyEnv) && options.httpClient != nil {
+		return nil, errors.New("proxy options cannot be used with WithHTTPClient")
+	}
+	if options.cacheSize < 0 {
+		return nil, fmt.Errorf("invalid cache size %d", options.cacheSize)
+	}
+
+	client := &WmClient{scheme: options.scheme, host: options.host, port: options.port, baseURI: options.baseURI,
+		infoValidation: options.infoValidation, sharedCache: options.sharedCache, requestMirror: options.requestMirror}
+	if options.httpClient != nil {
+		client.httpClient = options.httpClient
+		// kept if the timeouts are changed with SetHTTPTimeout
+		client.transport = options.httpClient.Transport
+	} else {
+		client.tlsConfig = options.tlsConfig
+		client.connTimeout = options.connTimeout
+		client.transferTimeout = options.transferTimeout
+		client.maxIdleTime = options.maxIdleTime
+		client.proxyURL = options.proxyURL
+		client.proxyFromEnvironment = options.proxyEnv
+		if client.connTimeout <= 0 {
+			client.connTimeout = defaultConnTimeout
+		}
+		if client.transferTimeout <= 0 {
+			client.transferTimeout = defaultTransferTimeout
+		}
+		client.httpClient = createHTTPClient(client.connTimeout, client.transferTimeout)
+		client.trackConnections()
+		client.applyTLSConfig()
+		client.applyMaxIdleTime()
+		client.applyProxy()
+	}
+	if len(options.decorators) == 1 {
+		client.requestDecorator = options.decorators[0]
+	} else if len(options.decorators) > 1 {
+		client.requestDecorator = ChainDecorators(options.decorators...)
+	}
+	if err := client.SetRetryPolicy(options.retryPolicy); err != nil {
+		return nil, err
+	}
+
+	// Test server connection and save important headers taken using getInfo function
+	data, err := client.GetInfo()
+	if err != nil {
+		return nil, err
+	}
+	if err = checkServerVersion(data.WmVersion, options.serverVersion); err != nil {
+		return nil, err
+	}
+
+	client.ImportantHeaders = data.ImportantHeaders
+	client.StaticCaps = data.StaticCaps
+	client.VirtualCaps = data.VirtualCaps
+	client.serverDeprecatedCaps = data.DeprecatedCaps
+	sort.Strings(client.StaticCaps)
+	sort.Strings(client.VirtualCaps)
+
+	if options.cacheSize > 0 {
+		deviceCacheSize := options.deviceCacheSize
+		if deviceCacheSize <= 0 {
+			deviceCacheSize = deviceDefaultCacheSize
+		}
+		client.setCacheSizes(options.cacheSize, deviceCacheSize)
+	}
+	if options.capabilities != nil {
+		client.SetRequestedCapabilities(options.capabilities)
+	}
+	return client, nil
+}
+
+// CreateFromURL creates a client for the WM server at the given URL, ie: "https://wm.internal:8443/wm", whose path is used
+// as base URI. The port can be omitted to use the default one of the scheme. User and password, if set in the URL, are sent
+// with basic authentication. The given options are applied after the ones derived from the URL
+func CreateFromURL(rawURL string, opts ...Option) (*WmClient, error) {
+	serverOpts, err := serverURLOptions(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return CreateWithOptions(append(serverOpts, opts...)...)
+}
+
+// serverURLOptions returns the options setting the WM server address, base URI and credentials held by the given URL
+func serverURLOptions(rawURL string) ([]Option, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid WM server URL %q: the scheme must be http or https", rawURL)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid WM server URL %q: missing host", rawURL)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("invalid WM server URL %q: query and fragment are not supported", rawURL)
+	}
+
+	opts := []Option{WithServer(u.Scheme, u.Hostname(), u.Port()), WithBaseURI(strings.Trim(u.Path, "/"))}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+		opts = append(opts, WithAuth("Basic "+credentials))
+	}
+	return opts, nil
+}
+
+// applyTLSConfig sets the TLS configuration of the client in the default transport
+func (c *WmClient) applyTLSConfig() {
+	if c.tlsConfig == nil {
+		return
+	}
+	transport, ok := c.httpClient.Transport.(*http.Transport)
+	if !ok {
+		return
+	}
+	// the configuration is cloned, since public key pinning changes it
+	transport.TLSClientConfig = c.tlsConfig.Clone()
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newOptionsTestHandler returns a WM server handler counting the lookups and checking the Authorization header, if not empty
+func newOptionsTestHandler(authorization string, lookups *int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authorization != "" && r.Header.Get("Authorization") != authorization {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"unauthorized"}`))
+			return
+		}
+		if r.URL.Path == "/v2/getinfo/json" {
+			json.NewEncoder(w).Encode(JSONInfoData{WmVersion: "2.1.0", WurflAPIVersion: "1.12", WurflInfo: "wurfl.zip", Ltime: "1",
+				ImportantHeaders: []string{userAgentHeader}, StaticCaps: []string{"brand_name"}, VirtualCaps: []string{"form_factor"}})
+			return
+		}
+		atomic.AddInt32(lookups, 1)
+		request := Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+		caps := map[string]string{"wurfl_id": "generic"}
+		for _, name := range append(request.RequestedCaps, request.RequestedVCaps...) {
+			caps[name] = "value"
+		}
+		json.NewEncoder(w).Encode(JSONDeviceData{Capabilities: caps, Ltime: "1"})
+	})
+}
+
+func TestCreateWithOptions(t *testing.T) {
+	var lookups int32
+	server := httptest.NewServer(newOptionsTestHandler("Bearer token", &lookups))
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.Nil(t, err)
+
+	_, err = CreateWithOptions(WithServer("http", host, port))
+	require.NotNil(t, err)
+
+	var decorated int32
+	client, err := CreateWithOptions(WithServer("", host, port), WithAuth("Bearer token"), WithCache(100),
+		WithRequestedCapabilities("brand_name", "form_factor", "unknown"), WithHTTPTimeout(time.Second, 5*time.Second),
+		WithRequestDecorator(func(request *http.Request) error {
+			atomic.AddInt32(&decorated, 1)
+			return nil
+		}))
+	require.Nil(t, err)
+	defer client.Close()
+	require.Equal(t, "http", client.scheme)
+	require.Equal(t, time.Second, client.connTimeout)
+	require.Equal(t, 5*time.Second, client.httpClient.Timeout)
+	require.Equal(t, []string{"brand_name"}, client.requestedStaticCaps)
+	require.Equal(t, []string{"form_factor"}, client.requestedVirtualCaps)
+
+	for i := 0; i < 2; i++ {
+		device, err := client.LookupUserAgent(context.Background(), "ua")
+		require.Nil(t, err)
+		require.Equal(t, "value", device.Capabilities["form_factor"])
+	}
+	// the second lookup is served by the cache
+	require.Equal(t, int32(1), atomic.LoadInt32(&lookups))
+	require.Equal(t, int32(2), atomic.LoadInt32(&decorated))
+}
+
+func TestCreateWithTLSOption(t *testing.T) {
+	var lookups int32
+	server := httptest.NewTLSServer(newOptionsTestHandler("", &lookups))
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.Nil(t, err)
+
+	// the test server certificate is not trusted by default
+	_, err = CreateWithOptions(WithServer("", host, port), WithTLS(nil))
+	require.NotNil(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	client, err := CreateWithOptions(WithServer("", host, port), WithTLS(&tls.Config{RootCAs: roots}))
+	require.Nil(t, err)
+	require.Equal(t, "https", client.scheme)
+
+	// the TLS configuration is kept when the timeouts change
+	client.SetHTTPTimeout(5, 10)
+	_, err = client.LookupUserAgent(context.Background(), "ua")
+	require.Nil(t, err)
+	client.Close()
+
+	_, err = CreateWithOptions(WithServer("", host, port), WithTLS(nil), WithHTTPClient(server.Client()))
+	require.EqualError(t, err, "WithTLS and the other TLS options cannot be used with WithHTTPClient")
+
+	// the given http.Client is used as it is, and kept when the timeouts change
+	client, err = CreateWithOptions(WithServer("https", host, port), WithHTTPClient(server.Client()))
+	require.Nil(t, err)
+	defer client.Close()
+	client.SetHTTPTimeout(5, 10)
+	_, err = client.LookupUserAgent(context.Background(), "ua")
+	require.Nil(t, err)
+}
+
+func TestServerURLOptions(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected clientOptions
+	}{
+		{"https://wm.internal:8443/wm", clientOptions{scheme: "https", host: "wm.internal", port: "8443", baseURI: "wm"}},
+		{"http://wm.internal", clientOptions{scheme: "http", host: "wm.internal"}},
+		{"http://10.0.0.1:8080/", clientOptions{scheme: "http", host: "10.0.0.1", port: "8080"}},
+		{"http://[::1]:8080/api/wm/", clientOptions{scheme: "http", host: "::1", port: "8080", baseURI: "api/wm"}},
+	}
+	for _, test := range tests {
+		opts, err := serverURLOptions(test.url)
+		require.Nil(t, err, test.url)
+		options := clientOptions{}
+		for _, opt := range opts {
+			opt(&options)
+		}
+		require.Equal(t, test.expected, options, test.url)
+	}
+
+	for _, url := range []string{"wm.internal:8080", "ftp://wm.internal", "http:///wm", "http://wm.internal/wm?x=1", "http://wm.internal/#wm", "%"} {
+		_, err := serverURLOptions(url)
+		require.NotNil(t, err, url)
+	}
+}
+
+func TestCreateFromURL(t *testing.T) {
+	var lookups int32
+	server := httptest.NewServer(http.StripPrefix("/wm", newOptionsTestHandler("Basic dXNlcjpzZWNyZXQ=", &lookups)))
+	defer server.Close()
+
+	client, err := CreateFromURL(server.URL+"/wm/", WithCache(10))
+	require.NotNil(t, err)
+	require.Nil(t, client)
+
+	u := strings.Replace(server.URL, "http://", "http://user:secret@", 1) + "/wm"
+	client, err = CreateFromURL(u, WithCache(10))
+	require.Nil(t, err)
+	defer client.Close()
+	require.Equal(t, "wm", client.baseURI)
+	_, err = client.LookupUserAgent(context.Background(), "ua")
+	require.Nil(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&lookups))
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultConcurrencyBackoff is the factor the concurrency limit is multiplied by on congestion, if not configured
+const defaultConcurrencyBackoff = 0.5
+
+// AdaptiveConcurrency configures the limit of the requests in flight to WM server, which is adapted to the observed latency
+// and errors with an AIMD (additive increase, multiplicative decrease) algorithm: each request completed in time without
+// errors increases the limit by 1/limit, so that it grows by about one every limit requests, while each request that fails
+// or is slower than LatencyThreshold multiplies it by Backoff. Requests over the limit wait for a free slot, or for their
+// context to be done
+type AdaptiveConcurrency struct {
+	MinLimit         int           // lower bound of the limit, at least 1
+	MaxLimit         int           // upper bound of the limit, and its initial value
+	LatencyThreshold time.Duration // requests slower than this are a congestion signal, <= 0 to only consider errors
+	Backoff          float64       // factor applied to the limit on congestion, between 0 and 1 excluded, 0.5 if 0
+}
+
+// ConcurrencyLimitEvent is sent to the stats hook every time the concurrency limit changes
+type ConcurrencyLimitEvent struct {
+	PreviousLimit int
+	NewLimit      int
+	InFlight      int           // requests in flight after the one that caused the change
+	Latency       time.Duration // latency of the request that caused the change
+	Failed        bool          // true if the request that caused the change failed
+}
+
+// concurrencyLimiter holds the adaptive limit of the requests in flight
+type concurrencyLimiter struct {
+	config   AdaptiveConcurrency
+	mutex    sync.Mutex
+	limit    float64
+	inFlight int
+	released chan struct{} // closed, and replaced, every time a request completes
+}
+
+// SetAdaptiveConcurrency limits the requests in flight to WM server with the given configuration, so that a small WM server
+// is protected from traffic peaks without a static limit to tune. A nil configuration removes the limit, which is the
+// default. This function should be called before performing any lookup
+func (c *WmClient) SetAdaptiveConcurrency(config *AdaptiveConcurrency) error {
+	if c == nil {
+		return ErrNilClient
+	}
+	if config == nil {
+		c.limiter = nil
+		return nil
+	}
+	if config.MinLimit < 1 || config.MaxLimit < config.MinLimit {
+		return fmt.Errorf("invalid concurrency limits %d-%d: the minimum must be at least 1 and not greater than the maximum",
+			config.MinLimit, config.MaxLimit)
+	}
+	if config.Backoff < 0 || config.Backoff >= 1 {
+		return fmt.Errorf("invalid concurrency backoff %.2f: it must be less than 1, or 0 for the default", config.Backoff)
+	}
+
+	limiter := &concurrencyLimiter{config: *config, limit: float64(config.MaxLimit), released: make(chan struct{})}
+	if limiter.config.Backoff == 0 {
+		limiter.config.Backoff = defaultConcurrencyBackoff
+	}
+	c.limiter = limiter
+	return nil
+}
+
+// GetConcurrencyLimit returns the current limit of the requests in flight to WM server and the number of requests in flight,
+// 0 and 0 if adaptive concurrency is disabled
+func (c *WmClient) GetConcurrencyLimit() (int, int) {
+	if c == nil {
+		return 0, 0
+	}
+	if c.limiter == nil {
+		return 0, 0
+	}
+	c.limiter.mutex.Lock()
+	defer c.limiter.mutex.Unlock()
+	return int(c.limiter.limit), c.limiter.inFlight
+}
+
+// acquire waits for the number of requests in flight to be under the limit, and counts a new request in flight
+func (l *concurrencyLimiter) acquire(ctx context.Context) error {
+	for {
+		l.mutex.Lock()
+		if l.inFlight < int(l.limit) {
+			l.inFlight++
+			l.mutex.Unlock()
+			return nil
+		}
+		released := l.released
+		l.mutex.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release counts the end of a request and adapts the limit to its outcome. Requests cancelled by the caller do not change
+// the limit. It returns the event to send if the limit has changed
+func (l *concurrencyLimiter) release(latency time.Duration, failed bool, cancelled bool) (ConcurrencyLimitEvent, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.inFlight--
+	close(l.released)
+	l.released = make(chan struct{})
+	if cancelled {
+		return ConcurrencyLimitEvent{}, false
+	}
+
+	previous := int(l.limit)
+	congested := failed || (l.config.LatencyThreshold > 0 && latency > l.config.LatencyThreshold)
+	if congested {
+		l.limit *= l.config.Backoff
+		if l.limit < float64(l.config.MinLimit) {
+			l.limit = float64(l.config.MinLimit)
+		}
+	} else {
+		l.limit += 1 / l.limit
+		if l.limit > float64(l.config.MaxLimit) {
+			l.limit = float64(l.config.MaxLimit)
+		}
+	}
+
+	if int(l.limit) == previous {
+		return ConcurrencyLimitEvent{}, false
+	}
+	return ConcurrencyLimitEvent{PreviousLimit: previous, NewLimit: int(l.limit), InFlight: l.inFlight, Latency: latency, Failed: failed}, true
+}
+
+// releaseLimiter releases the slot taken in the given limiter by a request started at the given time, which has completed
+// with the given status (0 if no response has been received) and error
+func (c *WmClient) releaseLimiter(ctx context.Context, limiter *concurrencyLimiter, start time.Time, status int, err error) {
+	if limiter == nil {
+		return
+	}
+	failed := err != nil || status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+	cancelled := errors.Is(ctx.Err(), context.Canceled)
+	if event, changed := limiter.release(time.Since(start), failed, cancelled); changed {
+		c.emitStats(event)
+	}
+}
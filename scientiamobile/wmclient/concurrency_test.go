@@ -0,0 +1,132 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrencyLimiterAIMD(t *testing.T) {
+	client := &WmClient{}
+	require.NotNil(t, client.SetAdaptiveConcurrency(&AdaptiveConcurrency{MinLimit: 0, MaxLimit: 10}))
+	require.NotNil(t, client.SetAdaptiveConcurrency(&AdaptiveConcurrency{MinLimit: 5, MaxLimit: 4}))
+	require.NotNil(t, client.SetAdaptiveConcurrency(&AdaptiveConcurrency{MinLimit: 1, MaxLimit: 4, Backoff: 1}))
+	require.Nil(t, client.SetAdaptiveConcurrency(&AdaptiveConcurrency{MinLimit: 2, MaxLimit: 8, LatencyThreshold: time.Second}))
+	limiter := client.limiter
+
+	release := func(latency time.Duration, failed bool) {
+		require.Nil(t, limiter.acquire(context.Background()))
+		limiter.release(latency, failed, false)
+	}
+
+	// congestion halves the limit, down to the minimum
+	release(time.Millisecond, true)
+	limit, inFlight := client.GetConcurrencyLimit()
+	require.Equal(t, 4, limit)
+	require.Equal(t, 0, inFlight)
+	release(2*time.Second, false)
+	release(2*time.Second, false)
+	limit, _ = client.GetConcurrencyLimit()
+	require.Equal(t, 2, limit)
+
+	// successes increase it by about one every limit requests: 2 + 1/2 + 1/2.5 + 1/2.9
+	release(time.Millisecond, false)
+	release(time.Millisecond, false)
+	release(time.Millisecond, false)
+	limit, _ = client.GetConcurrencyLimit()
+	require.Equal(t, 3, limit)
+
+	// cancelled requests do not change it
+	require.Nil(t, limiter.acquire(context.Background()))
+	_, changed := limiter.release(time.Millisecond, true, true)
+	require.False(t, changed)
+
+	// requests over the limit wait for a slot
+	require.Nil(t, limiter.acquire(context.Background()))
+	require.Nil(t, limiter.acquire(context.Background()))
+	require.Nil(t, limiter.acquire(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, limiter.acquire(ctx))
+
+	require.Nil(t, client.SetAdaptiveConcurrency(nil))
+	limit, inFlight = client.GetConcurrencyLimit()
+	require.Equal(t, 0, limit)
+	require.Equal(t, 0, inFlight)
+}
+
+func TestAdaptiveConcurrency(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	require.Nil(t, client.SetAdaptiveConcurrency(&AdaptiveConcurrency{MinLimit: 1, MaxLimit: 4}))
+	var events []ConcurrencyLimitEvent
+	client.SetStatsHook(func(event interface{}) {
+		if limitEvent, ok := event.(ConcurrencyLimitEvent); ok {
+			events = append(events, limitEvent)
+		}
+	})
+
+	// unavailable server: the limit falls to the minimum
+	for i := 0; i < 3; i++ {
+		client.GetInfoContext(context.Background())
+	}
+	limit, _ := client.GetConcurrencyLimit()
+	require.Equal(t, 1, limit)
+	require.Equal(t, []ConcurrencyLimitEvent{
+		{PreviousLimit: 4, NewLimit: 2, Failed: true},
+		{PreviousLimit: 2, NewLimit: 1, Failed: true},
+	}, clearLatencies(events))
+
+	done := make(chan struct{})
+	for i := 0; i < 5; i++ {
+		go func() {
+			client.GetInfoContext(context.Background())
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		<-done
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&maxInFlight))
+}
+
+// clearLatencies removes the latencies, which vary between runs, from the given events
+func clearLatencies(events []ConcurrencyLimitEvent) []ConcurrencyLimitEvent {
+	for i := range events {
+		events[i].Latency = 0
+	}
+	return events
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"errors"
+	"time"
+)
+
+// Config is the declarative configuration of a client, for applications reading it from a file or the environment, ie:
+// as JSON or YAML. NewFromConfig creates a client from it. Zero values keep the defaults of CreateWithOptions
+type Config struct {
+	// URL is the WM server endpoint, ie: "https://wm.internal:8443/wm", as given to CreateFromURL. If empty, Scheme, Host, Port
+	// and BaseURI are used
+	URL     string `json:"url,omitempty"`
+	Scheme  string `json:"scheme,omitempty"`
+	Host    string `json:"host,omitempty"`
+	Port    string `json:"port,omitempty"`
+	BaseURI string `json:"base_uri,omitempty"`
+
+	ConnTimeout     Duration `json:"conn_timeout,omitempty"`     // 10 seconds if 0
+	TransferTimeout Duration `json:"transfer_timeout,omitempty"` // 60 seconds if 0
+	MaxIdleTime     Duration `json:"max_idle_time,omitempty"`    // idle connections are kept open indefinitely if 0
+
+	UACacheSize     int `json:"ua_cache_size,omitempty"`     // the caches are disabled if 0
+	DeviceCacheSize int `json:"device_cache_size,omitempty"` // 20000 if 0 and the caches are enabled
+
+	RequestedCaps []string `json:"requested_caps,omitempty"` // static and virtual capabilities returned by lookups
+
+	TLS *TLSConfig `json:"tls,omitempty"` // if set, WM server is connected to using https
+
+	Proxy                string `json:"proxy,omitempty"`                  // proxy URL, see WithProxyURL
+	ProxyFromEnvironment bool   `json:"proxy_from_environment,omitempty"` // see WithProxyFromEnvironment
+
+	Retries int `json:"retries,omitempty"` // attempts after the first one of the requests failed, see RetryPolicy
+
+	Authorization string `json:"authorization,omitempty"` // value of the Authorization header sent to WM server, if not empty
+
+	LenientInfoValidation bool `json:"lenient_info_validation,omitempty"` // see InfoValidationLenient
+
+	RequireServerVersion string `json:"require_server_version,omitempty"` // see WithRequireServerVersion, ie: ">=2.1 <3"
+}
+
+// TLSConfig is the TLS configuration of a Config, referencing PEM files instead of holding the loaded certificates
+type TLSConfig struct {
+	CAFile             string `json:"ca_file,omitempty"`   // CA certificates trusted in addition to the system ones
+	CertFile           string `json:"cert_file,omitempty"` // client certificate, presented if set with KeyFile
+	KeyFile            string `json:"key_file,omitempty"`
+	ServerName         string `json:"server_name,omitempty"` // name verified in the server certificate, the host if empty
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+}
+
+// Duration is a time.Duration marshalled as text, ie: "1.5s", so that it can be written by hand in configuration files
+type Duration time.Duration
+
+// MarshalText returns the duration in the time.Duration String format
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText parses a duration in the format accepted by time.ParseDuration
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// NewFromConfig creates a client configured as described by the given configuration and checks that WM server can be
+// reached, as CreateWithOptions does. The given options are applied after the ones derived from the configuration
+func NewFromConfig(cfg Config, opts ...Option) (*WmClient, error) {
+	cfgOpts, err := cfg.options()
+	if err != nil {
+		return nil, err
+	}
+	return CreateWithOptions(append(cfgOpts, opts...)...)
+}
+
+// options returns the client options equivalent to the configuration
+func (cfg *Config) options() ([]Option, error) {
+	var opts []Option
+	if cfg.URL != "" {
+		if cfg.Scheme != "" || cfg.Host != "" || cfg.Port != "" || cfg.BaseURI != "" {
+			return nil, errors.New("invalid configuration: url cannot be used with scheme, host, port and base_uri")
+		}
+		serverOpts, err := serverURLOptions(cfg.URL)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, serverOpts...)
+	} else {
+		host, port := cfg.Host, cfg.Port
+		if host == "" {
+			host = "localhost"
+		}
+		if port == "" {
+			port = "8080"
+		}
+		opts = append(opts, WithServer(cfg.Scheme, host, port), WithBaseURI(cfg.BaseURI))
+	}
+
+	if cfg.ConnTimeout < 0 || cfg.TransferTimeout < 0 {
+		return nil, errors.New("invalid configuration: timeouts must not be negative")
+	}
+	opts = append(opts, WithHTTPTimeout(time.Duration(cfg.ConnTimeout), time.Duration(cfg.TransferTimeout)),
+		WithMaxIdleTime(time.Duration(cfg.MaxIdleTime)))
+	if cfg.UACacheSize < 0 || cfg.DeviceCacheSize < 0 {
+		return nil, errors.New("invalid configuration: cache sizes must not be negative")
+	}
+	if cfg.UACacheSize > 0 {
+		opts = append(opts, WithCacheSizes(cfg.UACacheSize, cfg.DeviceCacheSize))
+	}
+	if cfg.RequestedCaps != nil {
+		opts = append(opts, WithRequestedCapabilities(cfg.RequestedCaps...))
+	}
+	if cfg.TLS != nil {
+		opts = append(opts, cfg.TLS.options()...)
+	}
+	if cfg.Proxy != "" {
+		opts = append(opts, WithProxyURL(cfg.Proxy))
+	}
+	if cfg.ProxyFromEnvironment {
+		opts = append(opts, WithProxyFromEnvironment())
+	}
+	if cfg.Retries < 0 {
+		return nil, errors.New("invalid configuration: retries must not be negative")
+	}
+	if cfg.Retries > 0 {
+		opts = append(opts, WithRetryPolicy(&RetryPolicy{Retries: cfg.Retries}))
+	}
+	if cfg.Authorization != "" {
+		opts = append(opts, WithAuth(cfg.Authorization))
+	}
+	if cfg.LenientInfoValidation {
+		opts = append(opts, WithInfoValidation(InfoValidationLenient))
+	}
+	if cfg.RequireServerVersion != "" {
+		opts = append(opts, WithRequireServerVersion(cfg.RequireServerVersion))
+	}
+	return opts, nil
+}
+
+// options returns the TLS options equivalent to the configuration
+func (t *TLSConfig) options() []Option {
+	opts := []Option{WithTLS(nil)}
+	if t.CAFile != "" {
+		opts = append(opts, WithCAFile(t.CAFile))
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		opts = append(opts, WithClientCertificate(t.CertFile, t.KeyFile))
+	}
+	if t.ServerName != "" {
+		opts = append(opts, WithServerName(t.ServerName))
+	}
+	if t.InsecureSkipVerify {
+		opts = append(opts, WithInsecureSkipVerify())
+	}
+	return opts
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigJSON(t *testing.T) {
+	data := []byte(`{
+		"url": "https://wm.internal:8443/wm",
+		"conn_timeout": "1.5s",
+		"transfer_timeout": "10s",
+		"ua_cache_size": 100000,
+		"requested_caps": ["brand_name", "form_factor"],
+		"tls": {"ca_file": "/etc/wm/ca.pem"},
+		"retries": 2
+	}`)
+	var cfg Config
+	require.Nil(t, json.Unmarshal(data, &cfg))
+	require.Equal(t, Config{URL: "https://wm.internal:8443/wm", ConnTimeout: Duration(1500 * time.Millisecond),
+		TransferTimeout: Duration(10 * time.Second), UACacheSize: 100000, RequestedCaps: []string{"brand_name", "form_factor"},
+		TLS: &TLSConfig{CAFile: "/etc/wm/ca.pem"}, Retries: 2}, cfg)
+
+	marshalled, err := json.Marshal(cfg)
+	require.Nil(t, err)
+	var roundTrip Config
+	require.Nil(t, json.Unmarshal(marshalled, &roundTrip))
+	require.Equal(t, cfg, roundTrip)
+
+	require.NotNil(t, json.Unmarshal([]byte(`{"conn_timeout": "10"}`), &cfg))
+}
+
+func TestConfigOptions(t *testing.T) {
+	cfg := Config{Host: "wm.internal", BaseURI: "wm", UACacheSize: 10, Retries: 1, LenientInfoValidation: true,
+		Proxy: "http://proxy.internal:3128", ProxyFromEnvironment: true}
+	opts, err := cfg.options()
+	require.Nil(t, err)
+	options := clientOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	require.Equal(t, "wm.internal", options.host)
+	require.Equal(t, "8080", options.port)
+	require.Equal(t, "wm", options.baseURI)
+	require.Equal(t, 10, options.cacheSize)
+	require.Equal(t, 1, options.retryPolicy.Retries)
+	require.Equal(t, InfoValidationLenient, options.infoValidation)
+	require.Equal(t, "proxy.internal:3128", options.proxyURL.Host)
+	require.True(t, options.proxyEnv)
+
+	invalid := []Config{
+		{URL: "https://wm.internal", Host: "wm.internal"},
+		{URL: "ftp://wm.internal"},
+		{ConnTimeout: Duration(-time.Second)},
+		{UACacheSize: -1},
+		{Retries: -1},
+		{TLS: &TLSConfig{CAFile: "missing.pem"}},
+		{TLS: &TLSConfig{CertFile: "missing.pem"}},
+		{Proxy: "proxy.internal:3128"},
+	}
+	for _, cfg := range invalid {
+		// errors are found either converting the configuration or applying the options
+		opts, err := cfg.options()
+		if err == nil {
+			options := clientOptions{}
+			for _, opt := range opts {
+				opt(&options)
+			}
+			err = options.err
+		}
+		require.NotNil(t, err, "%+v", cfg)
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	var lookups int32
+	server := httptest.NewTLSServer(newOptionsTestHandler("Bearer token", &lookups))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "wmclient")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.Nil(t, ioutil.WriteFile(caFile, caPEM, 0600))
+
+	cfg := Config{URL: server.URL, TLS: &TLSConfig{CAFile: caFile}}
+	_, err = NewFromConfig(cfg)
+	require.NotNil(t, err)
+
+	cfg.Authorization = "Bearer token"
+	cfg.ConnTimeout = Duration(time.Second)
+	cfg.UACacheSize = 100
+	cfg.DeviceCacheSize = 50
+	cfg.RequestedCaps = []string{"brand_name"}
+	cfg.Retries = 1
+	client, err := NewFromConfig(cfg)
+	require.Nil(t, err)
+	defer client.Close()
+	require.Equal(t, "https", client.scheme)
+	require.Equal(t, time.Second, client.connTimeout)
+	require.Equal(t, 100, client.userAgentCache.MaxEntries)
+	require.Equal(t, 50, client.deviceCache.MaxEntries)
+	require.Equal(t, []string{"brand_name"}, client.requestedStaticCaps)
+	require.Equal(t, 1, client.retryPolicy.Retries)
+
+	for i := 0; i < 2; i++ {
+		device, err := client.LookupUserAgent(context.Background(), "ua")
+		require.Nil(t, err)
+		require.Equal(t, "value", device.Capabilities["brand_name"])
+	}
+	require.Equal(t, int32(1), lookups)
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// LoadConfig reads the client configuration from the given YAML or JSON file, whose keys are the JSON names of the Config
+// fields, ie:
+//
+//	url: https://wm.internal:8443/wm
+//	transfer_timeout: 10s
+//	ua_cache_size: 100000
+//	requested_caps: [brand_name, form_factor]
+//	tls:
+//	  ca_file: /etc/wm/ca.pem
+//	retries: 2
+//
+// Files with the .json extension are read as JSON, those with the .yaml or .yml extensions as YAML. The format of other
+// files is detected from their content. Unknown keys are reported as errors, so that typos are not silently ignored.
+// The configuration is validated when the client is created with NewFromConfig
+func LoadConfig(path string) (Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	var cfg Config
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = decodeJSONConfig(data, &cfg)
+	case ".yaml", ".yml":
+		err = decodeYAMLConfig(data, &cfg)
+	default:
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+			err = decodeJSONConfig(data, &cfg)
+		} else {
+			err = decodeYAMLConfig(data, &cfg)
+		}
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// decodeJSONConfig decodes the given JSON configuration, rejecting unknown keys
+func decodeJSONConfig(data []byte, cfg *Config) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("unexpected data after the configuration")
+	}
+	return nil
+}
+
+// decodeYAMLConfig decodes the given YAML configuration: the parsed document is converted to the JSON representation of
+// Config, following its field types, so that YAML and JSON files are decoded in the same way
+func decodeYAMLConfig(data []byte, cfg *Config) error {
+	document, err := parseYAML(data)
+	if err != nil {
+		return err
+	}
+	value, err := yamlToJSON(document, reflect.TypeOf(cfg).Elem(), "")
+	if err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return decodeJSONConfig(encoded, cfg)
+}
+
+// textUnmarshalerType is the type of encoding.TextUnmarshaler, implemented by types decoded from strings, ie: Duration
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// yamlToJSON converts the given parsed YAML value to the JSON value of the given type. Scalars are resolved according to the
+// type, ie: a port written as 8080 is a string. The key is the path of the value in the document, used in errors
+func yamlToJSON(value interface{}, t reflect.Type, key string) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		scalar, err := yamlScalarValue(value, key)
+		return scalar.value, err
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return yamlToJSON(value, t.Elem(), key)
+	case reflect.String:
+		scalar, err := yamlScalarValue(value, key)
+		return scalar.value, err
+	case reflect.Bool:
+		scalar, err := yamlScalarValue(value, key)
+		if err != nil {
+			return nil, err
+		}
+		switch scalar.value {
+		case "true", "True", "TRUE":
+			return true, nil
+		case "false", "False", "FALSE":
+			return false, nil
+		}
+		return nil, fmt.Errorf("%s: invalid boolean %q", key, scalar.value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64:
+		scalar, err := yamlScalarValue(value, key)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := strconv.ParseFloat(scalar.value, 64); err != nil {
+			return nil, fmt.Errorf("%s: invalid number %q", key, scalar.value)
+		}
+		return json.Number(scalar.value), nil
+	case reflect.Slice:
+		sequence, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: a sequence was expected", key)
+		}
+		values := make([]interface{}, 0, len(sequence))
+		for i, item := range sequence {
+			converted, err := yamlToJSON(item, t.Elem(), fmt.Sprintf("%s[%d]", key, i))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, converted)
+		}
+		return values, nil
+	case reflect.Struct:
+		mapping, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: a mapping was expected", key)
+		}
+		fields := jsonFields(t)
+		values := make(map[string]interface{}, len(mapping))
+		for name, item := range mapping {
+			field, ok := fields[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown key %s", joinYAMLKey(key, name))
+			}
+			converted, err := yamlToJSON(item, field.Type, joinYAMLKey(key, name))
+			if err != nil {
+				return nil, err
+			}
+			values[name] = converted
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported type %s", key, t)
+}
+
+// yamlScalarValue returns the given value, which must be a scalar
+func yamlScalarValue(value interface{}, key string) (yamlScalar, error) {
+	scalar, ok := value.(yamlScalar)
+	if !ok {
+		return yamlScalar{}, fmt.Errorf("%s: a scalar was expected", key)
+	}
+	return scalar, nil
+}
+
+// jsonFields returns the exported fields of the given struct type by JSON name
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+func joinYAMLKey(parent string, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeConfigFile writes the given content to a file with the given name in dir, returning its path
+func writeConfigFile(t *testing.T, dir string, name string, content string) string {
+	path := filepath.Join(dir, name)
+	require.Nil(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wmclient")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	expected := Config{Host: "wm.internal", Port: "8080", BaseURI: "wm", ConnTimeout: Duration(time.Second),
+		TransferTimeout: Duration(1500 * time.Millisecond), UACacheSize: 100000, DeviceCacheSize: 20000,
+		RequestedCaps: []string{"brand_name", "form_factor"}, TLS: &TLSConfig{CAFile: "/etc/wm/ca.pem", InsecureSkipVerify: false},
+		Retries: 2, LenientInfoValidation: true}
+
+	yamlConfig := `# WM client configuration
+host: wm.internal
+port: 8080
+base_uri: wm
+conn_timeout: 1s
+transfer_timeout: 1.5s
+ua_cache_size: 100000
+device_cache_size: 20000
+requested_caps:
+  - brand_name
+  - form_factor
+tls:
+  ca_file: /etc/wm/ca.pem
+  insecure_skip_verify: false
+retries: 2
+lenient_info_validation: true
+`
+	jsonConfig := `{"host": "wm.internal", "port": "8080", "base_uri": "wm", "conn_timeout": "1s", "transfer_timeout": "1.5s",
+		"ua_cache_size": 100000, "device_cache_size": 20000, "requested_caps": ["brand_name", "form_factor"],
+		"tls": {"ca_file": "/etc/wm/ca.pem", "insecure_skip_verify": false}, "retries": 2, "lenient_info_validation": true}`
+
+	for name, content := range map[string]string{"wm.yaml": yamlConfig, "wm.yml": yamlConfig, "wm.json": jsonConfig,
+		"wm-yaml.conf": yamlConfig, "wm-json.conf": jsonConfig} {
+		cfg, err := LoadConfig(writeConfigFile(t, dir, name, content))
+		require.Nil(t, err, name)
+		require.Equal(t, expected, cfg, name)
+	}
+
+	cfg, err := LoadConfig(writeConfigFile(t, dir, "flow.yaml", "url: https://wm.internal/wm\nrequested_caps: [brand_name]\n"))
+	require.Nil(t, err)
+	require.Equal(t, Config{URL: "https://wm.internal/wm", RequestedCaps: []string{"brand_name"}}, cfg)
+
+	cfg, err = LoadConfig(writeConfigFile(t, dir, "empty.yaml", "# nothing configured\n"))
+	require.Nil(t, err)
+	require.Equal(t, Config{}, cfg)
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wmclient")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = LoadConfig(filepath.Join(dir, "missing.yaml"))
+	require.True(t, os.IsNotExist(err))
+
+	invalid := map[string]string{
+		"unknown.yaml":      "hots: wm.internal\n",
+		"unknown-tls.yaml":  "tls:\n  ca: /etc/wm/ca.pem\n",
+		"number.yaml":       "ua_cache_size: many\n",
+		"bool.yaml":         "lenient_info_validation: yes\n",
+		"duration.yaml":     "conn_timeout: 10\n",
+		"scalar.yaml":       "requested_caps: brand_name\n",
+		"mapping.yaml":      "tls: /etc/wm/ca.pem\n",
+		"syntax.yaml":       "host: wm\n  port: 8080\n",
+		"unknown.json":      `{"hots": "wm.internal"}`,
+		"trailing.json":     `{"host": "wm.internal"} {}`,
+		"syntax.json":       `{"host": "wm.internal"`,
+		"type.json":         `{"retries": "2"}`,
+		"not-a-config.yaml": "- host\n",
+	}
+	for name, content := range invalid {
+		_, err := LoadConfig(writeConfigFile(t, dir, name, content))
+		require.NotNil(t, err, name)
+		require.Contains(t, err.Error(), name)
+	}
+}
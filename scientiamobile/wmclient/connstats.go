@@ -0,0 +1,147 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+)
+
+// ConnectionStats holds the statistics of the connections to WM server, useful to correlate latency with connection churn.
+// They are sampled from the default transport only: connections of a custom transport (ie: HTTP/3) are not tracked
+type ConnectionStats struct {
+	Open            int     // connections currently open
+	Idle            int     // open connections that are not serving a request
+	Created         uint64  // connections opened since the client creation
+	Closed          uint64  // connections closed since the client creation
+	Requests        uint64  // requests sent on the tracked connections
+	RequestsPerConn float64 // average number of requests served by each created connection, 0 if no connection has been created
+}
+
+// connTracker keeps track of the connections opened by the default transport
+type connTracker struct {
+	mutex    sync.Mutex
+	conns    map[string]*trackedConn // open connections, by local address
+	created  uint64
+	closed   uint64
+	requests uint64
+}
+
+// trackedConn is a connection that notifies its tracker when it is closed
+type trackedConn struct {
+	net.Conn
+	tracker   *connTracker
+	key       string
+	active    int // requests in progress on the connection, protected by the tracker mutex
+	closeOnce sync.Once
+}
+
+func (tc *trackedConn) Close() error {
+	tc.closeOnce.Do(func() {
+		tc.tracker.mutex.Lock()
+		if tc.tracker.conns[tc.key] == tc {
+			delete(tc.tracker.conns, tc.key)
+		}
+		tc.tracker.closed++
+		tc.tracker.mutex.Unlock()
+	})
+	return tc.Conn.Close()
+}
+
+// GetConnectionStats returns a snapshot of the statistics of the connections to WM server
+func (c *WmClient) GetConnectionStats() ConnectionStats {
+	if c == nil {
+		return ConnectionStats{}
+	}
+	if c.conns == nil {
+		return ConnectionStats{}
+	}
+	return c.conns.stats()
+}
+
+// trackConnections makes the default transport of the client http client report its connections to the client tracker
+func (c *WmClient) trackConnections() {
+	transport, ok := c.httpClient.Transport.(*http.Transport)
+	if !ok || transport.Dial == nil {
+		return
+	}
+	if c.conns == nil {
+		c.conns = &connTracker{conns: make(map[string]*trackedConn)}
+	}
+
+	dial := transport.Dial
+	tracker := c.conns
+	transport.Dial = func(network string, address string) (net.Conn, error) {
+		conn, err := dial(network, address)
+		if err != nil {
+			return nil, err
+		}
+		return tracker.add(conn), nil
+	}
+}
+
+func (t *connTracker) add(conn net.Conn) *trackedConn {
+	tc := &trackedConn{Conn: conn, tracker: t, key: conn.LocalAddr().String()}
+	t.mutex.Lock()
+	t.conns[tc.key] = tc
+	t.created++
+	t.mutex.Unlock()
+	return tc
+}
+
+// trace returns a client trace that marks the connection used by a request as active, and a function to call when the
+// request has completed to mark it idle again
+func (t *connTracker) trace() (*httptrace.ClientTrace, func()) {
+	var used *trackedConn
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			// the connection is found by its local address, since the transport may have wrapped it (ie: in a TLS connection)
+			if tc, ok := t.conns[info.Conn.LocalAddr().String()]; ok {
+				tc.active++
+				t.requests++
+				used = tc
+			}
+		},
+	}
+	done := func() {
+		t.mutex.Lock()
+		if used != nil {
+			used.active--
+		}
+		t.mutex.Unlock()
+	}
+	return trace, done
+}
+
+func (t *connTracker) stats() ConnectionStats {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	stats := ConnectionStats{Open: len(t.conns), Created: t.created, Closed: t.closed, Requests: t.requests}
+	for _, tc := range t.conns {
+		if tc.active == 0 {
+			stats.Idle++
+		}
+	}
+	if t.created > 0 {
+		stats.RequestsPerConn = float64(t.requests) / float64(t.created)
+	}
+	return stats
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, server)
+	require.Equal(t, ConnectionStats{}, client.GetConnectionStats())
+	client.trackConnections()
+
+	for i := 0; i < 3; i++ {
+		_, _, err := client.sendRequest(context.Background(), "GET", "/v2/getinfo/json", nil, FormatJSON)
+		require.Nil(t, err)
+	}
+
+	// requests are sequential, so the same connection is reused
+	stats := client.GetConnectionStats()
+	require.Equal(t, 1, stats.Open)
+	require.Equal(t, 1, stats.Idle)
+	require.Equal(t, uint64(1), stats.Created)
+	require.Equal(t, uint64(0), stats.Closed)
+	require.Equal(t, uint64(3), stats.Requests)
+	require.Equal(t, 3.0, stats.RequestsPerConn)
+
+	client.httpClient.Transport.(*http.Transport).CloseIdleConnections()
+	stats = client.GetConnectionStats()
+	require.Equal(t, 0, stats.Open)
+	require.Equal(t, uint64(1), stats.Closed)
+}
@@ -0,0 +1,192 @@
+//go:build !wmclient_lite
+// +build !wmclient_lite
+
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultDeviceCookieName is the name of the cookie written by DeviceCookie, if not configured
+const DefaultDeviceCookieName = "wm_device"
+
+// DeviceCookie stores a small, signed, subset of the capabilities of the device detected for a web request in a cookie, so
+// that the following requests of the same browser are served without a lookup, not even a cached one. A cookie is reused
+// only if its signature is valid, it has not expired, it has been written for the same important headers (ie: the browser
+// has not been updated) and WM server has not loaded a new WURFL file since it has been written.
+// Capabilities are visible to the browser: only the ones needed by the web backend should be stored, keeping the cookie small.
+// A DeviceCookie is safe for concurrent use, its fields must not be changed after its first use
+type DeviceCookie struct {
+	Name   string        // cookie name, DefaultDeviceCookieName if empty
+	MaxAge time.Duration // cookie lifetime, 24 hours if 0
+	Path   string        // cookie path, "/" if empty
+	Domain string        // cookie domain, the request host if empty
+	Secure bool          // if true, the cookie is sent over HTTPS only
+	// OptOut returns true for the requests whose device must not be stored in a cookie, ie: of users that did not consent to
+	// it. Those requests are always detected with a lookup, and a cookie they may hold is deleted. Nil to never opt out
+	OptOut func(request *http.Request) bool
+
+	client       *WmClient
+	key          []byte
+	capabilities []string
+}
+
+// deviceCookiePayload is the signed content of the cookie
+type deviceCookiePayload struct {
+	DeviceID     string            `json:"i"`
+	Capabilities map[string]string `json:"c"`
+	Ltime        string            `json:"l"`
+	HeadersKey   string            `json:"h"` // key of the important headers of the request, as in the UA cache
+	Expires      int64             `json:"e"` // unix time
+}
+
+// NewDeviceCookie returns a helper that stores the given capabilities in cookies signed with the given key, which must be kept
+// secret and shared among the web backend instances. Capabilities must be requested by the client, the others are not stored
+func (c *WmClient) NewDeviceCookie(key []byte, capNames []string) (*DeviceCookie, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	if len(key) < 16 {
+		return nil, errors.New("device cookie key must be at least 16 bytes long")
+	}
+	return &DeviceCookie{client: c, key: key, capabilities: capNames}, nil
+}
+
+// Lookup returns the device stored in the request cookie, if it is valid, or detects it with LookupRequestContext and writes
+// it in a new cookie of the response, which must not have been written yet. Devices read from the cookie hold the stored
+// capabilities, wurfl_id and ltime only
+func (dc *DeviceCookie) Lookup(w http.ResponseWriter, request *http.Request) (*JSONDeviceData, error) {
+	if dc.OptOut != nil && dc.OptOut(request) {
+		if _, err := request.Cookie(dc.name()); err == nil {
+			http.SetCookie(w, dc.cookie("", -1))
+		}
+		return dc.client.LookupRequestContext(request.Context(), request)
+	}
+
+	headersKey := dc.headersKey(request)
+	if cookie, err := request.Cookie(dc.name()); err == nil {
+		if device, ok := dc.read(cookie.Value, headersKey); ok {
+			return device, nil
+		}
+	}
+
+	device, err := dc.client.LookupRequestContext(request.Context(), request)
+	if err != nil {
+		return nil, err
+	}
+	if value, err := dc.write(device, headersKey); err == nil {
+		http.SetCookie(w, dc.cookie(value, int(dc.maxAge()/time.Second)))
+	}
+	return device, nil
+}
+
+func (dc *DeviceCookie) name() string {
+	if dc.Name == "" {
+		return DefaultDeviceCookieName
+	}
+	return dc.Name
+}
+
+func (dc *DeviceCookie) maxAge() time.Duration {
+	if dc.MaxAge <= 0 {
+		return 24 * time.Hour
+	}
+	return dc.MaxAge
+}
+
+// cookie returns the cookie with the given value and max age, a negative max age deletes it
+func (dc *DeviceCookie) cookie(value string, maxAge int) *http.Cookie {
+	path := dc.Path
+	if path == "" {
+		path = "/"
+	}
+	return &http.Cookie{Name: dc.name(), Value: value, Path: path, Domain: dc.Domain, MaxAge: maxAge, Secure: dc.Secure,
+		HttpOnly: true, SameSite: http.SameSiteLaxMode}
+}
+
+// headersKey returns the key of the important headers of the given request
+func (dc *DeviceCookie) headersKey(request *http.Request) string {
+	headers := make(map[string]string, len(dc.client.ImportantHeaders))
+	for _, name := range dc.client.ImportantHeaders {
+		headers[name] = request.Header.Get(name)
+	}
+	return dc.client.getUserAgentCacheKey(headers)
+}
+
+// write returns the signed cookie value holding the given device
+func (dc *DeviceCookie) write(device *JSONDeviceData, headersKey string) (string, error) {
+	payload := deviceCookiePayload{
+		DeviceID:     deviceID(device),
+		Capabilities: make(map[string]string, len(dc.capabilities)),
+		Ltime:        device.Ltime,
+		HeadersKey:   headersKey,
+		Expires:      now().Add(dc.maxAge()).Unix(),
+	}
+	for _, name := range dc.capabilities {
+		if value, ok := device.Capabilities[name]; ok {
+			payload.Capabilities[name] = value
+		}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(dc.sign(encoded)), nil
+}
+
+// read returns the device held by the given cookie value, and false if the value is not valid for the request
+func (dc *DeviceCookie) read(value string, headersKey string) (*JSONDeviceData, bool) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 {
+		return nil, false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, dc.sign(parts[0])) {
+		return nil, false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, false
+	}
+	payload := deviceCookiePayload{}
+	if err = json.Unmarshal(data, &payload); err != nil {
+		return nil, false
+	}
+
+	dc.client.ltimeMutex.Lock()
+	ltime := dc.client.clientLtime
+	dc.client.ltimeMutex.Unlock()
+	if payload.HeadersKey != headersKey || payload.Ltime == "" || payload.Ltime != ltime || now().Unix() >= payload.Expires {
+		return nil, false
+	}
+	return &JSONDeviceData{DeviceID: payload.DeviceID, Capabilities: payload.Capabilities, Ltime: payload.Ltime}, true
+}
+
+func (dc *DeviceCookie) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, dc.key)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,107 @@
+//go:build !wmclient_lite
+// +build !wmclient_lite
+
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceCookie(t *testing.T) {
+	lookups := 0
+	ltime := "2024-01-01 00:00:00"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		json.NewEncoder(w).Encode(JSONDeviceData{Ltime: ltime,
+			Capabilities: map[string]string{"wurfl_id": "generic_android", "is_smartphone": "true", "brand_name": "Generic"}})
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.ImportantHeaders = []string{userAgentHeader}
+
+	_, err := client.NewDeviceCookie([]byte("short"), nil)
+	require.NotNil(t, err)
+	deviceCookie, err := client.NewDeviceCookie([]byte("0123456789abcdef0123456789abcdef"), []string{"is_smartphone"})
+	require.Nil(t, err)
+
+	// lookup returns the device of the given request, using the given cookie, and the cookie written in the response
+	lookup := func(userAgent string, cookie *http.Cookie) (*JSONDeviceData, *http.Cookie) {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set(userAgentHeader, userAgent)
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		device, err := deviceCookie.Lookup(recorder, request)
+		require.Nil(t, err)
+		cookies := recorder.Result().Cookies()
+		if len(cookies) == 0 {
+			return device, nil
+		}
+		return device, cookies[0]
+	}
+
+	device, cookie := lookup("ua", nil)
+	require.Equal(t, 1, lookups)
+	require.NotNil(t, cookie)
+	require.Equal(t, DefaultDeviceCookieName, cookie.Name)
+	require.True(t, cookie.HttpOnly)
+	require.Equal(t, "Generic", device.Capabilities["brand_name"])
+
+	// the device is read from the cookie, with the stored capabilities only
+	device, written := lookup("ua", cookie)
+	require.Equal(t, 1, lookups)
+	require.Nil(t, written)
+	require.Equal(t, "generic_android", device.DeviceID)
+	require.Equal(t, map[string]string{"is_smartphone": "true"}, device.Capabilities)
+
+	// the cookie is not reused for other headers, or if tampered with
+	lookup("other ua", cookie)
+	require.Equal(t, 2, lookups)
+	tampered := *cookie
+	tampered.Value = "x" + cookie.Value
+	lookup("ua", &tampered)
+	require.Equal(t, 3, lookups)
+
+	// nor after WM server loads a new WURFL file
+	ltime = "2024-02-01 00:00:00"
+	lookup("other ua", nil)
+	require.Equal(t, 4, lookups)
+	_, cookie = lookup("ua", cookie)
+	require.Equal(t, 5, lookups)
+	lookup("ua", cookie)
+	require.Equal(t, 5, lookups)
+
+	// nor after it expires
+	now = func() time.Time { return time.Now().Add(25 * time.Hour) }
+	lookup("ua", cookie)
+	now = time.Now
+	require.Equal(t, 6, lookups)
+
+	// opted out requests are always looked up and their cookie is deleted
+	deviceCookie.OptOut = func(request *http.Request) bool { return true }
+	_, deleted := lookup("ua", cookie)
+	require.Equal(t, 7, lookups)
+	require.True(t, deleted.MaxAge < 0)
+}
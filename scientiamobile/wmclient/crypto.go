@@ -0,0 +1,62 @@
+//go:build !wmclient_lite
+// +build !wmclient_lite
+
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The functions in this file use the crypto packages, so they are not compiled in lite builds, see lite.go
+
+// TimestampSigningDecorator returns a decorator that sets the current unix time in the given timestamp header and the
+// hex encoded HMAC-SHA256, computed with the given secret, of timestamp + method + path in the given signature header
+func TimestampSigningDecorator(timestampHeader string, signatureHeader string, secret []byte) RequestDecorator {
+	return func(request *http.Request) error {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(timestamp + request.Method + request.URL.Path))
+
+		request.Header.Set(timestampHeader, timestamp)
+		request.Header.Set(signatureHeader, hex.EncodeToString(mac.Sum(nil)))
+		return nil
+	}
+}
+
+// SHA256IdempotencyKey is the default IdempotencyKeyFunc: the hex encoded SHA-256 of method + path + body
+func SHA256IdempotencyKey(method string, path string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + path))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// defaultIdempotencyKey is the key function used by IdempotencyKeyDecorator when none is given
+var defaultIdempotencyKey IdempotencyKeyFunc = SHA256IdempotencyKey
+
+// hashKey returns the hex encoded MD5 of the given key, used as the key of the UA cache entries
+func hashKey(key string) string {
+	md5Sum := md5.Sum([]byte(key))
+	return hex.EncodeToString(md5Sum[:])
+}
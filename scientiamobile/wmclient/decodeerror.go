@@ -0,0 +1,116 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxSnippetSize is the maximum number of payload bytes kept in a DecodeError
+const maxSnippetSize = 256
+
+// DecodeError is returned when a WM server response cannot be decoded, ie: when a proxy replies with an HTML error page or
+// the body is truncated. It holds what is needed to find the cause from the logs alone: the response status and content type,
+// and the beginning of the payload, sanitized so that it can be logged safely
+type DecodeError struct {
+	Path        string // path of the WM server endpoint
+	StatusCode  int    // HTTP status of the response
+	ContentType string // Content-Type header of the response, empty if not set
+	Size        int    // size of the payload, in bytes. 0 for streamed responses, which are not read in full
+	Snippet     string // beginning of the payload, or for streamed responses the data following the decoding failure, at most 256 bytes, with control and invalid characters replaced
+	Err         error  // error returned by the decoder
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("cannot decode WM server %s response (status %d, content type %q, %d bytes): %v; payload: %q",
+		e.Path, e.StatusCode, e.ContentType, e.Size, e.Err, e.Snippet)
+}
+
+// Unwrap returns the error returned by the decoder, ie: a *json.SyntaxError
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeErrorEvent is sent to the stats hook every time a WM server response cannot be decoded
+type DecodeErrorEvent struct {
+	Err *DecodeError
+}
+
+// newDecodeError returns the error for the given response, whose payload could not be decoded, and reports it to the stats hook
+func (c *WmClient) newDecodeError(res *http.Response, payload []byte, size int, err error) *DecodeError {
+	decodeErr := &DecodeError{
+		StatusCode:  res.StatusCode,
+		ContentType: res.Header.Get("Content-Type"),
+		Size:        size,
+		Snippet:     payloadSnippet(payload),
+		Err:         err,
+	}
+	if res.Request != nil && res.Request.URL != nil {
+		decodeErr.Path = res.Request.URL.Path
+	}
+	c.emitStats(DecodeErrorEvent{Err: decodeErr})
+	return decodeErr
+}
+
+// payloadSnippet returns the first bytes of the given payload as a single line of printable text: whitespace sequences are
+// replaced by a space, leading and trailing ones are removed, other control characters and invalid UTF-8 sequences by '.'. Truncated payloads end with "..."
+func payloadSnippet(payload []byte) string {
+	truncated := len(payload) > maxSnippetSize
+	if truncated {
+		payload = payload[:maxSnippetSize]
+	}
+	var snippet strings.Builder
+	space := false
+	for len(payload) > 0 {
+		r, size := utf8.DecodeRune(payload)
+		if r == utf8.RuneError && size == 1 {
+			if truncated && !utf8.FullRune(payload) {
+				// rune cut by the truncation
+				break
+			}
+			r = '.'
+		}
+		payload = payload[size:]
+		if unicode.IsSpace(r) {
+			if !space {
+				snippet.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		space = false
+		if !unicode.IsPrint(r) {
+			r = '.'
+		}
+		snippet.WriteRune(r)
+	}
+	if truncated {
+		snippet.WriteString("...")
+	}
+	return strings.TrimSpace(snippet.String())
+}
+
+// bufferedSnippet returns at most maxSnippetSize bytes of the given buffered data, as returned by json.Decoder.Buffered
+func bufferedSnippet(buffered io.Reader) []byte {
+	data, _ := ioutil.ReadAll(io.LimitReader(buffered, maxSnippetSize+1))
+	return data
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayloadSnippet(t *testing.T) {
+	require.Equal(t, "", payloadSnippet(nil))
+	require.Equal(t, `{"error":"x"}`, payloadSnippet([]byte(`{"error":"x"}`)))
+	require.Equal(t, "<html> <body>Bad Gateway</body> </html>", payloadSnippet([]byte("<html>\r\n  <body>Bad Gateway</body>\n</html>\n")))
+	require.Equal(t, "a.b.c..", payloadSnippet([]byte("a\x00b\xffc\xe2\x82")))
+	require.Equal(t, "èé", payloadSnippet([]byte("èé")))
+
+	long := strings.Repeat("x", maxSnippetSize+100)
+	require.Equal(t, long[:maxSnippetSize]+"...", payloadSnippet([]byte(long)))
+	// a rune cut by the truncation is dropped
+	cut := strings.Repeat("x", maxSnippetSize-1) + "é"
+	require.Equal(t, cut[:maxSnippetSize-1]+"...", payloadSnippet([]byte(cut+"x")))
+}
+
+// newDecodeErrorTestHandler returns a WM server handler replying to all the requests with the given payload
+func newDecodeErrorTestHandler(contentType string, payload string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(payload))
+	})
+}
+
+func TestDecodeError(t *testing.T) {
+	page := "<html>\n<head><title>502 Bad Gateway</title></head>\n<body>nginx</body>\n</html>\n"
+	server := httptest.NewServer(newDecodeErrorTestHandler("text/html", page))
+	defer server.Close()
+	client := newTestClient(t, server)
+	var events []DecodeErrorEvent
+	client.SetStatsHook(func(event interface{}) {
+		if e, ok := event.(DecodeErrorEvent); ok {
+			events = append(events, e)
+		}
+	})
+
+	_, err := client.LookupUserAgent(context.Background(), "ua")
+	var decodeErr *DecodeError
+	require.True(t, errors.As(err, &decodeErr))
+	require.Equal(t, lookupUserAgentPath, decodeErr.Path)
+	require.Equal(t, http.StatusOK, decodeErr.StatusCode)
+	require.Equal(t, "text/html", decodeErr.ContentType)
+	require.Equal(t, len(page), decodeErr.Size)
+	require.Equal(t, "<html> <head><title>502 Bad Gateway</title></head> <body>nginx</body> </html>", decodeErr.Snippet)
+	var syntaxErr *json.SyntaxError
+	require.True(t, errors.As(err, &syntaxErr))
+	require.Contains(t, err.Error(), `content type "text/html"`)
+	require.Contains(t, err.Error(), "502 Bad Gateway")
+	require.Len(t, events, 1)
+	require.Equal(t, decodeErr, events[0].Err)
+}
+
+func TestStreamDecodeError(t *testing.T) {
+	// a body truncated by a proxy
+	server := httptest.NewServer(newDecodeErrorTestHandler(FormatJSON, `[{"brand_name":"Apple","model_name":"iPhone"},{"brand_name":"Sams`))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	entries := 0
+	err := client.streamArray(context.Background(), "/v2/alldevices/json", func() interface{} { return &JSONMakeModel{} },
+		func(entry interface{}) bool {
+			entries++
+			return true
+		})
+	require.Equal(t, 1, entries)
+	var decodeErr *DecodeError
+	require.True(t, errors.As(err, &decodeErr))
+	require.Equal(t, "/v2/alldevices/json", decodeErr.Path)
+	require.Equal(t, FormatJSON, decodeErr.ContentType)
+	require.Equal(t, 0, decodeErr.Size)
+	require.Contains(t, decodeErr.Snippet, `"Sams`)
+
+	// errors not due to the payload are returned unchanged
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = client.streamArray(ctx, "/v2/alldevices/json", func() interface{} { return &JSONMakeModel{} },
+		func(entry interface{}) bool { return true })
+	require.False(t, errors.As(err, &decodeErr))
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"io/ioutil"
+	"net/http"
+)
+
+// IdempotencyKeyHeader is the header set by IdempotencyKeyDecorator
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// RequestDecorator modifies every request sent to the WM server (lookups, server info and enumeration loads) before it is sent,
+// ie: to add the authentication headers required by enterprise deployments. Returning an error aborts the request
+type RequestDecorator func(request *http.Request) error
+
+// SetRequestDecorator sets the decorator applied to all requests sent to WM server. A nil decorator disables decoration.
+// Use ChainDecorators to apply more than one decorator. This function should be called before performing any lookup
+func (c *WmClient) SetRequestDecorator(decorator RequestDecorator) {
+	if c == nil {
+		return
+	}
+	c.requestDecorator = decorator
+}
+
+// ChainDecorators returns a decorator that applies the given decorators in order, stopping at the first error
+func ChainDecorators(decorators ...RequestDecorator) RequestDecorator {
+	return func(request *http.Request) error {
+		for _, decorator := range decorators {
+			if err := decorator(request); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// HeadersDecorator returns a decorator that sets the given headers (ie: X-Tenant-Id) on every request
+func HeadersDecorator(headers map[string]string) RequestDecorator {
+	return func(request *http.Request) error {
+		for name, value := range headers {
+			request.Header.Set(name, value)
+		}
+		return nil
+	}
+}
+
+// IdempotencyKeyFunc computes the idempotency key of a request from its method, path and body
+type IdempotencyKeyFunc func(method string, path string, body []byte) string
+
+// IdempotencyKeyDecorator returns a decorator that sets the Idempotency-Key header, computed with the given function
+// (SHA256IdempotencyKey if nil, or a FNV-1a hash in lite builds), on requests with a body, ie: lookups. Since the key only
+// depends on the request payload, a replayed lookup has the same key as the original one and WM server, or an
+// intermediary, can deduplicate it
+func IdempotencyKeyDecorator(keyFunc IdempotencyKeyFunc) RequestDecorator {
+	if keyFunc == nil {
+		keyFunc = defaultIdempotencyKey
+	}
+	return func(request *http.Request) error {
+		if request.GetBody == nil {
+			return nil
+		}
+		// the body is read from a copy, so that the request one is left untouched
+		bodyReader, err := request.GetBody()
+		if err != nil {
+			return err
+		}
+		defer bodyReader.Close()
+		body, err := ioutil.ReadAll(bodyReader)
+		if err != nil {
+			return err
+		}
+		request.Header.Set(IdempotencyKeyHeader, keyFunc(request.Method, request.URL.Path, body))
+		return nil
+	}
+}
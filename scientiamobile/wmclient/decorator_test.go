@@ -0,0 +1,119 @@
+//go:build !wmclient_lite
+// +build !wmclient_lite
+
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainDecorators(t *testing.T) {
+	request, err := http.NewRequest("POST", "http://localhost:8080/v2/lookupuseragent/json", nil)
+	require.Nil(t, err)
+
+	secret := []byte("secret")
+	decorator := ChainDecorators(
+		HeadersDecorator(map[string]string{"X-Tenant-Id": "tenant-1"}),
+		TimestampSigningDecorator("X-Timestamp", "X-Signature", secret),
+	)
+	require.Nil(t, decorator(request))
+	require.Equal(t, "tenant-1", request.Header.Get("X-Tenant-Id"))
+
+	timestamp := request.Header.Get("X-Timestamp")
+	require.NotEmpty(t, timestamp)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "POST/v2/lookupuseragent/json"))
+	require.Equal(t, hex.EncodeToString(mac.Sum(nil)), request.Header.Get("X-Signature"))
+
+	// chain stops at first error
+	called := false
+	decorator = ChainDecorators(
+		func(r *http.Request) error { return errors.New("no credentials") },
+		func(r *http.Request) error { called = true; return nil },
+	)
+	require.EqualError(t, decorator(request), "no credentials")
+	require.False(t, called)
+}
+
+func TestRequestDecoratorIsAppliedToAllRequests(t *testing.T) {
+	client := createTestClient(t)
+
+	decorated := 0
+	client.SetRequestDecorator(func(r *http.Request) error {
+		decorated++
+		return nil
+	})
+	_, err := client.GetInfo()
+	require.Nil(t, err)
+	_, err = client.LookupUserAgent(context.Background(), "Mozilla/5.0")
+	require.Nil(t, err)
+	_, err = client.GetAllOSes()
+	require.Nil(t, err)
+	require.Equal(t, 3, decorated)
+
+	client.SetRequestDecorator(func(r *http.Request) error { return errors.New("decorator error") })
+	_, err = client.LookupDeviceID(context.Background(), "generic")
+	require.EqualError(t, err, "decorator error")
+	client.DestroyConnection()
+}
+
+func TestIdempotencyKeyDecorator(t *testing.T) {
+	newRequest := func(body string) *http.Request {
+		request, err := http.NewRequest("POST", "http://localhost:8080/v2/lookupuseragent/json", bytes.NewBufferString(body))
+		require.Nil(t, err)
+		return request
+	}
+
+	decorator := IdempotencyKeyDecorator(nil)
+	first := newRequest(`{"lookup_headers":{"User-Agent":"Mozilla/5.0"}}`)
+	require.Nil(t, decorator(first))
+	key := first.Header.Get(IdempotencyKeyHeader)
+	require.Equal(t, SHA256IdempotencyKey("POST", "/v2/lookupuseragent/json", []byte(`{"lookup_headers":{"User-Agent":"Mozilla/5.0"}}`)), key)
+
+	// the body is still readable
+	body, err := ioutil.ReadAll(first.Body)
+	require.Nil(t, err)
+	require.Equal(t, `{"lookup_headers":{"User-Agent":"Mozilla/5.0"}}`, string(body))
+
+	// a replayed request has the same key, a different payload has a different one
+	replayed := newRequest(`{"lookup_headers":{"User-Agent":"Mozilla/5.0"}}`)
+	require.Nil(t, decorator(replayed))
+	require.Equal(t, key, replayed.Header.Get(IdempotencyKeyHeader))
+	other := newRequest(`{"lookup_headers":{"User-Agent":"Opera"}}`)
+	require.Nil(t, decorator(other))
+	require.NotEqual(t, key, other.Header.Get(IdempotencyKeyHeader))
+
+	// custom key function, requests without body are left untouched
+	decorator = IdempotencyKeyDecorator(func(method string, path string, body []byte) string { return "custom" })
+	require.Nil(t, decorator(replayed))
+	require.Equal(t, "custom", replayed.Header.Get(IdempotencyKeyHeader))
+	get, err := http.NewRequest("GET", "http://localhost:8080/v2/getinfo/json", nil)
+	require.Nil(t, err)
+	require.Nil(t, decorator(get))
+	require.Empty(t, get.Header.Get(IdempotencyKeyHeader))
+}
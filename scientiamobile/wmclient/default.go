@@ -0,0 +1,120 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Environment variables read by Default, with their default values
+const (
+	EnvScheme       = "WM_SCHEME"       // http
+	EnvHost         = "WM_HOST"         // localhost
+	EnvPort         = "WM_PORT"         // 8080
+	EnvBaseURI      = "WM_BASE_URI"     // empty
+	EnvCacheSize    = "WM_CACHE_SIZE"   // 100000, 0 to disable the caches
+	EnvCapabilities = "WM_CAPABILITIES" // comma separated list of the requested capabilities, all of them if empty
+)
+
+const defaultClientCacheSize = 100000
+
+var (
+	defaultOnce   sync.Once
+	defaultClient *WmClient
+	defaultErr    error
+)
+
+// Default returns the package default client, which is created on first use from the environment variables listed by
+// the Env* constants. It is meant for small tools and scripts: services should create their clients with Create.
+// If the creation fails, ie: because WM server cannot be reached, the error is returned by every call
+func Default() (*WmClient, error) {
+	defaultOnce.Do(func() {
+		defaultClient, defaultErr = newClientFromEnv()
+	})
+	return defaultClient, defaultErr
+}
+
+// newClientFromEnv creates a client configured with the Env* environment variables
+func newClientFromEnv() (*WmClient, error) {
+	client, err := Create(getenv(EnvScheme, "http"), getenv(EnvHost, "localhost"), getenv(EnvPort, "8080"), os.Getenv(EnvBaseURI))
+	if err != nil {
+		return nil, err
+	}
+
+	cacheSize, err := strconv.Atoi(getenv(EnvCacheSize, strconv.Itoa(defaultClientCacheSize)))
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("invalid %s: %v", EnvCacheSize, err)
+	}
+	if cacheSize > 0 {
+		client.SetCacheSize(cacheSize)
+	}
+
+	if caps := os.Getenv(EnvCapabilities); caps != "" {
+		client.SetRequestedCapabilities(strings.Split(caps, ","))
+	}
+	return client, nil
+}
+
+// getenv returns the value of the given environment variable, or fallback if it is not set or empty
+func getenv(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// LookupUserAgent detects the device of the given user agent with the default client
+func LookupUserAgent(ctx context.Context, userAgent string, options ...LookupOption) (*JSONDeviceData, error) {
+	client, err := Default()
+	if err != nil {
+		return nil, err
+	}
+	return client.LookupUserAgent(ctx, userAgent, options...)
+}
+
+// LookupHeaders detects the device of the given request headers with the default client
+func LookupHeaders(ctx context.Context, headers map[string]string, options ...LookupOption) (*JSONDeviceData, error) {
+	client, err := Default()
+	if err != nil {
+		return nil, err
+	}
+	return client.LookupHeaders(ctx, headers, options...)
+}
+
+// LookupRequest detects the device of the given HTTP request with the default client, using the request context
+func LookupRequest(request *http.Request) (*JSONDeviceData, error) {
+	client, err := Default()
+	if err != nil {
+		return nil, err
+	}
+	return client.LookupRequestContext(request.Context(), request)
+}
+
+// LookupDeviceID returns the device data of the given wurfl_id with the default client
+func LookupDeviceID(ctx context.Context, deviceID string, options ...LookupOption) (*JSONDeviceData, error) {
+	client, err := Default()
+	if err != nil {
+		return nil, err
+	}
+	return client.LookupDeviceID(ctx, deviceID, options...)
+}
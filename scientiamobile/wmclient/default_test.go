@@ -0,0 +1,96 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// setenv sets the given environment variables, returning a function that restores them
+func setenv(variables map[string]string) func() {
+	previous := make(map[string]*string, len(variables))
+	for name, value := range variables {
+		if old, ok := os.LookupEnv(name); ok {
+			previous[name] = &old
+		} else {
+			previous[name] = nil
+		}
+		os.Setenv(name, value)
+	}
+	return func() {
+		for name, value := range previous {
+			if value == nil {
+				os.Unsetenv(name)
+			} else {
+				os.Setenv(name, *value)
+			}
+		}
+	}
+}
+
+func TestDefaultClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/wm/v2/getinfo/json" {
+			w.Write([]byte(`{"wm_version":"2.1.0","wurfl_api_version":"1.12","wurfl_info":"wurfl.zip",` +
+				`"important_headers":["User-Agent"],"static_caps":["brand_name","model_name"],"virtual_caps":["is_mobile"]}`))
+			return
+		}
+		request := Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Write([]byte(`{"capabilities":{"wurfl_id":"generic","brand_name":"Generic"}}`))
+	}))
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.Nil(t, err)
+	restore := setenv(map[string]string{EnvHost: host, EnvPort: port, EnvBaseURI: "wm", EnvCacheSize: "10",
+		EnvCapabilities: "brand_name,is_mobile,unknown"})
+	defer restore()
+
+	client, err := newClientFromEnv()
+	require.Nil(t, err)
+	defer client.Close()
+	require.Equal(t, []string{"brand_name"}, client.requestedStaticCaps)
+	require.Equal(t, []string{"is_mobile"}, client.requestedVirtualCaps)
+	_, uaCacheSize := client.GetActualCacheSizes()
+	require.Equal(t, 0, uaCacheSize)
+	require.Equal(t, 10, client.userAgentCache.MaxEntries)
+
+	// the default client is created once
+	first, err := Default()
+	require.Nil(t, err)
+	second, err := Default()
+	require.Nil(t, err)
+	require.True(t, first == second)
+
+	device, err := LookupUserAgent(context.Background(), "ua")
+	require.Nil(t, err)
+	require.Equal(t, "generic", device.DeviceID)
+	device, err = LookupDeviceID(context.Background(), "generic")
+	require.Nil(t, err)
+	require.Equal(t, "Generic", device.Capabilities["brand_name"])
+
+	os.Setenv(EnvCacheSize, "many")
+	_, err = newClientFromEnv()
+	require.NotNil(t, err)
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+// CapabilityDeprecationEvent is sent to the stats hook when a deprecated capability is requested with one of the
+// SetRequested[...] methods, so that it can be replaced before it is removed from WURFL. The stats hook must be set before
+// setting the requested capabilities to receive these events
+type CapabilityDeprecationEvent struct {
+	Capability  string // name of the deprecated capability
+	Replacement string // capability to use instead, empty if there is none
+	FromServer  bool   // true if the capability is declared deprecated by WM server, false if by the client
+}
+
+// bundledDeprecatedCaps lists the capabilities known to be deprecated when this client has been released, with their
+// replacement, if any. WM server versions that declare deprecated capabilities in their info take precedence
+var bundledDeprecatedCaps = map[string]string{}
+
+// SetDeprecatedCapabilities adds the given capabilities, with their replacement (empty if none), to the ones reported as
+// deprecated when requested. It can be used to anticipate deprecations not yet known by this client
+func (c *WmClient) SetDeprecatedCapabilities(caps map[string]string) {
+	if c == nil {
+		return
+	}
+	if c.deprecatedCaps == nil {
+		c.deprecatedCaps = make(map[string]string, len(caps))
+	}
+	for name, replacement := range caps {
+		c.deprecatedCaps[name] = replacement
+	}
+}
+
+// warnDeprecatedCapabilities sends a CapabilityDeprecationEvent for each of the given capabilities that is deprecated
+func (c *WmClient) warnDeprecatedCapabilities(names []string) {
+	if c.statsHook == nil {
+		return
+	}
+
+	for _, name := range names {
+		if sliceContains(c.serverDeprecatedCaps, name) {
+			c.emitStats(CapabilityDeprecationEvent{Capability: name, FromServer: true})
+		} else if replacement, ok := c.deprecatedCaps[name]; ok {
+			c.emitStats(CapabilityDeprecationEvent{Capability: name, Replacement: replacement})
+		} else if replacement, ok := bundledDeprecatedCaps[name]; ok {
+			c.emitStats(CapabilityDeprecationEvent{Capability: name, Replacement: replacement})
+		}
+	}
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapabilityDeprecationWarnings(t *testing.T) {
+	var events []CapabilityDeprecationEvent
+	client := &WmClient{
+		StaticCaps:           []string{"brand_name", "model_name", "xhtml_support_level"},
+		VirtualCaps:          []string{"is_ios", "is_smartphone"},
+		serverDeprecatedCaps: []string{"is_ios"},
+	}
+	client.SetStatsHook(func(event interface{}) {
+		if e, ok := event.(CapabilityDeprecationEvent); ok {
+			events = append(events, e)
+		}
+	})
+	client.SetDeprecatedCapabilities(map[string]string{"xhtml_support_level": "html_preferred_dtd"})
+
+	client.SetRequestedCapabilities([]string{"brand_name", "xhtml_support_level", "is_ios"})
+	require.Equal(t, []CapabilityDeprecationEvent{
+		{Capability: "xhtml_support_level", Replacement: "html_preferred_dtd"},
+		{Capability: "is_ios", FromServer: true},
+	}, events)
+
+	// capabilities that are not deprecated do not send events
+	events = nil
+	client.SetRequestedStaticCapabilities([]string{"brand_name", "model_name"})
+	client.SetRequestedVirtualCapabilities([]string{"is_smartphone"})
+	require.Empty(t, events)
+}
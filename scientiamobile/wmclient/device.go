@@ -0,0 +1,110 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+// Names of the capabilities read by Device, to be used with SetRequestedCapabilities and the other capability lists
+const (
+	CapBrandName     = "brand_name"
+	CapModelName     = "model_name"
+	CapMarketingName = "marketing_name"
+	CapIsTablet      = "is_tablet"
+	CapFormFactor    = "form_factor"                  // virtual capability
+	CapIsMobile      = "is_mobile"                    // virtual capability
+	CapIsSmartphone  = "is_smartphone"                // virtual capability
+	CapIsRobot       = "is_robot"                     // virtual capability
+	CapOS            = "advertised_device_os"         // virtual capability
+	CapOSVersion     = "advertised_device_os_version" // virtual capability
+)
+
+// Values of the form_factor virtual capability
+const (
+	FormFactorDesktop        = "Desktop"
+	FormFactorApp            = "App"
+	FormFactorTablet         = "Tablet"
+	FormFactorSmartphone     = "Smartphone"
+	FormFactorFeaturePhone   = "Feature Phone"
+	FormFactorSmartTV        = "Smart-TV"
+	FormFactorRobot          = "Robot"
+	FormFactorOtherNonMobile = "Other non-Mobile"
+	FormFactorOtherMobile    = "Other Mobile"
+)
+
+// Device wraps device data with accessors for the most used capabilities, ie: device.IsTablet() instead of
+// device.Capabilities["is_tablet"] == "true". Accessors return the zero value if the capability has not been requested:
+// the names of the capabilities they read are the Cap* constants. The device data fields are available as well
+type Device struct {
+	*JSONDeviceData
+}
+
+// NewDevice wraps the given device data, which must not be nil
+func NewDevice(data *JSONDeviceData) Device {
+	return Device{JSONDeviceData: data}
+}
+
+// WurflID returns the device wurfl_id
+func (d Device) WurflID() string {
+	return deviceID(d.JSONDeviceData)
+}
+
+// Brand returns the brand_name capability
+func (d Device) Brand() string {
+	return d.Capabilities[CapBrandName]
+}
+
+// Model returns the model_name capability
+func (d Device) Model() string {
+	return d.Capabilities[CapModelName]
+}
+
+// MarketingName returns the marketing_name capability
+func (d Device) MarketingName() string {
+	return d.Capabilities[CapMarketingName]
+}
+
+// FormFactor returns the form_factor virtual capability, one of the FormFactor* constants
+func (d Device) FormFactor() string {
+	return d.Capabilities[CapFormFactor]
+}
+
+// OS returns the advertised_device_os virtual capability
+func (d Device) OS() string {
+	return d.Capabilities[CapOS]
+}
+
+// OSVersion returns the advertised_device_os_version virtual capability
+func (d Device) OSVersion() string {
+	return d.Capabilities[CapOSVersion]
+}
+
+// IsMobile returns the is_mobile virtual capability
+func (d Device) IsMobile() bool {
+	return d.Capabilities[CapIsMobile] == "true"
+}
+
+// IsTablet returns the is_tablet capability
+func (d Device) IsTablet() bool {
+	return d.Capabilities[CapIsTablet] == "true"
+}
+
+// IsSmartphone returns the is_smartphone virtual capability
+func (d Device) IsSmartphone() bool {
+	return d.Capabilities[CapIsSmartphone] == "true"
+}
+
+// IsBot returns the is_robot virtual capability
+func (d Device) IsBot() bool {
+	return d.Capabilities[CapIsRobot] == "true"
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDevice(t *testing.T) {
+	device := NewDevice(&JSONDeviceData{
+		DeviceID: "apple_ipad_ver1_sub12",
+		Capabilities: map[string]string{
+			CapBrandName:     "Apple",
+			CapModelName:     "iPad",
+			CapMarketingName: "iPad Air",
+			CapFormFactor:    FormFactorTablet,
+			CapIsMobile:      "true",
+			CapIsTablet:      "true",
+			CapIsSmartphone:  "false",
+			CapOS:            "iOS",
+			CapOSVersion:     "12.0",
+		},
+		Ltime: "2020-01-01 10:00:00",
+	})
+
+	require.Equal(t, "apple_ipad_ver1_sub12", device.WurflID())
+	require.Equal(t, "Apple", device.Brand())
+	require.Equal(t, "iPad", device.Model())
+	require.Equal(t, "iPad Air", device.MarketingName())
+	require.Equal(t, FormFactorTablet, device.FormFactor())
+	require.Equal(t, "iOS", device.OS())
+	require.Equal(t, "12.0", device.OSVersion())
+	require.True(t, device.IsMobile())
+	require.True(t, device.IsTablet())
+	require.False(t, device.IsSmartphone())
+	// not requested
+	require.False(t, device.IsBot())
+	// device data fields
+	require.Equal(t, "2020-01-01 10:00:00", device.Ltime)
+}
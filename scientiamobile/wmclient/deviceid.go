@@ -0,0 +1,50 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+// wurflIDCapability is the capability that WM server always returns, in addition to the requested ones
+const wurflIDCapability = "wurfl_id"
+
+// SetWurflIDInCapabilities sets whether wurfl_id, which WM server always returns, is kept in the device Capabilities map
+// in addition to the DeviceID field. The default is true, for backward compatibility. Setting it to false makes the number
+// of capabilities equal to the number of requested ones. This function should be called before performing any lookup
+func (c *WmClient) SetWurflIDInCapabilities(include bool) {
+	if c == nil {
+		return
+	}
+	c.excludeWurflID = !include
+}
+
+// setDeviceID copies the wurfl_id capability of the given device to its DeviceID field and, if configured to do so,
+// removes it from the capabilities
+func (c *WmClient) setDeviceID(device *JSONDeviceData) {
+	id, ok := device.Capabilities[wurflIDCapability]
+	if !ok {
+		return
+	}
+	device.DeviceID = id
+	if c.excludeWurflID {
+		delete(device.Capabilities, wurflIDCapability)
+	}
+}
+
+// deviceID returns the wurfl_id of the given device, wherever it has been stored
+func deviceID(device *JSONDeviceData) string {
+	if device.DeviceID != "" {
+		return device.DeviceID
+	}
+	return device.Capabilities[wurflIDCapability]
+}
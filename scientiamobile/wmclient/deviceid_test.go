@@ -0,0 +1,39 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetDeviceID(t *testing.T) {
+	client := &WmClient{}
+	device := &JSONDeviceData{Capabilities: map[string]string{"wurfl_id": "generic", "brand_name": "Generic"}}
+	client.setDeviceID(device)
+	require.Equal(t, "generic", device.DeviceID)
+	require.Equal(t, 2, len(device.Capabilities))
+
+	client.SetWurflIDInCapabilities(false)
+	device = &JSONDeviceData{Capabilities: map[string]string{"wurfl_id": "generic", "brand_name": "Generic"}}
+	client.setDeviceID(device)
+	require.Equal(t, "generic", device.DeviceID)
+	require.Equal(t, map[string]string{"brand_name": "Generic"}, device.Capabilities)
+	require.Equal(t, "generic", deviceID(device))
+
+	require.Equal(t, "generic", deviceID(&JSONDeviceData{Capabilities: map[string]string{"wurfl_id": "generic"}}))
+}
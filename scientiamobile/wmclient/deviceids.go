@@ -0,0 +1,51 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"net/http"
+	"sort"
+)
+
+// allDeviceIDsPath is the WM server endpoint used by GetAllDeviceIDs. Servers that do not support it reply with one of the
+// statuses in endpointUnsupported
+const allDeviceIDsPath = "/v2/alldeviceids/json"
+
+// GetAllDeviceIDs returns the wurfl_ids of all the devices known by WM server, in lexical order, ie: to build offline
+// indexes or to check, with sort.SearchStrings, that stored wurfl_ids still exist in the loaded WURFL file.
+// The list is not cached by the client, since it is large and rarely needed. ErrDeviceIDsUnsupported is returned if WM
+// server does not support it
+func (c *WmClient) GetAllDeviceIDs(ctx context.Context) ([]string, error) {
+	res, resbody, err := c.doRequest(ctx, "GET", allDeviceIDsPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	if endpointUnsupported[res.StatusCode] {
+		return nil, ErrDeviceIDsUnsupported
+	}
+	if res.StatusCode != http.StatusOK {
+		data := JSONDeviceData{Error: http.StatusText(res.StatusCode)}
+		return nil, newServerError(&data, res.StatusCode, false)
+	}
+
+	ids := make([]string, 0)
+	if err = c.decodeResponse(res, resbody, &ids); err != nil {
+		return nil, err
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAllDeviceIDs(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != allDeviceIDsPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`["generic_mobile","apple_iphone_ver1","generic"]`))
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	ids, err := client.GetAllDeviceIDs(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, []string{"apple_iphone_ver1", "generic", "generic_mobile"}, ids)
+	require.Equal(t, 1, sort.SearchStrings(ids, "generic"))
+
+	status = http.StatusInternalServerError
+	_, err = client.GetAllDeviceIDs(context.Background())
+	require.True(t, isServerError(err))
+
+	status = http.StatusNotImplemented
+	_, err = client.GetAllDeviceIDs(context.Background())
+	require.Equal(t, ErrDeviceIDsUnsupported, err)
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Do sends a request to the given WM server path, ie: "/v2/newendpoint/json", and decodes the response in result, unless it
+// is nil. It is meant to call WM server endpoints that the client does not support yet. The request is sent with the same
+// base URI, transport, timeouts, request decorator and concurrency limit of the other requests: as a POST with the JSON
+// encoded payload, or as a GET if payload is nil. Responses with a non 2xx status are returned as a *ServerError.
+// Do does not use the client caches
+func (c *WmClient) Do(ctx context.Context, path string, payload interface{}, result interface{}) error {
+	if c == nil {
+		return ErrNilClient
+	}
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("invalid path %q: it must start with /", path)
+	}
+
+	method := "GET"
+	var reqbody []byte
+	if payload != nil {
+		var err error
+		if reqbody, err = json.Marshal(payload); err != nil {
+			return err
+		}
+		method = "POST"
+	}
+
+	res, body, err := c.doRequest(ctx, method, path, reqbody)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		data := JSONDeviceData{}
+		if derr := c.decodeResponse(res, body, &data); derr != nil || data.Error == "" {
+			data.Error = http.StatusText(res.StatusCode)
+		}
+		return newServerError(&data, res.StatusCode, false)
+	}
+
+	if result == nil {
+		return nil
+	}
+	return c.decodeResponse(res, body, result)
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "tenant", r.Header.Get("X-Tenant-Id"))
+		switch r.URL.Path {
+		case "/wm/v2/echo/json":
+			require.Equal(t, "POST", r.Method)
+			payload := map[string]string{}
+			json.NewDecoder(r.Body).Decode(&payload)
+			json.NewEncoder(w).Encode(map[string]string{"echo": payload["value"]})
+		case "/wm/v2/ping/json":
+			require.Equal(t, "GET", r.Method)
+			w.Write([]byte(`{"status":"ok"}`))
+		case "/wm/v2/invalid/json":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid payload"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.baseURI = "wm"
+	client.SetRequestDecorator(HeadersDecorator(map[string]string{"X-Tenant-Id": "tenant"}))
+
+	echo := map[string]string{}
+	require.Nil(t, client.Do(context.Background(), "/v2/echo/json", map[string]string{"value": "hello"}, &echo))
+	require.Equal(t, "hello", echo["echo"])
+
+	var ping struct {
+		Status string `json:"status"`
+	}
+	require.Nil(t, client.Do(context.Background(), "/v2/ping/json", nil, &ping))
+	require.Equal(t, "ok", ping.Status)
+	require.Nil(t, client.Do(context.Background(), "/v2/ping/json", nil, nil))
+
+	var serverError *ServerError
+	err := client.Do(context.Background(), "/v2/invalid/json", map[string]string{}, nil)
+	require.True(t, errors.As(err, &serverError))
+	require.Equal(t, http.StatusBadRequest, serverError.StatusCode)
+	require.Equal(t, "invalid payload", serverError.Message)
+
+	err = client.Do(context.Background(), "/v2/unknown/json", nil, nil)
+	require.True(t, errors.As(err, &serverError))
+	require.Equal(t, http.StatusNotFound, serverError.StatusCode)
+	require.Equal(t, "Not Found", serverError.Message)
+
+	require.NotNil(t, client.Do(context.Background(), "v2/ping/json", nil, nil))
+}
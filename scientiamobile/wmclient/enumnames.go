@@ -0,0 +1,109 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// UnknownNameError is returned by GetAllDevicesForMake and GetAllVersionsForOS when the given brand or OS name is unknown
+// to WM server, even ignoring letter case and white spaces. Suggestion holds the known name most similar to the given one,
+// if any is similar enough, ie: to show "did you mean 'Nokia'?" to users
+type UnknownNameError struct {
+	Name       string
+	Suggestion string
+}
+
+func (e *UnknownNameError) Error() string {
+	message := fmt.Sprintf("Error getting data from WM server: %s does not exist", e.Name)
+	if e.Suggestion != "" {
+		message += fmt.Sprintf(", did you mean '%s'?", e.Suggestion)
+	}
+	return message
+}
+
+// enumNameKey returns the form of a brand or OS name used to match it: case folded, with white spaces trimmed and collapsed
+func enumNameKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// matchEnumName returns the name in names equal to the given one or, if none is, the first one that matches it by
+// enumNameKey. It returns false if no name matches
+func matchEnumName(names []string, name string) (string, bool) {
+	for _, n := range names {
+		if n == name {
+			return n, true
+		}
+	}
+	key := enumNameKey(name)
+	for _, n := range names {
+		if enumNameKey(n) == key {
+			return n, true
+		}
+	}
+	return "", false
+}
+
+// newUnknownNameError returns the error for the given unknown name, suggesting the most similar of the known names: the one
+// at the lowest edit distance, if that is at most a third of the name length (at least 1), so that only likely typos are
+// suggested
+func newUnknownNameError(names []string, name string) *UnknownNameError {
+	err := &UnknownNameError{Name: name}
+	key := enumNameKey(name)
+	maxDistance := utf8.RuneCountInString(key) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+	best := maxDistance + 1
+	for _, n := range names {
+		if distance := editDistance(key, enumNameKey(n)); distance < best {
+			best = distance
+			err.Suggestion = n
+		}
+	}
+	return err
+}
+
+// editDistance returns the Levenshtein distance between the given strings, in runes
+func editDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, minInt(current[j-1]+1, previous[j-1]+cost))
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
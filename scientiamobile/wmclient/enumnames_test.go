@@ -0,0 +1,79 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnumeratorNamesMatching(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/alldevices/json":
+			json.NewEncoder(w).Encode([]JSONMakeModel{{BrandName: "Nokia", ModelName: "3310"}, {BrandName: "Samsung", ModelName: "SM-G991B"}})
+		case devicesForMakePath + "Nokia":
+			json.NewEncoder(w).Encode([]JSONModelMktName{{ModelName: "3310"}})
+		case "/v2/alldeviceosversions/json":
+			json.NewEncoder(w).Encode([]JSONDeviceOsVersions{{OsName: "Android", OsVersion: "13"}, {OsName: "iOS", OsVersion: "17.0"}})
+		default:
+			// the per-brand endpoint returns no devices for unknown brands
+			w.Write([]byte(`[]`))
+		}
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// the brand is not known by the per-brand endpoint as given, it is found in the whole device makes data
+	devices, err := client.GetAllDevicesForMake(" nokia ")
+	require.Nil(t, err)
+	require.Equal(t, []JSONModelMktName{{ModelName: "3310"}}, devices)
+	devices, err = client.GetAllDevicesForMake("SAMSUNG")
+	require.Nil(t, err)
+	require.Equal(t, []JSONModelMktName{{ModelName: "SM-G991B"}}, devices)
+
+	_, err = client.GetAllDevicesForMake("Samsnug")
+	var unknown *UnknownNameError
+	require.True(t, errors.As(err, &unknown))
+	require.Equal(t, "Samsung", unknown.Suggestion)
+	require.Equal(t, "Error getting data from WM server: Samsnug does not exist, did you mean 'Samsung'?", err.Error())
+	_, err = client.GetAllDevicesForMake("Apple")
+	require.True(t, errors.As(err, &unknown))
+	require.Equal(t, "", unknown.Suggestion)
+
+	versions, err := client.GetAllVersionsForOS("android")
+	require.Nil(t, err)
+	require.Equal(t, []string{"13"}, versions)
+	versions, err = client.GetAllVersionsForOS("IOS")
+	require.Nil(t, err)
+	require.Equal(t, []string{"17.0"}, versions)
+	_, err = client.GetAllVersionsForOS("andriod")
+	require.True(t, errors.As(err, &unknown))
+	require.Equal(t, "Android", unknown.Suggestion)
+}
+
+func TestEditDistance(t *testing.T) {
+	require.Equal(t, 0, editDistance("nokia", "nokia"))
+	require.Equal(t, 1, editDistance("nokia", "nokya"))
+	require.Equal(t, 2, editDistance("samsnug", "samsung"))
+	require.Equal(t, 5, editDistance("", "apple"))
+	require.Equal(t, 1, editDistance("huawéi", "huawei"))
+}
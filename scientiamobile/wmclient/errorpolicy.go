@@ -0,0 +1,74 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrorPolicy controls how the errors returned by WM server (ServerError) are treated. Client errors are the ones due to
+// the request, ie: an unknown wurfl_id, returned with a 4xx status or within a successful response. Server errors are the
+// ones returned with a 5xx status. The zero value, which is the default, never caches errors and never counts them as failures
+type ErrorPolicy struct {
+	ClientErrorTTL          time.Duration // time client errors are kept in the UA and device caches, <= 0 to not cache them
+	ServerErrorTTL          time.Duration // time server errors are kept in the UA and device caches, <= 0 to not cache them
+	ClientErrorsAreFailures bool          // if true, client errors make Manager report the client as unhealthy
+	ServerErrorsAreFailures bool          // if true, server errors make Manager report the client as unhealthy
+}
+
+// SetErrorPolicy sets how errors returned by WM server are cached and accounted. Cached errors are returned by the lookups
+// with the same data until they expire, regardless of the cache TTL set with SetCacheTTL, and are removed when WM server
+// loads a new WURFL file. This function should be called before performing any lookup
+func (c *WmClient) SetErrorPolicy(policy ErrorPolicy) {
+	if c == nil {
+		return
+	}
+	c.errorPolicy = policy
+}
+
+// isServerSideError returns true if the given ServerError has been returned with a 5xx status
+func isServerSideError(err error) bool {
+	var serverError *ServerError
+	return errors.As(err, &serverError) && serverError.StatusCode >= http.StatusInternalServerError
+}
+
+// errorCacheTTL returns the time the given ServerError can be cached, 0 if it must not be cached. Rate limiting errors are
+// never cached, since they are not due to the request data
+func (c *WmClient) errorCacheTTL(err error) time.Duration {
+	var serverError *ServerError
+	if errors.As(err, &serverError) && serverError.StatusCode == http.StatusTooManyRequests {
+		return 0
+	}
+	if isServerSideError(err) {
+		return c.errorPolicy.ServerErrorTTL
+	}
+	return c.errorPolicy.ClientErrorTTL
+}
+
+// countsAsFailure returns true if the given ServerError must be accounted as a failure
+func (c *WmClient) countsAsFailure(err error) bool {
+	if isServerSideError(err) {
+		return c.errorPolicy.ServerErrorsAreFailures
+	}
+	return c.errorPolicy.ClientErrorsAreFailures
+}
+
+// newErrorCacheEntry returns a cache entry holding the given lookup error for the given time
+func newErrorCacheEntry(err error, ttl time.Duration) *cacheEntry {
+	return &cacheEntry{err: err, expiresAt: time.Now().Add(ttl)}
+}
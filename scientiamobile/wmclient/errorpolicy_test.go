@@ -0,0 +1,125 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newErrorPolicyTestHandler returns a WM server handler failing the lookups of the unknown and broken devices, and counting
+// the requests by wurfl_id or user agent
+func newErrorPolicyTestHandler(requests map[string]int) http.Handler {
+	var mutex sync.Mutex
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+		mutex.Lock()
+		requests[request.WurflID+request.LookupHeaders[userAgentHeader]]++
+		mutex.Unlock()
+		switch {
+		case request.WurflID == "unknown":
+			w.Write([]byte(`{"error":"device not found"}`))
+		case request.WurflID == "broken" || request.LookupHeaders[userAgentHeader] == "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":"internal error"}`))
+		default:
+			w.Write([]byte(`{"capabilities":{"wurfl_id":"generic"}}`))
+		}
+	})
+}
+
+func TestErrorPolicyCaching(t *testing.T) {
+	requests := make(map[string]int)
+	server := httptest.NewServer(newErrorPolicyTestHandler(requests))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.ImportantHeaders = []string{userAgentHeader}
+	client.SetCacheSize(100)
+
+	// by default errors are not cached
+	for i := 0; i < 2; i++ {
+		_, err := client.LookupDeviceID(context.Background(), "unknown")
+		require.True(t, errors.Is(err, ErrDeviceNotFound))
+	}
+	require.Equal(t, 2, requests["unknown"])
+
+	client.SetErrorPolicy(ErrorPolicy{ClientErrorTTL: time.Hour})
+	for i := 0; i < 3; i++ {
+		device, err := client.LookupDeviceID(context.Background(), "unknown")
+		require.Nil(t, device)
+		require.True(t, errors.Is(err, ErrDeviceNotFound))
+		require.Equal(t, http.StatusOK, err.(*ServerError).StatusCode)
+
+		_, err = client.LookupDeviceID(context.Background(), "broken")
+		require.Equal(t, http.StatusInternalServerError, err.(*ServerError).StatusCode)
+		_, err = client.LookupUserAgent(context.Background(), "broken")
+		require.True(t, isServerError(err))
+	}
+	require.Equal(t, 3, requests["unknown"])
+	// server errors of wurfl_id and user-agent lookups are counted together
+	require.Equal(t, 6, requests["broken"])
+
+	// server errors are cached for their own time
+	client.SetErrorPolicy(ErrorPolicy{ServerErrorTTL: 5 * time.Millisecond})
+	client.clearCache(CacheClearManual)
+	for i := 0; i < 3; i++ {
+		_, err := client.LookupUserAgent(context.Background(), "broken")
+		require.True(t, isServerError(err))
+	}
+	time.Sleep(10 * time.Millisecond)
+	_, err := client.LookupUserAgent(context.Background(), "broken")
+	require.True(t, isServerError(err))
+	require.Equal(t, 6+2, requests["broken"])
+}
+
+func TestErrorPolicyFailureAccounting(t *testing.T) {
+	server := httptest.NewServer(newErrorPolicyTestHandler(make(map[string]int)))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.ImportantHeaders = []string{userAgentHeader}
+	client.SetCacheSize(100)
+	manager := NewManager()
+	manager.Add("wm", client)
+
+	request, err := http.NewRequest("GET", "http://mysite.com/", nil)
+	require.Nil(t, err)
+	request.Header.Set(userAgentHeader, "broken")
+
+	// by default a server that returns errors is reachable, and then healthy
+	_, err = manager.LookupRequestContext(context.Background(), request)
+	require.True(t, isServerError(err))
+	require.True(t, manager.GetLatencies()[0].Healthy)
+
+	client.SetErrorPolicy(ErrorPolicy{ServerErrorsAreFailures: true})
+	_, err = manager.LookupRequestContext(context.Background(), request)
+	require.True(t, isServerError(err))
+	require.False(t, manager.GetLatencies()[0].Healthy)
+
+	// client errors are accounted separately
+	client.SetErrorPolicy(ErrorPolicy{ServerErrorsAreFailures: false, ClientErrorsAreFailures: true})
+	_, err = manager.LookupRequestContext(context.Background(), request)
+	require.True(t, isServerError(err))
+	require.True(t, manager.GetLatencies()[0].Healthy)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrDeviceNotFound is matched, using errors.Is, by the error returned by LookupDeviceID and LookupTAC when WM server does not
+// know the given wurfl_id or TAC
+var ErrDeviceNotFound = errors.New("device not found")
+
+// ErrExplainUnsupported is returned by LookupUserAgentExplain when WM server does not support explain mode
+var ErrExplainUnsupported = errors.New("WM server does not support detection explanation")
+
+// ErrDeviceIDsUnsupported is returned by GetAllDeviceIDs when WM server does not support the enumeration of wurfl_ids
+var ErrDeviceIDsUnsupported = errors.New("WM server does not support the enumeration of device IDs")
+
+// ErrPublicKeyPinMismatch is matched, using errors.Is, by the error returned when the WM server certificate chain does not
+// hold any of the public keys pinned with SetPinnedPublicKeys
+var ErrPublicKeyPinMismatch = errors.New("WM server public key does not match any pinned key")
+
+// ErrNilClient is returned by the methods, returning an error, that are called on a nil *WmClient
+var ErrNilClient = errors.New("WM client is nil")
+
+// ErrClientNotInitialized is returned by the methods that send requests to WM server when the client has not been created
+// with Create, ie: a zero value WmClient
+var ErrClientNotInitialized = errors.New("WM client is not initialized, it must be created with Create")
+
+// ServerError is returned by lookups when WM server has been reached but replied with an error message. In that case
+// lookups return a nil device: the response data that is not related to a device is available in the error fields
+type ServerError struct {
+	Message    string            // error message returned by WM server
+	APIVersion string            // WM server API version
+	Mtime      int64             // timestamp of the response creation
+	Ltime      string            // time of last wurfl.xml file load
+	Metadata   *ResponseMetadata // diagnostic data of the WM server response
+	StatusCode int               // HTTP status of the WM server response, which may be 200 for errors due to the request data
+	RetryAfter time.Duration     // delay before sending the request again, set by WM server, or a gateway in front of it, with the Retry-After header. 0 if not set
+	notFound   bool              // true if the error is due to an unknown wurfl_id or TAC
+}
+
+// newServerError returns the error for the given device data, which holds the error message returned by WM server
+func newServerError(deviceData *JSONDeviceData, statusCode int, notFound bool) *ServerError {
+	return &ServerError{
+		Message:    deviceData.Error,
+		APIVersion: deviceData.APIVersion,
+		Mtime:      deviceData.Mtime,
+		Ltime:      deviceData.Ltime,
+		Metadata:   deviceData.Metadata,
+		StatusCode: statusCode,
+		notFound:   notFound,
+	}
+}
+
+func (e *ServerError) Error() string {
+	return "Received error from WM server: " + e.Message
+}
+
+// Is reports whether the error matches target. A ServerError returned for an unknown wurfl_id matches ErrDeviceNotFound
+func (e *ServerError) Is(target error) bool {
+	return target == ErrDeviceNotFound && e.notFound
+}
+
+// isServerError returns true if err has been returned by a WM server that could be reached
+func isServerError(err error) bool {
+	var serverError *ServerError
+	return errors.As(err, &serverError)
+}
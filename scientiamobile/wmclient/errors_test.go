@@ -0,0 +1,66 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerError(t *testing.T) {
+	err := &ServerError{Message: "device not found", notFound: true}
+	require.Equal(t, "Received error from WM server: device not found", err.Error())
+	require.True(t, errors.Is(err, ErrDeviceNotFound))
+	require.True(t, errors.Is(fmt.Errorf("lookup failed: %w", err), ErrDeviceNotFound))
+	require.True(t, isServerError(err))
+
+	err = &ServerError{Message: "invalid request"}
+	require.False(t, errors.Is(err, ErrDeviceNotFound))
+	require.True(t, isServerError(err))
+
+	require.False(t, isServerError(errors.New("connection refused")))
+	require.False(t, isServerError(nil))
+}
+
+func TestServerErrorNotFound(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		if status == http.StatusOK || status == http.StatusNotFound {
+			w.Write([]byte(`{"error":"device not found"}`))
+		} else {
+			w.Write([]byte("<html>overloaded</html>"))
+		}
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	_, err := client.LookupDeviceID(context.Background(), "unknown")
+	require.True(t, errors.Is(err, ErrDeviceNotFound))
+
+	// an overloaded or failing server has not reported an unknown id
+	for _, status = range []int{http.StatusServiceUnavailable, http.StatusTooManyRequests} {
+		_, err = client.LookupDeviceID(context.Background(), "unknown")
+		require.True(t, isServerError(err), "%d", status)
+		require.False(t, errors.Is(err, ErrDeviceNotFound), "%d", status)
+	}
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+)
+
+// lookupUserAgentExplainPath is the WM server endpoint used by LookupUserAgentExplain. Servers that do not support it reply
+// with one of the statuses in endpointUnsupported
+const lookupUserAgentExplainPath = "/v2/lookupuseragentexplain/json"
+
+// LookupUserAgentExplain detects the device of the given user agent like LookupUserAgent, returning also how WM server has
+// detected it (matchers evaluated, conclusive or recovery match), which is useful to report detection issues to ScientiaMobile.
+// Explanations are never cached. ErrExplainUnsupported is returned if WM server does not support explain mode
+func (c *WmClient) LookupUserAgentExplain(ctx context.Context, userAgent string) (*JSONDetectionExplanation, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	request := Request{
+		LookupHeaders:  c.userAgentLookupHeaders(userAgent),
+		RequestedCaps:  c.requestedStaticCaps,
+		RequestedVCaps: c.requestedVirtualCaps,
+	}
+	res, resbody, err := c.postLookup(ctx, lookupUserAgentExplainPath, func(legacy bool) interface{} {
+		return lookupPayload(request, legacy)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if endpointUnsupported[res.StatusCode] {
+		return nil, ErrExplainUnsupported
+	}
+
+	explanation := &JSONDetectionExplanation{}
+	if err = c.decodeResponse(res, resbody, explanation); err != nil {
+		return nil, err
+	}
+	explanation.Metadata = c.getResponseMetadata(res.Header)
+	c.setDeviceID(&explanation.JSONDeviceData)
+
+	// error messages in json are returned as errors, without explanation
+	if len(explanation.Error) > 0 {
+		return nil, newServerError(&explanation.JSONDeviceData, res.StatusCode, false)
+	}
+	return explanation, nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupUserAgentExplain(t *testing.T) {
+	supported := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !supported || r.URL.Path != lookupUserAgentExplainPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		request := Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+		if request.LookupHeaders[userAgentHeader] == "" {
+			w.Write([]byte(`{"error":"missing user agent"}`))
+			return
+		}
+		w.Write([]byte(`{"capabilities":{"wurfl_id":"apple_iphone_ver13"},"normalized_user_agent":"iPhone 13",` +
+			`"matcher":"AppleMatcher","matcher_path":["BotMatcher","AppleMatcher"],"match_type":"conclusive"}`))
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	explanation, err := client.LookupUserAgentExplain(context.Background(), "Mozilla/5.0 (iPhone; CPU iPhone OS 13_0 like Mac OS X)")
+	require.Nil(t, err)
+	require.Equal(t, "apple_iphone_ver13", explanation.DeviceID)
+	require.Equal(t, "AppleMatcher", explanation.Matcher)
+	require.Equal(t, []string{"BotMatcher", "AppleMatcher"}, explanation.MatcherPath)
+	require.Equal(t, "conclusive", explanation.MatchType)
+	require.Equal(t, "iPhone 13", explanation.NormalizedUserAgent)
+
+	_, err = client.LookupUserAgentExplain(context.Background(), "")
+	require.True(t, isServerError(err))
+
+	supported = false
+	_, err = client.LookupUserAgentExplain(context.Background(), "Mozilla/5.0")
+	require.Equal(t, ErrExplainUnsupported, err)
+}
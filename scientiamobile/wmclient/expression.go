@@ -0,0 +1,633 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expression is a compiled boolean expression over device capabilities, such as
+// `is_mobile && resolution_width >= 768` or `brand_name == "Apple" || !is_touchscreen`.
+// Supported operators are ||, &&, !, ==, !=, <, <=, >, >= and parentheses. Operands are capability names, numbers,
+// double quoted strings and the true and false literals. A capability used as a boolean must have a "true" or "false" value.
+// Comparisons are typed by the capability schema, when the expression is compiled with one: capabilities are compared as
+// booleans, numbers or strings according to their schema type, and comparing values of different types is a compile error.
+// Capabilities missing from the schema, or compiled without one, are compared numerically when both operands are numbers,
+// as booleans when one of them is a boolean literal, lexically otherwise. Nesting of ( and ! is limited to 100 levels.
+// An Expression is safe for concurrent use
+type Expression struct {
+	source       string
+	root         exprNode
+	capabilities []string
+}
+
+// maxExpressionDepth is the maximum nesting level of the parenthesis and ! operators of an expression
+const maxExpressionDepth = 100
+
+// CompileExpression parses the given expression, whose comparison types are inferred from the operand values. It is meant
+// to be called at startup, so that syntax errors are found early
+func CompileExpression(expression string) (*Expression, error) {
+	return CompileExpressionWithSchema(expression, nil)
+}
+
+// CompileExpressionWithSchema parses the given expression, typing its comparisons with the given capability schema, as
+// returned by GetCapabilitySchema. String capabilities of a schema inferred by the client are not typed, since that type
+// is the fallback of the names that are not recognized
+func CompileExpressionWithSchema(expression string, schema []CapabilitySchema) (*Expression, error) {
+	tokens, err := tokenizeExpression(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	types := make(map[string]exprType, len(schema))
+	for _, capability := range schema {
+		switch {
+		case capability.Type == CapabilityBool:
+			types[capability.Name] = typeBool
+		case capability.Type == CapabilityInt:
+			types[capability.Name] = typeNumber
+		case capability.Type == CapabilityEnum || (capability.Type == CapabilityString && !capability.Inferred):
+			types[capability.Name] = typeString
+		}
+	}
+	p := &exprParser{tokens: tokens, capabilities: make(map[string]bool), types: types}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q at position %d in expression %q", p.tokens[p.pos].text, p.tokens[p.pos].pos, expression)
+	}
+
+	caps := make([]string, 0, len(p.capabilities))
+	for name := range p.capabilities {
+		caps = append(caps, name)
+	}
+	sort.Strings(caps)
+	return &Expression{source: expression, root: root, capabilities: caps}, nil
+}
+
+// String returns the source of the expression
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Capabilities returns the sorted names of the capabilities used by the expression, which must be requested to WM server
+func (e *Expression) Capabilities() []string {
+	return e.capabilities
+}
+
+// CompileTypedExpression parses the given expression, typing its comparisons with the capability schema of the WM server
+// this client is connected to
+func (c *WmClient) CompileTypedExpression(ctx context.Context, expression string) (*Expression, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	schema, err := c.GetCapabilitySchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return CompileExpressionWithSchema(expression, schema)
+}
+
+// CheckExpression returns an error if the given expression uses capabilities that are not in the static or virtual
+// capability set of the WM server this client is connected to
+func (c *WmClient) CheckExpression(e *Expression) error {
+	if c == nil {
+		return ErrNilClient
+	}
+	if e == nil {
+		return errors.New("nil expression")
+	}
+	var unknown []string
+	for _, name := range e.capabilities {
+		if !c.HasStaticCapability(name) && !c.HasVirtualCapability(name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("expression %q uses capabilities unknown to WM server: %s", e.source, strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// Evaluate evaluates the expression against the given device. An error is returned if a used capability is missing
+// from the device data or if its value cannot be converted to the type required by the expression
+func (e *Expression) Evaluate(device *JSONDeviceData) (bool, error) {
+	if device == nil {
+		return false, fmt.Errorf("cannot evaluate expression %q on nil device data", e.source)
+	}
+
+	v, err := e.root.eval(device.Capabilities)
+	if err != nil {
+		return false, err
+	}
+	return v.toBool()
+}
+
+// expression values are kept as strings together with their literal kind, conversion happens at comparison time
+type exprValueKind int
+
+const (
+	kindCapability exprValueKind = iota
+	kindNumber
+	kindString
+	kindBool
+)
+
+// exprType is the type of an operand, known at compile time
+type exprType int
+
+const (
+	typeUnknown exprType = iota // a capability that is not in the schema: its type is inferred from its value
+	typeBool
+	typeNumber
+	typeString
+)
+
+func (t exprType) String() string {
+	switch t {
+	case typeBool:
+		return "boolean"
+	case typeNumber:
+		return "number"
+	case typeString:
+		return "string"
+	}
+	return "unknown"
+}
+
+type exprValue struct {
+	kind  exprValueKind
+	text  string
+	name  string // capability name, for error messages
+	bool  bool
+	isSet bool // true if bool holds the result of a boolean operator
+}
+
+func (v exprValue) toBool() (bool, error) {
+	if v.isSet {
+		return v.bool, nil
+	}
+	b, err := strconv.ParseBool(v.text)
+	if err != nil || (v.kind != kindCapability && v.kind != kindBool) {
+		return false, fmt.Errorf("%s is not a boolean value", v.describe())
+	}
+	return b, nil
+}
+
+func (v exprValue) toNumber() (float64, error) {
+	f, err := strconv.ParseFloat(v.text, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s is not a number", v.describe())
+	}
+	return f, nil
+}
+
+func (v exprValue) describe() string {
+	if v.kind == kindCapability {
+		return fmt.Sprintf("capability %s (value %q)", v.name, v.text)
+	}
+	return strconv.Quote(v.text)
+}
+
+type exprNode interface {
+	eval(caps map[string]string) (exprValue, error)
+}
+
+type literalNode struct {
+	value exprValue
+}
+
+func (n literalNode) eval(caps map[string]string) (exprValue, error) {
+	return n.value, nil
+}
+
+type capabilityNode struct {
+	name string
+}
+
+func (n capabilityNode) eval(caps map[string]string) (exprValue, error) {
+	value, ok := caps[n.name]
+	if !ok {
+		return exprValue{}, fmt.Errorf("capability %s is not present in device data", n.name)
+	}
+	return exprValue{kind: kindCapability, text: value, name: n.name}, nil
+}
+
+type notNode struct {
+	operand exprNode
+}
+
+func (n notNode) eval(caps map[string]string) (exprValue, error) {
+	v, err := n.operand.eval(caps)
+	if err != nil {
+		return exprValue{}, err
+	}
+	b, err := v.toBool()
+	if err != nil {
+		return exprValue{}, err
+	}
+	return exprValue{bool: !b, isSet: true}, nil
+}
+
+type logicalNode struct {
+	and         bool // true for &&, false for ||
+	left, right exprNode
+}
+
+func (n logicalNode) eval(caps map[string]string) (exprValue, error) {
+	lv, err := n.left.eval(caps)
+	if err != nil {
+		return exprValue{}, err
+	}
+	l, err := lv.toBool()
+	if err != nil {
+		return exprValue{}, err
+	}
+	// short circuit
+	if l != n.and {
+		return exprValue{bool: l, isSet: true}, nil
+	}
+
+	rv, err := n.right.eval(caps)
+	if err != nil {
+		return exprValue{}, err
+	}
+	r, err := rv.toBool()
+	if err != nil {
+		return exprValue{}, err
+	}
+	return exprValue{bool: r, isSet: true}, nil
+}
+
+type comparisonNode struct {
+	op          string
+	left, right exprNode
+	typ         exprType // type of the compared values, typeUnknown if it must be inferred from them
+}
+
+func (n comparisonNode) eval(caps map[string]string) (exprValue, error) {
+	lv, err := n.left.eval(caps)
+	if err != nil {
+		return exprValue{}, err
+	}
+	rv, err := n.right.eval(caps)
+	if err != nil {
+		return exprValue{}, err
+	}
+
+	var cmp int
+	switch {
+	case n.typ == typeBool || (n.typ == typeUnknown && (lv.kind == kindBool || rv.kind == kindBool || lv.isSet || rv.isSet)):
+		if n.op != "==" && n.op != "!=" {
+			return exprValue{}, fmt.Errorf("operator %s cannot be applied to boolean values", n.op)
+		}
+		l, lerr := lv.toBool()
+		if lerr != nil {
+			return exprValue{}, lerr
+		}
+		r, rerr := rv.toBool()
+		if rerr != nil {
+			return exprValue{}, rerr
+		}
+		if l != r {
+			cmp = 1
+		}
+	case n.typ == typeNumber || (n.typ == typeUnknown && (lv.kind == kindNumber || rv.kind == kindNumber || (isNumber(lv.text) && isNumber(rv.text)))):
+		l, lerr := lv.toNumber()
+		if lerr != nil {
+			return exprValue{}, lerr
+		}
+		r, rerr := rv.toNumber()
+		if rerr != nil {
+			return exprValue{}, rerr
+		}
+		cmp = compareFloats(l, r)
+	default:
+		cmp = strings.Compare(lv.text, rv.text)
+	}
+
+	var result bool
+	switch n.op {
+	case "==":
+		result = cmp == 0
+	case "!=":
+		result = cmp != 0
+	case "<":
+		result = cmp < 0
+	case "<=":
+		result = cmp <= 0
+	case ">":
+		result = cmp > 0
+	case ">=":
+		result = cmp >= 0
+	}
+	return exprValue{bool: result, isSet: true}, nil
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+func compareFloats(a float64, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// tokenizer
+
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota
+	tokNumber
+	tokString
+	tokOperator
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func tokenizeExpression(expression string) ([]exprToken, error) {
+	tokens := make([]exprToken, 0, 8)
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"':
+			j := i + 1
+			var sb strings.Builder
+			for j < len(runes) && runes[j] != '"' {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				sb.WriteRune(runes[j])
+				j++
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d in expression %q", i, expression)
+			}
+			tokens = append(tokens, exprToken{kind: tokString, text: sb.String(), pos: i})
+			i = j + 1
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			j := i + 1
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, exprToken{kind: tokNumber, text: string(runes[i:j]), pos: i})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i + 1
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, exprToken{kind: tokIdent, text: string(runes[i:j]), pos: i})
+			i = j
+		default:
+			op := ""
+			if i+1 < len(runes) {
+				switch two := string(runes[i : i+2]); two {
+				case "&&", "||", "==", "!=", "<=", ">=":
+					op = two
+				}
+			}
+			if op == "" {
+				switch r {
+				case '!', '<', '>', '(', ')':
+					op = string(r)
+				default:
+					return nil, fmt.Errorf("unexpected character %q at position %d in expression %q", r, i, expression)
+				}
+			}
+			tokens = append(tokens, exprToken{kind: tokOperator, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+// recursive descent parser
+
+type exprParser struct {
+	tokens       []exprToken
+	pos          int
+	capabilities map[string]bool
+	types        map[string]exprType // capability types from the schema
+	depth        int                 // nesting level of the parenthesis and ! operators being parsed
+}
+
+// enter increments the nesting level, returning an error if it exceeds maxExpressionDepth
+func (p *exprParser) enter(token exprToken) error {
+	p.depth++
+	if p.depth > maxExpressionDepth {
+		return fmt.Errorf("%q at position %d exceeds the maximum nesting of %d levels", token.text, token.pos, maxExpressionDepth)
+	}
+	return nil
+}
+
+// typeOf returns the type of the values of the given node, if it is known at compile time
+func (p *exprParser) typeOf(node exprNode) exprType {
+	switch n := node.(type) {
+	case literalNode:
+		switch n.value.kind {
+		case kindNumber:
+			return typeNumber
+		case kindString:
+			return typeString
+		}
+		return typeBool
+	case capabilityNode:
+		return p.types[n.name]
+	}
+	return typeBool
+}
+
+// checkOperands returns an error if one of the given operands of a logical operator is known not to be a boolean
+func (p *exprParser) checkOperands(token exprToken, left exprNode, right exprNode) error {
+	if err := p.checkBool(left, token); err != nil {
+		return err
+	}
+	return p.checkBool(right, token)
+}
+
+// checkBool returns an error if the given operand of a boolean operator is known not to be a boolean
+func (p *exprParser) checkBool(node exprNode, token exprToken) error {
+	if typ := p.typeOf(node); typ != typeUnknown && typ != typeBool {
+		return fmt.Errorf("%s operand of %q at position %d is not a boolean", typ, token.text, token.pos)
+	}
+	return nil
+}
+
+func (p *exprParser) peekOperator(ops ...string) (string, bool) {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokOperator {
+		return "", false
+	}
+	for _, op := range ops {
+		if p.tokens[p.pos].text == op {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.peekOperator("||"); !ok {
+			return left, nil
+		}
+		token := p.tokens[p.pos]
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.checkOperands(token, left, right); err != nil {
+			return nil, err
+		}
+		left = logicalNode{and: false, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.peekOperator("&&"); !ok {
+			return left, nil
+		}
+		token := p.tokens[p.pos]
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.checkOperands(token, left, right); err != nil {
+			return nil, err
+		}
+		left = logicalNode{and: true, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if _, ok := p.peekOperator("!"); ok {
+		token := p.tokens[p.pos]
+		p.pos++
+		if err := p.enter(token); err != nil {
+			return nil, err
+		}
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		p.depth--
+		if err = p.checkBool(operand, token); err != nil {
+			return nil, err
+		}
+		return notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.peekOperator("==", "!=", "<", "<=", ">", ">=")
+	if !ok {
+		return left, nil
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	// the comparison is typed by the operand whose type is known, values of different types cannot be compared
+	typ, rightType := p.typeOf(left), p.typeOf(right)
+	if typ == typeUnknown {
+		typ = rightType
+	} else if rightType != typeUnknown && rightType != typ {
+		return nil, fmt.Errorf("%q at position %d compares a %s with a %s", op, token.pos, typ, rightType)
+	}
+	return comparisonNode{op: op, left: left, right: right, typ: typ}, nil
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	token := p.tokens[p.pos]
+	p.pos++
+	switch token.kind {
+	case tokNumber:
+		if !isNumber(token.text) {
+			return nil, fmt.Errorf("invalid number %q at position %d", token.text, token.pos)
+		}
+		return literalNode{value: exprValue{kind: kindNumber, text: token.text}}, nil
+	case tokString:
+		return literalNode{value: exprValue{kind: kindString, text: token.text}}, nil
+	case tokIdent:
+		if token.text == "true" || token.text == "false" {
+			return literalNode{value: exprValue{kind: kindBool, text: token.text}}, nil
+		}
+		p.capabilities[token.text] = true
+		return capabilityNode{name: token.text}, nil
+	}
+
+	if token.text == "(" {
+		if err := p.enter(token); err != nil {
+			return nil, err
+		}
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.depth--
+		if _, ok := p.peekOperator(")"); !ok {
+			return nil, fmt.Errorf("missing ) for ( at position %d", token.pos)
+		}
+		p.pos++
+		return node, nil
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", token.text, token.pos)
+}
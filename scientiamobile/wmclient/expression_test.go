@@ -0,0 +1,177 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpressionEvaluate(t *testing.T) {
+	device := &JSONDeviceData{Capabilities: map[string]string{
+		"is_mobile":        "true",
+		"is_smarttv":       "false",
+		"resolution_width": "1080",
+		"brand_name":       "Samsung",
+		"device_os":        "Android",
+	}}
+
+	tests := map[string]bool{
+		"is_mobile && resolution_width >= 768":    true,
+		"is_mobile && resolution_width < 768":     false,
+		"is_smarttv || brand_name == \"Samsung\"": true,
+		"!is_smarttv":                                           true,
+		"!(is_mobile && is_smarttv)":                            true,
+		"is_mobile == true && is_smarttv != true":               true,
+		"brand_name != \"Apple\" && device_os == \"Android\"":   true,
+		"resolution_width > 1000.5":                             true,
+		"is_smarttv && missing_cap":                             false, // short circuit, missing_cap is not evaluated
+		"(is_smarttv || is_mobile) && resolution_width == 1080": true,
+	}
+	for source, expected := range tests {
+		expr, err := CompileExpression(source)
+		require.Nil(t, err, source)
+		result, err := expr.Evaluate(device)
+		require.Nil(t, err, source)
+		require.Equal(t, expected, result, source)
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	for _, source := range []string{"", "is_mobile &&", "(is_mobile", "is_mobile ) ", "brand_name == \"Apple", "a = b", "1.2.3 > 1"} {
+		_, err := CompileExpression(source)
+		require.NotNil(t, err, source)
+	}
+
+	device := &JSONDeviceData{Capabilities: map[string]string{"brand_name": "Samsung", "resolution_width": "1080"}}
+	for _, source := range []string{"brand_name", "missing_cap", "brand_name > 10", "resolution_width && true", "true < false"} {
+		expr, err := CompileExpression(source)
+		require.Nil(t, err, source)
+		_, err = expr.Evaluate(device)
+		require.NotNil(t, err, source)
+	}
+
+	expr, _ := CompileExpression("is_mobile")
+	_, err := expr.Evaluate(nil)
+	require.NotNil(t, err)
+}
+
+func TestExpressionCapabilities(t *testing.T) {
+	expr, err := CompileExpression("is_mobile && (resolution_width >= 768 || is_mobile) && brand_name != \"Apple\"")
+	require.Nil(t, err)
+	require.Equal(t, []string{"brand_name", "is_mobile", "resolution_width"}, expr.Capabilities())
+	require.Equal(t, "is_mobile && (resolution_width >= 768 || is_mobile) && brand_name != \"Apple\"", expr.String())
+}
+
+func TestCheckExpression(t *testing.T) {
+	client := &WmClient{StaticCaps: []string{"brand_name", "resolution_width"}, VirtualCaps: []string{"is_mobile"}}
+	expr, err := CompileExpression("is_mobile && resolution_width >= 768")
+	require.Nil(t, err)
+	require.Nil(t, client.CheckExpression(expr))
+
+	expr, err = CompileExpression("is_mobile && is_unknown_cap")
+	require.Nil(t, err)
+	err = client.CheckExpression(expr)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "is_unknown_cap")
+}
+
+func TestExpressionWithSchema(t *testing.T) {
+	schema := []CapabilitySchema{
+		{Name: "model_name", Type: CapabilityString},
+		{Name: "marketing_name", Type: CapabilityString},
+		{Name: "resolution_width", Type: CapabilityInt},
+		{Name: "is_mobile", Type: CapabilityBool},
+		{Name: "xhtml_support_level", Type: CapabilityString, Inferred: true},
+	}
+	device := &JSONDeviceData{Capabilities: map[string]string{
+		"model_name":          "1.0",
+		"marketing_name":      "1",
+		"resolution_width":    "1080",
+		"is_mobile":           "true",
+		"xhtml_support_level": "4",
+		"release_year":        "2020",
+	}}
+
+	tests := map[string]bool{
+		// string capabilities are compared lexically, even if their values look like numbers
+		"model_name == marketing_name":     false,
+		"model_name > marketing_name":      true,
+		"resolution_width > 999":           true,
+		"is_mobile == true":                true,
+		"xhtml_support_level < 10":         true,
+		"release_year >= resolution_width": true,
+	}
+	for source, expected := range tests {
+		expr, err := CompileExpressionWithSchema(source, schema)
+		require.Nil(t, err, source)
+		result, err := expr.Evaluate(device)
+		require.Nil(t, err, source)
+		require.Equal(t, expected, result, source)
+	}
+
+	// without schema the values are compared as numbers
+	expr, err := CompileExpression("model_name == marketing_name")
+	require.Nil(t, err)
+	result, err := expr.Evaluate(device)
+	require.Nil(t, err)
+	require.True(t, result)
+
+	for _, source := range []string{"model_name == 1", "resolution_width == \"1080\"", "is_mobile == 1", "model_name && is_mobile",
+		"!resolution_width", "resolution_width == is_mobile"} {
+		_, err = CompileExpressionWithSchema(source, schema)
+		require.NotNil(t, err, source)
+	}
+}
+
+func TestExpressionDepth(t *testing.T) {
+	_, err := CompileExpression(strings.Repeat("!", maxExpressionDepth) + "true")
+	require.Nil(t, err)
+	_, err = CompileExpression(strings.Repeat("(", maxExpressionDepth) + "true" + strings.Repeat(")", maxExpressionDepth))
+	require.Nil(t, err)
+
+	_, err = CompileExpression(strings.Repeat("!", 100000) + "true")
+	require.NotNil(t, err)
+	_, err = CompileExpression(strings.Repeat("(", maxExpressionDepth+1) + "true" + strings.Repeat(")", maxExpressionDepth+1))
+	require.NotNil(t, err)
+	_, err = CompileExpression(strings.Repeat("!(", maxExpressionDepth/2+1) + "true" + strings.Repeat(")", maxExpressionDepth/2+1))
+	require.NotNil(t, err)
+}
+
+func TestCompileTypedExpression(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == capabilitySchemaPath {
+			w.Write([]byte(`[{"name":"model_name","type":"string"},{"name":"is_mobile","type":"bool","virtual":true}]`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	expr, err := client.CompileTypedExpression(context.Background(), "is_mobile && model_name == \"10\"")
+	require.Nil(t, err)
+	result, err := expr.Evaluate(&JSONDeviceData{Capabilities: map[string]string{"is_mobile": "true", "model_name": "10.0"}})
+	require.Nil(t, err)
+	require.False(t, result)
+	_, err = client.CompileTypedExpression(context.Background(), "model_name > 9")
+	require.NotNil(t, err)
+}
@@ -0,0 +1,36 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package featureflags evaluates feature flags whose rules target device attributes (brand, form factor, OS version
+// ranges and any other capability), detecting the device with a WM client, so that services do not need custom glue to
+// pass device data to their flag rules.
+//
+// Provider follows the OpenFeature provider contract (typed evaluations that take a flattened evaluation context and return
+// the value with its variant and reason) without depending on the OpenFeature SDK: adapting it to the SDK FeatureProvider
+// interface only requires converting the result types. The device is detected from the wurfl_id or the user agent set in the
+// evaluation context:
+//
+//	provider := featureflags.NewProvider(client, map[string]featureflags.Flag{
+//		"new-checkout": {
+//			Variants:       map[string]interface{}{"on": true, "off": false},
+//			DefaultVariant: "off",
+//			Rules:          []featureflags.Rule{{OS: "Android", MinOSVersion: "10", Variant: "on"}},
+//		},
+//	})
+//	enabled := provider.BooleanEvaluation(ctx, "new-checkout", false, featureflags.FlattenedContext{
+//		featureflags.UserAgentKey: request.UserAgent(),
+//	}).Value
+package featureflags
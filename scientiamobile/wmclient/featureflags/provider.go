@@ -0,0 +1,300 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package featureflags
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/wurfl/wurfl-microservice-client-golang/v2/scientiamobile/wmclient"
+)
+
+// Evaluation context keys used to detect the device. The wurfl_id is used if both are set
+const (
+	DeviceIDKey  = "wurfl_id"
+	UserAgentKey = "user_agent"
+)
+
+// Reasons of the resolutions, as defined by OpenFeature
+const (
+	ReasonTargetingMatch = "TARGETING_MATCH" // a rule matched the device
+	ReasonDefault        = "DEFAULT"         // no rule matched, the flag default variant is used
+	ReasonError          = "ERROR"           // the evaluation failed, the default value given by the caller is used
+)
+
+// Error codes of the failed resolutions, as defined by OpenFeature
+const (
+	ErrorFlagNotFound = "FLAG_NOT_FOUND"
+	ErrorTypeMismatch = "TYPE_MISMATCH"
+	ErrorGeneral      = "GENERAL" // ie: the device could not be detected
+)
+
+// FlattenedContext is the evaluation context of a flag, as in OpenFeature
+type FlattenedContext map[string]interface{}
+
+// Metadata describes the provider
+type Metadata struct {
+	Name string
+}
+
+// Rule selects a variant for the devices that match all its conditions. Empty conditions match any device
+type Rule struct {
+	Brands       []string          // brand_name values, matched case insensitively
+	FormFactors  []string          // form_factor values, see the wmclient.FormFactor* constants
+	OS           string            // advertised_device_os value, matched case insensitively
+	MinOSVersion string            // lowest advertised_device_os_version, compared with wmclient.CompareVersions
+	MaxOSVersion string            // highest advertised_device_os_version, compared with wmclient.CompareVersions
+	Capabilities map[string]string // values of any other capability
+	Variant      string            // variant selected by the rule
+}
+
+// Flag is a feature flag: its variants and the rules selecting them. Rules are evaluated in order, the first one matching
+// the device selects the variant, DefaultVariant is used if none does or if the device is unknown
+type Flag struct {
+	Variants       map[string]interface{}
+	DefaultVariant string
+	Rules          []Rule
+}
+
+// ResolutionDetail holds the details of a flag resolution
+type ResolutionDetail struct {
+	Variant      string
+	Reason       string
+	ErrorCode    string // empty if the resolution succeeded
+	ErrorMessage string
+}
+
+// BoolResolutionDetail is the result of BooleanEvaluation
+type BoolResolutionDetail struct {
+	Value bool
+	ResolutionDetail
+}
+
+// StringResolutionDetail is the result of StringEvaluation
+type StringResolutionDetail struct {
+	Value string
+	ResolutionDetail
+}
+
+// IntResolutionDetail is the result of IntEvaluation
+type IntResolutionDetail struct {
+	Value int64
+	ResolutionDetail
+}
+
+// FloatResolutionDetail is the result of FloatEvaluation
+type FloatResolutionDetail struct {
+	Value float64
+	ResolutionDetail
+}
+
+// InterfaceResolutionDetail is the result of ObjectEvaluation
+type InterfaceResolutionDetail struct {
+	Value interface{}
+	ResolutionDetail
+}
+
+// Provider evaluates feature flags targeting devices. It is safe for concurrent use, its flags must not be changed after
+// its creation
+type Provider struct {
+	client *wmclient.WmClient
+	flags  map[string]Flag
+}
+
+// NewProvider returns a provider evaluating the given flags, by key, on the devices detected by the given client.
+// Rule conditions are evaluated on the capabilities returned by the client lookups: the capabilities listed by
+// RequiredCapabilities must be requested by the client, or the rules using them never match
+func NewProvider(client *wmclient.WmClient, flags map[string]Flag) *Provider {
+	return &Provider{client: client, flags: flags}
+}
+
+// Metadata returns the provider metadata
+func (p *Provider) Metadata() Metadata {
+	return Metadata{Name: "wurfl-microservice"}
+}
+
+// RequiredCapabilities returns the names of the capabilities read by the rules of the provider flags, in lexical order
+func (p *Provider) RequiredCapabilities() []string {
+	required := make(map[string]bool)
+	for _, flag := range p.flags {
+		for _, rule := range flag.Rules {
+			if len(rule.Brands) > 0 {
+				required[wmclient.CapBrandName] = true
+			}
+			if len(rule.FormFactors) > 0 {
+				required[wmclient.CapFormFactor] = true
+			}
+			if rule.OS != "" {
+				required[wmclient.CapOS] = true
+			}
+			if rule.MinOSVersion != "" || rule.MaxOSVersion != "" {
+				required[wmclient.CapOSVersion] = true
+			}
+			for name := range rule.Capabilities {
+				required[name] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(required))
+	for name := range required {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BooleanEvaluation returns the value of a boolean flag for the device of the given evaluation context
+func (p *Provider) BooleanEvaluation(ctx context.Context, flag string, defaultValue bool, evalCtx FlattenedContext) BoolResolutionDetail {
+	value, detail := p.resolve(ctx, flag, evalCtx)
+	if typed, ok := value.(bool); ok && detail.ErrorCode == "" {
+		return BoolResolutionDetail{Value: typed, ResolutionDetail: detail}
+	}
+	return BoolResolutionDetail{Value: defaultValue, ResolutionDetail: typeMismatch(flag, value, detail)}
+}
+
+// StringEvaluation returns the value of a string flag for the device of the given evaluation context
+func (p *Provider) StringEvaluation(ctx context.Context, flag string, defaultValue string, evalCtx FlattenedContext) StringResolutionDetail {
+	value, detail := p.resolve(ctx, flag, evalCtx)
+	if typed, ok := value.(string); ok && detail.ErrorCode == "" {
+		return StringResolutionDetail{Value: typed, ResolutionDetail: detail}
+	}
+	return StringResolutionDetail{Value: defaultValue, ResolutionDetail: typeMismatch(flag, value, detail)}
+}
+
+// IntEvaluation returns the value of an integer flag, whose variants are int or int64, for the device of the given
+// evaluation context
+func (p *Provider) IntEvaluation(ctx context.Context, flag string, defaultValue int64, evalCtx FlattenedContext) IntResolutionDetail {
+	value, detail := p.resolve(ctx, flag, evalCtx)
+	if detail.ErrorCode == "" {
+		switch typed := value.(type) {
+		case int64:
+			return IntResolutionDetail{Value: typed, ResolutionDetail: detail}
+		case int:
+			return IntResolutionDetail{Value: int64(typed), ResolutionDetail: detail}
+		}
+	}
+	return IntResolutionDetail{Value: defaultValue, ResolutionDetail: typeMismatch(flag, value, detail)}
+}
+
+// FloatEvaluation returns the value of a float flag for the device of the given evaluation context
+func (p *Provider) FloatEvaluation(ctx context.Context, flag string, defaultValue float64, evalCtx FlattenedContext) FloatResolutionDetail {
+	value, detail := p.resolve(ctx, flag, evalCtx)
+	if typed, ok := value.(float64); ok && detail.ErrorCode == "" {
+		return FloatResolutionDetail{Value: typed, ResolutionDetail: detail}
+	}
+	return FloatResolutionDetail{Value: defaultValue, ResolutionDetail: typeMismatch(flag, value, detail)}
+}
+
+// ObjectEvaluation returns the value of a flag of any type for the device of the given evaluation context
+func (p *Provider) ObjectEvaluation(ctx context.Context, flag string, defaultValue interface{}, evalCtx FlattenedContext) InterfaceResolutionDetail {
+	value, detail := p.resolve(ctx, flag, evalCtx)
+	if detail.ErrorCode != "" {
+		return InterfaceResolutionDetail{Value: defaultValue, ResolutionDetail: detail}
+	}
+	return InterfaceResolutionDetail{Value: value, ResolutionDetail: detail}
+}
+
+// typeMismatch returns the details of a resolution whose value does not have the evaluation type, unless it already failed
+func typeMismatch(flag string, value interface{}, detail ResolutionDetail) ResolutionDetail {
+	if detail.ErrorCode != "" {
+		return detail
+	}
+	return ResolutionDetail{Variant: detail.Variant, Reason: ReasonError, ErrorCode: ErrorTypeMismatch,
+		ErrorMessage: fmt.Sprintf("variant %s of flag %s is a %T", detail.Variant, flag, value)}
+}
+
+// resolve returns the value of the given flag for the device of the given evaluation context
+func (p *Provider) resolve(ctx context.Context, key string, evalCtx FlattenedContext) (interface{}, ResolutionDetail) {
+	flag, ok := p.flags[key]
+	if !ok {
+		return nil, ResolutionDetail{Reason: ReasonError, ErrorCode: ErrorFlagNotFound, ErrorMessage: "unknown flag " + key}
+	}
+
+	device, err := p.detect(ctx, evalCtx)
+	if err != nil {
+		return nil, ResolutionDetail{Reason: ReasonError, ErrorCode: ErrorGeneral, ErrorMessage: err.Error()}
+	}
+	variant, reason := flag.DefaultVariant, ReasonDefault
+	if device != nil {
+		for _, rule := range flag.Rules {
+			if rule.matches(wmclient.NewDevice(device)) {
+				variant, reason = rule.Variant, ReasonTargetingMatch
+				break
+			}
+		}
+	}
+
+	value, ok := flag.Variants[variant]
+	if !ok {
+		return nil, ResolutionDetail{Variant: variant, Reason: ReasonError, ErrorCode: ErrorGeneral,
+			ErrorMessage: fmt.Sprintf("flag %s has no variant %s", key, variant)}
+	}
+	return value, ResolutionDetail{Variant: variant, Reason: reason}
+}
+
+// detect returns the device of the given evaluation context, nil if the context does not identify any
+func (p *Provider) detect(ctx context.Context, evalCtx FlattenedContext) (*wmclient.JSONDeviceData, error) {
+	if id, ok := evalCtx[DeviceIDKey].(string); ok && id != "" {
+		return p.client.LookupDeviceID(ctx, id)
+	}
+	if userAgent, ok := evalCtx[UserAgentKey].(string); ok && userAgent != "" {
+		return p.client.LookupUserAgent(ctx, userAgent)
+	}
+	return nil, nil
+}
+
+// matches returns true if the given device matches all the rule conditions
+func (r *Rule) matches(device wmclient.Device) bool {
+	if len(r.Brands) > 0 && !containsFold(r.Brands, device.Brand()) {
+		return false
+	}
+	if len(r.FormFactors) > 0 && !containsFold(r.FormFactors, device.FormFactor()) {
+		return false
+	}
+	if r.OS != "" && !strings.EqualFold(r.OS, device.OS()) {
+		return false
+	}
+	if r.MinOSVersion != "" || r.MaxOSVersion != "" {
+		version := device.OSVersion()
+		if version == "" {
+			return false
+		}
+		if r.MinOSVersion != "" && wmclient.CompareVersions(version, r.MinOSVersion) < 0 {
+			return false
+		}
+		if r.MaxOSVersion != "" && wmclient.CompareVersions(version, r.MaxOSVersion) > 0 {
+			return false
+		}
+	}
+	for name, value := range r.Capabilities {
+		if actual, ok := device.Capabilities[name]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+// containsFold returns true if values holds the given value, compared case insensitively
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
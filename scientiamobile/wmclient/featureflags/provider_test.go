@@ -0,0 +1,154 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package featureflags
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wurfl/wurfl-microservice-client-golang/v2/scientiamobile/wmclient"
+)
+
+var testDevices = map[string]map[string]string{
+	"pixel_7": {"brand_name": "Google", "form_factor": "Smartphone", "advertised_device_os": "Android",
+		"advertised_device_os_version": "13", "is_app_webview": "false"},
+	"galaxy_tab": {"brand_name": "Samsung", "form_factor": "Tablet", "advertised_device_os": "Android",
+		"advertised_device_os_version": "9.1", "is_app_webview": "false"},
+	"iphone_webview": {"brand_name": "Apple", "form_factor": "Smartphone", "advertised_device_os": "iOS",
+		"advertised_device_os_version": "16.4", "is_app_webview": "true"},
+}
+
+// newTestProvider returns a provider using a client of a fake WM server, to be closed with the returned function
+func newTestProvider(t *testing.T, flags map[string]Flag) (*Provider, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/getinfo/json" {
+			json.NewEncoder(w).Encode(wmclient.JSONInfoData{WmVersion: "2.0.0", WurflAPIVersion: "1.12", WurflInfo: "test",
+				Ltime: "1", ImportantHeaders: []string{"User-Agent"}, StaticCaps: []string{"brand_name"}})
+			return
+		}
+		var request wmclient.Request
+		json.NewDecoder(r.Body).Decode(&request)
+		id := request.WurflID
+		if ua := request.LookupHeaders["User-Agent"]; ua != "" {
+			id = ua // test user agents are wurfl_ids
+		}
+		caps, ok := testDevices[id]
+		if !ok {
+			json.NewEncoder(w).Encode(wmclient.JSONDeviceData{Ltime: "1", Capabilities: map[string]string{"wurfl_id": "generic"}})
+			return
+		}
+		data := wmclient.JSONDeviceData{Ltime: "1", Capabilities: map[string]string{"wurfl_id": id}}
+		for name, value := range caps {
+			data.Capabilities[name] = value
+		}
+		json.NewEncoder(w).Encode(data)
+	}))
+
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	client, err := wmclient.Create("http", u.Hostname(), u.Port(), "")
+	require.NoError(t, err)
+	return NewProvider(client, flags), func() {
+		client.Close()
+		server.Close()
+	}
+}
+
+func TestProviderTargetsDeviceAttributes(t *testing.T) {
+	provider, closeProvider := newTestProvider(t, map[string]Flag{
+		"new-checkout": {
+			Variants:       map[string]interface{}{"on": true, "off": false},
+			DefaultVariant: "off",
+			Rules: []Rule{
+				{Capabilities: map[string]string{"is_app_webview": "true"}, Variant: "off"},
+				{OS: "android", MinOSVersion: "10", Variant: "on"},
+				{Brands: []string{"apple"}, FormFactors: []string{wmclient.FormFactorSmartphone}, Variant: "on"},
+			},
+		},
+		"layout": {
+			Variants:       map[string]interface{}{"compact": "compact", "wide": "wide"},
+			DefaultVariant: "compact",
+			Rules:          []Rule{{FormFactors: []string{wmclient.FormFactorTablet}, OS: "Android", MaxOSVersion: "9.2", Variant: "wide"}},
+		},
+	})
+	defer closeProvider()
+	ctx := context.Background()
+
+	res := provider.BooleanEvaluation(ctx, "new-checkout", false, FlattenedContext{DeviceIDKey: "pixel_7"})
+	assert.True(t, res.Value)
+	assert.Equal(t, ResolutionDetail{Variant: "on", Reason: ReasonTargetingMatch}, res.ResolutionDetail)
+
+	// 9.1 is lower than 10 when compared as a version
+	res = provider.BooleanEvaluation(ctx, "new-checkout", true, FlattenedContext{UserAgentKey: "galaxy_tab"})
+	assert.False(t, res.Value)
+	assert.Equal(t, ResolutionDetail{Variant: "off", Reason: ReasonDefault}, res.ResolutionDetail)
+
+	// the first matching rule wins
+	res = provider.BooleanEvaluation(ctx, "new-checkout", true, FlattenedContext{DeviceIDKey: "iphone_webview"})
+	assert.False(t, res.Value)
+	assert.Equal(t, ReasonTargetingMatch, res.Reason)
+
+	// unknown device and missing device
+	res = provider.BooleanEvaluation(ctx, "new-checkout", true, FlattenedContext{UserAgentKey: "unknown"})
+	assert.Equal(t, ResolutionDetail{Variant: "off", Reason: ReasonDefault}, res.ResolutionDetail)
+	res = provider.BooleanEvaluation(ctx, "new-checkout", true, nil)
+	assert.Equal(t, ResolutionDetail{Variant: "off", Reason: ReasonDefault}, res.ResolutionDetail)
+
+	layout := provider.StringEvaluation(ctx, "layout", "", FlattenedContext{DeviceIDKey: "galaxy_tab"})
+	assert.Equal(t, "wide", layout.Value)
+	layout = provider.StringEvaluation(ctx, "layout", "", FlattenedContext{DeviceIDKey: "pixel_7"})
+	assert.Equal(t, "compact", layout.Value)
+
+	assert.Equal(t, []string{"advertised_device_os", "advertised_device_os_version", "brand_name", "form_factor", "is_app_webview"},
+		provider.RequiredCapabilities())
+}
+
+func TestProviderErrors(t *testing.T) {
+	provider, closeProvider := newTestProvider(t, map[string]Flag{
+		"limit": {Variants: map[string]interface{}{"low": 10, "high": int64(100)}, DefaultVariant: "low",
+			Rules: []Rule{{FormFactors: []string{wmclient.FormFactorTablet}, Variant: "high"}}},
+		"broken": {Variants: map[string]interface{}{"on": true}, DefaultVariant: "off"},
+	})
+	defer closeProvider()
+	ctx := context.Background()
+
+	limit := provider.IntEvaluation(ctx, "limit", 1, FlattenedContext{DeviceIDKey: "galaxy_tab"})
+	assert.Equal(t, int64(100), limit.Value)
+	limit = provider.IntEvaluation(ctx, "limit", 1, FlattenedContext{DeviceIDKey: "pixel_7"})
+	assert.Equal(t, int64(10), limit.Value)
+
+	object := provider.ObjectEvaluation(ctx, "limit", nil, FlattenedContext{DeviceIDKey: "pixel_7"})
+	assert.Equal(t, 10, object.Value)
+
+	mismatch := provider.StringEvaluation(ctx, "limit", "default", FlattenedContext{DeviceIDKey: "pixel_7"})
+	assert.Equal(t, "default", mismatch.Value)
+	assert.Equal(t, ReasonError, mismatch.Reason)
+	assert.Equal(t, ErrorTypeMismatch, mismatch.ErrorCode)
+
+	missing := provider.FloatEvaluation(ctx, "missing", 0.5, nil)
+	assert.Equal(t, 0.5, missing.Value)
+	assert.Equal(t, ErrorFlagNotFound, missing.ErrorCode)
+
+	broken := provider.BooleanEvaluation(ctx, "broken", true, nil)
+	assert.True(t, broken.Value)
+	assert.Equal(t, ErrorGeneral, broken.ErrorCode)
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// FormatJSON is the media type of the JSON response format, which is supported by every WM server
+const FormatJSON = "application/json"
+
+// ResponseDecoder decodes a WM server response body into v
+type ResponseDecoder func(body []byte, v interface{}) error
+
+var decodersMutex sync.RWMutex
+var responseDecoders = map[string]ResponseDecoder{FormatJSON: json.Unmarshal}
+
+// RegisterResponseFormat registers the decoder used for WM server responses having the given media type
+// (ie: "application/msgpack"), so that the format can be requested with SetAcceptFormats
+func RegisterResponseFormat(mediaType string, decoder ResponseDecoder) {
+	decodersMutex.Lock()
+	responseDecoders[strings.ToLower(mediaType)] = decoder
+	decodersMutex.Unlock()
+}
+
+func getResponseDecoder(mediaType string) (ResponseDecoder, bool) {
+	decodersMutex.RLock()
+	defer decodersMutex.RUnlock()
+	decoder, ok := responseDecoders[strings.ToLower(mediaType)]
+	return decoder, ok
+}
+
+// SetAcceptFormats sets the response formats (media types), in order of preference, that the client asks to the WM server
+// using the Accept header. JSON is always accepted as the least preferred format, and it is used for all the following
+// requests if the server replies that it cannot produce any of the preferred ones.
+// Every format must have been registered with RegisterResponseFormat. This function should be called before performing any lookup
+func (c *WmClient) SetAcceptFormats(mediaTypes []string) error {
+	if c == nil {
+		return ErrNilClient
+	}
+	for _, mediaType := range mediaTypes {
+		if _, ok := getResponseDecoder(mediaType); !ok {
+			return fmt.Errorf("no decoder registered for response format %s", mediaType)
+		}
+	}
+	c.acceptFormats = mediaTypes
+	atomic.StoreInt32(&c.formatFallback, 0)
+	return nil
+}
+
+// acceptHeader builds the Accept header value from the preferred formats, using decreasing quality values
+func (c *WmClient) acceptHeader() string {
+	if !c.negotiatesFormat() {
+		return FormatJSON
+	}
+
+	values := make([]string, 0, len(c.acceptFormats)+1)
+	hasJSON := false
+	for i, mediaType := range c.acceptFormats {
+		hasJSON = hasJSON || strings.EqualFold(mediaType, FormatJSON)
+		if i == 0 {
+			values = append(values, mediaType)
+			continue
+		}
+		values = append(values, fmt.Sprintf("%s;q=%.1f", mediaType, acceptQuality(i)))
+	}
+	if !hasJSON {
+		values = append(values, fmt.Sprintf("%s;q=%.1f", FormatJSON, acceptQuality(len(c.acceptFormats))))
+	}
+	return strings.Join(values, ", ")
+}
+
+// acceptQuality returns the quality value for the format at the given position in the preference list
+func acceptQuality(position int) float64 {
+	q := 1.0 - float64(position)*0.1
+	if q < 0.1 {
+		return 0.1
+	}
+	return q
+}
+
+// negotiatesFormat returns true if formats other than JSON can be requested to the server
+func (c *WmClient) negotiatesFormat() bool {
+	return len(c.acceptFormats) > 0 && atomic.LoadInt32(&c.formatFallback) == 0
+}
+
+// disableFormatNegotiation makes the client request JSON only, after the server refused the preferred formats
+func (c *WmClient) disableFormatNegotiation() {
+	atomic.StoreInt32(&c.formatFallback, 1)
+}
+
+// decodeResponse decodes the given response body into v, using the decoder registered for the response Content-Type.
+// Responses with a missing or unknown Content-Type are decoded as JSON. Decoding errors are returned as *DecodeError
+func (c *WmClient) decodeResponse(res *http.Response, body []byte, v interface{}) error {
+	decoder := ResponseDecoder(json.Unmarshal)
+	if mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type")); err == nil {
+		if d, ok := getResponseDecoder(mediaType); ok {
+			decoder = d
+		}
+	}
+	if err := decoder(body, v); err != nil {
+		return c.newDecodeError(res, body, len(body), err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptHeader(t *testing.T) {
+	client := &WmClient{}
+	require.Equal(t, "application/json", client.acceptHeader())
+
+	require.NotNil(t, client.SetAcceptFormats([]string{"application/x-unknown"}))
+
+	RegisterResponseFormat("application/x-test", func(body []byte, v interface{}) error {
+		return errors.New("test decoder")
+	})
+	require.Nil(t, client.SetAcceptFormats([]string{"application/x-test"}))
+	require.Equal(t, "application/x-test, application/json;q=0.9", client.acceptHeader())
+
+	// after a fallback only JSON is accepted
+	client.disableFormatNegotiation()
+	require.Equal(t, "application/json", client.acceptHeader())
+}
+
+func TestDecodeResponse(t *testing.T) {
+	client := &WmClient{}
+	RegisterResponseFormat("application/x-test", func(body []byte, v interface{}) error {
+		return errors.New("test decoder")
+	})
+
+	res := &http.Response{Header: make(http.Header)}
+	var info JSONInfoData
+
+	// missing content type: response is decoded as JSON
+	require.Nil(t, client.decodeResponse(res, []byte(`{"wm_version":"2.1.0"}`), &info))
+	require.Equal(t, "2.1.0", info.WmVersion)
+
+	res.Header.Set("Content-Type", "application/json; charset=utf-8")
+	require.Nil(t, client.decodeResponse(res, []byte(`{"wm_version":"2.1.1"}`), &info))
+	require.Equal(t, "2.1.1", info.WmVersion)
+
+	res.Header.Set("Content-Type", "application/x-test")
+	err := client.decodeResponse(res, []byte(`{}`), &info)
+	var decodeErr *DecodeError
+	require.True(t, errors.As(err, &decodeErr))
+	require.Equal(t, "application/x-test", decodeErr.ContentType)
+	require.EqualError(t, errors.Unwrap(err), "test decoder")
+}
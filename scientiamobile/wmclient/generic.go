@@ -0,0 +1,62 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+// The generic devices are well-formed device data to be used when a device cannot be detected, ie: when WM server cannot be
+// reached, and in tests. They hold the wurfl_id and the capabilities read by Device, with the values WURFL gives to its
+// generic devices. Each function returns a new copy, which the caller can modify
+
+// GenericDevice returns the device data of the WURFL root device, "generic", which is neither a mobile device nor a desktop
+func GenericDevice() *JSONDeviceData {
+	return newGenericDevice("generic", "", false, false, false, FormFactorOtherNonMobile)
+}
+
+// GenericMobile returns the device data of "generic_mobile", a mobile phone that is not a smartphone
+func GenericMobile() *JSONDeviceData {
+	return newGenericDevice("generic_mobile", "", true, false, false, FormFactorFeaturePhone)
+}
+
+// GenericTablet returns the device data of "generic_android_ver3_0", the generic Android tablet
+func GenericTablet() *JSONDeviceData {
+	return newGenericDevice("generic_android_ver3_0", "Android", true, true, false, FormFactorTablet)
+}
+
+func newGenericDevice(wurflID string, os string, mobile bool, tablet bool, smartphone bool, formFactor string) *JSONDeviceData {
+	return &JSONDeviceData{
+		DeviceID: wurflID,
+		Capabilities: map[string]string{
+			wurflIDCapability: wurflID,
+			CapBrandName:      "Generic",
+			CapModelName:      "",
+			CapMarketingName:  "",
+			CapIsMobile:       formatBool(mobile),
+			CapIsTablet:       formatBool(tablet),
+			CapIsSmartphone:   formatBool(smartphone),
+			CapIsRobot:        "false",
+			CapFormFactor:     formFactor,
+			CapOS:             os,
+			CapOSVersion:      "",
+		},
+	}
+}
+
+// formatBool returns the WURFL representation of a boolean capability value
+func formatBool(value bool) string {
+	if value {
+		return "true"
+	}
+	return "false"
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenericDevices(t *testing.T) {
+	generic := NewDevice(GenericDevice())
+	require.Equal(t, "generic", generic.WurflID())
+	require.Equal(t, "generic", generic.Capabilities[wurflIDCapability])
+	require.Equal(t, "Generic", generic.Brand())
+	require.False(t, generic.IsMobile())
+	require.Equal(t, FormFactorOtherNonMobile, generic.FormFactor())
+
+	mobile := NewDevice(GenericMobile())
+	require.Equal(t, "generic_mobile", mobile.WurflID())
+	require.True(t, mobile.IsMobile())
+	require.False(t, mobile.IsTablet())
+	require.False(t, mobile.IsSmartphone())
+
+	tablet := NewDevice(GenericTablet())
+	require.True(t, tablet.IsMobile())
+	require.True(t, tablet.IsTablet())
+	require.Equal(t, FormFactorTablet, tablet.FormFactor())
+	require.False(t, tablet.IsBot())
+
+	// every call returns a new copy
+	GenericMobile().Capabilities[CapBrandName] = "Changed"
+	require.Equal(t, "Generic", GenericMobile().Capabilities[CapBrandName])
+}
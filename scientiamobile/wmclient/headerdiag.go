@@ -0,0 +1,88 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import "strings"
+
+// HeaderMismatchEvent is sent to the stats hook, when header diagnostics are enabled, every time an inbound header looks like
+// one of the important headers but the client could not map it, ie: a non canonical key in an http.Header or a CGI style name
+// such as HTTP_USER_AGENT. Such headers are not sent to WM server and may lead to a less accurate detection
+type HeaderMismatchEvent struct {
+	ImportantHeader string // important header name, as returned by WM server
+	ReceivedHeader  string // name of the inbound header that could not be mapped
+}
+
+// SetHeaderDiagnostics enables or disables the detection of inbound headers that the client failed to map to the important
+// headers. Mismatches are counted, see GetHeaderMismatchCounts, and reported to the stats hook as HeaderMismatchEvent values.
+// Diagnostics add some overhead to each lookup, so they are disabled by default. This function should be called before
+// performing any lookup
+func (c *WmClient) SetHeaderDiagnostics(enabled bool) {
+	if c == nil {
+		return
+	}
+	c.headerDiagnostics = enabled
+}
+
+// GetHeaderMismatchCounts returns, for each important header, the number of lookups in which it was present in the inbound
+// headers but could not be mapped. Only lookups done with header diagnostics enabled are counted
+func (c *WmClient) GetHeaderMismatchCounts() map[string]uint64 {
+	if c == nil {
+		return nil
+	}
+	c.headerMismatchMutex.Lock()
+	defer c.headerMismatchMutex.Unlock()
+
+	counts := make(map[string]uint64, len(c.headerMismatches))
+	for name, count := range c.headerMismatches {
+		counts[name] = count
+	}
+	return counts
+}
+
+// checkHeaderMismatches looks for received header names that match an important header not found in the mapped ones
+func (c *WmClient) checkHeaderMismatches(received []string, mapped map[string]string) {
+	if !c.headerDiagnostics {
+		return
+	}
+
+	for _, important := range c.ImportantHeaders {
+		if _, ok := mapped[important]; ok {
+			continue
+		}
+		lowerImportant := strings.ToLower(important)
+		for _, name := range received {
+			if normalizeHeaderName(name) != lowerImportant {
+				continue
+			}
+			c.headerMismatchMutex.Lock()
+			if c.headerMismatches == nil {
+				c.headerMismatches = make(map[string]uint64)
+			}
+			c.headerMismatches[important]++
+			c.headerMismatchMutex.Unlock()
+
+			c.emitStats(HeaderMismatchEvent{ImportantHeader: important, ReceivedHeader: name})
+			break
+		}
+	}
+}
+
+// normalizeHeaderName returns the lowercase, dash separated form of the given header name, without the CGI HTTP_ prefix
+func normalizeHeaderName(name string) string {
+	name = strings.ToLower(name)
+	name = strings.TrimPrefix(name, "http_")
+	return strings.Replace(name, "_", "-", -1)
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderMismatchDiagnostics(t *testing.T) {
+	client := &WmClient{ImportantHeaders: []string{"User-Agent", "X-UCBrowser-Device-UA", "Device-Stock-UA"}}
+
+	var events []HeaderMismatchEvent
+	client.SetStatsHook(func(event interface{}) {
+		if e, ok := event.(HeaderMismatchEvent); ok {
+			events = append(events, e)
+		}
+	})
+
+	received := []string{"user-agent", "HTTP_X_UCBROWSER_DEVICE_UA", "Device-Stock-UA", "Accept"}
+	mapped := map[string]string{"Device-Stock-UA": "Mozilla/5.0"}
+
+	// disabled by default
+	client.checkHeaderMismatches(received, mapped)
+	require.Empty(t, events)
+	require.Empty(t, client.GetHeaderMismatchCounts())
+
+	client.SetHeaderDiagnostics(true)
+	client.checkHeaderMismatches(received, mapped)
+	client.checkHeaderMismatches([]string{"user_agent"}, map[string]string{})
+	require.Equal(t, []HeaderMismatchEvent{
+		{ImportantHeader: "User-Agent", ReceivedHeader: "user-agent"},
+		{ImportantHeader: "X-UCBrowser-Device-UA", ReceivedHeader: "HTTP_X_UCBROWSER_DEVICE_UA"},
+		{ImportantHeader: "User-Agent", ReceivedHeader: "user_agent"},
+	}, events)
+	require.Equal(t, map[string]uint64{"User-Agent": 2, "X-UCBrowser-Device-UA": 1}, client.GetHeaderMismatchCounts())
+}
+
+func TestNormalizeHeaderName(t *testing.T) {
+	require.Equal(t, "user-agent", normalizeHeaderName("HTTP_USER_AGENT"))
+	require.Equal(t, "user-agent", normalizeHeaderName("User_Agent"))
+	require.Equal(t, "x-wap-profile", normalizeHeaderName("X-Wap-Profile"))
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import "strings"
+
+// HeaderSource gives access, by case insensitive name, to all the headers received by a lookup, not only to the important ones
+type HeaderSource interface {
+	Get(name string) string
+}
+
+// LookupHeadersHook modifies the headers sent to WM server by a lookup, ie: to set the User-Agent to the original one that
+// an app webview sends in a custom header. lookupHeaders holds the important headers found in the received headers and
+// can be changed in place; received gives access to all of them. The hook is called before the UA cache is searched, so
+// that the cache key is computed on the modified headers: it must then always make the same changes for the same headers
+type LookupHeadersHook func(lookupHeaders map[string]string, received HeaderSource)
+
+// SetLookupHeadersHook sets the hook applied to the headers of header and user-agent lookups. A nil hook disables it.
+// This function should be called before performing any lookup
+func (c *WmClient) SetLookupHeadersHook(hook LookupHeadersHook) {
+	if c == nil {
+		return
+	}
+	c.lookupHeadersHook = hook
+}
+
+// lowerCaseHeaders is a HeaderSource over headers whose names are lowercase
+type lowerCaseHeaders map[string]string
+
+func (h lowerCaseHeaders) Get(name string) string {
+	return h[strings.ToLower(name)]
+}
+
+// applyLookupHeadersHook calls the lookup headers hook, if one is set
+func (c *WmClient) applyLookupHeadersHook(lookupHeaders map[string]string, received HeaderSource) {
+	if c.lookupHeadersHook != nil {
+		c.lookupHeadersHook(lookupHeaders, received)
+	}
+}
+
+// userAgentLookupHeaders returns the headers sent by a lookup of the given user-agent
+func (c *WmClient) userAgentLookupHeaders(userAgent string) map[string]string {
+	headers := map[string]string{userAgentHeader: userAgent}
+	c.applyLookupHeadersHook(headers, lowerCaseHeaders{strings.ToLower(userAgentHeader): userAgent})
+	return headers
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupHeadersHook(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+		received = append(received, request.LookupHeaders[userAgentHeader])
+		w.Write([]byte(`{"capabilities":{"wurfl_id":"generic"}}`))
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.ImportantHeaders = []string{userAgentHeader}
+	client.SetCacheSize(100)
+
+	// the app webview sends the original browser user-agent in a custom header
+	client.SetLookupHeadersHook(func(lookupHeaders map[string]string, received HeaderSource) {
+		if original := received.Get("X-Original-UA"); original != "" {
+			lookupHeaders[userAgentHeader] = original
+		}
+	})
+	originalUA := "Mozilla/5.0 (Linux; Android 13; SM-S901B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/112.0.0.0 Mobile Safari/537.36"
+
+	_, err := client.LookupHeaders(context.Background(), map[string]string{"User-Agent": "MyApp/1.0 webview", "x-original-ua": originalUA})
+	require.Nil(t, err)
+	request, err := http.NewRequest("GET", "http://mysite.com/", nil)
+	require.Nil(t, err)
+	request.Header.Set("User-Agent", "MyApp/2.0 webview")
+	request.Header.Set("X-Original-UA", originalUA)
+	_, err = client.LookupRequestContext(context.Background(), request)
+	require.Nil(t, err)
+	_, err = client.LookupUserAgent(context.Background(), originalUA)
+	require.Nil(t, err)
+
+	// the cache key is computed on the modified headers: all the lookups detect the same user-agent
+	require.Equal(t, []string{originalUA}, received)
+
+	_, err = client.LookupUserAgent(context.Background(), "MyApp/1.0 webview")
+	require.Nil(t, err)
+	require.Equal(t, []string{originalUA, "MyApp/1.0 webview"}, received)
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"net/http"
+	"time"
+)
+
+// CloseIdleConnections closes the connections to WM server that are not serving a request, so that the following requests
+// open new ones. Connections in use are not interrupted. Call it, ie: when WM server is known to have been restarted or
+// before a daemon goes idle for a long time, to avoid lookups failing on connections the server has already closed
+func (c *WmClient) CloseIdleConnections() {
+	if c == nil || c.httpClient == nil {
+		return
+	}
+	c.httpClient.CloseIdleConnections()
+}
+
+// SetMaxIdleTime sets how long a connection to WM server can stay idle before it is closed. Connections kept idle across
+// a WM server restart fail the first requests sent on them, so long-idle clients should use a limit shorter than the time
+// the server, or a load balancer in front of it, keeps idle connections open. A value <= 0, the default, keeps idle
+// connections open indefinitely. It applies to the default transport only: the idle timeout of an http.Client given with
+// WithHTTPClient must be set on its transport. This function should be called before performing any lookup
+func (c *WmClient) SetMaxIdleTime(maxIdleTime time.Duration) {
+	if c == nil {
+		return
+	}
+	c.maxIdleTime = maxIdleTime
+	if c.httpClient != nil && c.transport == nil {
+		c.applyMaxIdleTime()
+	}
+}
+
+// WithMaxIdleTime sets how long a connection to WM server can stay idle before it is closed, as SetMaxIdleTime does
+func WithMaxIdleTime(maxIdleTime time.Duration) Option {
+	return func(options *clientOptions) {
+		options.maxIdleTime = maxIdleTime
+	}
+}
+
+// applyMaxIdleTime sets the idle connection timeout of the client in the default transport
+func (c *WmClient) applyMaxIdleTime() {
+	transport, ok := c.httpClient.Transport.(*http.Transport)
+	if !ok {
+		return
+	}
+	if c.maxIdleTime > 0 {
+		transport.IdleConnTimeout = c.maxIdleTime
+	} else {
+		transport.IdleConnTimeout = 0
+	}
+}
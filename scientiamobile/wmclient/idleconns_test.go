@@ -0,0 +1,77 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloseIdleConnections(t *testing.T) {
+	var lookups int32
+	server := httptest.NewServer(newOptionsTestHandler("", &lookups))
+	defer server.Close()
+	client, err := CreateFromURL(server.URL)
+	require.Nil(t, err)
+	defer client.Close()
+	_, err = client.LookupUserAgent(context.Background(), "ua")
+	require.Nil(t, err)
+	require.Equal(t, 1, client.GetConnectionStats().Idle)
+
+	client.CloseIdleConnections()
+	stats := client.GetConnectionStats()
+	require.Equal(t, 0, stats.Open)
+	require.Equal(t, uint64(1), stats.Closed)
+
+	// a new connection is opened by the following lookup
+	_, err = client.LookupUserAgent(context.Background(), "ua")
+	require.Nil(t, err)
+	require.Equal(t, uint64(2), client.GetConnectionStats().Created)
+}
+
+func TestMaxIdleTime(t *testing.T) {
+	var lookups int32
+	server := httptest.NewServer(newOptionsTestHandler("", &lookups))
+	defer server.Close()
+	client, err := CreateFromURL(server.URL, WithMaxIdleTime(50*time.Millisecond))
+	require.Nil(t, err)
+	defer client.Close()
+	_, err = client.LookupUserAgent(context.Background(), "ua")
+	require.Nil(t, err)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for client.GetConnectionStats().Open > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Equal(t, 0, client.GetConnectionStats().Open)
+
+	// the limit is kept when the timeouts change, and can be removed
+	client.SetHTTPTimeout(5, 10)
+	require.Equal(t, 50*time.Millisecond, client.httpClient.Transport.(*http.Transport).IdleConnTimeout)
+	client.SetMaxIdleTime(0)
+	require.Equal(t, time.Duration(0), client.httpClient.Transport.(*http.Transport).IdleConnTimeout)
+
+	cfg := Config{URL: server.URL, MaxIdleTime: Duration(time.Minute)}
+	client, err = NewFromConfig(cfg)
+	require.Nil(t, err)
+	defer client.Close()
+	require.Equal(t, time.Minute, client.httpClient.Transport.(*http.Transport).IdleConnTimeout)
+}
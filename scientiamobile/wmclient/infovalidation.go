@@ -0,0 +1,79 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import "strings"
+
+// InfoValidation selects the checks done on the WM server information read by Create and GetInfo
+type InfoValidation int
+
+const (
+	// InfoValidationStrict requires all the WM server information: wm_version, wurfl_api_version, wurfl_info and at least
+	// one capability, static or virtual. It is the default
+	InfoValidationStrict InfoValidation = iota
+	// InfoValidationLenient requires wm_version only, so that minimal WM servers, or test ones, publishing no capability are
+	// accepted. Lookups return the capabilities chosen by the server, since none can be requested
+	InfoValidationLenient
+)
+
+// InfoValidationError is returned by Create and GetInfo when the WM server information misses required fields
+type InfoValidationError struct {
+	Missing []string // JSON names of the missing fields, ie: wurfl_info
+}
+
+func (e *InfoValidationError) Error() string {
+	return "server returned empty data or a wrong json format: missing " + strings.Join(e.Missing, ", ")
+}
+
+// SetInfoValidation sets the checks done on the WM server information by the following GetInfo calls. Use WithInfoValidation
+// to set them for the checks done by CreateWithOptions
+func (c *WmClient) SetInfoValidation(validation InfoValidation) {
+	if c == nil {
+		return
+	}
+	c.infoValidation = validation
+}
+
+// WithInfoValidation sets the checks done on the WM server information, when the client is created and by GetInfo
+func WithInfoValidation(validation InfoValidation) Option {
+	return func(options *clientOptions) {
+		options.infoValidation = validation
+	}
+}
+
+// validateInfo returns an InfoValidationError if the given WM server information misses the fields required by the
+// given validation
+func validateInfo(info *JSONInfoData, validation InfoValidation) error {
+	var missing []string
+	if info.WmVersion == "" {
+		missing = append(missing, "wm_version")
+	}
+	if validation == InfoValidationStrict {
+		if info.WurflAPIVersion == "" {
+			missing = append(missing, "wurfl_api_version")
+		}
+		if info.WurflInfo == "" {
+			missing = append(missing, "wurfl_info")
+		}
+		if len(info.StaticCaps) == 0 && len(info.VirtualCaps) == 0 {
+			missing = append(missing, "static_caps or virtual_caps")
+		}
+	}
+	if len(missing) > 0 {
+		return &InfoValidationError{Missing: missing}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateInfo(t *testing.T) {
+	full := JSONInfoData{WmVersion: "2.1.0", WurflAPIVersion: "1.12", WurflInfo: "wurfl.zip", StaticCaps: []string{"brand_name"}}
+	noCaps := JSONInfoData{WmVersion: "2.1.0", WurflAPIVersion: "1.12", WurflInfo: "wurfl.zip"}
+	virtualOnly := JSONInfoData{WmVersion: "2.1.0", WurflAPIVersion: "1.12", WurflInfo: "wurfl.zip", VirtualCaps: []string{"form_factor"}}
+
+	tests := []struct {
+		name       string
+		info       JSONInfoData
+		validation InfoValidation
+		missing    []string
+	}{
+		{"strict full", full, InfoValidationStrict, nil},
+		{"strict virtual caps only", virtualOnly, InfoValidationStrict, nil},
+		{"strict no caps", noCaps, InfoValidationStrict, []string{"static_caps or virtual_caps"}},
+		{"strict empty", JSONInfoData{}, InfoValidationStrict,
+			[]string{"wm_version", "wurfl_api_version", "wurfl_info", "static_caps or virtual_caps"}},
+		{"lenient no caps", noCaps, InfoValidationLenient, nil},
+		{"lenient version only", JSONInfoData{WmVersion: "2.1.0"}, InfoValidationLenient, nil},
+		{"lenient empty", JSONInfoData{}, InfoValidationLenient, []string{"wm_version"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateInfo(&test.info, test.validation)
+			if test.missing == nil {
+				require.Nil(t, err)
+				return
+			}
+			var validationErr *InfoValidationError
+			require.True(t, errors.As(err, &validationErr))
+			require.Equal(t, test.missing, validationErr.Missing)
+		})
+	}
+
+	err := validateInfo(&JSONInfoData{WmVersion: "2.1.0"}, InfoValidationStrict)
+	require.Equal(t, "server returned empty data or a wrong json format: missing wurfl_api_version, wurfl_info, static_caps or virtual_caps", err.Error())
+}
+
+func TestCreateWithInfoValidation(t *testing.T) {
+	// a minimal WM server publishing no capability
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/getinfo/json" {
+			json.NewEncoder(w).Encode(JSONInfoData{WmVersion: "2.1.0", WurflAPIVersion: "1.12", WurflInfo: "wurfl.zip", Ltime: "1",
+				ImportantHeaders: []string{userAgentHeader}})
+			return
+		}
+		json.NewEncoder(w).Encode(JSONDeviceData{Capabilities: map[string]string{"wurfl_id": "generic"}, Ltime: "1"})
+	}))
+	defer server.Close()
+	_, err := CreateFromURL(server.URL)
+	var validationErr *InfoValidationError
+	require.True(t, errors.As(err, &validationErr))
+	require.Equal(t, []string{"static_caps or virtual_caps"}, validationErr.Missing)
+
+	client, err := CreateFromURL(server.URL, WithInfoValidation(InfoValidationLenient))
+	require.Nil(t, err)
+	defer client.Close()
+	device, err := client.LookupUserAgent(context.Background(), "Mozilla/5.0")
+	require.Nil(t, err)
+	require.Equal(t, "generic", device.Capabilities["wurfl_id"])
+
+	client.SetInfoValidation(InfoValidationStrict)
+	_, err = client.GetInfo()
+	require.True(t, errors.As(err, &validationErr))
+}
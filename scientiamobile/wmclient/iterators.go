@@ -0,0 +1,54 @@
+//go:build go1.23
+// +build go1.23
+
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"iter"
+)
+
+// Iterators are compiled with Go 1.23 or later only, so that the module minimum Go version is not raised
+
+// Devices returns an iterator over the brand, model and marketing names of all the devices known by WM server, which
+// streams them as they are decoded from the WM server response instead of loading all of them in memory, as
+// GetAllDeviceMakes and GetAllDevicesForMake do. Devices are not cached by the client: every iteration sends a new request.
+// If the request or the decoding fails, the error is yielded, with a zero JSONMakeModel, and the iteration ends
+func (c *WmClient) Devices(ctx context.Context) iter.Seq2[JSONMakeModel, error] {
+	return func(yield func(JSONMakeModel, error) bool) {
+		err := c.streamArray(ctx, "/v2/alldevices/json", func() interface{} { return &JSONMakeModel{} }, func(entry interface{}) bool {
+			return yield(*entry.(*JSONMakeModel), nil)
+		})
+		if err != nil {
+			yield(JSONMakeModel{}, err)
+		}
+	}
+}
+
+// OSVersions returns an iterator over the operating system names and versions of all the devices known by WM server, one
+// pair per device, in the same way as Devices. The same pair can be yielded more than once
+func (c *WmClient) OSVersions(ctx context.Context) iter.Seq2[JSONDeviceOsVersions, error] {
+	return func(yield func(JSONDeviceOsVersions, error) bool) {
+		err := c.streamArray(ctx, "/v2/alldeviceosversions/json", func() interface{} { return &JSONDeviceOsVersions{} }, func(entry interface{}) bool {
+			return yield(*entry.(*JSONDeviceOsVersions), nil)
+		})
+		if err != nil {
+			yield(JSONDeviceOsVersions{}, err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+//go:build go1.23
+// +build go1.23
+
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIterators(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/alldevices/json":
+			w.Write([]byte(`[{"brand_name":"Apple","model_name":"iPhone","marketing_name":""},` +
+				`{"brand_name":"Samsung","model_name":"SM-G991B","marketing_name":"Galaxy S21"},` +
+				`{"brand_name":"Google","model_name":"Pixel 7","marketing_name":""}]`))
+		case "/v2/alldeviceosversions/json":
+			w.Write([]byte(`[{"device_os":"Android","device_os_version":"13"},{"device_os":"iOS"`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	var brands []string
+	for device, err := range client.Devices(context.Background()) {
+		require.Nil(t, err)
+		brands = append(brands, device.BrandName)
+		if device.ModelName == "SM-G991B" {
+			require.Equal(t, "Galaxy S21", device.MarketingName)
+			break
+		}
+	}
+	require.Equal(t, []string{"Apple", "Samsung"}, brands)
+
+	// a truncated response yields the entries decoded before the error
+	var oses []JSONDeviceOsVersions
+	var iterErr error
+	for os, err := range client.OSVersions(context.Background()) {
+		if err != nil {
+			iterErr = err
+			continue
+		}
+		oses = append(oses, os)
+	}
+	require.Equal(t, []JSONDeviceOsVersions{{OsName: "Android", OsVersion: "13"}}, oses)
+	require.NotNil(t, iterErr)
+
+	client.host = "127.0.0.1"
+	client.port = "1"
+	for _, err := range client.Devices(context.Background()) {
+		require.NotNil(t, err)
+	}
+}
+
+func TestIteratorsOnNilClient(t *testing.T) {
+	var client *WmClient
+	for _, err := range client.Devices(context.Background()) {
+		require.True(t, errors.Is(err, ErrNilClient), fmt.Sprint(err))
+	}
+	for _, err := range (&WmClient{}).OSVersions(context.Background()) {
+		require.True(t, errors.Is(err, ErrClientNotInitialized), fmt.Sprint(err))
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// errClientClosed is returned when a background task is started on a closed client
+var errClientClosed = errors.New("client is closed")
+
+// taskGroup runs the client background tasks (cache auto-tuning, prefetch, cache re-population) under a single lifecycle,
+// in the same way as golang.org/x/sync/errgroup, which is not used to keep the module dependencies and its minimum Go version
+type taskGroup struct {
+	mutex  sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	err    error // first error returned by a task, context cancellation excluded
+	closed bool
+}
+
+func newTaskGroup() *taskGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &taskGroup{ctx: ctx, cancel: cancel}
+}
+
+// goTask runs the given task in a new goroutine. The task context is cancelled when the returned function is called or when the
+// group is closed. An error is returned, and the task is not run, if the group is already closed
+func (g *taskGroup) goTask(task func(ctx context.Context) error) (context.CancelFunc, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.closed {
+		return nil, errClientClosed
+	}
+
+	ctx, cancel := context.WithCancel(g.ctx)
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer cancel()
+		if err := task(ctx); err != nil && err != context.Canceled {
+			g.mutex.Lock()
+			if g.err == nil {
+				g.err = err
+			}
+			g.mutex.Unlock()
+		}
+	}()
+	return cancel, nil
+}
+
+// close cancels all the running tasks, waits for them to return and returns the first error returned by a task, if any
+func (g *taskGroup) close() error {
+	g.mutex.Lock()
+	g.closed = true
+	g.mutex.Unlock()
+
+	g.cancel()
+	g.wg.Wait()
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.err
+}
+
+// getTasks returns the task group of the client, creating it on first use
+func (c *WmClient) getTasks() *taskGroup {
+	c.tasksMutex.Lock()
+	defer c.tasksMutex.Unlock()
+	if c.tasks == nil {
+		c.tasks = newTaskGroup()
+	}
+	return c.tasks
+}
+
+// Close stops the client, in this order: background tasks are cancelled and waited for, so that none of them uses the client
+// afterwards, then connections to WM server are closed and caches are cleared. It returns the first error returned by a
+// background task, if any. A closed client cannot start new background tasks and must not be used for lookups
+func (c *WmClient) Close() error {
+	if c == nil {
+		return ErrNilClient
+	}
+	err := c.getTasks().close()
+
+	if closer, ok := c.transport.(io.Closer); ok {
+		closer.Close()
+	}
+	if c.httpClient != nil {
+		c.httpClient.CloseIdleConnections()
+	}
+	c.clearCache(CacheClearClose)
+	return err
+}
@@ -0,0 +1,253 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestTaskGroup(t *testing.T) {
+	group := newTaskGroup()
+
+	stopped := make(chan struct{})
+	_, err := group.goTask(func(ctx context.Context) error {
+		<-ctx.Done()
+		close(stopped)
+		return ctx.Err()
+	})
+	require.Nil(t, err)
+
+	// a task can be cancelled alone
+	cancel, err := group.goTask(func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+	require.Nil(t, err)
+	cancel()
+
+	_, err = group.goTask(func(ctx context.Context) error { return errors.New("task failed") })
+	require.Nil(t, err)
+
+	// close waits for all tasks and returns the first error, context cancellation excluded
+	require.EqualError(t, group.close(), "task failed")
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("close returned before all tasks ended")
+	}
+
+	_, err = group.goTask(func(ctx context.Context) error { return nil })
+	require.Equal(t, errClientClosed, err)
+}
+
+func TestCloseStopsBackgroundTasks(t *testing.T) {
+	client := &WmClient{scheme: "http", host: "localhost", port: "18080", httpClient: createHTTPClient(defaultConnTimeout, defaultTransferTimeout)}
+	client.SetCacheSize(10)
+	require.Nil(t, client.EnableCacheAutoTuning(1, 100, time.Millisecond))
+	client.PrefetchAsync(EnumInfo, PrefetchPolicy{Retries: 100, MinInterval: time.Hour})
+
+	require.Nil(t, client.Close())
+	require.NotNil(t, client.WaitReady(context.Background()))
+
+	// no background task can be started on a closed client
+	require.Equal(t, errClientClosed, client.EnableCacheAutoTuning(1, 100, time.Millisecond))
+	client.PrefetchAsync(EnumInfo, PrefetchPolicy{})
+	require.Equal(t, errClientClosed, client.WaitReady(context.Background()))
+}
+
+// fakeServer is a minimal WM server, which reports the ltime it is given
+type fakeServer struct {
+	*httptest.Server
+	ltime atomic.Value
+}
+
+func newFakeServer() *fakeServer {
+	server := &fakeServer{}
+	server.ltime.Store("2020-01-01 10:00:00")
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ltime := server.ltime.Load().(string)
+		var data interface{}
+		switch r.URL.Path {
+		case "/v2/getinfo/json":
+			data = JSONInfoData{WmVersion: "2.1.0", WurflAPIVersion: "1.12", WurflInfo: "wurfl.zip", Ltime: ltime,
+				ImportantHeaders: []string{"User-Agent"}, StaticCaps: []string{"brand_name"}, VirtualCaps: []string{"is_mobile"}}
+		case lookupDeviceIDPath:
+			data = JSONDeviceData{APIVersion: "2.1.0", Capabilities: map[string]string{"wurfl_id": "generic", "brand_name": "Generic"}, Ltime: ltime}
+		case lookupUserAgentBatchPath:
+			batch := BatchRequest{}
+			json.NewDecoder(r.Body).Decode(&batch)
+			response := BatchResponse{}
+			for range batch.Requests {
+				response.Devices = append(response.Devices, JSONDeviceData{APIVersion: "2.1.0",
+					Capabilities: map[string]string{"wurfl_id": "generic", "brand_name": "Generic"}, Ltime: ltime})
+			}
+			data = response
+		default:
+			data = JSONDeviceData{APIVersion: "2.1.0", Capabilities: map[string]string{"wurfl_id": "generic", "brand_name": "Generic"}, Ltime: ltime}
+		}
+		w.Header().Set("Content-Type", FormatJSON)
+		json.NewEncoder(w).Encode(data)
+	}))
+	return server
+}
+
+func (s *fakeServer) create(t *testing.T) *WmClient {
+	client, err := CreateFromURL(s.URL)
+	require.Nil(t, err)
+	return client
+}
+
+// newTestClient returns a client connected to the given test server. Unlike Create, it does not send any request to the
+// server, so that tests control all the requests the server receives, and sets no option
+func newTestClient(t *testing.T, server *httptest.Server) *WmClient {
+	serverURL, err := url.Parse(server.URL)
+	require.Nil(t, err)
+	return &WmClient{scheme: serverURL.Scheme, host: serverURL.Hostname(), port: serverURL.Port(),
+		httpClient: createHTTPClient(defaultConnTimeout, defaultTransferTimeout)}
+}
+
+// Goroutines started by the client must be stopped by Close. Each configuration enables the features starting goroutines,
+// and returns the function releasing the resources it has created, if any, which is called after Close
+func TestLifecycleNoLeaks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wmclient")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	configurations := map[string]func(client *WmClient) func(){
+		"default": func(client *WmClient) func() { return nil },
+		"caching": func(client *WmClient) func() {
+			client.SetCacheSize(100)
+			client.SetCacheTTL(time.Minute, 0.1)
+			client.SetMemoCacheSize(100)
+			return nil
+		},
+		"background tasks": func(client *WmClient) func() {
+			client.SetCacheSize(100)
+			require.Nil(t, client.EnableCacheAutoTuning(10, 1000, time.Millisecond))
+			client.SetCacheRewarm(10)
+			client.PrefetchAsync(EnumInfo, PrefetchPolicy{Retries: 1})
+			require.Nil(t, client.WaitReady(context.Background()))
+			return nil
+		},
+		"hedged retries": func(client *WmClient) func() {
+			require.Nil(t, client.SetRetryPolicy(&RetryPolicy{Retries: 2, Hedge: true, MinBudget: time.Millisecond}))
+			return nil
+		},
+		"shared cache": func(client *WmClient) func() {
+			// the cache is served by another instance, so that requests go through the unix socket
+			path := filepath.Join(dir, "cache.sock")
+			serving, err := NewUnixSocketCache(path, 100)
+			require.Nil(t, err)
+			shared, err := NewUnixSocketCache(path, 100)
+			require.Nil(t, err)
+			client.SetCacheSize(100)
+			client.SetSharedCache(shared)
+			return func() {
+				require.Nil(t, shared.Close())
+				require.Nil(t, serving.Close())
+			}
+		},
+		"mirror and telemetry": func(client *WmClient) func() {
+			mirror, err := NewRequestMirror(filepath.Join(dir, "mirror.jsonl"), MirrorOptions{})
+			require.Nil(t, err)
+			client.SetRequestMirror(mirror)
+			client.SetTelemetrySampleRate(1)
+			client.SetCacheSize(100)
+			client.SetCacheRewarm(10)
+			return func() {
+				require.Nil(t, mirror.Close())
+			}
+		},
+	}
+
+	for name, configure := range configurations {
+		t.Run(name, func(t *testing.T) {
+			server := newFakeServer()
+			defer server.Close()
+			ignore := goleak.IgnoreCurrent()
+
+			client := server.create(t)
+			release := configure(client)
+			for i := 0; i < 5; i++ {
+				_, err := client.LookupUserAgent(context.Background(), "Mozilla/5.0")
+				require.Nil(t, err)
+				_, err = client.LookupDeviceID(context.Background(), "generic")
+				require.Nil(t, err)
+			}
+			for _, result := range client.LookupUserAgentBatch(context.Background(), []string{"ua 1", "ua 2", "ua 3"}, 2) {
+				require.Nil(t, result.Err)
+			}
+			_, err := client.LookupMany(context.Background(), []LookupInput{{UserAgent: "ua 4"}, {DeviceID: "generic"}}, 2)
+			require.Nil(t, err)
+			// a new WURFL file load starts the cache re-population, if enabled
+			server.ltime.Store("2020-01-02 10:00:00")
+			_, err = client.LookupUserAgent(context.Background(), "Mozilla/5.0")
+			require.Nil(t, err)
+
+			require.Nil(t, client.Close())
+			require.Equal(t, 0, client.GetConnectionStats().Open)
+			if release != nil {
+				release()
+			}
+			// closing does not wait for the standard library goroutines, ie: the connection readers, which VerifyNone
+			// gives some time to exit
+			goleak.VerifyNone(t, ignore)
+		})
+	}
+}
+
+func TestManagerLifecycleNoLeaks(t *testing.T) {
+	servers := []*fakeServer{newFakeServer(), newFakeServer()}
+	ignore := goleak.IgnoreCurrent()
+
+	// each managed client runs its own background tasks, which DestroyConnections must stop
+	manager := NewManager()
+	for i, name := range []string{"primary", "secondary"} {
+		client := servers[i].create(t)
+		client.SetCacheSize(100)
+		require.Nil(t, client.EnableCacheAutoTuning(10, 1000, time.Millisecond))
+		manager.Add(name, client)
+	}
+	manager.SetStatsHook(func(event interface{}) {})
+	require.Nil(t, manager.EnableLatencyAwareRouting(0.5))
+	for i := 0; i < 10; i++ {
+		request, err := http.NewRequest("GET", "http://localhost/", nil)
+		require.Nil(t, err)
+		request.Header.Set("User-Agent", "Mozilla/5.0")
+		_, err = manager.LookupRequest(*request)
+		require.Nil(t, err)
+	}
+
+	manager.DestroyConnections()
+	goleak.VerifyNone(t, ignore)
+	for _, server := range servers {
+		server.Close()
+	}
+}
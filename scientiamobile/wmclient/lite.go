@@ -0,0 +1,45 @@
+//go:build wmclient_lite
+// +build wmclient_lite
+
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+// Lite builds, enabled by the wmclient_lite build tag, leave out the optional subsystems that need the crypto packages
+// (DeviceCookie, TimestampSigningDecorator and SHA256IdempotencyKey) and hash keys with FNV-1a instead of MD5, so that the
+// client compiles small for constrained targets, ie: go build -tags wmclient_lite with GOOS=js GOARCH=wasm. Most of the
+// binary size comes from net/http, which imports crypto/tls in any case, and the linker already drops the subsystems
+// a program does not use, so the savings are small: TestLiteBuildSize checks that lite builds do not grow. Lookups, caches and all the other features work as in default builds
+
+import (
+	"encoding/hex"
+	"hash/fnv"
+)
+
+// defaultIdempotencyKey is the key function used by IdempotencyKeyDecorator when none is given
+var defaultIdempotencyKey IdempotencyKeyFunc = func(method string, path string, body []byte) string {
+	hash := fnv.New128a()
+	hash.Write([]byte(method + path))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// hashKey returns the hex encoded 128 bit FNV-1a hash of the given key, used as the key of the UA cache entries
+func hashKey(key string) string {
+	hash := fnv.New128a()
+	hash.Write([]byte(key))
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// liteWasmSizeBudget is the maximum size of testdata/sizecheck built for js/wasm in lite mode, without debug information.
+// It has a 10% margin over the size measured with Go 1.27: raise it only for deliberate additions to the client
+const liteWasmSizeBudget = 13 * 1000 * 1000
+
+// buildSizeCheck builds testdata/sizecheck for js/wasm with the given build tags and returns the binary size
+func buildSizeCheck(t *testing.T, tags string) int64 {
+	dir, err := ioutil.TempDir("", "wmclient")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "sizecheck.wasm")
+	cmd := exec.Command("go", "build", "-tags", tags, "-ldflags", "-s -w", "-o", output, "./testdata/sizecheck")
+	cmd.Env = append(os.Environ(), "GOOS=js", "GOARCH=wasm")
+	out, err := cmd.CombinedOutput()
+	require.Nil(t, err, string(out))
+	info, err := os.Stat(output)
+	require.Nil(t, err)
+	return info.Size()
+}
+
+func TestLiteBuildImports(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not available")
+	}
+	out, err := exec.Command("go", "list", "-tags", "wmclient_lite", "-f", "{{join .Imports \"\\n\"}}", ".").CombinedOutput()
+	require.Nil(t, err, string(out))
+	// crypto/tls and crypto/x509, needed by https and public key pinning, are imported by net/http anyway
+	imports := strings.Fields(string(out))
+	require.NotContains(t, imports, "crypto/md5")
+	require.NotContains(t, imports, "crypto/hmac")
+}
+
+func TestLiteBuildSize(t *testing.T) {
+	if testing.Short() {
+		t.Skip("wasm builds are slow")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not available")
+	}
+	// the linker already drops the subsystems that a program does not use, so default builds of sizecheck are not
+	// bigger than lite ones: the budget catches the growth of the code every program links
+	lite := buildSizeCheck(t, "wmclient_lite")
+	t.Logf("js/wasm size: %d bytes", lite)
+	require.True(t, lite <= liteWasmSizeBudget, "lite build is %d bytes, budget is %d", lite, liteWasmSizeBudget)
+}
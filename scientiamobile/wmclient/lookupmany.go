@@ -0,0 +1,117 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// LookupInput is one of the lookups done by LookupMany. Its first non empty field is used: DeviceID, Headers or UserAgent
+type LookupInput struct {
+	DeviceID  string
+	Headers   map[string]string
+	UserAgent string
+	Options   []LookupOption
+}
+
+// lookup detects the device of the input, as with LookupDeviceID, LookupHeaders or LookupUserAgent
+func (in *LookupInput) lookup(ctx context.Context, c *WmClient) (*JSONDeviceData, error) {
+	switch {
+	case in.DeviceID != "":
+		return c.LookupDeviceID(ctx, in.DeviceID, in.Options...)
+	case len(in.Headers) > 0:
+		return c.LookupHeaders(ctx, in.Headers, in.Options...)
+	default:
+		return c.LookupUserAgent(ctx, in.UserAgent, in.Options...)
+	}
+}
+
+// LookupMany detects the devices of the given inputs using up to workers parallel lookups, and returns them in the same
+// order as the inputs. As with an errgroup, the first failed lookup cancels the others and its error, wrapped with the
+// index of the input, is returned; ctx error is returned if ctx is done first. In both cases the devices of the inputs
+// that have not been detected are nil. Use LookupUserAgentBatch to get the error of each lookup instead
+func (c *WmClient) LookupMany(ctx context.Context, inputs []LookupInput, workers int) ([]*JSONDeviceData, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(inputs) {
+		workers = len(inputs)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	devices := make([]*JSONDeviceData, len(inputs))
+	var firstErr error
+	var once sync.Once
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if ctx.Err() != nil {
+					continue
+				}
+				device, err := inputs[i].lookup(ctx, c)
+				if err != nil {
+					if ctx.Err() != nil {
+						fail(ctx.Err())
+					} else {
+						fail(fmt.Errorf("lookup %d: %w", i, err))
+					}
+					continue
+				}
+				devices[i] = device
+			}
+		}()
+	}
+
+sending:
+	for i := range inputs {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break sending
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr == nil {
+		// ctx may be done after the last input has been sent, before all the lookups are completed
+		for _, device := range devices {
+			if device == nil {
+				firstErr = ctx.Err()
+				break
+			}
+		}
+	}
+	return devices, firstErr
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupMany(t *testing.T) {
+	requests := make(map[string]int)
+	server := httptest.NewServer(newBatchTestHandler(false, requests))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.ImportantHeaders = []string{userAgentHeader}
+
+	inputs := make([]LookupInput, 0, 50)
+	for i := 0; i < 50; i++ {
+		inputs = append(inputs, LookupInput{UserAgent: "ua" + string(rune('A'+i))})
+	}
+
+	devices, err := client.LookupMany(context.Background(), inputs, 8)
+	require.Nil(t, err)
+	require.Len(t, devices, len(inputs))
+	for i, input := range inputs {
+		require.Equal(t, "id_"+input.UserAgent, devices[i].DeviceID)
+	}
+	require.Equal(t, 50, requests[lookupUserAgentPath])
+}
+
+func TestLookupManyStopsOnFirstError(t *testing.T) {
+	server := httptest.NewServer(newBatchTestHandler(false, make(map[string]int)))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.ImportantHeaders = []string{userAgentHeader}
+
+	inputs := []LookupInput{{UserAgent: "a"}, {UserAgent: "unknown"}}
+	for i := 0; i < 100; i++ {
+		inputs = append(inputs, LookupInput{UserAgent: "b"})
+	}
+
+	devices, err := client.LookupMany(context.Background(), inputs, 1)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "lookup 1: ")
+	require.True(t, isServerError(err))
+	require.Equal(t, "id_a", devices[0].DeviceID)
+	require.Nil(t, devices[1])
+	require.Nil(t, devices[len(devices)-1])
+}
+
+func TestLookupManyRespectsContext(t *testing.T) {
+	requests := make(map[string]int)
+	server := httptest.NewServer(newBatchTestHandler(false, requests))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.ImportantHeaders = []string{userAgentHeader}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	devices, err := client.LookupMany(ctx, []LookupInput{{UserAgent: "a"}, {UserAgent: "b"}}, 2)
+	require.Equal(t, context.Canceled, err)
+	require.Equal(t, []*JSONDeviceData{nil, nil}, devices)
+	require.Equal(t, 0, requests[lookupUserAgentPath])
+}
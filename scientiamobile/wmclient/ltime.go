@@ -0,0 +1,79 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"fmt"
+	"time"
+)
+
+// ltimeLayouts are the layouts of the WURFL file load time sent by WM server versions
+var ltimeLayouts = []string{"2006-01-02 15:04:05 -0700 MST", "2006-01-02 15:04:05", time.RFC3339}
+
+// LtimeParser converts the WURFL file load time (ltime) reported by WM server to a time, so that the load times reported by
+// different servers, or by the same server over time, can be ordered
+type LtimeParser func(ltime string) (time.Time, error)
+
+// ParseLtime is the default LtimeParser: it parses the ltime formats sent by WM server versions. Custom parsers can fall
+// back to it
+func ParseLtime(ltime string) (time.Time, error) {
+	for _, layout := range ltimeLayouts {
+		if loaded, err := time.Parse(layout, ltime); err == nil {
+			return loaded, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse the WURFL file load time %s", ltime)
+}
+
+// SetLtimeParser sets the parser of the WURFL file load times reported by WM server, ie: for servers behind a proxy that
+// rewrites them in another format. A nil parser restores ParseLtime. The client caches are cleared only when the reported
+// load time is later than the one the cached data comes from, so that clients whose requests are spread among servers that
+// loaded the WURFL file at different times do not clear their caches at every switch. When the load times cannot be parsed,
+// the caches are cleared at every change. This function should be called before performing any lookup
+func (c *WmClient) SetLtimeParser(parser LtimeParser) {
+	if c == nil {
+		return
+	}
+	c.ltimeParser = parser
+}
+
+// parseLtime parses the given WURFL file load time with the client parser
+func (c *WmClient) parseLtime(ltime string) (time.Time, error) {
+	if c.ltimeParser != nil {
+		return c.ltimeParser(ltime)
+	}
+	return ParseLtime(ltime)
+}
+
+// isNewerLtime returns true if the given WURFL file load time is later than the client one, or if it differs from the
+// client one and either cannot be parsed. It must be called holding the ltime mutex
+func (c *WmClient) isNewerLtime(ltime string) bool {
+	if ltime == c.clientLtime {
+		return false
+	}
+	if c.clientLtime == "" {
+		return true
+	}
+	current, err := c.parseLtime(c.clientLtime)
+	if err != nil {
+		return true
+	}
+	loaded, err := c.parseLtime(ltime)
+	if err != nil {
+		return true
+	}
+	return loaded.After(current)
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLtime(t *testing.T) {
+	for _, ltime := range []string{"2023-05-10 08:30:00 +0000 UTC", "2023-05-10 08:30:00", "2023-05-10T08:30:00Z"} {
+		loaded, err := ParseLtime(ltime)
+		require.Nil(t, err, ltime)
+		require.True(t, loaded.Equal(time.Date(2023, 5, 10, 8, 30, 0, 0, time.UTC)), ltime)
+	}
+	_, err := ParseLtime("yesterday")
+	require.NotNil(t, err)
+}
+
+func TestClearCachesOnNewerLtimeOnly(t *testing.T) {
+	client := &WmClient{}
+	client.setCacheSizes(10, 10)
+	cached := func() int {
+		return client.userAgentCache.Len()
+	}
+
+	client.clearCachesIfNeeded("2023-05-10 08:30:00")
+	client.addToUserAgentCache("ua", &JSONDeviceData{})
+
+	// an older ltime, ie: sent by a server that has not reloaded the WURFL file yet, is ignored
+	client.clearCachesIfNeeded("2023-05-09 08:30:00")
+	require.Equal(t, 1, cached())
+	require.Equal(t, "2023-05-10 08:30:00", client.clientLtime)
+
+	// the same time, in another format
+	client.clearCachesIfNeeded("2023-05-10T08:30:00Z")
+	require.Equal(t, 1, cached())
+
+	client.clearCachesIfNeeded("2023-05-11 08:30:00")
+	require.Equal(t, 0, cached())
+	require.Equal(t, "2023-05-11 08:30:00", client.clientLtime)
+
+	// ltimes that cannot be parsed clear the caches at every change
+	client.addToUserAgentCache("ua", &JSONDeviceData{})
+	client.clearCachesIfNeeded("unknown")
+	require.Equal(t, 0, cached())
+	client.addToUserAgentCache("ua", &JSONDeviceData{})
+	client.clearCachesIfNeeded("2023-05-01 08:30:00")
+	require.Equal(t, 0, cached())
+}
+
+func TestSetLtimeParser(t *testing.T) {
+	client := &WmClient{}
+	client.setCacheSizes(10, 10)
+	// ltimes sent as unix timestamps
+	client.SetLtimeParser(func(ltime string) (time.Time, error) {
+		seconds, err := strconv.ParseInt(ltime, 10, 64)
+		if err != nil {
+			return time.Time{}, errors.New("invalid ltime")
+		}
+		return time.Unix(seconds, 0), nil
+	})
+
+	client.clearCachesIfNeeded("1683707400")
+	client.addToUserAgentCache("ua", &JSONDeviceData{})
+	client.clearCachesIfNeeded("1683700000")
+	require.Equal(t, 1, client.userAgentCache.Len())
+	client.clearCachesIfNeeded("1683800000")
+	require.Equal(t, 0, client.userAgentCache.Len())
+
+	client.SetMaxDataAge(time.Hour)
+	check := client.verifyDataFreshness(strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10))
+	require.True(t, check.Passed, check.Message)
+
+	client.SetLtimeParser(nil)
+	check = client.verifyDataFreshness("1683800000")
+	require.False(t, check.Passed)
+}
@@ -0,0 +1,310 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// devicesForMakePath is the WM server endpoint that returns the devices of a single brand, the brand name is escaped and
+// appended to it. Servers that do not support it reply with one of the statuses in endpointUnsupported
+const devicesForMakePath = "/v2/alldevices/json/"
+
+// endpointUnsupported holds the statuses returned by WM server versions that do not support an optional endpoint
+var endpointUnsupported = map[int]bool{
+	http.StatusNotFound:         true,
+	http.StatusMethodNotAllowed: true,
+	http.StatusNotImplemented:   true,
+}
+
+// loadDevicesForMake returns the devices of the given brand, fetching only that brand from WM server, if it supports it.
+// The bool result is false if the per-brand endpoint is not supported, in that case the whole device makes data must be loaded
+func (c *WmClient) loadDevicesForMake(ctx context.Context, brandName string) ([]JSONModelMktName, bool, error) {
+	if atomic.LoadInt32(&c.brandEndpointFallback) == 1 {
+		return nil, false, nil
+	}
+
+	c.deviceMakesMutex.Lock()
+	devices, ok := c.brandDevices[brandName]
+	c.deviceMakesMutex.Unlock()
+	if ok {
+		return devices, true, nil
+	}
+
+	res, body, err := c.doRequest(ctx, "GET", devicesForMakePath+url.PathEscape(brandName), nil)
+	if err != nil {
+		return nil, true, err
+	}
+	if endpointUnsupported[res.StatusCode] {
+		atomic.StoreInt32(&c.brandEndpointFallback, 1)
+		return nil, false, nil
+	}
+
+	devices = make([]JSONModelMktName, 0)
+	if err = c.decodeResponse(res, body, &devices); err != nil {
+		return nil, true, err
+	}
+
+	c.deviceMakesMutex.Lock()
+	if c.brandDevices == nil {
+		c.brandDevices = make(map[string][]JSONModelMktName)
+	}
+	c.brandDevices[brandName] = devices
+	c.deviceMakesMutex.Unlock()
+	return devices, true, nil
+}
+
+// SetModelNameIndex enables or disables the index of the device makes data by model_name, used by GetBrandForModel.
+// The index is built when the device makes data is loaded or, if it is already loaded, by this function
+func (c *WmClient) SetModelNameIndex(enabled bool) {
+	if c == nil {
+		return
+	}
+	c.deviceMakesMutex.Lock()
+	defer c.deviceMakesMutex.Unlock()
+
+	c.modelIndexEnabled = enabled
+	c.modelIndex = nil
+	if !enabled || len(c.deviceMakes) == 0 {
+		return
+	}
+	c.modelIndex = make(map[string][]JSONMakeModel)
+	for _, brandName := range c.deviceMakes {
+		for _, device := range c.deviceMakesMap[brandName] {
+			c.modelIndex[device.ModelName] = append(c.modelIndex[device.ModelName], JSONMakeModel{brandName, device.ModelName, device.MarketingName})
+		}
+	}
+}
+
+// GetBrandForModel returns brand_name, model_name and marketing_name of the devices with the given model_name. Usually there is
+// only one of them, but different brands may use the same model name. It requires the index to be enabled with SetModelNameIndex,
+// and it loads the whole device makes data, if not already loaded
+func (c *WmClient) GetBrandForModel(modelName string) ([]JSONMakeModel, error) {
+	return c.GetBrandForModelContext(context.Background(), modelName)
+}
+
+// GetBrandForModelContext works like GetBrandForModel, the request to WM server, if needed, is bound to the given context
+func (c *WmClient) GetBrandForModelContext(ctx context.Context, modelName string) ([]JSONMakeModel, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	c.deviceMakesMutex.Lock()
+	enabled := c.modelIndexEnabled
+	c.deviceMakesMutex.Unlock()
+	if !enabled {
+		return nil, errors.New("model name index is not enabled, see SetModelNameIndex")
+	}
+
+	if err := c.loadDeviceMakesData(ctx); err != nil {
+		return nil, err
+	}
+
+	c.deviceMakesMutex.Lock()
+	devices, ok := c.modelIndex[modelName]
+	c.deviceMakesMutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("Error getting data from WM server: model %s does not exist", modelName)
+	}
+	return devices, nil
+}
+
+// SearchDevices returns brand_name, model_name and marketing_name of the devices whose model_name or marketing_name contains
+// the given query. Names are compared case insensitively, in the form returned by MarketingNameKey, so that the query
+// "galaxy s" matches "Galaxy S®". An empty query matches no device. It loads the whole device makes data, if not already loaded
+func (c *WmClient) SearchDevices(ctx context.Context, query string) ([]JSONMakeModel, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	if err := c.loadDeviceMakesData(ctx); err != nil {
+		return nil, err
+	}
+
+	devices := make([]JSONMakeModel, 0)
+	key := MarketingNameKey(query)
+	if key == "" {
+		return devices, nil
+	}
+
+	c.deviceMakesMutex.Lock()
+	defer c.deviceMakesMutex.Unlock()
+	for _, brandName := range c.deviceMakes {
+		for _, device := range c.deviceMakesMap[brandName] {
+			if strings.Contains(MarketingNameKey(device.ModelName), key) || strings.Contains(MarketingNameKey(device.MarketingName), key) {
+				devices = append(devices, JSONMakeModel{brandName, device.ModelName, device.MarketingName})
+			}
+		}
+	}
+	return devices, nil
+}
+
+// DevicesPage is a page of the devices of a brand, see GetDevicesForMakePage
+type DevicesPage struct {
+	Devices []JSONModelMktName // devices of the page, in the order returned by WM server
+	Offset  int                // position of the first device of the page among the brand devices
+	Total   int                // number of devices of the brand
+}
+
+// HasMore returns true if the brand has devices after the ones of the page
+func (p *DevicesPage) HasMore() bool {
+	return p.Offset+len(p.Devices) < p.Total
+}
+
+// GetDevicesForMakePage works like GetAllDevicesForMakeContext, returning at most limit devices of the given brand, starting
+// from the one at the given offset, so that brands with thousands of models can be paged through, ie: by web UIs, without
+// holding or copying the whole list. The page is empty if offset is past the last device.
+// The devices of the brand are loaded from WM server and cached as GetAllDevicesForMake does, so pages are consistent with
+// each other until WM server loads a new WURFL file
+func (c *WmClient) GetDevicesForMakePage(ctx context.Context, brandName string, offset int, limit int) (*DevicesPage, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	if offset < 0 || limit <= 0 {
+		return nil, fmt.Errorf("invalid page offset %d and limit %d: the offset must not be negative and the limit must be positive", offset, limit)
+	}
+
+	devices, err := c.GetAllDevicesForMakeContext(ctx, brandName)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &DevicesPage{Devices: make([]JSONModelMktName, 0), Offset: offset, Total: len(devices)}
+	if offset < len(devices) {
+		end := offset + limit
+		if end > len(devices) {
+			end = len(devices)
+		}
+		page.Devices = append(page.Devices, devices[offset:end]...)
+	}
+	return page, nil
+}
+
+// GetAllDevicesForMakeFiltered works like GetAllDevicesForMakeContext, returning only the devices whose capabilities have
+// all the given values, ie: {"is_smartphone": "true"}. brand_name, model_name and marketing_name are matched using the
+// device makes data, the other capabilities are resolved lazily, only for the devices of the brand, with lookups by
+// wurfl_id that use the device cache: a device is kept as soon as one of its wurfl_ids matches. Capabilities that are not
+// requested by the client are resolved with uncached lookups, so they should be requested when filtering often.
+// Filtering on other capabilities requires WM server to support device queries, which are used to find the wurfl_ids of
+// the brand devices
+func (c *WmClient) GetAllDevicesForMakeFiltered(ctx context.Context, brandName string, filter map[string]string) ([]JSONModelMktName, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	devices, err := c.GetAllDevicesForMakeContext(ctx, brandName)
+	if err != nil {
+		return nil, err
+	}
+	if value, ok := filter["brand_name"]; ok && enumNameKey(value) != enumNameKey(brandName) {
+		return make([]JSONModelMktName, 0), nil
+	}
+
+	capFilter := make(map[string]string, len(filter))
+	for name, value := range filter {
+		if !makesDataCapabilities[name] {
+			capFilter[name] = value
+		}
+	}
+	var idsByModel map[JSONModelMktName][]string
+	if len(capFilter) > 0 {
+		if idsByModel, err = c.deviceIDsByModel(ctx, brandName); err != nil {
+			return nil, err
+		}
+	}
+
+	filtered := make([]JSONModelMktName, 0)
+	for _, device := range devices {
+		if value, ok := filter["model_name"]; ok && value != device.ModelName {
+			continue
+		}
+		if value, ok := filter["marketing_name"]; ok && value != device.MarketingName {
+			continue
+		}
+		matches := len(capFilter) == 0
+		for _, id := range idsByModel[device] {
+			if matches, err = c.deviceMatches(ctx, id, capFilter); err != nil {
+				return nil, err
+			}
+			if matches {
+				break
+			}
+		}
+		if matches {
+			filtered = append(filtered, device)
+		}
+	}
+	return filtered, nil
+}
+
+// deviceIDsByModel returns the wurfl_ids of the devices of the given brand, by model and marketing name
+func (c *WmClient) deviceIDsByModel(ctx context.Context, brandName string) (map[JSONModelMktName][]string, error) {
+	c.deviceMakesMutex.Lock()
+	if name, ok := matchEnumName(c.deviceMakes, brandName); ok {
+		brandName = name
+	}
+	c.deviceMakesMutex.Unlock()
+
+	queried, err := c.QueryDevices(ctx, map[string]string{"brand_name": brandName})
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[JSONModelMktName][]string)
+	for _, device := range queried {
+		if device.WurflID == "" {
+			return nil, errors.New("devices cannot be filtered by capability: WM server does not support device queries")
+		}
+		model := JSONModelMktName{ModelName: device.ModelName, MarketingName: device.MarketingName}
+		ids[model] = append(ids[model], device.WurflID)
+	}
+	return ids, nil
+}
+
+// deviceMatches returns true if the capabilities of the device with the given wurfl_id have all the given values
+func (c *WmClient) deviceMatches(ctx context.Context, wurflID string, filter map[string]string) (bool, error) {
+	device, err := c.LookupDeviceID(ctx, wurflID)
+	if err != nil {
+		return false, err
+	}
+	values := make(map[string]string, len(filter))
+	missing := make([]string, 0)
+	for name := range filter {
+		if value, ok := device.Capabilities[name]; ok {
+			values[name] = value
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		// some of the capabilities are not requested by the client
+		uncached, err := c.LookupDeviceID(ctx, wurflID, WithCapabilities(missing...))
+		if err != nil {
+			return false, err
+		}
+		for _, name := range missing {
+			values[name] = uncached.Capabilities[name]
+		}
+	}
+	for name, value := range filter {
+		if values[name] != value {
+			return false, nil
+		}
+	}
+	return true, nil
+}
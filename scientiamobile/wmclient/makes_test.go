@@ -0,0 +1,301 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newMakesTestHandler returns a WM server handler knowing three devices, serving the devices of single brands if perBrand
+// is set, and counting the requests by path
+func newMakesTestHandler(perBrand bool, requests map[string]int) http.Handler {
+	var mutex sync.Mutex
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests[r.URL.Path]++
+		mutex.Unlock()
+		switch {
+		case r.URL.Path == "/v2/alldevices/json":
+			json.NewEncoder(w).Encode([]JSONMakeModel{{BrandName: "Apple", ModelName: "iPhone"}, {BrandName: "Nokia", ModelName: "3310"},
+				{BrandName: "Samsung", ModelName: "SM-G991B", MarketingName: "Galaxy S21\u00ae"}})
+		case perBrand && r.URL.Path == devicesForMakePath+"Apple":
+			json.NewEncoder(w).Encode([]JSONModelMktName{{ModelName: "iPhone"}})
+		case perBrand && r.URL.Path == devicesForMakePath+"Unknown Brand":
+			w.Write([]byte(`[]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func TestGetAllDevicesForMakeFetchesSingleBrand(t *testing.T) {
+	requests := make(map[string]int)
+	server := httptest.NewServer(newMakesTestHandler(true, requests))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	for i := 0; i < 2; i++ {
+		devices, err := client.GetAllDevicesForMake("Apple")
+		require.Nil(t, err)
+		require.Equal(t, []JSONModelMktName{{ModelName: "iPhone"}}, devices)
+	}
+	// the brand is cached and the whole data is never downloaded
+	require.Equal(t, 1, requests[devicesForMakePath+"Apple"])
+	require.Equal(t, 0, requests["/v2/alldevices/json"])
+
+	_, err := client.GetAllDevicesForMake("Unknown Brand")
+	require.NotNil(t, err)
+}
+
+func TestGetAllDevicesForMakeFallsBackToFullLoad(t *testing.T) {
+	requests := make(map[string]int)
+	server := httptest.NewServer(newMakesTestHandler(false, requests))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	devices, err := client.GetAllDevicesForMake("Nokia")
+	require.Nil(t, err)
+	require.Equal(t, []JSONModelMktName{{ModelName: "3310"}}, devices)
+	devices, err = client.GetAllDevicesForMake("Apple")
+	require.Nil(t, err)
+	require.Equal(t, []JSONModelMktName{{ModelName: "iPhone"}}, devices)
+
+	// the per-brand endpoint is tried only once
+	require.Equal(t, 1, requests[devicesForMakePath+"Nokia"])
+	require.Equal(t, 0, requests[devicesForMakePath+"Apple"])
+	require.Equal(t, 1, requests["/v2/alldevices/json"])
+}
+
+func TestGetAllDeviceMakesWhileClearingCache(t *testing.T) {
+	server := httptest.NewServer(newMakesTestHandler(false, make(map[string]int)))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// the makes are read while a cache clear may reset them
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			makes, err := client.GetAllDeviceMakes()
+			require.Nil(t, err)
+			// empty if the cache has been cleared after the makes have been loaded
+			require.Contains(t, []int{0, 3}, len(makes))
+		}()
+		go func() {
+			defer wg.Done()
+			client.clearCache(CacheClearManual)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestEnumeratorsRespectContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// slow server: it replies when the client gives up
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	calls := map[string]func(ctx context.Context) error{
+		"GetInfoContext":           func(ctx context.Context) error { _, err := client.GetInfoContext(ctx); return err },
+		"GetAllDeviceMakesContext": func(ctx context.Context) error { _, err := client.GetAllDeviceMakesContext(ctx); return err },
+		"GetAllDevicesForMakeContext": func(ctx context.Context) error {
+			_, err := client.GetAllDevicesForMakeContext(ctx, "Apple")
+			return err
+		},
+		"GetAllOSesContext":          func(ctx context.Context) error { _, err := client.GetAllOSesContext(ctx); return err },
+		"GetAllVersionsForOSContext": func(ctx context.Context) error { _, err := client.GetAllVersionsForOSContext(ctx, "iOS"); return err },
+	}
+	for name, call := range calls {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		start := time.Now()
+		err := call(ctx)
+		cancel()
+		require.NotNil(t, err, name)
+		require.True(t, time.Since(start) < 5*time.Second, name)
+	}
+}
+
+func TestGetBrandForModel(t *testing.T) {
+	requests := make(map[string]int)
+	server := httptest.NewServer(newMakesTestHandler(false, requests))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	_, err := client.GetBrandForModel("iPhone")
+	require.NotNil(t, err)
+
+	client.SetModelNameIndex(true)
+	devices, err := client.GetBrandForModel("iPhone")
+	require.Nil(t, err)
+	require.Equal(t, []JSONMakeModel{{BrandName: "Apple", ModelName: "iPhone"}}, devices)
+	devices, err = client.GetBrandForModel("3310")
+	require.Nil(t, err)
+	require.Equal(t, "Nokia", devices[0].BrandName)
+	require.Equal(t, 1, requests["/v2/alldevices/json"])
+
+	_, err = client.GetBrandForModel("unknown")
+	require.NotNil(t, err)
+
+	// enabling the index after the data has been loaded builds it
+	client.SetModelNameIndex(false)
+	client.SetModelNameIndex(true)
+	devices, err = client.GetBrandForModel("3310")
+	require.Nil(t, err)
+	require.Equal(t, []JSONMakeModel{{BrandName: "Nokia", ModelName: "3310"}}, devices)
+	require.Equal(t, 1, requests["/v2/alldevices/json"])
+}
+
+func TestSearchDevices(t *testing.T) {
+	requests := make(map[string]int)
+	server := httptest.NewServer(newMakesTestHandler(false, requests))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	devices, err := client.SearchDevices(context.Background(), "IPHO")
+	require.Nil(t, err)
+	require.Equal(t, []JSONMakeModel{{BrandName: "Apple", ModelName: "iPhone"}}, devices)
+
+	// marketing names are searched in their normalized form
+	devices, err = client.SearchDevices(context.Background(), "galaxy  s21")
+	require.Nil(t, err)
+	require.Equal(t, []JSONMakeModel{{BrandName: "Samsung", ModelName: "SM-G991B", MarketingName: "Galaxy S21\u00ae"}}, devices)
+
+	devices, err = client.SearchDevices(context.Background(), "1")
+	require.Nil(t, err)
+	require.Len(t, devices, 2)
+
+	devices, err = client.SearchDevices(context.Background(), " ")
+	require.Nil(t, err)
+	require.Empty(t, devices)
+	require.Equal(t, 1, requests["/v2/alldevices/json"])
+}
+
+func TestGetDevicesForMakePage(t *testing.T) {
+	devices := make([]JSONModelMktName, 0)
+	for i := 0; i < 25; i++ {
+		devices = append(devices, JSONModelMktName{ModelName: fmt.Sprintf("SM-%03d", i)})
+	}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != devicesForMakePath+"Samsung" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(devices)
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	var paged []JSONModelMktName
+	for offset := 0; ; offset += 10 {
+		page, err := client.GetDevicesForMakePage(context.Background(), "Samsung", offset, 10)
+		require.Nil(t, err)
+		require.Equal(t, 25, page.Total)
+		require.Equal(t, offset, page.Offset)
+		paged = append(paged, page.Devices...)
+		if !page.HasMore() {
+			require.Len(t, page.Devices, 5)
+			break
+		}
+		require.Len(t, page.Devices, 10)
+	}
+	require.Equal(t, devices, paged)
+	require.Equal(t, 1, requests)
+
+	page, err := client.GetDevicesForMakePage(context.Background(), "Samsung", 30, 10)
+	require.Nil(t, err)
+	require.Empty(t, page.Devices)
+	require.False(t, page.HasMore())
+
+	_, err = client.GetDevicesForMakePage(context.Background(), "Samsung", -1, 10)
+	require.NotNil(t, err)
+	_, err = client.GetDevicesForMakePage(context.Background(), "Samsung", 0, 0)
+	require.NotNil(t, err)
+}
+
+func TestGetAllDevicesForMakeFiltered(t *testing.T) {
+	// SM-A has a 4G and a 5G variant
+	queried := []JSONQueriedDevice{{WurflID: "sm_a_4g", BrandName: "Samsung", ModelName: "SM-A"},
+		{WurflID: "sm_a_5g", BrandName: "Samsung", ModelName: "SM-A"},
+		{WurflID: "sm_b", BrandName: "Samsung", ModelName: "SM-B", MarketingName: "Galaxy B"},
+		{WurflID: "sm_tab", BrandName: "Samsung", ModelName: "SM-T"}}
+	caps := map[string]map[string]string{
+		"sm_a_4g": {"is_smartphone": "true", "is_tablet": "false", "network_type": "4g"},
+		"sm_a_5g": {"is_smartphone": "true", "is_tablet": "false", "network_type": "5g"},
+		"sm_b":    {"is_smartphone": "true", "is_tablet": "false", "network_type": "4g"},
+		"sm_tab":  {"is_smartphone": "false", "is_tablet": "true", "network_type": "5g"},
+	}
+	lookups := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case devicesForMakePath + "Samsung":
+			json.NewEncoder(w).Encode([]JSONModelMktName{{ModelName: "SM-A"}, {ModelName: "SM-B", MarketingName: "Galaxy B"}, {ModelName: "SM-T"}})
+		case queryDevicesPath:
+			json.NewEncoder(w).Encode(queried)
+		case lookupDeviceIDPath:
+			request := Request{}
+			json.NewDecoder(r.Body).Decode(&request)
+			lookups[request.WurflID]++
+			device := map[string]string{"wurfl_id": request.WurflID}
+			for _, name := range append(request.RequestedCaps, request.RequestedVCaps...) {
+				device[name] = caps[request.WurflID][name]
+			}
+			json.NewEncoder(w).Encode(JSONDeviceData{Capabilities: device})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.StaticCaps = []string{"network_type"}
+	client.VirtualCaps = []string{"is_smartphone", "is_tablet"}
+	client.SetCacheSize(100)
+	client.SetRequestedCapabilities([]string{"is_smartphone", "is_tablet"})
+
+	devices, err := client.GetAllDevicesForMakeFiltered(context.Background(), "Samsung", map[string]string{"is_smartphone": "true"})
+	require.Nil(t, err)
+	require.Equal(t, []JSONModelMktName{{ModelName: "SM-A"}, {ModelName: "SM-B", MarketingName: "Galaxy B"}}, devices)
+	// a model is kept as soon as one of its devices matches
+	require.Equal(t, 0, lookups["sm_a_5g"])
+
+	// capabilities not requested by the client are resolved with uncached lookups
+	devices, err = client.GetAllDevicesForMakeFiltered(context.Background(), "Samsung", map[string]string{"is_smartphone": "true", "network_type": "5g"})
+	require.Nil(t, err)
+	require.Equal(t, []JSONModelMktName{{ModelName: "SM-A"}}, devices)
+	// the requested capabilities of sm_a_4g and sm_b come from the device cache, network_type from one more lookup
+	require.Equal(t, 2, lookups["sm_a_4g"])
+	require.Equal(t, 2, lookups["sm_b"])
+
+	devices, err = client.GetAllDevicesForMakeFiltered(context.Background(), "Samsung", map[string]string{"marketing_name": "Galaxy B"})
+	require.Nil(t, err)
+	require.Equal(t, []JSONModelMktName{{ModelName: "SM-B", MarketingName: "Galaxy B"}}, devices)
+	devices, err = client.GetAllDevicesForMakeFiltered(context.Background(), "Samsung", map[string]string{"brand_name": "Apple"})
+	require.Nil(t, err)
+	require.Empty(t, devices)
+}
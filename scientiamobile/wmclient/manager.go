@@ -0,0 +1,355 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// smoothing factor of the exponentially weighted moving average of client latencies
+const latencyEWMAAlpha = 0.2
+
+// Router returns the name of the managed client that must be used to detect the device of the given request
+// (ie: the client connected to the WM server of the request origin region). An empty name selects the default client
+type Router func(request *http.Request) string
+
+// ManagedClientEvent wraps the events sent to the Manager stats hook with the name of the client that generated them
+type ManagedClientEvent struct {
+	Client string
+	Event  interface{}
+}
+
+// EndpointLatency holds the latency statistics of a managed client, as observed by the manager
+type EndpointLatency struct {
+	Client  string
+	EWMA    time.Duration // exponentially weighted moving average of the lookup latency
+	Samples uint64
+	Healthy bool // false if the last lookup could not reach the WM server
+}
+
+// RoutingDecisionEvent is sent to the manager stats hook every time the latency-aware routing selects a client
+type RoutingDecisionEvent struct {
+	Client    string
+	Explored  bool // true if the client has been selected to refresh its statistics, rather than for being the fastest one
+	Latencies []EndpointLatency
+}
+
+// Manager holds a set of named clients, each one connected to a different WM server (ie: one per region or WURFL data version),
+// and routes lookups to them. Events of all clients are sent to the manager stats hook
+type Manager struct {
+	mutex          sync.RWMutex // protects all the fields below, except the latency ones
+	clients        map[string]*WmClient
+	defaultName    string
+	router         Router
+	statsHook      StatsHook
+	latencyRouting bool
+	exploration    float64
+
+	latencyMutex sync.Mutex // protects latencies
+	latencies    map[string]*EndpointLatency
+
+	rnd randomSource
+}
+
+// NewManager creates an empty client manager
+func NewManager() *Manager {
+	return &Manager{clients: make(map[string]*WmClient), latencies: make(map[string]*EndpointLatency)}
+}
+
+// Add adds the given client with the given name, replacing (but not destroying) the client previously added with the same name.
+// The first client added becomes the default one
+func (m *Manager) Add(name string, client *WmClient) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.clients[name] = client
+	if m.defaultName == "" {
+		m.defaultName = name
+	}
+	if m.statsHook != nil {
+		client.SetStatsHook(m.clientStatsHook(name, m.statsHook))
+	}
+}
+
+// Remove removes the client with the given name from the manager and returns it, so that it can be destroyed
+func (m *Manager) Remove(name string) (*WmClient, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	client, ok := m.clients[name]
+	delete(m.clients, name)
+	if m.defaultName == name {
+		m.defaultName = ""
+	}
+
+	m.latencyMutex.Lock()
+	delete(m.latencies, name)
+	m.latencyMutex.Unlock()
+	return client, ok
+}
+
+// Get returns the client with the given name
+func (m *Manager) Get(name string) (*WmClient, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	client, ok := m.clients[name]
+	return client, ok
+}
+
+// Names returns the sorted names of the managed clients
+func (m *Manager) Names() []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	names := make([]string, 0, len(m.clients))
+	for name := range m.clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetDefault sets the name of the client used when the router is not set or it returns an empty name
+func (m *Manager) SetDefault(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.clients[name]; !ok {
+		return fmt.Errorf("client %s does not exist", name)
+	}
+	m.defaultName = name
+	return nil
+}
+
+// SetRouter sets the function that selects the client to use for a request
+func (m *Manager) SetRouter(router Router) {
+	m.mutex.Lock()
+	m.router = router
+	m.mutex.Unlock()
+}
+
+// SetStatsHook sets the hook that receives the events of all the managed clients, wrapped in ManagedClientEvent values.
+// It replaces the stats hooks of the managed clients
+func (m *Manager) SetStatsHook(hook StatsHook) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.statsHook = hook
+	for name, client := range m.clients {
+		client.SetStatsHook(m.clientStatsHook(name, hook))
+	}
+}
+
+func (m *Manager) clientStatsHook(name string, hook StatsHook) StatsHook {
+	if hook == nil {
+		return nil
+	}
+	return func(event interface{}) {
+		hook(ManagedClientEvent{Client: name, Event: event})
+	}
+}
+
+// EnableLatencyAwareRouting makes the manager route the requests, for which the router does not select a client, to the
+// healthy client with the lowest average latency. With the given exploration probability (between 0 and 1) another client
+// is selected instead, to keep the statistics of all clients up to date. Each selection is sent to the stats hook as a RoutingDecisionEvent.
+// Latencies are measured by the manager lookup methods, or they can be reported with ObserveLatency
+func (m *Manager) EnableLatencyAwareRouting(exploration float64) error {
+	if exploration < 0 || exploration > 1 {
+		return errors.New("exploration probability must be between 0 and 1")
+	}
+
+	m.mutex.Lock()
+	m.latencyRouting = true
+	m.exploration = exploration
+	m.mutex.Unlock()
+	return nil
+}
+
+// DisableLatencyAwareRouting restores the routing to the default client
+func (m *Manager) DisableLatencyAwareRouting() {
+	m.mutex.Lock()
+	m.latencyRouting = false
+	m.mutex.Unlock()
+}
+
+// ObserveLatency updates the latency statistics of the given client with the duration of a lookup. success must be false
+// when the lookup could not reach the WM server, the client is then considered unhealthy until a successful lookup is observed
+func (m *Manager) ObserveLatency(name string, latency time.Duration, success bool) {
+	m.latencyMutex.Lock()
+	defer m.latencyMutex.Unlock()
+
+	stats, ok := m.latencies[name]
+	if !ok {
+		stats = &EndpointLatency{Client: name}
+		m.latencies[name] = stats
+	}
+
+	stats.Healthy = success
+	if !success {
+		return
+	}
+	if stats.Samples == 0 {
+		stats.EWMA = latency
+	} else {
+		stats.EWMA = time.Duration(latencyEWMAAlpha*float64(latency) + (1-latencyEWMAAlpha)*float64(stats.EWMA))
+	}
+	stats.Samples++
+}
+
+// GetLatencies returns the latency statistics of all the managed clients, sorted by client name
+func (m *Manager) GetLatencies() []EndpointLatency {
+	names := m.Names()
+
+	m.latencyMutex.Lock()
+	defer m.latencyMutex.Unlock()
+	return m.latenciesOf(names)
+}
+
+// latenciesOf returns the latency statistics of the given clients. It must be called holding the latency mutex
+func (m *Manager) latenciesOf(names []string) []EndpointLatency {
+	latencies := make([]EndpointLatency, 0, len(names))
+	for _, name := range names {
+		if stats, ok := m.latencies[name]; ok {
+			latencies = append(latencies, *stats)
+		} else {
+			// clients that have never been used are considered healthy, so that they get tried
+			latencies = append(latencies, EndpointLatency{Client: name, Healthy: true})
+		}
+	}
+	return latencies
+}
+
+// selectByLatency returns the name of the fastest healthy client or, with the exploration probability, of another one,
+// and the routing decision to send to the stats hook. It must be called holding the manager mutex
+func (m *Manager) selectByLatency() (string, *RoutingDecisionEvent) {
+	names := make([]string, 0, len(m.clients))
+	for name := range m.clients {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return "", nil
+	}
+	sort.Strings(names)
+
+	m.latencyMutex.Lock()
+	latencies := m.latenciesOf(names)
+	m.latencyMutex.Unlock()
+
+	best := -1
+	for i, stats := range latencies {
+		if stats.Healthy && (best < 0 || stats.EWMA < latencies[best].EWMA) {
+			best = i
+		}
+	}
+
+	decision := &RoutingDecisionEvent{Latencies: latencies}
+	if best < 0 {
+		// no healthy client: any one can be tried
+		best = m.rnd.intn(len(latencies))
+		decision.Explored = true
+	} else if len(latencies) > 1 && m.rnd.float64() < m.exploration {
+		// explore a client picked uniformly among the ones other than the best
+		selected := m.rnd.intn(len(latencies) - 1)
+		if selected >= best {
+			selected++
+		}
+		best = selected
+		decision.Explored = true
+	}
+	decision.Client = latencies[best].Client
+	return decision.Client, decision
+}
+
+// Route returns the client selected by the router for the given request
+func (m *Manager) Route(request *http.Request) (*WmClient, error) {
+	_, client, err := m.route(request)
+	return client, err
+}
+
+// route selects the client for the given request. The routing decision, if any, is sent to the stats hook after releasing
+// the manager mutex, so that the hook can call the manager
+func (m *Manager) route(request *http.Request) (string, *WmClient, error) {
+	name, client, decision, hook, err := m.selectRoute(request)
+	if decision != nil && hook != nil {
+		hook(*decision)
+	}
+	return name, client, err
+}
+
+func (m *Manager) selectRoute(request *http.Request) (string, *WmClient, *RoutingDecisionEvent, StatsHook, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	name := ""
+	if m.router != nil {
+		name = m.router(request)
+	}
+	var decision *RoutingDecisionEvent
+	if name == "" && m.latencyRouting {
+		name, decision = m.selectByLatency()
+	}
+	if name == "" {
+		name = m.defaultName
+	}
+
+	client, ok := m.clients[name]
+	if !ok {
+		return "", nil, decision, m.statsHook, fmt.Errorf("no client available for route %q", name)
+	}
+	return name, client, decision, m.statsHook, nil
+}
+
+// LookupRequest detects the device of the given request using the client selected by the router
+func (m *Manager) LookupRequest(request http.Request) (*JSONDeviceData, error) {
+	return m.LookupRequestContext(request.Context(), &request)
+}
+
+// LookupRequestContext works like LookupRequest, the request to WM server is bound to the given context
+func (m *Manager) LookupRequestContext(ctx context.Context, request *http.Request) (*JSONDeviceData, error) {
+	name, client, err := m.route(request)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	device, err := client.LookupRequestContext(ctx, request)
+	// a ServerError means that the server has been reached, it is a failure only if the client ErrorPolicy says so
+	m.ObserveLatency(name, time.Since(start), err == nil || isServerError(err) && !client.countsAsFailure(err))
+	return device, err
+}
+
+// DestroyConnections destroys all managed clients and removes them from the manager
+func (m *Manager) DestroyConnections() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for name, client := range m.clients {
+		client.DestroyConnection()
+		delete(m.clients, name)
+	}
+	m.defaultName = ""
+
+	m.latencyMutex.Lock()
+	m.latencies = make(map[string]*EndpointLatency)
+	m.latencyMutex.Unlock()
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"math/rand"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestManagerRouting(t *testing.T) {
+	eu := &WmClient{host: "wm-eu"}
+	us := &WmClient{host: "wm-us"}
+
+	manager := NewManager()
+	request, err := http.NewRequest("GET", "http://mysite.com", nil)
+	require.Nil(t, err)
+	_, err = manager.Route(request)
+	require.NotNil(t, err)
+
+	manager.Add("eu", eu)
+	manager.Add("us", us)
+	require.Equal(t, []string{"eu", "us"}, manager.Names())
+
+	// first client is the default one
+	client, err := manager.Route(request)
+	require.Nil(t, err)
+	require.Equal(t, eu, client)
+
+	manager.SetRouter(func(r *http.Request) string {
+		return r.Header.Get("X-Region")
+	})
+	request.Header.Set("X-Region", "us")
+	client, err = manager.Route(request)
+	require.Nil(t, err)
+	require.Equal(t, us, client)
+
+	request.Header.Set("X-Region", "ap")
+	_, err = manager.Route(request)
+	require.NotNil(t, err)
+
+	require.NotNil(t, manager.SetDefault("ap"))
+	require.Nil(t, manager.SetDefault("us"))
+	request.Header.Del("X-Region")
+	client, err = manager.Route(request)
+	require.Nil(t, err)
+	require.Equal(t, us, client)
+
+	removed, ok := manager.Remove("us")
+	require.True(t, ok)
+	require.Equal(t, us, removed)
+	_, ok = manager.Get("us")
+	require.False(t, ok)
+}
+
+func TestManagerStatsHook(t *testing.T) {
+	manager := NewManager()
+	manager.Add("eu", &WmClient{})
+
+	var events []ManagedClientEvent
+	manager.SetStatsHook(func(event interface{}) {
+		events = append(events, event.(ManagedClientEvent))
+	})
+	// clients added after the hook is set get it too
+	manager.Add("us", &WmClient{})
+
+	eu, _ := manager.Get("eu")
+	us, _ := manager.Get("us")
+	eu.emitStats(CacheTuningEvent{NewSize: 1})
+	us.emitStats(CacheTuningEvent{NewSize: 2})
+
+	require.Equal(t, []ManagedClientEvent{
+		{Client: "eu", Event: CacheTuningEvent{NewSize: 1}},
+		{Client: "us", Event: CacheTuningEvent{NewSize: 2}},
+	}, events)
+}
+
+func TestManagerLatencyAwareRouting(t *testing.T) {
+	manager := NewManager()
+	manager.Add("eu-1", &WmClient{})
+	manager.Add("eu-2", &WmClient{})
+	manager.Add("eu-3", &WmClient{})
+	manager.SetRandSource(rand.NewSource(1))
+	require.NotNil(t, manager.EnableLatencyAwareRouting(1.5))
+	require.Nil(t, manager.EnableLatencyAwareRouting(0))
+
+	var decisions []RoutingDecisionEvent
+	manager.SetStatsHook(func(event interface{}) {
+		if d, ok := event.(RoutingDecisionEvent); ok {
+			decisions = append(decisions, d)
+		}
+	})
+
+	manager.ObserveLatency("eu-1", 30*time.Millisecond, true)
+	manager.ObserveLatency("eu-2", 10*time.Millisecond, true)
+	manager.ObserveLatency("eu-3", 20*time.Millisecond, true)
+
+	request, err := http.NewRequest("GET", "http://mysite.com", nil)
+	require.Nil(t, err)
+	name, _, err := manager.route(request)
+	require.Nil(t, err)
+	require.Equal(t, "eu-2", name)
+	require.Equal(t, 1, len(decisions))
+	require.False(t, decisions[0].Explored)
+	require.Equal(t, 3, len(decisions[0].Latencies))
+
+	// fastest client is down: the second fastest is selected
+	manager.ObserveLatency("eu-2", time.Second, false)
+	name, _, _ = manager.route(request)
+	require.Equal(t, "eu-3", name)
+
+	// EWMA smooths latency changes
+	manager.ObserveLatency("eu-3", 70*time.Millisecond, true)
+	latencies := manager.GetLatencies()
+	require.Equal(t, 30*time.Millisecond, latencies[2].EWMA)
+	require.Equal(t, uint64(2), latencies[2].Samples)
+	require.False(t, latencies[1].Healthy)
+
+	// always exploring: the best client is never selected
+	require.Nil(t, manager.EnableLatencyAwareRouting(1))
+	for i := 0; i < 10; i++ {
+		name, _, _ = manager.route(request)
+		require.NotEqual(t, "eu-1", name)
+		require.True(t, decisions[len(decisions)-1].Explored)
+	}
+
+	// an explicit route wins over latency
+	manager.SetRouter(func(r *http.Request) string { return "eu-1" })
+	name, _, _ = manager.route(request)
+	require.Equal(t, "eu-1", name)
+}
+
+func TestManagerExplorationIsUniform(t *testing.T) {
+	manager := NewManager()
+	for _, name := range []string{"a", "b", "c", "d"} {
+		manager.Add(name, &WmClient{})
+	}
+	manager.SetRandSource(rand.NewSource(1))
+	require.Nil(t, manager.EnableLatencyAwareRouting(1))
+	manager.ObserveLatency("a", 40*time.Millisecond, true)
+	manager.ObserveLatency("b", 10*time.Millisecond, true)
+	manager.ObserveLatency("c", 20*time.Millisecond, true)
+	manager.ObserveLatency("d", 30*time.Millisecond, true)
+
+	request, err := http.NewRequest("GET", "http://mysite.com", nil)
+	require.Nil(t, err)
+	selected := make(map[string]int)
+	for i := 0; i < 300; i++ {
+		name, _, err := manager.route(request)
+		require.Nil(t, err)
+		selected[name]++
+	}
+	require.Equal(t, 0, selected["b"])
+	for _, name := range []string{"a", "c", "d"} {
+		require.True(t, selected[name] > 50, "%s selected %d times", name, selected[name])
+	}
+}
+
+func TestManagerStatsHookCanCallManager(t *testing.T) {
+	manager := NewManager()
+	manager.Add("eu-1", &WmClient{})
+	manager.Add("eu-2", &WmClient{})
+	require.Nil(t, manager.EnableLatencyAwareRouting(0.5))
+
+	// the hook takes the manager write lock: it would deadlock if called while route holds the read lock
+	var decisions int
+	manager.SetStatsHook(func(event interface{}) {
+		if _, ok := event.(RoutingDecisionEvent); ok {
+			decisions++
+			manager.SetRouter(nil)
+			manager.Names()
+		}
+	})
+
+	request, err := http.NewRequest("GET", "http://mysite.com", nil)
+	require.Nil(t, err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			manager.Route(request)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stats hook deadlocks calling the manager")
+	}
+	require.Equal(t, 10, decisions)
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"fmt"
+
+	"github.com/golang/groupcache/lru"
+)
+
+// Derivation computes a value from device data, ie: a device class or an image size recommendation
+type Derivation func(device *JSONDeviceData) (interface{}, error)
+
+// memoKey identifies a derived value: the same derivation name on the same device always yields the same value
+type memoKey struct {
+	wurflID string
+	name    string
+}
+
+// SetMemoCacheSize enables the memo cache used by Memoize, holding up to maxEntries derived values. A maxEntries <= 0
+// disables it. Like the other caches, the memo cache is cleared when WM server loads a new WURFL file.
+// This function should be called before performing any lookup
+func (c *WmClient) SetMemoCacheSize(maxEntries int) {
+	if c == nil {
+		return
+	}
+	c.memoMutex.Lock()
+	if maxEntries > 0 {
+		c.memoCache = lru.New(maxEntries)
+	} else {
+		c.memoCache = nil
+	}
+	c.memoMutex.Unlock()
+}
+
+// Memoize returns the value computed by derive for the given device, computing it only once per wurfl_id and derivation
+// name, so that expensive derivations are not repeated for every request detected as the same device.
+// Errors returned by derive are not cached. If the memo cache is disabled or the device data has no wurfl_id,
+// derive is called every time
+func (c *WmClient) Memoize(name string, device *JSONDeviceData, derive Derivation) (interface{}, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	if device == nil {
+		return nil, fmt.Errorf("cannot compute %s on nil device data", name)
+	}
+
+	wurflID := deviceID(device)
+	if wurflID == "" {
+		return derive(device)
+	}
+
+	key := memoKey{wurflID: wurflID, name: name}
+	c.memoMutex.Lock()
+	if c.memoCache == nil {
+		c.memoMutex.Unlock()
+		return derive(device)
+	}
+	if value, ok := c.memoCache.Get(key); ok {
+		c.memoMutex.Unlock()
+		return value, nil
+	}
+	c.memoMutex.Unlock()
+
+	// derive is called without holding the mutex: concurrent misses on the same key may compute the value more than once,
+	// which is harmless since derivations are deterministic
+	value, err := derive(device)
+	if err != nil {
+		return nil, err
+	}
+
+	c.memoMutex.Lock()
+	if c.memoCache != nil {
+		c.memoCache.Add(key, value)
+	}
+	c.memoMutex.Unlock()
+	return value, nil
+}
+
+// clearMemoCache removes all derived values, which may be stale after a WURFL file reload. Like the other caches, the memo
+// cache is swapped with an empty one instead of being cleared in place
+func (c *WmClient) clearMemoCache() {
+	c.memoMutex.Lock()
+	if c.memoCache != nil && c.memoCache.Len() > 0 {
+		c.memoCache = lru.New(c.memoCache.MaxEntries)
+	}
+	c.memoMutex.Unlock()
+}
+
+// DecisionPolicy maps a device to an application decision, ie: one of a handful of experience buckets, running the policy
+// function once per wurfl_id instead of once per request. Decisions are stored in the client memo cache, which must be
+// enabled with SetMemoCacheSize, and are recomputed after WURFL file reloads. A DecisionPolicy is safe for concurrent use
+type DecisionPolicy struct {
+	client *WmClient
+	name   string
+	decide Derivation
+}
+
+// NewDecisionPolicy returns a policy that decides using the given function. The name identifies the policy in the memo
+// cache: policies with different functions must have different names
+func (c *WmClient) NewDecisionPolicy(name string, decide Derivation) *DecisionPolicy {
+	return &DecisionPolicy{client: c, name: name, decide: decide}
+}
+
+// Decide returns the policy decision for the given device
+func (p *DecisionPolicy) Decide(device *JSONDeviceData) (interface{}, error) {
+	return p.client.Memoize(p.name, device, p.decide)
+}
+
+// DecideString returns the policy decision for the given device, for policies whose decisions are strings
+func (p *DecisionPolicy) DecideString(device *JSONDeviceData) (string, error) {
+	decision, err := p.Decide(device)
+	if err != nil {
+		return "", err
+	}
+	value, ok := decision.(string)
+	if !ok {
+		return "", fmt.Errorf("policy %s decision is a %T, not a string", p.name, decision)
+	}
+	return value, nil
+}
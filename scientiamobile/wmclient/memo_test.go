@@ -0,0 +1,118 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoize(t *testing.T) {
+	client := &WmClient{}
+	client.SetMemoCacheSize(10)
+
+	calls := 0
+	deviceClass := func(device *JSONDeviceData) (interface{}, error) {
+		calls++
+		if device.Capabilities["is_smartphone"] == "true" {
+			return "smartphone", nil
+		}
+		return "other", nil
+	}
+
+	device := &JSONDeviceData{Capabilities: map[string]string{"wurfl_id": "apple_iphone_ver10", "is_smartphone": "true"}}
+	for i := 0; i < 3; i++ {
+		value, err := client.Memoize("device_class", device, deviceClass)
+		require.Nil(t, err)
+		require.Equal(t, "smartphone", value)
+	}
+	require.Equal(t, 1, calls)
+
+	// a different derivation name is computed separately
+	_, err := client.Memoize("other_class", device, deviceClass)
+	require.Nil(t, err)
+	require.Equal(t, 2, calls)
+
+	// clearing the caches (ie: on WURFL reload) drops derived values
+	client.clearCache(CacheClearManual)
+	_, err = client.Memoize("device_class", device, deviceClass)
+	require.Nil(t, err)
+	require.Equal(t, 3, calls)
+
+	// devices without wurfl_id are not memoized
+	noID := &JSONDeviceData{Capabilities: map[string]string{"is_smartphone": "false"}}
+	client.Memoize("device_class", noID, deviceClass)
+	client.Memoize("device_class", noID, deviceClass)
+	require.Equal(t, 5, calls)
+}
+
+func TestMemoizeErrorNotCached(t *testing.T) {
+	client := &WmClient{}
+	client.SetMemoCacheSize(10)
+	device := &JSONDeviceData{Capabilities: map[string]string{"wurfl_id": "generic"}}
+
+	calls := 0
+	failing := func(device *JSONDeviceData) (interface{}, error) {
+		calls++
+		return nil, errors.New("derivation failed")
+	}
+	_, err := client.Memoize("x", device, failing)
+	require.NotNil(t, err)
+	_, err = client.Memoize("x", device, failing)
+	require.NotNil(t, err)
+	require.Equal(t, 2, calls)
+
+	_, err = client.Memoize("x", nil, failing)
+	require.NotNil(t, err)
+}
+
+func TestDecisionPolicy(t *testing.T) {
+	client := &WmClient{}
+	client.SetMemoCacheSize(10)
+
+	calls := 0
+	bucket := client.NewDecisionPolicy("bucket", func(device *JSONDeviceData) (interface{}, error) {
+		calls++
+		if device.Capabilities["is_smartphone"] == "true" {
+			return "rich", nil
+		}
+		return "lite", nil
+	})
+	smartphone := &JSONDeviceData{Capabilities: map[string]string{"wurfl_id": "apple_iphone_ver10", "is_smartphone": "true"}}
+	feature := &JSONDeviceData{Capabilities: map[string]string{"wurfl_id": "nokia_3310_ver1", "is_smartphone": "false"}}
+
+	for i := 0; i < 3; i++ {
+		decision, err := bucket.DecideString(smartphone)
+		require.Nil(t, err)
+		require.Equal(t, "rich", decision)
+		decision, err = bucket.DecideString(feature)
+		require.Nil(t, err)
+		require.Equal(t, "lite", decision)
+	}
+	require.Equal(t, 2, calls)
+
+	// decisions of other types are not converted
+	size := client.NewDecisionPolicy("image_size", func(device *JSONDeviceData) (interface{}, error) {
+		return 640, nil
+	})
+	decision, err := size.Decide(smartphone)
+	require.Nil(t, err)
+	require.Equal(t, 640, decision)
+	_, err = size.DecideString(smartphone)
+	require.NotNil(t, err)
+}
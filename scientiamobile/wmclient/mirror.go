@@ -0,0 +1,184 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// MirroredRequest is a lookup input written by a RequestMirror, one JSON object per line, ie:
+//
+//	{"time":"2024-05-02T10:04:05.123Z","path":"/v2/lookuprequest/json","headers":{"User-Agent":"Mozilla/5.0 ..."}}
+//
+// Replaying the lookups of a mirror file, in order, reproduces the traffic shape of the mirrored client, its cache hit ratio
+// included. Only the important headers sent to WM server are kept, with hashed values if the mirror hashes them
+type MirroredRequest struct {
+	Time    time.Time         `json:"time"`
+	Path    string            `json:"path"`             // WM server lookup endpoint
+	Headers map[string]string `json:"headers"`          // lookup headers, by name
+	Hashed  bool              `json:"hashed,omitempty"` // true if the header values are hashed, so not real user agents
+}
+
+// MirrorOptions configures a RequestMirror
+type MirrorOptions struct {
+	// SampleRate is the fraction of the lookups written, ie: 0.01 writes one lookup out of 100. Values <= 0 or >= 1 write
+	// every lookup
+	SampleRate float64
+	// HashValues replaces the header values with their hash, so that the file holds no user agent while keeping the
+	// number of distinct values and their frequency. Salt is hashed with the values, to prevent guessing them
+	HashValues bool
+	Salt       string
+}
+
+// RequestMirror appends the inputs of a sample of the lookups to a file, so that they can be replayed offline, ie: by a
+// load test tool reading them with ReadMirroredRequests. A RequestMirror is safe for concurrent use and can be shared by
+// several clients. Since the file is opened in append mode, processes can share it too
+type RequestMirror struct {
+	options MirrorOptions
+
+	mutex   sync.Mutex // protects the fields below
+	file    *os.File
+	written uint64
+	err     error // last write error
+}
+
+// NewRequestMirror creates a mirror appending the lookups to the file at the given path, which is created if needed
+func NewRequestMirror(path string, options MirrorOptions) (*RequestMirror, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &RequestMirror{options: options, file: file}, nil
+}
+
+// Written returns the number of lookups written, and the last write error, if any
+func (m *RequestMirror) Written() (uint64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.written, m.err
+}
+
+// Close closes the mirror file. Lookups done afterwards are not written
+func (m *RequestMirror) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.file == nil {
+		return nil
+	}
+	err := m.file.Close()
+	m.file = nil
+	return err
+}
+
+// write appends the given lookup to the file
+func (m *RequestMirror) write(path string, headers map[string]string) {
+	request := MirroredRequest{Time: time.Now().UTC(), Path: path, Headers: headers}
+	if m.options.HashValues {
+		request.Headers = make(map[string]string, len(headers))
+		for name, value := range headers {
+			request.Headers[name] = hashKey(m.options.Salt + "\x00" + value)
+		}
+		request.Hashed = true
+	}
+	line, err := json.Marshal(&request)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.file == nil {
+		return
+	}
+	// the line is written with a single call, so that lines appended by other processes are not interleaved with it
+	if _, err = m.file.Write(line); err != nil {
+		m.err = err
+		return
+	}
+	m.written++
+}
+
+// ReadMirroredRequests calls fn for each lookup read from r, which holds the lines written by a RequestMirror, stopping at
+// the first error returned by fn. Empty lines are skipped
+func ReadMirroredRequests(r io.Reader, fn func(request MirroredRequest) error) error {
+	scanner := bufio.NewScanner(r)
+	// user agents can be long, but lines larger than 1MB are not lookups
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var request MirroredRequest
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			return &MirrorFormatError{Line: line, Err: err}
+		}
+		if err := fn(request); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// MirrorFormatError is returned by ReadMirroredRequests for lines that are not mirrored requests
+type MirrorFormatError struct {
+	Line int
+	Err  error
+}
+
+func (e *MirrorFormatError) Error() string {
+	return fmt.Sprintf("invalid mirrored request at line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the decoding error
+func (e *MirrorFormatError) Unwrap() error {
+	return e.Err
+}
+
+// SetRequestMirror sets the mirror the client writes a sample of its lookup inputs to. A nil mirror disables mirroring,
+// which is the default. The mirror is not closed by the client. Lookups done with LookupDeviceID are not mirrored, since
+// they do not detect a device. This function should be called before performing any lookup
+func (c *WmClient) SetRequestMirror(mirror *RequestMirror) {
+	if c == nil {
+		return
+	}
+	c.requestMirror = mirror
+}
+
+// WithRequestMirror sets the mirror the client writes a sample of its lookup inputs to, as SetRequestMirror does
+func WithRequestMirror(mirror *RequestMirror) Option {
+	return func(options *clientOptions) {
+		options.requestMirror = mirror
+	}
+}
+
+// mirrorLookup writes the given lookup input to the request mirror, if set and if the lookup is sampled
+func (c *WmClient) mirrorLookup(path string, headers map[string]string) {
+	m := c.requestMirror
+	if m == nil {
+		return
+	}
+	if rate := m.options.SampleRate; rate > 0 && rate < 1 && c.rnd.float64() >= rate {
+		return
+	}
+	m.write(path, headers)
+}
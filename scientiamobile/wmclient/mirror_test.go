@@ -0,0 +1,135 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestMirror(t *testing.T) {
+	var lookups int32
+	server := httptest.NewServer(newOptionsTestHandler("", &lookups))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "wmclient")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mirror.jsonl")
+
+	mirror, err := NewRequestMirror(path, MirrorOptions{})
+	require.Nil(t, err)
+	client, err := CreateFromURL(server.URL, WithCache(100), WithRequestMirror(mirror))
+	require.Nil(t, err)
+	defer client.Close()
+
+	// cache hits are mirrored too, so that replays have the same cache hit ratio
+	for _, userAgent := range []string{"ua 1", "ua 2", "ua 1"} {
+		_, err = client.LookupUserAgent(context.Background(), userAgent)
+		require.Nil(t, err)
+	}
+	client.LookupUserAgentBatch(context.Background(), []string{"ua 2", "ua 3"}, 1)
+	written, err := mirror.Written()
+	require.Nil(t, err)
+	require.Equal(t, uint64(5), written)
+	require.Nil(t, mirror.Close())
+	require.Nil(t, mirror.Close())
+	// lookups done after the mirror is closed are not written
+	_, err = client.LookupUserAgent(context.Background(), "ua 4")
+	require.Nil(t, err)
+
+	file, err := os.Open(path)
+	require.Nil(t, err)
+	defer file.Close()
+	var userAgents []string
+	require.Nil(t, ReadMirroredRequests(file, func(request MirroredRequest) error {
+		require.False(t, request.Hashed)
+		require.False(t, request.Time.IsZero())
+		require.Equal(t, lookupUserAgentPath, request.Path)
+		userAgents = append(userAgents, request.Headers[userAgentHeader])
+		return nil
+	}))
+	require.Equal(t, []string{"ua 1", "ua 2", "ua 1", "ua 2", "ua 3"}, userAgents)
+}
+
+func TestRequestMirrorOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wmclient")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mirror.jsonl")
+
+	mirror, err := NewRequestMirror(path, MirrorOptions{HashValues: true, Salt: "salt"})
+	require.Nil(t, err)
+	client := &WmClient{requestMirror: mirror}
+	client.mirrorLookup(lookupUserAgentPath, map[string]string{userAgentHeader: "ua 1"})
+	client.mirrorLookup(lookupUserAgentPath, map[string]string{userAgentHeader: "ua 1"})
+	client.mirrorLookup(lookupUserAgentPath, map[string]string{userAgentHeader: "ua 2"})
+	require.Nil(t, mirror.Close())
+
+	// the file is appended to
+	mirror, err = NewRequestMirror(path, MirrorOptions{SampleRate: 0.1})
+	require.Nil(t, err)
+	client = &WmClient{}
+	client.SetRequestMirror(mirror)
+	client.SetRandSource(rand.NewSource(42))
+	for i := 0; i < 1000; i++ {
+		client.mirrorLookup("/v2/lookuprequest/json", map[string]string{userAgentHeader: "ua"})
+	}
+	written, err := mirror.Written()
+	require.Nil(t, err)
+	require.InDelta(t, 100, written, 40)
+	require.Nil(t, mirror.Close())
+
+	data, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	require.NotContains(t, string(data), "ua 1")
+	var hashes []string
+	sampled := 0
+	require.Nil(t, ReadMirroredRequests(strings.NewReader(string(data)), func(request MirroredRequest) error {
+		if request.Hashed {
+			hashes = append(hashes, request.Headers[userAgentHeader])
+		} else {
+			sampled++
+		}
+		return nil
+	}))
+	require.Len(t, hashes, 3)
+	require.Equal(t, hashes[0], hashes[1])
+	require.NotEqual(t, hashes[0], hashes[2])
+	require.Equal(t, int(written), sampled)
+
+	stop := errors.New("stop")
+	require.Equal(t, stop, ReadMirroredRequests(strings.NewReader(string(data)), func(MirroredRequest) error {
+		return stop
+	}))
+	err = ReadMirroredRequests(strings.NewReader("\n{\"path\":\"/v2/lookuprequest/json\"}\nnot json\n"), func(MirroredRequest) error {
+		return nil
+	})
+	var formatErr *MirrorFormatError
+	require.True(t, errors.As(err, &formatErr))
+	require.Equal(t, 3, formatErr.Line)
+
+	_, err = NewRequestMirror(filepath.Join(dir, "missing", "mirror.jsonl"), MirrorOptions{})
+	require.NotNil(t, err)
+}
@@ -15,6 +15,8 @@ limitations under the License.
 */
 package wmclient
 
+import "net/http"
+
 // Contains all the data structures used by both wm server and client
 
 // JSONInfoData - server and API informations
@@ -25,32 +27,67 @@ type JSONInfoData struct {
 	ImportantHeaders []string `json:"important_headers"`
 	StaticCaps       []string `json:"static_caps"`
 	VirtualCaps      []string `json:"virtual_caps"`
+	DeprecatedCaps   []string `json:"deprecated_caps,omitempty"` // sent only by WM server versions that support capability deprecation
 	Ltime            string   `json:"ltime"`
 }
 
 // Request - data object that is sent to the WM server in POST requests
 type Request struct {
-	LookupHeaders  map[string]string `json:"lookup_headers"`
-	RequestedCaps  []string          `json:"requested_caps"`
-	RequestedVCaps []string          `json:"requested_vcaps, omitempty"`
-	WurflID        string            `json:"wurfl_id, omitempty"`
-	TacCode        string            `json:"tac_code, omitempty"`
+	LookupHeaders  map[string]string `json:"lookup_headers,omitempty"`
+	RequestedCaps  []string          `json:"requested_caps,omitempty"`
+	RequestedVCaps []string          `json:"requested_vcaps,omitempty"`
+	WurflID        string            `json:"wurfl_id,omitempty"`
+	TacCode        string            `json:"tac_code,omitempty"`
+}
+
+// BatchRequest - data object that is sent to the WM server to detect many devices with a single request
+type BatchRequest struct {
+	Requests []Request `json:"requests"`
+}
+
+// BatchResponse - data object returned by the WM server for a BatchRequest, devices are in the same order as requests
+type BatchResponse struct {
+	Devices []JSONDeviceData `json:"devices"`
 }
 
 // JSONDeviceData models a WURFL device data in JSON string only format
 type JSONDeviceData struct {
 	APIVersion   string            `json:"apiVersion"`
 	Capabilities map[string]string `json:"capabilities"`
-	Error        string            `json:"error, omitempty"`
+	DeviceID     string            `json:"-"` // wurfl_id of the device, see WmClient.SetWurflIDInCapabilities
+	Error        string            `json:"error,omitempty"`
 	Mtime        int64             `json:"mtime"` // timestamp of this data structure creation
 	Ltime        string            `json:"ltime"` // time of last wurfl.xml file load
+	Metadata     *ResponseMetadata `json:"-"`     // diagnostic data of the WM server response this device has been read from
+	RawBody      []byte            `json:"-"`     // WM server response body, set only by lookups with the WithRawBody option
+}
+
+// JSONDetectionExplanation models the diagnostic data returned by WM server in explain mode: the detected device together
+// with how the detection has been performed
+type JSONDetectionExplanation struct {
+	JSONDeviceData
+	NormalizedUserAgent string   `json:"normalized_user_agent"` // user agent as normalized before matching
+	Matcher             string   `json:"matcher"`               // name of the matcher that detected the device
+	MatcherPath         []string `json:"matcher_path"`          // matchers evaluated, in order, until the device was detected
+	MatchType           string   `json:"match_type"`            // ie: conclusive, recovery or catch-all
+}
+
+// ResponseMetadata holds the diagnostic headers of a WM server response, useful to identify the request in support tickets
+type ResponseMetadata struct {
+	ServerVersion  string      `json:"serverVersion,omitempty"`  // value of the Server header
+	RequestID      string      `json:"requestId,omitempty"`      // value of the X-Request-Id header
+	ProcessingTime string      `json:"processingTime,omitempty"` // value of the X-Processing-Time header
+	Headers        http.Header `json:"headers,omitempty"`        // all the diagnostic headers found in the response
+	FromSnapshot   bool        `json:"fromSnapshot,omitempty"`   // true if the device has been read from the device snapshot because WM server could not be reached
+	Stale          bool        `json:"stale,omitempty"`          // true if the device has been read from an expired cache entry because the lookup timed out
+	Repaired       []string    `json:"repaired,omitempty"`       // requested capabilities missing from the response, set by the client to their zero value
 }
 
 // JSONDeviceDataTyped models a WURFL device data in JSON typed format
 type JSONDeviceDataTyped struct {
 	APIVersion   string                 `json:"apiVersion"`
 	Capabilities map[string]interface{} `json:"capabilities"`
-	Error        string                 `json:"error, omitempty"`
+	Error        string                 `json:"error,omitempty"`
 	Mtime        int64                  `json:"mtime"`
 	Ltime        string                 `json:"ltime"`
 }
@@ -62,6 +99,19 @@ type JSONMakeModel struct {
 	MarketingName string `json:"marketing_name,omitempty"`
 }
 
+// DeviceQuery - data object that is sent to the WM server to find the devices whose capabilities have the given values
+type DeviceQuery struct {
+	Filters map[string]string `json:"filters"`
+}
+
+// JSONQueriedDevice models a device found by a device query
+type JSONQueriedDevice struct {
+	WurflID       string `json:"wurfl_id,omitempty"` // empty if the query has been answered using the device makes data
+	BrandName     string `json:"brand_name"`
+	ModelName     string `json:"model_name"`
+	MarketingName string `json:"marketing_name,omitempty"`
+}
+
 // JSONModelMktName holds model_name and marketing_name
 type JSONModelMktName struct {
 	ModelName     string `json:"model_name"`
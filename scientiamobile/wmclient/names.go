@@ -0,0 +1,94 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"strings"
+	"sync"
+)
+
+// trademarkReplacer removes trademark symbols, in their unicode and ASCII forms, from names
+var trademarkReplacer = strings.NewReplacer(
+	"\u2122", "", // trade mark sign
+	"\u00ae", "", // registered sign
+	"\u00a9", "", // copyright sign
+	"\u2120", "", // service mark sign
+	"(TM)", "",
+	"(tm)", "",
+	"(R)", "",
+	"(r)", "",
+)
+
+// NormalizeMarketingName returns the given marketing (or model) name in a form suitable to be displayed: trademark symbols
+// are removed and white spaces are trimmed and collapsed. Letter case is preserved, use MarketingNameKey to compare names
+func NormalizeMarketingName(name string) string {
+	return strings.Join(strings.Fields(trademarkReplacer.Replace(name)), " ")
+}
+
+// MarketingNameKey returns the case folded, normalized form of the given name, to be used to compare or index names
+func MarketingNameKey(name string) string {
+	return strings.ToLower(NormalizeMarketingName(name))
+}
+
+// MarketingNameAliases maps alternative names of a device (ie: "Galaxy S 3" or "GT-I9300") to the one to display
+// (ie: "Galaxy S III"). Aliases are matched by MarketingNameKey. It is safe for concurrent use
+type MarketingNameAliases struct {
+	mutex   sync.RWMutex
+	aliases map[string]string
+}
+
+// NewMarketingNameAliases creates a set of aliases from the given alias -> display name map
+func NewMarketingNameAliases(aliases map[string]string) *MarketingNameAliases {
+	a := &MarketingNameAliases{aliases: make(map[string]string, len(aliases))}
+	for alias, name := range aliases {
+		a.Add(alias, name)
+	}
+	return a
+}
+
+// Add adds an alias of the given display name
+func (a *MarketingNameAliases) Add(alias string, name string) {
+	a.mutex.Lock()
+	a.aliases[MarketingNameKey(alias)] = NormalizeMarketingName(name)
+	a.mutex.Unlock()
+}
+
+// Resolve returns the normalized display name of the given name: the one it is an alias of, if any, or the name itself
+func (a *MarketingNameAliases) Resolve(name string) string {
+	a.mutex.RLock()
+	resolved, ok := a.aliases[MarketingNameKey(name)]
+	a.mutex.RUnlock()
+	if ok {
+		return resolved
+	}
+	return NormalizeMarketingName(name)
+}
+
+// NormalizeDevices returns a copy of the given enumeration data, ie: the result of GetAllDevicesForMake, with model and
+// marketing names normalized and marketing names resolved using the given aliases, which can be nil
+func NormalizeDevices(devices []JSONModelMktName, aliases *MarketingNameAliases) []JSONModelMktName {
+	normalized := make([]JSONModelMktName, 0, len(devices))
+	for _, device := range devices {
+		device.ModelName = NormalizeMarketingName(device.ModelName)
+		if aliases != nil {
+			device.MarketingName = aliases.Resolve(device.MarketingName)
+		} else {
+			device.MarketingName = NormalizeMarketingName(device.MarketingName)
+		}
+		normalized = append(normalized, device)
+	}
+	return normalized
+}
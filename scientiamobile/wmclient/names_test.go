@@ -0,0 +1,43 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeMarketingName(t *testing.T) {
+	require.Equal(t, "Galaxy S III", NormalizeMarketingName("  Galaxy® S  III™ "))
+	require.Equal(t, "Kindle Fire", NormalizeMarketingName("Kindle(TM) Fire"))
+	require.Equal(t, "", NormalizeMarketingName("  "))
+	require.Equal(t, "galaxy s iii", MarketingNameKey("GALAXY  S III™"))
+}
+
+func TestMarketingNameAliases(t *testing.T) {
+	aliases := NewMarketingNameAliases(map[string]string{"Galaxy S 3": "Galaxy S III"})
+	aliases.Add("gt-i9300", "Galaxy S III")
+
+	require.Equal(t, "Galaxy S III", aliases.Resolve(" galaxy s 3 "))
+	require.Equal(t, "Galaxy S III", aliases.Resolve("GT-I9300"))
+	require.Equal(t, "iPhone", aliases.Resolve(" iPhone™"))
+
+	devices := NormalizeDevices([]JSONModelMktName{{ModelName: "GT-I9300 ", MarketingName: "Galaxy S 3"}}, aliases)
+	require.Equal(t, []JSONModelMktName{{ModelName: "GT-I9300", MarketingName: "Galaxy S III"}}, devices)
+	devices = NormalizeDevices([]JSONModelMktName{{ModelName: "A1", MarketingName: " Phone®"}}, nil)
+	require.Equal(t, []JSONModelMktName{{ModelName: "A1", MarketingName: "Phone"}}, devices)
+}
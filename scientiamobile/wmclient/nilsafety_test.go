@@ -0,0 +1,117 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+var requestType = reflect.TypeOf((*http.Request)(nil))
+
+// callWithZeroArgs calls the given method of the client with zero value arguments, but for contexts, which expire shortly,
+// requests and maps, which are empty instead of nil, and strings, which are the path of a file in dir, so that methods
+// writing files do not write them in the package directory. It returns the error the method returns, if any, or the value
+// of the panic it raises
+func callWithZeroArgs(client *WmClient, method reflect.Method, dir string) (err error, panicked interface{}) {
+	defer func() {
+		panicked = recover()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	methodType := method.Type
+	args := []reflect.Value{reflect.ValueOf(client)}
+	for i := 1; i < methodType.NumIn(); i++ {
+		argType := methodType.In(i)
+		if methodType.IsVariadic() && i == methodType.NumIn()-1 {
+			break
+		}
+		switch {
+		case argType == contextType:
+			args = append(args, reflect.ValueOf(ctx))
+		case argType == requestType:
+			args = append(args, reflect.ValueOf(httptest.NewRequest("GET", "/", nil)))
+		case argType.Kind() == reflect.Map:
+			args = append(args, reflect.MakeMap(argType))
+		case argType.Kind() == reflect.String:
+			args = append(args, reflect.ValueOf(filepath.Join(dir, method.Name)).Convert(argType))
+		default:
+			args = append(args, reflect.Zero(argType))
+		}
+	}
+
+	results := method.Func.Call(args)
+	for _, result := range results {
+		if result.Type() == errorType && !result.IsNil() {
+			err = result.Interface().(error)
+		}
+	}
+	return err, nil
+}
+
+// returnsError returns true if the last result of the given method is an error
+func returnsError(method reflect.Method) bool {
+	return method.Type.NumOut() > 0 && method.Type.Out(method.Type.NumOut()-1) == errorType
+}
+
+func TestNilClientMethods(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wmclient")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	clientType := reflect.TypeOf((*WmClient)(nil))
+	for i := 0; i < clientType.NumMethod(); i++ {
+		method := clientType.Method(i)
+		err, panicked := callWithZeroArgs(nil, method, dir)
+		assert.Nil(t, panicked, "%s panics on a nil client: %v", method.Name, panicked)
+		if returnsError(method) {
+			assert.True(t, errors.Is(err, ErrNilClient), "%s returns %v on a nil client", method.Name, err)
+		}
+	}
+}
+
+func TestZeroValueClientMethods(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wmclient")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	clientType := reflect.TypeOf((*WmClient)(nil))
+	for i := 0; i < clientType.NumMethod(); i++ {
+		method := clientType.Method(i)
+		_, panicked := callWithZeroArgs(&WmClient{}, method, dir)
+		assert.Nil(t, panicked, "%s panics on a zero value client: %v", method.Name, panicked)
+	}
+
+	// methods sending requests to WM server tell that the client has not been created with Create
+	client := &WmClient{}
+	_, err = client.LookupUserAgent(context.Background(), "ua")
+	require.True(t, errors.Is(err, ErrClientNotInitialized), fmt.Sprint(err))
+	_, err = client.GetAllDeviceMakes()
+	require.True(t, errors.Is(err, ErrClientNotInitialized), fmt.Sprint(err))
+}
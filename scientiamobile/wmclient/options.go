@@ -0,0 +1,163 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// LookupOption changes the behaviour of a single lookup, without changing the client shared settings. Options are accepted
+// by LookupUserAgent, LookupHeaders and LookupDeviceID
+type LookupOption func(options *lookupOptions)
+
+// lookupOptions holds the options of a lookup. They are passed to the lookup internals in its context
+type lookupOptions struct {
+	capabilities []string
+	overrideCaps bool
+	rawBody      bool
+	noCache      bool
+	timeout      time.Duration
+	extraHeaders map[string]string
+}
+
+// lookupOptionsKey is the context key of the lookup options
+type lookupOptionsKey struct{}
+
+// WithCapabilities makes a lookup return the given capabilities, static or virtual, instead of the ones set with the
+// SetRequested[...] methods, without changing them. Unknown capability names are discarded.
+// Since the client caches hold devices with the client requested capabilities, lookups with this option do not use them
+func WithCapabilities(capNames ...string) LookupOption {
+	return func(options *lookupOptions) {
+		options.capabilities = capNames
+		options.overrideCaps = true
+	}
+}
+
+// WithTimeout bounds the duration of a lookup, including its retries, to the given timeout. It can only shorten the transfer
+// timeout set with SetHTTPTimeout, which still applies to each request sent to WM server. A timeout <= 0 is ignored
+func WithTimeout(timeout time.Duration) LookupOption {
+	return func(options *lookupOptions) {
+		options.timeout = timeout
+	}
+}
+
+// WithNoCache makes a lookup neither read from nor write to the client caches, as the [...]Uncached lookup methods do.
+// Unlike WithCacheBypass, WM server is not asked to skip its own cache
+func WithNoCache() LookupOption {
+	return func(options *lookupOptions) {
+		options.noCache = true
+	}
+}
+
+// WithExtraHeaders adds the given headers to the ones sent to WM server by a user agent or headers lookup, ie: client hints
+// received out of band. Only the important headers are sent, header names are matched case insensitively and headers
+// already present in the lookup are not replaced. Device ID lookups ignore this option
+func WithExtraHeaders(headers map[string]string) LookupOption {
+	return func(options *lookupOptions) {
+		options.extraHeaders = headers
+	}
+}
+
+// capabilityHintsKey is the context key of the capability hints set with WithCaps
+type capabilityHintsKey struct{}
+
+// WithCaps returns a copy of ctx holding the capabilities, static or virtual, that lookups bound to it must return instead
+// of the ones set with the SetRequested[...] methods. It lets code that runs before a generic device detection middleware
+// (ie: a router that knows which handler will serve the request) ask for the capabilities that handler needs, setting them
+// on the request context: LookupRequest and the other lookups with a context honour them as the WithCapabilities option
+// does, which takes precedence when both are given. Unknown capability names are discarded and, as with WithCapabilities,
+// lookups with capability hints do not use the client caches
+func WithCaps(ctx context.Context, capNames ...string) context.Context {
+	return context.WithValue(ctx, capabilityHintsKey{}, capNames)
+}
+
+// WithRawBody makes a lookup set the RawBody of the returned device to the WM server response body, as received, ie: to
+// forward it verbatim to other systems. The body is JSON unless other formats have been set with SetAcceptFormats.
+// Since cached devices have no response body, lookups with this option do not use the client caches
+func WithRawBody() LookupOption {
+	return func(options *lookupOptions) {
+		options.rawBody = true
+	}
+}
+
+// withLookupOptions returns a context holding the given options, which must be cancelled when the lookup ends
+func withLookupOptions(ctx context.Context, options []LookupOption) (context.Context, context.CancelFunc) {
+	if len(options) == 0 {
+		return ctx, func() {}
+	}
+	lookupOptions := &lookupOptions{}
+	for _, option := range options {
+		option(lookupOptions)
+	}
+	ctx = context.WithValue(ctx, lookupOptionsKey{}, lookupOptions)
+	if lookupOptions.timeout > 0 {
+		return context.WithTimeout(ctx, lookupOptions.timeout)
+	}
+	return ctx, func() {}
+}
+
+// requestedCapabilities returns the static and virtual capabilities to request in a lookup with the given context, and
+// true if they are neither the client requested capabilities nor the ones of a ScopedClient, whose lookups are cached
+func (c *WmClient) requestedCapabilities(ctx context.Context) ([]string, []string, bool) {
+	if options, ok := ctx.Value(lookupOptionsKey{}).(*lookupOptions); ok && options.overrideCaps {
+		staticCaps, virtualCaps := c.splitCapabilities(options.capabilities)
+		return staticCaps, virtualCaps, true
+	}
+	if capNames, ok := ctx.Value(capabilityHintsKey{}).([]string); ok {
+		staticCaps, virtualCaps := c.splitCapabilities(capNames)
+		return staticCaps, virtualCaps, true
+	}
+	if scope := getCapabilityScope(ctx); scope != nil {
+		return scope.staticCaps, scope.virtualCaps, false
+	}
+	return c.requestedStaticCaps, c.requestedVirtualCaps, false
+}
+
+// wantsRawBody returns true if the lookup with the given context must return the WM server response body
+func wantsRawBody(ctx context.Context) bool {
+	options, ok := ctx.Value(lookupOptionsKey{}).(*lookupOptions)
+	return ok && options.rawBody
+}
+
+// wantsNoCache returns true if the lookup with the given context must not use the client caches
+func wantsNoCache(ctx context.Context) bool {
+	options, ok := ctx.Value(lookupOptionsKey{}).(*lookupOptions)
+	return ok && options.noCache
+}
+
+// addExtraHeaders returns the given lookup headers with the extra headers of the lookup with the given context added, see
+// WithExtraHeaders. The given headers are not modified
+func (c *WmClient) addExtraHeaders(ctx context.Context, lookupHeaders map[string]string) map[string]string {
+	options, ok := ctx.Value(lookupOptionsKey{}).(*lookupOptions)
+	if !ok || len(options.extraHeaders) == 0 {
+		return lookupHeaders
+	}
+
+	headers := make(map[string]string, len(lookupHeaders)+len(options.extraHeaders))
+	for name, value := range lookupHeaders {
+		headers[name] = value
+	}
+	for name, value := range options.extraHeaders {
+		for _, important := range c.ImportantHeaders {
+			if strings.EqualFold(name, important) && value != "" && headers[important] == "" {
+				headers[important] = value
+			}
+		}
+	}
+	return headers
+}
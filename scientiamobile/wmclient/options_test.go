@@ -0,0 +1,169 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupWithCapabilitiesOverride(t *testing.T) {
+	// the test server returns the requested capabilities
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+		caps := map[string]string{"wurfl_id": "generic"}
+		for _, name := range append(request.RequestedCaps, request.RequestedVCaps...) {
+			caps[name] = "value"
+		}
+		json.NewEncoder(w).Encode(JSONDeviceData{Capabilities: caps})
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.ImportantHeaders = []string{userAgentHeader}
+	client.StaticCaps = []string{"brand_name", "model_name"}
+	client.VirtualCaps = []string{"is_smartphone"}
+	client.SetCacheSize(100)
+	client.SetRequestedCapabilities([]string{"brand_name"})
+
+	device, err := client.LookupUserAgent(context.Background(), "ua", WithCapabilities("model_name", "is_smartphone", "unknown"))
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"wurfl_id": "generic", "model_name": "value", "is_smartphone": "value"}, device.Capabilities)
+	device, err = client.LookupDeviceID(context.Background(), "generic", WithCapabilities("model_name"))
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"wurfl_id": "generic", "model_name": "value"}, device.Capabilities)
+
+	// overridden lookups do not change the client requested capabilities, nor its caches
+	dCacheSize, uaCacheSize := client.GetActualCacheSizes()
+	require.Equal(t, 0, dCacheSize)
+	require.Equal(t, 0, uaCacheSize)
+	device, err = client.LookupHeaders(context.Background(), map[string]string{userAgentHeader: "ua"})
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"wurfl_id": "generic", "brand_name": "value"}, device.Capabilities)
+	_, uaCacheSize = client.GetActualCacheSizes()
+	require.Equal(t, 1, uaCacheSize)
+}
+
+func TestLookupWithCapabilityHints(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+		caps := map[string]string{"wurfl_id": "generic"}
+		for _, name := range append(request.RequestedCaps, request.RequestedVCaps...) {
+			caps[name] = "value"
+		}
+		json.NewEncoder(w).Encode(JSONDeviceData{Capabilities: caps})
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.ImportantHeaders = []string{userAgentHeader}
+	client.StaticCaps = []string{"brand_name", "model_name"}
+	client.VirtualCaps = []string{"is_smartphone"}
+	client.SetCacheSize(100)
+	client.SetRequestedCapabilities([]string{"brand_name"})
+
+	// hints set on the request context are honoured by LookupRequest
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(userAgentHeader, "ua")
+	request = request.WithContext(WithCaps(request.Context(), "model_name", "is_smartphone"))
+	device, err := client.LookupRequest(*request)
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"wurfl_id": "generic", "model_name": "value", "is_smartphone": "value"}, device.Capabilities)
+	dCacheSize, uaCacheSize := client.GetActualCacheSizes()
+	require.Equal(t, 0, dCacheSize)
+	require.Equal(t, 0, uaCacheSize)
+
+	// the WithCapabilities option takes precedence over the hints
+	device, err = client.LookupUserAgent(request.Context(), "ua", WithCapabilities("brand_name"))
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"wurfl_id": "generic", "brand_name": "value"}, device.Capabilities)
+}
+
+func TestLookupWithRawBody(t *testing.T) {
+	body := `{"apiVersion":"2.1.0","capabilities":{"wurfl_id":"generic","brand_name":"Generic"},"mtime":1,"ltime":"x"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.ImportantHeaders = []string{userAgentHeader}
+	client.SetCacheSize(100)
+
+	device, err := client.LookupUserAgent(context.Background(), "ua", WithRawBody())
+	require.Nil(t, err)
+	require.Equal(t, body, string(device.RawBody))
+	require.Equal(t, "Generic", device.Capabilities["brand_name"])
+	device, err = client.LookupDeviceID(context.Background(), "generic", WithRawBody())
+	require.Nil(t, err)
+	require.Equal(t, body, string(device.RawBody))
+
+	// devices with the raw body are not cached, and lookups without the option do not return it
+	dCacheSize, uaCacheSize := client.GetActualCacheSizes()
+	require.Equal(t, 0, dCacheSize)
+	require.Equal(t, 0, uaCacheSize)
+	device, err = client.LookupUserAgent(context.Background(), "ua")
+	require.Nil(t, err)
+	require.Nil(t, device.RawBody)
+}
+
+func TestLookupOptions(t *testing.T) {
+	var received []map[string]string
+	var mutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+		mutex.Lock()
+		received = append(received, request.LookupHeaders)
+		mutex.Unlock()
+		if request.LookupHeaders[userAgentHeader] == "slow" {
+			time.Sleep(500 * time.Millisecond)
+		}
+		json.NewEncoder(w).Encode(JSONDeviceData{Capabilities: map[string]string{"wurfl_id": "generic"}})
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.ImportantHeaders = []string{userAgentHeader, "Sec-CH-UA-Model"}
+	client.SetCacheSize(100)
+
+	// extra headers are sent with the lookup headers, only if important and not already present
+	_, err := client.LookupUserAgent(context.Background(), "ua", WithNoCache(),
+		WithExtraHeaders(map[string]string{"sec-ch-ua-model": "Pixel", "user-agent": "other", "X-Unknown": "x"}))
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{userAgentHeader: "ua", "Sec-CH-UA-Model": "Pixel"}, received[0])
+	_, err = client.LookupDeviceID(context.Background(), "generic", WithNoCache())
+	require.Nil(t, err)
+	dCacheSize, uaCacheSize := client.GetActualCacheSizes()
+	require.Equal(t, 0, dCacheSize)
+	require.Equal(t, 0, uaCacheSize)
+
+	_, err = client.LookupHeaders(context.Background(), map[string]string{userAgentHeader: "ua"})
+	require.Nil(t, err)
+	_, uaCacheSize = client.GetActualCacheSizes()
+	require.Equal(t, 1, uaCacheSize)
+
+	// the timeout applies to the single lookup
+	start := time.Now()
+	_, err = client.LookupUserAgent(context.Background(), "slow", WithTimeout(50*time.Millisecond))
+	require.NotNil(t, err)
+	require.True(t, time.Since(start) < 400*time.Millisecond)
+}
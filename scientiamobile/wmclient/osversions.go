@@ -0,0 +1,172 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CompareVersions compares two OS versions, such as device_os_version values, returning -1, 0 or 1 if a is lower, equal
+// or greater than b. Versions are compared component by component, components being separated by dots: the leading
+// numbers of the components are compared as numbers ("10" > "9"), missing components are equal to 0 ("10" == "10.0"),
+// and a component with a suffix is lower than the same number without it ("1.0beta" < "1.0"), as in semantic versioning.
+// Components without a leading number, such as "XP", are greater than numeric ones and compared case insensitively
+func CompareVersions(a string, b string) int {
+	aParts := strings.Split(strings.TrimSpace(a), ".")
+	bParts := strings.Split(strings.TrimSpace(b), ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		aPart, bPart := "0", "0"
+		if i < len(aParts) {
+			aPart = aParts[i]
+		}
+		if i < len(bParts) {
+			bPart = bParts[i]
+		}
+		if result := compareVersionComponents(aPart, bPart); result != 0 {
+			return result
+		}
+	}
+	return 0
+}
+
+// compareVersionComponents compares two version components as documented in CompareVersions
+func compareVersionComponents(a string, b string) int {
+	aNumber, aSuffix, aNumeric := splitVersionComponent(a)
+	bNumber, bSuffix, bNumeric := splitVersionComponent(b)
+	switch {
+	case aNumeric && !bNumeric:
+		return -1
+	case !aNumeric && bNumeric:
+		return 1
+	case aNumber != bNumber:
+		if aNumber < bNumber {
+			return -1
+		}
+		return 1
+	case aSuffix == bSuffix:
+		return 0
+	case aSuffix == "":
+		return 1
+	case bSuffix == "":
+		return -1
+	}
+	return strings.Compare(aSuffix, bSuffix)
+}
+
+// splitVersionComponent returns the leading number of a version component and its lowercase suffix. The bool result is
+// false if the component does not start with a number
+func splitVersionComponent(component string) (uint64, string, bool) {
+	component = strings.ToLower(strings.TrimSpace(component))
+	digits := 0
+	for digits < len(component) && component[digits] >= '0' && component[digits] <= '9' {
+		digits++
+	}
+	if digits == 0 {
+		return 0, component, component == ""
+	}
+	number, err := strconv.ParseUint(component[:digits], 10, 64)
+	if err != nil {
+		// numbers too large for uint64 are not versions
+		return 0, component, false
+	}
+	return number, component[digits:], true
+}
+
+// GetAllVersionsForOSSorted works like GetAllVersionsForOSContext, returning the versions without duplicates and sorted
+// from the lowest to the highest, as compared by CompareVersions
+func (c *WmClient) GetAllVersionsForOSSorted(ctx context.Context, osName string) ([]string, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	versions, err := c.GetAllVersionsForOSContext(ctx, osName)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]string, 0, len(versions))
+	seen := make(map[string]bool, len(versions))
+	for _, version := range versions {
+		if !seen[version] {
+			seen[version] = true
+			sorted = append(sorted, version)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return CompareVersions(sorted[i], sorted[j]) < 0
+	})
+	return sorted, nil
+}
+
+// GetOSVersionsInRange returns the versions of the given OS between min and max, both included, sorted as
+// GetAllVersionsForOSSorted does, ie: to build the list of versions targeted by a "from Android 10 to 13" rule. Versions are
+// compared by CompareVersions, so a max of "13" does not include "13.1". An empty min or max leaves the range unbounded on
+// that side
+func (c *WmClient) GetOSVersionsInRange(ctx context.Context, osName string, min string, max string) ([]string, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	versions, err := c.GetAllVersionsForOSSorted(ctx, osName)
+	if err != nil {
+		return nil, err
+	}
+
+	inRange := make([]string, 0)
+	for _, version := range versions {
+		if min != "" && CompareVersions(version, min) < 0 {
+			continue
+		}
+		if max != "" && CompareVersions(version, max) > 0 {
+			break
+		}
+		inRange = append(inRange, version)
+	}
+	return inRange, nil
+}
+
+// GetOSVersionsAtLeast returns the versions of the given OS greater than or equal to min, sorted as
+// GetAllVersionsForOSSorted does, ie: GetOSVersionsAtLeast(ctx, "Android", "10") returns "10", "10.0.1", "11" and so on.
+// Versions are compared by CompareVersions, so "10.0beta" is lower than "10"
+func (c *WmClient) GetOSVersionsAtLeast(ctx context.Context, osName string, min string) ([]string, error) {
+	return c.GetOSVersionsInRange(ctx, osName, min, "")
+}
+
+// GetOSVersionsMatching returns the versions of the given OS satisfying the given constraint, sorted as
+// GetAllVersionsForOSSorted does. The constraint is parsed by ParseVersionConstraint, ie: ">=10 <13 !=11" returns the
+// versions from 10 included to 13 excluded, except 11
+func (c *WmClient) GetOSVersionsMatching(ctx context.Context, osName string, constraint string) ([]string, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	parsed, err := ParseVersionConstraint(constraint)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := c.GetAllVersionsForOSSorted(ctx, osName)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := make([]string, 0)
+	for _, version := range versions {
+		if parsed.Allows(version) {
+			matching = append(matching, version)
+		}
+	}
+	return matching, nil
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"10", "9", 1},
+		{"4.4", "4.10", -1},
+		{"10", "10.0", 0},
+		{"10.0.1", "10", 1},
+		{"1.0beta", "1.0", -1},
+		{"1.0beta", "1.0rc", -1},
+		{"XP", "10", 1},
+		{"Vista", "xp", -1},
+		{" 7.1 ", "7.1", 0},
+		{"", "0", 0},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.expected, CompareVersions(test.a, test.b), "%s vs %s", test.a, test.b)
+		require.Equal(t, -test.expected, CompareVersions(test.b, test.a), "%s vs %s", test.b, test.a)
+	}
+}
+
+func TestGetOSVersionsInRange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		versions := make([]JSONDeviceOsVersions, 0)
+		for _, version := range []string{"9", "10", "4.4", "13", "12.1", "", "4.4.2", "10", "13.1", "2.3.6"} {
+			versions = append(versions, JSONDeviceOsVersions{OsName: "Android", OsVersion: version})
+		}
+		json.NewEncoder(w).Encode(versions)
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	versions, err := client.GetAllVersionsForOSSorted(context.Background(), "Android")
+	require.Nil(t, err)
+	require.Equal(t, []string{"2.3.6", "4.4", "4.4.2", "9", "10", "12.1", "13", "13.1"}, versions)
+
+	versions, err = client.GetOSVersionsInRange(context.Background(), "Android", "4.4.1", "13")
+	require.Nil(t, err)
+	require.Equal(t, []string{"4.4.2", "9", "10", "12.1", "13"}, versions)
+	versions, err = client.GetOSVersionsInRange(context.Background(), "Android", "12", "")
+	require.Nil(t, err)
+	require.Equal(t, []string{"12.1", "13", "13.1"}, versions)
+	versions, err = client.GetOSVersionsInRange(context.Background(), "Android", "", "4.4")
+	require.Nil(t, err)
+	require.Equal(t, []string{"2.3.6", "4.4"}, versions)
+
+	_, err = client.GetOSVersionsInRange(context.Background(), "Tizen", "", "")
+	require.NotNil(t, err)
+
+	versions, err = client.GetOSVersionsAtLeast(context.Background(), "Android", "10")
+	require.Nil(t, err)
+	require.Equal(t, []string{"10", "12.1", "13", "13.1"}, versions)
+
+	versions, err = client.GetOSVersionsMatching(context.Background(), "Android", ">=4.4 <13 !=9")
+	require.Nil(t, err)
+	require.Equal(t, []string{"4.4", "4.4.2", "10", "12.1"}, versions)
+	versions, err = client.GetOSVersionsMatching(context.Background(), "Android", ">14")
+	require.Nil(t, err)
+	require.Empty(t, versions)
+	_, err = client.GetOSVersionsMatching(context.Background(), "Android", ">=")
+	require.NotNil(t, err)
+	_, err = client.GetOSVersionsMatching(context.Background(), "Tizen", ">=1")
+	require.NotNil(t, err)
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+// legacyRequest is the encoding of Request sent to WM servers that reject lookup payloads without the empty fields: until
+// the omitempty options of Request were fixed, every lookup included them, with empty strings and null arrays
+type legacyRequest struct {
+	LookupHeaders  map[string]string `json:"lookup_headers"`
+	RequestedCaps  []string          `json:"requested_caps"`
+	RequestedVCaps []string          `json:"requested_vcaps"`
+	WurflID        string            `json:"wurfl_id"`
+	TacCode        string            `json:"tac_code"`
+}
+
+// legacyBatchRequest is the encoding of BatchRequest matching legacyRequest
+type legacyBatchRequest struct {
+	Requests []legacyRequest `json:"requests"`
+}
+
+// lookupPayload returns the value encoded as the payload of the given lookup request
+func lookupPayload(request Request, legacy bool) interface{} {
+	if legacy {
+		return legacyRequest(request)
+	}
+	return request
+}
+
+// postLookup sends a lookup to the given WM server path, with the JSON encoding of the payload returned by the given
+// function. Payloads omit empty fields, unless WM server has replied to one of them with 400 Bad Request: in that case the
+// lookup is sent again with the legacy payload (legacy is true), which is used for all the following lookups
+func (c *WmClient) postLookup(ctx context.Context, path string, payload func(legacy bool) interface{}) (*http.Response, []byte, error) {
+	legacy := atomic.LoadInt32(&c.legacyPayloadFallback) == 1
+	for {
+		reqbody, err := json.Marshal(payload(legacy))
+		if err != nil {
+			return nil, nil, err
+		}
+		res, resbody, err := c.doRequest(ctx, "POST", path, reqbody)
+		if err != nil || legacy || res.StatusCode != http.StatusBadRequest {
+			return res, resbody, err
+		}
+		atomic.StoreInt32(&c.legacyPayloadFallback, 1)
+		legacy = true
+	}
+}
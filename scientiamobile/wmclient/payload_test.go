@@ -0,0 +1,115 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// payloadBenchmarkUserAgent is a typical user agent, as sent by most lookups
+const payloadBenchmarkUserAgent = "Mozilla/5.0 (Linux; Android 13; SM-G991B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/110.0.0.0 Mobile Safari/537.36"
+
+// payloadBenchmarkRequests are the lookups measured by BenchmarkLookupPayload
+var payloadBenchmarkRequests = []struct {
+	name    string
+	request Request
+}{
+	{"useragent", Request{LookupHeaders: map[string]string{userAgentHeader: payloadBenchmarkUserAgent}}},
+	{"useragent-caps", Request{LookupHeaders: map[string]string{userAgentHeader: payloadBenchmarkUserAgent},
+		RequestedCaps: []string{"brand_name", "model_name"}, RequestedVCaps: []string{"is_smartphone", "form_factor"}}},
+	{"deviceid", Request{WurflID: "samsung_sm_g991b_ver1"}},
+}
+
+func TestLookupPayload(t *testing.T) {
+	compact, err := json.Marshal(lookupPayload(Request{WurflID: "generic"}, false))
+	require.Nil(t, err)
+	require.Equal(t, `{"wurfl_id":"generic"}`, string(compact))
+
+	legacy, err := json.Marshal(lookupPayload(Request{WurflID: "generic"}, true))
+	require.Nil(t, err)
+	require.Equal(t, `{"lookup_headers":null,"requested_caps":null,"requested_vcaps":null,"wurfl_id":"generic","tac_code":""}`, string(legacy))
+
+	request := Request{LookupHeaders: map[string]string{userAgentHeader: "ua"}, RequestedCaps: []string{"brand_name"}}
+	compact, err = json.Marshal(lookupPayload(request, false))
+	require.Nil(t, err)
+	require.Equal(t, `{"lookup_headers":{"User-Agent":"ua"},"requested_caps":["brand_name"]}`, string(compact))
+}
+
+func TestLegacyPayloadFallback(t *testing.T) {
+	var mutex sync.Mutex
+	bodies := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mutex.Lock()
+		bodies = append(bodies, string(body))
+		mutex.Unlock()
+		// an old server that requires all the fields
+		if !strings.Contains(string(body), `"tac_code"`) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"missing tac_code"}`))
+			return
+		}
+		w.Write([]byte(`{"capabilities":{"wurfl_id":"generic"}}`))
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.ImportantHeaders = []string{userAgentHeader}
+
+	device, err := client.LookupUserAgentUncached(context.Background(), "ua")
+	require.Nil(t, err)
+	require.Equal(t, "generic", device.DeviceID)
+	_, err = client.LookupUserAgentUncached(context.Background(), "ua")
+	require.Nil(t, err)
+
+	// the first lookup is sent again with the legacy payload, which is used by the following ones
+	require.Equal(t, []string{
+		`{"lookup_headers":{"User-Agent":"ua"}}`,
+		`{"lookup_headers":{"User-Agent":"ua"},"requested_caps":null,"requested_vcaps":null,"wurfl_id":"","tac_code":""}`,
+		`{"lookup_headers":{"User-Agent":"ua"},"requested_caps":null,"requested_vcaps":null,"wurfl_id":"","tac_code":""}`,
+	}, bodies)
+}
+
+// BenchmarkLookupPayload reports the size of the compact and legacy payloads of typical lookups, as payload-B/op
+func BenchmarkLookupPayload(b *testing.B) {
+	for _, test := range payloadBenchmarkRequests {
+		for _, legacy := range []bool{false, true} {
+			name := test.name + "/payload=compact"
+			if legacy {
+				name = test.name + "/payload=legacy"
+			}
+			b.Run(name, func(b *testing.B) {
+				size := 0
+				for i := 0; i < b.N; i++ {
+					body, err := json.Marshal(lookupPayload(test.request, legacy))
+					if err != nil {
+						b.Fatal(err)
+					}
+					size = len(body)
+				}
+				b.ReportMetric(float64(size), "payload-B/op")
+			})
+		}
+	}
+}
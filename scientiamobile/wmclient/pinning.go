@@ -0,0 +1,134 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// PeerCertificateVerifier has the signature of tls.Config.VerifyPeerCertificate
+type PeerCertificateVerifier func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error
+
+// PublicKeyPin returns the pin of the given certificate: the base64 encoded SHA-256 hash of its SubjectPublicKeyInfo, the
+// same value printed by openssl x509 -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64
+func PublicKeyPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// PublicKeyPinVerifier returns a verifier that accepts a WM server certificate chain only if it holds one of the given pins,
+// in the format returned by PublicKeyPin, optionally prefixed by "sha256//" as in curl --pinnedpubkey. The verifier checks
+// the chains verified by crypto/tls or, if certificate verification is disabled, the server certificate only.
+// It can be set as VerifyPeerCertificate in the TLS configuration of a custom transport, ie: the HTTP/3 one
+func PublicKeyPinVerifier(pins []string) (PeerCertificateVerifier, error) {
+	if len(pins) == 0 {
+		return nil, errors.New("no public key pins given")
+	}
+	pinned := make(map[string]bool, len(pins))
+	for _, pin := range pins {
+		pin = strings.TrimPrefix(strings.TrimPrefix(pin, "sha256//"), "sha256/")
+		hash, err := base64.StdEncoding.DecodeString(pin)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("invalid public key pin %q: it must be a base64 encoded SHA-256 hash", pin)
+		}
+		pinned[pin] = true
+	}
+
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		chains := verifiedChains
+		if len(chains) == 0 && len(rawCerts) > 0 {
+			// certificates that have not been verified could be added by anyone: only the server one is checked
+			cert, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return err
+			}
+			chains = [][]*x509.Certificate{{cert}}
+		}
+
+		var seen []string
+		for _, chain := range chains {
+			for _, cert := range chain {
+				pin := PublicKeyPin(cert)
+				if pinned[pin] {
+					return nil
+				}
+				seen = append(seen, pin)
+			}
+		}
+		return fmt.Errorf("%w: WM server sent %s, the connection may be intercepted by a proxy", ErrPublicKeyPinMismatch,
+			strings.Join(seen, ", "))
+	}, nil
+}
+
+// SetPinnedPublicKeys makes the client connect only to a WM server whose certificate chain holds one of the given public
+// key pins (see PublicKeyPinVerifier for their format), in addition to the usual certificate verification. Give more than
+// one pin to rotate keys without downtime: the current key and the next one, or the key of a backup CA. Connections to a
+// server with none of the pins fail with an error matching ErrPublicKeyPinMismatch. A nil or empty list disables pinning.
+// Pinning requires the https scheme and applies to the default transport only: a custom transport must set its own
+// verifier. This function should be called before performing any lookup
+func (c *WmClient) SetPinnedPublicKeys(pins []string) error {
+	if c == nil {
+		return ErrNilClient
+	}
+	if len(pins) == 0 {
+		c.pinVerifier = nil
+		c.applyPinning()
+		return nil
+	}
+	if c.scheme != "https" {
+		return errors.New("public key pinning requires the https scheme")
+	}
+	if c.transport != nil {
+		return errors.New("public key pinning is not applied to custom transports, use PublicKeyPinVerifier in their TLS configuration")
+	}
+
+	verifier, err := PublicKeyPinVerifier(pins)
+	if err != nil {
+		return err
+	}
+	c.pinVerifier = verifier
+	c.applyPinning()
+
+	// connections opened before pinning have not been checked
+	c.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// applyPinning sets the pin verifier of the client in the TLS configuration of the default transport
+func (c *WmClient) applyPinning() {
+	if c.httpClient == nil {
+		// not created with Create: the setting is applied by SetHTTPTimeout
+		return
+	}
+	transport, ok := c.httpClient.Transport.(*http.Transport)
+	if !ok {
+		return
+	}
+	if transport.TLSClientConfig == nil {
+		if c.pinVerifier == nil {
+			return
+		}
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.VerifyPeerCertificate = c.pinVerifier
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetPinnedPublicKeys(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"wm_version":"2.1.0","wurfl_api_version":"1.12","wurfl_info":"wurfl.zip","static_caps":["brand_name"]}`))
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	client.httpClient.Transport.(*http.Transport).TLSClientConfig = &tls.Config{RootCAs: roots}
+
+	otherHash := sha256.Sum256([]byte("other key"))
+	otherPin := base64.StdEncoding.EncodeToString(otherHash[:])
+	serverPin := PublicKeyPin(server.Certificate())
+
+	// the server key is one of the pins, ie: during a key rotation
+	require.Nil(t, client.SetPinnedPublicKeys([]string{otherPin, "sha256//" + serverPin}))
+	_, err := client.GetInfoContext(context.Background())
+	require.Nil(t, err)
+
+	require.Nil(t, client.SetPinnedPublicKeys([]string{otherPin}))
+	_, err = client.GetInfoContext(context.Background())
+	require.True(t, errors.Is(err, ErrPublicKeyPinMismatch))
+	require.Contains(t, err.Error(), serverPin)
+
+	// pinning is kept when the http client is created again
+	client.SetHTTPTimeout(5, 5)
+	client.httpClient.Transport.(*http.Transport).TLSClientConfig.RootCAs = roots
+	_, err = client.GetInfoContext(context.Background())
+	require.True(t, errors.Is(err, ErrPublicKeyPinMismatch))
+
+	require.Nil(t, client.SetPinnedPublicKeys(nil))
+	_, err = client.GetInfoContext(context.Background())
+	require.Nil(t, err)
+
+	require.NotNil(t, client.SetPinnedPublicKeys([]string{"not a pin"}))
+	require.NotNil(t, client.SetPinnedPublicKeys([]string{base64.StdEncoding.EncodeToString([]byte("short"))}))
+	client.scheme = "http"
+	require.NotNil(t, client.SetPinnedPublicKeys([]string{serverPin}))
+}
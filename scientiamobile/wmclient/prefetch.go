@@ -0,0 +1,157 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"time"
+)
+
+// Enumeration identifies a set of data that the client loads from WM server and keeps in memory. Values can be combined with |
+type Enumeration int
+
+const (
+	// EnumInfo is the server information returned by GetInfo
+	EnumInfo Enumeration = 1 << iota
+	// EnumMakes is the device makes and models data used by GetAllDeviceMakes and GetAllDevicesForMake
+	EnumMakes
+	// EnumOSes is the device OS and versions data used by GetAllOSes and GetAllVersionsForOS
+	EnumOSes
+)
+
+// PrefetchPolicy controls how enumeration data is loaded by Prefetch
+type PrefetchPolicy struct {
+	Retries     int           // number of retries of each failed load
+	MinInterval time.Duration // minimum time between two requests to WM server, to avoid flooding it when it is under stress
+}
+
+// prefetchState tracks a prefetch running in background
+type prefetchState struct {
+	done chan struct{} // closed when prefetch ends
+	err  error         // prefetch result, readable after done is closed
+}
+
+// Prefetch loads the given enumeration data from WM server, retrying failed loads as configured by the policy, so that
+// services that will certainly need it do not pay the load time on the first user request
+func (c *WmClient) Prefetch(ctx context.Context, targets Enumeration, policy PrefetchPolicy) error {
+	if c == nil {
+		return ErrNilClient
+	}
+	loaders := []struct {
+		target Enumeration
+		load   func(ctx context.Context) error
+	}{
+		{EnumInfo, func(ctx context.Context) error { _, err := c.GetInfoContext(ctx); return err }},
+		{EnumMakes, c.loadDeviceMakesData},
+		{EnumOSes, c.loadDeviceOsesData},
+	}
+
+	var lastRequest time.Time
+	for _, loader := range loaders {
+		if targets&loader.target == 0 {
+			continue
+		}
+
+		var err error
+		for attempt := 0; attempt <= policy.Retries; attempt++ {
+			// rate limiting: wait until MinInterval has elapsed since the previous request
+			if wait := policy.MinInterval - time.Since(lastRequest); !lastRequest.IsZero() && wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				case <-timer.C:
+				}
+			}
+
+			lastRequest = time.Now()
+			if err = loader.load(ctx); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PrefetchAsync runs Prefetch in background. Ready and WaitReady can be used to gate the service readiness on its completion.
+// A running prefetch is stopped by Close and DestroyConnection
+func (c *WmClient) PrefetchAsync(targets Enumeration, policy PrefetchPolicy) {
+	if c == nil {
+		return
+	}
+	state := &prefetchState{done: make(chan struct{})}
+
+	c.prefetchMutex.Lock()
+	c.prefetch = state
+	c.prefetchMutex.Unlock()
+
+	// the prefetch error is reported by Ready and WaitReady, not by Close
+	_, err := c.getTasks().goTask(func(ctx context.Context) error {
+		state.err = c.Prefetch(ctx, targets, policy)
+		close(state.done)
+		return nil
+	})
+	if err != nil {
+		state.err = err
+		close(state.done)
+	}
+}
+
+// Ready returns true if no background prefetch has been started, or if it has completed successfully
+func (c *WmClient) Ready() bool {
+	if c == nil {
+		return false
+	}
+	state := c.getPrefetchState()
+	if state == nil {
+		return true
+	}
+
+	select {
+	case <-state.done:
+		return state.err == nil
+	default:
+		return false
+	}
+}
+
+// WaitReady waits for the background prefetch, if any, to complete and returns its error
+func (c *WmClient) WaitReady(ctx context.Context) error {
+	if c == nil {
+		return ErrNilClient
+	}
+	state := c.getPrefetchState()
+	if state == nil {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-state.done:
+		return state.err
+	}
+}
+
+func (c *WmClient) getPrefetchState() *prefetchState {
+	c.prefetchMutex.Lock()
+	defer c.prefetchMutex.Unlock()
+	return c.prefetch
+}
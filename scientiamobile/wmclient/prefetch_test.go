@@ -0,0 +1,76 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefetch(t *testing.T) {
+	client := createTestClient(t)
+
+	requests := 0
+	client.SetRequestDecorator(func(r *http.Request) error {
+		requests++
+		return nil
+	})
+
+	require.True(t, client.Ready())
+	client.PrefetchAsync(EnumMakes|EnumOSes, PrefetchPolicy{Retries: 2, MinInterval: 10 * time.Millisecond})
+	require.Nil(t, client.WaitReady(context.Background()))
+	require.True(t, client.Ready())
+	require.Equal(t, 2, requests)
+
+	// data is already loaded, no more requests are sent
+	_, err := client.GetAllDeviceMakes()
+	require.Nil(t, err)
+	_, err = client.GetAllOSes()
+	require.Nil(t, err)
+	require.Equal(t, 2, requests)
+	client.DestroyConnection()
+}
+
+func TestPrefetchWithServerDown(t *testing.T) {
+	client := &WmClient{scheme: "http", host: "localhost", port: "18080", httpClient: createHTTPClient(defaultConnTimeout, defaultTransferTimeout)}
+
+	attempts := 0
+	client.SetRequestDecorator(func(r *http.Request) error {
+		attempts++
+		return nil
+	})
+
+	start := time.Now()
+	err := client.Prefetch(context.Background(), EnumInfo, PrefetchPolicy{Retries: 2, MinInterval: 20 * time.Millisecond})
+	require.NotNil(t, err)
+	require.Equal(t, 3, attempts)
+	// requests are rate limited
+	require.True(t, time.Since(start) >= 40*time.Millisecond)
+
+	client.PrefetchAsync(EnumInfo, PrefetchPolicy{})
+	require.NotNil(t, client.WaitReady(context.Background()))
+	require.False(t, client.Ready())
+
+	// a cancelled context stops the retries
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = client.Prefetch(ctx, EnumInfo, PrefetchPolicy{Retries: 5, MinInterval: time.Second})
+	require.Equal(t, context.Canceled, err)
+}
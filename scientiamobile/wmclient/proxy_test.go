@@ -0,0 +1,122 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newHTTPProxy returns a forward HTTP proxy counting the requests it has served
+func newHTTPProxy(proxied *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "Basic d206c2VjcmV0" { // wm:secret
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		atomic.AddInt32(proxied, 1)
+		request, err := http.NewRequest(r.Method, r.URL.String(), r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		request.Header = r.Header.Clone()
+		request.Header.Del("Proxy-Authorization")
+		res, err := http.DefaultTransport.RoundTrip(request)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+	}))
+}
+
+func TestProxyOptions(t *testing.T) {
+	var lookups, proxied int32
+	server := httptest.NewServer(newOptionsTestHandler("", &lookups))
+	defer server.Close()
+	proxy := newHTTPProxy(&proxied)
+	defer proxy.Close()
+	proxyURL := "http://wm:secret@" + proxy.Listener.Addr().String()
+
+	client, err := CreateFromURL(server.URL, WithProxyURL(proxyURL))
+	require.Nil(t, err)
+	defer client.Close()
+	_, err = client.LookupUserAgent(context.Background(), "ua")
+	require.Nil(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&proxied))
+
+	// the proxy is kept when the http client is created again
+	client.SetHTTPTimeout(5, 5)
+	_, err = client.LookupUserAgent(context.Background(), "ua")
+	require.Nil(t, err)
+	require.Equal(t, int32(3), atomic.LoadInt32(&proxied))
+
+	require.Nil(t, client.SetProxy(""))
+	_, err = client.LookupUserAgent(context.Background(), "ua")
+	require.Nil(t, err)
+	require.Equal(t, int32(3), atomic.LoadInt32(&proxied))
+
+	require.Nil(t, client.SetProxy("http://wm:wrong@"+proxy.Listener.Addr().String()))
+	_, err = client.LookupUserAgent(context.Background(), "ua")
+	require.NotNil(t, err)
+
+	for _, rawURL := range []string{"proxy.internal:3128", "ftp://proxy.internal", "http://", "http://proxy internal"} {
+		require.NotNil(t, client.SetProxy(rawURL), rawURL)
+		_, err = CreateFromURL(server.URL, WithProxyURL(rawURL))
+		require.NotNil(t, err, rawURL)
+	}
+	_, err = CreateFromURL(server.URL, WithProxyURL(proxyURL), WithHTTPClient(&http.Client{}))
+	require.EqualError(t, err, "proxy options cannot be used with WithHTTPClient")
+}
+
+func TestProxyFromEnvironment(t *testing.T) {
+	client := &WmClient{httpClient: createHTTPClient(defaultConnTimeout, defaultTransferTimeout)}
+	transport := client.httpClient.Transport.(*http.Transport)
+	require.Nil(t, transport.Proxy)
+
+	require.Nil(t, client.SetProxyFromEnvironment(true))
+	require.NotNil(t, transport.Proxy)
+	// requests to localhost are never proxied
+	request, err := http.NewRequest("GET", "http://localhost:8080/v2/getinfo/json", nil)
+	require.Nil(t, err)
+	proxy, err := transport.Proxy(request)
+	require.Nil(t, err)
+	require.Nil(t, proxy)
+
+	// an explicit proxy takes precedence
+	require.Nil(t, client.SetProxy("http://proxy.internal:3128"))
+	proxy, err = transport.Proxy(request)
+	require.Nil(t, err)
+	require.Equal(t, "proxy.internal:3128", proxy.Host)
+	require.Nil(t, client.SetProxy(""))
+	require.NotNil(t, transport.Proxy)
+
+	require.Nil(t, client.SetProxyFromEnvironment(false))
+	require.Nil(t, transport.Proxy)
+
+	client.transport = &http.Transport{}
+	require.NotNil(t, client.SetProxyFromEnvironment(true))
+	require.NotNil(t, client.SetProxy("http://proxy.internal:3128"))
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+)
+
+// queryDevicesPath is the WM server endpoint used by QueryDevices. Servers that do not support it reply with one of the
+// statuses in endpointUnsupported
+const queryDevicesPath = "/v2/querydevices/json"
+
+// makesDataCapabilities are the capabilities that QueryDevices can filter using the device makes data
+var makesDataCapabilities = map[string]bool{"brand_name": true, "model_name": true, "marketing_name": true}
+
+// QueryDevices returns the devices whose capabilities have all the given values, ie: {"brand_name": "Samsung",
+// "is_smarttv": "true"}. If WM server supports device queries any static or virtual capability can be used, and the
+// wurfl_id of the devices is returned. Otherwise the query is answered using the device makes data, loading it if needed:
+// only brand_name, model_name and marketing_name can be used, and an error is returned for the other capabilities
+func (c *WmClient) QueryDevices(ctx context.Context, filters map[string]string) ([]JSONQueriedDevice, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	if atomic.LoadInt32(&c.queryEndpointFallback) == 0 {
+		reqbody, err := json.Marshal(DeviceQuery{Filters: filters})
+		if err != nil {
+			return nil, err
+		}
+		res, resbody, err := c.doRequest(ctx, "POST", queryDevicesPath, reqbody)
+		if err != nil {
+			return nil, err
+		}
+		if !endpointUnsupported[res.StatusCode] {
+			devices := make([]JSONQueriedDevice, 0)
+			if err = c.decodeResponse(res, resbody, &devices); err != nil {
+				return nil, err
+			}
+			return devices, nil
+		}
+		atomic.StoreInt32(&c.queryEndpointFallback, 1)
+	}
+
+	for name := range filters {
+		if !makesDataCapabilities[name] {
+			return nil, fmt.Errorf("capability %s cannot be queried: WM server does not support device queries", name)
+		}
+	}
+	if err := c.loadDeviceMakesData(ctx); err != nil {
+		return nil, err
+	}
+
+	c.deviceMakesMutex.Lock()
+	defer c.deviceMakesMutex.Unlock()
+	devices := make([]JSONQueriedDevice, 0)
+	for _, brandName := range c.deviceMakes {
+		if value, ok := filters["brand_name"]; ok && value != brandName {
+			continue
+		}
+		for _, device := range c.deviceMakesMap[brandName] {
+			if value, ok := filters["model_name"]; ok && value != device.ModelName {
+				continue
+			}
+			if value, ok := filters["marketing_name"]; ok && value != device.MarketingName {
+				continue
+			}
+			devices = append(devices, JSONQueriedDevice{BrandName: brandName, ModelName: device.ModelName, MarketingName: device.MarketingName})
+		}
+	}
+	return devices, nil
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryDevices(t *testing.T) {
+	var query DeviceQuery
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&query)
+		json.NewEncoder(w).Encode([]JSONQueriedDevice{{WurflID: "samsung_smart_tv_ver1", BrandName: "Samsung", ModelName: "Smart TV"}})
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	filters := map[string]string{"brand_name": "Samsung", "is_smarttv": "true"}
+	devices, err := client.QueryDevices(context.Background(), filters)
+	require.Nil(t, err)
+	require.Equal(t, filters, query.Filters)
+	require.Equal(t, []JSONQueriedDevice{{WurflID: "samsung_smart_tv_ver1", BrandName: "Samsung", ModelName: "Smart TV"}}, devices)
+}
+
+func TestQueryDevicesFallsBackToMakesData(t *testing.T) {
+	requests := make(map[string]int)
+	server := httptest.NewServer(newMakesTestHandler(false, requests))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	devices, err := client.QueryDevices(context.Background(), map[string]string{"brand_name": "Apple"})
+	require.Nil(t, err)
+	require.Equal(t, []JSONQueriedDevice{{BrandName: "Apple", ModelName: "iPhone"}}, devices)
+
+	devices, err = client.QueryDevices(context.Background(), map[string]string{"model_name": "3310"})
+	require.Nil(t, err)
+	require.Equal(t, []JSONQueriedDevice{{BrandName: "Nokia", ModelName: "3310"}}, devices)
+
+	devices, err = client.QueryDevices(context.Background(), map[string]string{"brand_name": "Apple", "model_name": "3310"})
+	require.Nil(t, err)
+	require.Empty(t, devices)
+
+	_, err = client.QueryDevices(context.Background(), map[string]string{"is_smarttv": "true"})
+	require.NotNil(t, err)
+
+	// the query endpoint is requested only once, the makes data is loaded only once
+	require.Equal(t, 1, requests[queryDevicesPath])
+	require.Equal(t, 1, requests["/v2/alldevices/json"])
+}
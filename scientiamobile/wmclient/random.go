@@ -0,0 +1,77 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// randomSource is the single source of randomness of a client (or manager). Its zero value uses the math/rand global source
+type randomSource struct {
+	mutex  sync.Mutex // protects random, which is not safe for concurrent use
+	random *rand.Rand
+}
+
+func (r *randomSource) setSource(src rand.Source) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if src == nil {
+		r.random = nil
+		return
+	}
+	r.random = rand.New(src)
+}
+
+// float64 returns a pseudo-random number in [0.0,1.0)
+func (r *randomSource) float64() float64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.random == nil {
+		return rand.Float64()
+	}
+	return r.random.Float64()
+}
+
+// intn returns a pseudo-random number in [0,n)
+func (r *randomSource) intn(n int) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.random == nil {
+		return rand.Intn(n)
+	}
+	return r.random.Intn(n)
+}
+
+// SetRandSource sets the source of randomness used by every randomized behavior of the client (ie: cache TTL jitter).
+// Passing a source created with a fixed seed, ie rand.NewSource(42), makes those behaviors reproducible in tests.
+// A nil source restores the default one (the math/rand package global source).
+// This function should be called before performing any lookup
+func (c *WmClient) SetRandSource(src rand.Source) {
+	if c == nil {
+		return
+	}
+	c.rnd.setSource(src)
+}
+
+// SetRandSource sets the source of randomness used by the manager latency-aware routing exploration.
+// A nil source restores the default one (the math/rand package global source)
+func (m *Manager) SetRandSource(src rand.Source) {
+	m.rnd.setSource(src)
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetRandSourceIsReproducible(t *testing.T) {
+	c1 := &WmClient{}
+	c2 := &WmClient{}
+	c1.SetRandSource(rand.NewSource(42))
+	c2.SetRandSource(rand.NewSource(42))
+
+	for i := 0; i < 10; i++ {
+		require.Equal(t, c1.rnd.float64(), c2.rnd.float64())
+		require.Equal(t, c1.rnd.intn(100), c2.rnd.intn(100))
+	}
+
+	// restoring the default source
+	c1.SetRandSource(nil)
+	require.Nil(t, c1.rnd.random)
+	v := c1.rnd.float64()
+	require.True(t, v >= 0 && v < 1)
+}
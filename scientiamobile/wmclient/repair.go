@@ -0,0 +1,78 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+// CapabilityRepairEvent is sent to the stats hook every time requested capabilities missing from a lookup response are added
+// by the client, which usually means that the WM server WURFL file does not match the one the client has been set up with
+type CapabilityRepairEvent struct {
+	DeviceID     string
+	Capabilities []string // capabilities added
+}
+
+// SetCapabilityRepair sets whether the requested capabilities missing from a lookup response are added to the returned
+// device with a zero value, instead of being absent from its Capabilities map, so that parsing them does not fail.
+// The zero value is "false" for boolean capabilities (ie: is_*, has_*, can_*), "0" for numeric ones (ie: *_width, *_size)
+// and "" for the others, unless zeroValues holds a value for the capability. Added capabilities are listed in the device
+// Metadata.Repaired field and reported to the stats hook with a CapabilityRepairEvent.
+// This function should be called before performing any lookup
+func (c *WmClient) SetCapabilityRepair(enabled bool, zeroValues map[string]string) {
+	if c == nil {
+		return
+	}
+	c.repairCaps = enabled
+	c.repairZeroValue = zeroValues
+}
+
+// repairCapabilities adds to the given device the capabilities of the given request that are missing
+func (c *WmClient) repairCapabilities(device *JSONDeviceData, request Request) {
+	var repaired []string
+	for _, names := range [][]string{request.RequestedCaps, request.RequestedVCaps} {
+		for _, name := range names {
+			if _, ok := device.Capabilities[name]; ok {
+				continue
+			}
+			if device.Capabilities == nil {
+				device.Capabilities = make(map[string]string)
+			}
+			device.Capabilities[name] = c.capabilityZeroValue(name)
+			repaired = append(repaired, name)
+		}
+	}
+	if len(repaired) == 0 {
+		return
+	}
+
+	if device.Metadata == nil {
+		device.Metadata = &ResponseMetadata{}
+	}
+	device.Metadata.Repaired = repaired
+	c.emitStats(CapabilityRepairEvent{DeviceID: device.DeviceID, Capabilities: repaired})
+}
+
+// capabilityZeroValue returns the value of the given capability when it is missing from a response
+func (c *WmClient) capabilityZeroValue(name string) string {
+	if value, ok := c.repairZeroValue[name]; ok {
+		return value
+	}
+	switch inferCapabilityType(name) {
+	case CapabilityBool:
+		return "false"
+	case CapabilityInt:
+		return "0"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapabilityRepair(t *testing.T) {
+	// the test server does not know resolution_width, is_smartphone and marketing_name
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"capabilities":{"wurfl_id":"generic","brand_name":"Generic"}}`))
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.StaticCaps = []string{"brand_name", "density_class", "marketing_name", "playback_oma_size_limit", "resolution_width"}
+	client.VirtualCaps = []string{"is_smartphone"}
+	client.SetRequestedCapabilities([]string{"brand_name", "resolution_width", "playback_oma_size_limit", "marketing_name", "density_class", "is_smartphone"})
+
+	device, err := client.LookupUserAgent(context.Background(), "ua")
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"wurfl_id": "generic", "brand_name": "Generic"}, device.Capabilities)
+	require.Nil(t, device.Metadata.Repaired)
+
+	var events []CapabilityRepairEvent
+	client.SetStatsHook(func(event interface{}) {
+		if repairEvent, ok := event.(CapabilityRepairEvent); ok {
+			events = append(events, repairEvent)
+		}
+	})
+	client.SetCapabilityRepair(true, map[string]string{"density_class": "1.0"})
+	device, err = client.LookupUserAgent(context.Background(), "ua")
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{
+		"wurfl_id":                "generic",
+		"brand_name":              "Generic",
+		"density_class":           "1.0",
+		"marketing_name":          "",
+		"playback_oma_size_limit": "0",
+		"resolution_width":        "0",
+		"is_smartphone":           "false",
+	}, device.Capabilities)
+	repaired := []string{"resolution_width", "playback_oma_size_limit", "marketing_name", "density_class", "is_smartphone"}
+	require.Equal(t, repaired, device.Metadata.Repaired)
+	require.Equal(t, []CapabilityRepairEvent{{DeviceID: "generic", Capabilities: repaired}}, events)
+}
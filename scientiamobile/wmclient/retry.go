@@ -0,0 +1,295 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultFirstShare is the share of the remaining time budget given to each attempt but the last, if not configured
+const defaultFirstShare = 0.6
+
+// defaultMaxRetryAfter is the longest Retry-After delay waited before a retry, if not configured
+const defaultMaxRetryAfter = 5 * time.Second
+
+// now returns the current time. It is a variable so that tests can replace the clock used to split time budgets
+var now = time.Now
+
+// RetryPolicy configures the retries of the requests to WM server that fail because the server cannot be reached, does not
+// reply in time or replies with a 429, 502, 503 or 504 status. When the failed response has a Retry-After header, the retry
+// is sent after the requested delay, unless it is longer than MaxRetryAfter or than the time left before the request
+// deadline: in that case the request is not retried and the returned ServerError holds the delay in its RetryAfter field.
+// When the request context has a deadline, the time left is split among the attempts, instead of letting the first attempt
+// consume all of it: each attempt but the last gets FirstShare of the time left when it starts, ie: with 100ms left and one
+// retry, the first attempt gets 60ms and the retry the remaining 40ms. Without a deadline, attempts are bound by the
+// transfer timeout only.
+// With Hedge set, an attempt that exceeds its share is not cancelled: the next attempt is sent alongside it and the first
+// successful reply is used, trading load on WM server for lower tail latency
+type RetryPolicy struct {
+	Retries    int           // attempts after the first one, at least 1
+	FirstShare float64       // share of the time left given to each attempt but the last, between 0 and 1 excluded, 0.6 if 0
+	MinBudget  time.Duration // attempts are given at least this time, if left, so that retries are not sent with no chance to succeed
+	Hedge      bool          // if true, slow attempts are hedged instead of cancelled
+	// MaxRetryAfter is the longest Retry-After delay waited before a retry, 5 seconds if 0
+	MaxRetryAfter time.Duration
+}
+
+// RetryEvent is sent to the stats hook every time a request to WM server is attempted again
+type RetryEvent struct {
+	Path    string
+	Attempt int           // 1 for the first retry
+	Hedged  bool          // true if the previous attempts are still in progress
+	Budget  time.Duration // time given to the attempt, 0 if the request has no deadline
+	Err     error         // error of the previous attempt, nil if hedged or if WM server replied
+	Status  int           // status of the previous attempt response, 0 if hedged or if WM server did not reply
+	Wait    time.Duration // delay waited before the attempt, as requested by the previous response Retry-After header
+}
+
+// SetRetryPolicy sets the policy used to retry the failed requests to WM server. A nil policy disables retries, which is the
+// default. This function should be called before performing any lookup
+func (c *WmClient) SetRetryPolicy(policy *RetryPolicy) error {
+	if c == nil {
+		return ErrNilClient
+	}
+	if policy == nil {
+		c.retryPolicy = nil
+		return nil
+	}
+	if policy.Retries < 1 {
+		return fmt.Errorf("invalid number of retries %d: it must be at least 1", policy.Retries)
+	}
+	if policy.FirstShare < 0 || policy.FirstShare >= 1 {
+		return fmt.Errorf("invalid first attempt share %.2f: it must be less than 1, or 0 for the default", policy.FirstShare)
+	}
+	if policy.MaxRetryAfter < 0 {
+		return fmt.Errorf("invalid maximum Retry-After delay %s: it must not be negative", policy.MaxRetryAfter)
+	}
+
+	retryPolicy := *policy
+	if retryPolicy.FirstShare == 0 {
+		retryPolicy.FirstShare = defaultFirstShare
+	}
+	if retryPolicy.MaxRetryAfter == 0 {
+		retryPolicy.MaxRetryAfter = defaultMaxRetryAfter
+	}
+	c.retryPolicy = &retryPolicy
+	return nil
+}
+
+// AttemptBudget returns the time given to the attempt with the given index, 0 for the first one, when the given time is left
+func (p *RetryPolicy) AttemptBudget(remaining time.Duration, attempt int) time.Duration {
+	if remaining <= 0 {
+		return 0
+	}
+	if attempt >= p.Retries {
+		return remaining
+	}
+	share := p.FirstShare
+	if share == 0 {
+		share = defaultFirstShare
+	}
+	budget := time.Duration(float64(remaining) * share)
+	if budget < p.MinBudget {
+		budget = p.MinBudget
+	}
+	if budget > remaining {
+		budget = remaining
+	}
+	return budget
+}
+
+// attemptResult is the outcome of an attempt
+type attemptResult struct {
+	res  *http.Response
+	body []byte
+	err  error
+}
+
+// sendWithRetries sends a request, retrying or hedging it as configured by the retry policy
+func (c *WmClient) sendWithRetries(ctx context.Context, method string, path string, reqbody []byte, accept string) (*http.Response, []byte, error) {
+	policy := c.retryPolicy
+	if policy == nil {
+		return c.sendRequest(ctx, method, path, reqbody, accept)
+	}
+
+	attempts := policy.Retries + 1
+	results := make(chan attemptResult, attempts)
+	var cancels []context.CancelFunc
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+
+	started, inFlight := 0, 0
+	var last attemptResult
+	// launch starts the next attempt, after waiting the given delay, returning a channel that fires when the attempt must be
+	// hedged, nil if never
+	launch := func(wait time.Duration) <-chan time.Time {
+		var budget time.Duration
+		attemptCtx, cancel := context.WithCancel(ctx)
+		var hedge <-chan time.Time
+		if deadline, ok := ctx.Deadline(); ok {
+			budget = policy.AttemptBudget(deadline.Sub(now()), started)
+			if policy.Hedge {
+				if started < policy.Retries {
+					hedge = time.After(budget)
+				}
+			} else {
+				cancel()
+				attemptCtx, cancel = context.WithTimeout(ctx, budget)
+			}
+		}
+		cancels = append(cancels, cancel)
+		if started > 0 {
+			event := RetryEvent{Path: path, Attempt: started, Hedged: inFlight > 0, Budget: budget, Err: last.err, Wait: wait}
+			if last.res != nil {
+				event.Status = last.res.StatusCode
+			}
+			c.emitStats(event)
+		}
+		started++
+		inFlight++
+		go func() {
+			res, body, err := c.sendRequest(attemptCtx, method, path, reqbody, accept)
+			results <- attemptResult{res: res, body: body, err: err}
+		}()
+		return hedge
+	}
+
+	hedge := launch(0)
+	for inFlight > 0 {
+		select {
+		case result := <-results:
+			inFlight--
+			if ctx.Err() != nil || !isRetryable(result) {
+				return result.res, result.body, result.err
+			}
+			last = result
+			if inFlight == 0 && started < attempts {
+				wait, ok := c.retryAfterWait(ctx, policy, result)
+				if !ok {
+					return result.res, result.body, result.err
+				}
+				hedge = launch(wait)
+			}
+		case <-hedge:
+			hedge = nil
+			if started < attempts {
+				last = attemptResult{}
+				hedge = launch(0)
+			}
+		}
+	}
+	return last.res, last.body, last.err
+}
+
+// retryAfterWait waits the delay requested by the Retry-After header of the given response, if any, returning the time
+// waited. It returns false, without waiting, if the delay is longer than the policy maximum or than the time left before
+// the context deadline, and if the context is done while waiting
+func (c *WmClient) retryAfterWait(ctx context.Context, policy *RetryPolicy, result attemptResult) (time.Duration, bool) {
+	if result.res == nil {
+		return 0, true
+	}
+	wait, ok := parseRetryAfter(result.res.Header)
+	if !ok || wait == 0 {
+		return 0, true
+	}
+	if wait > policy.MaxRetryAfter {
+		return 0, false
+	}
+	if deadline, ok := ctx.Deadline(); ok && wait >= deadline.Sub(now()) {
+		return 0, false
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return wait, true
+	case <-ctx.Done():
+		return 0, false
+	}
+}
+
+// parseRetryAfter returns the delay requested by the Retry-After header of the given response headers, which holds either
+// a number of seconds or an HTTP date. It returns false if the header is missing or invalid
+func parseRetryAfter(header http.Header) (time.Duration, bool) {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if wait := date.Sub(now()); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
+
+// isRetryable returns true if the request that had the given result may succeed if sent again
+func isRetryable(result attemptResult) bool {
+	if result.err != nil {
+		return isTransportError(result.err)
+	}
+	switch result.res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isTransportError returns true if the given error has been raised sending the request or reading the response, ie: a
+// refused connection or an attempt timeout. Errors raised before the request is sent, such as the request decorator and
+// concurrency limiter ones, cancelled attempts and failed certificate checks are not retried, since they would happen again
+func isTransportError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrPublicKeyPinMismatch) {
+		return false
+	}
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) {
+		return false
+	}
+
+	// the errors returned by http.Client.Do
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return true
+	}
+	// the errors reading the response body. The limiter returns the context deadline error, which is a net.Error too
+	var netErr net.Error
+	return errors.Is(err, io.ErrUnexpectedEOF) || (errors.As(err, &netErr) && !errors.Is(err, context.DeadlineExceeded))
+}
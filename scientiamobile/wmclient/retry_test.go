@@ -0,0 +1,271 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicyAttemptBudget(t *testing.T) {
+	policy := &RetryPolicy{Retries: 2}
+	require.Equal(t, 60*time.Millisecond, policy.AttemptBudget(100*time.Millisecond, 0))
+	require.Equal(t, 24*time.Millisecond, policy.AttemptBudget(40*time.Millisecond, 1))
+	require.Equal(t, 16*time.Millisecond, policy.AttemptBudget(16*time.Millisecond, 2))
+	require.Equal(t, time.Duration(0), policy.AttemptBudget(-time.Millisecond, 0))
+
+	policy = &RetryPolicy{Retries: 1, FirstShare: 0.5, MinBudget: 80 * time.Millisecond}
+	require.Equal(t, 80*time.Millisecond, policy.AttemptBudget(100*time.Millisecond, 0))
+	require.Equal(t, 50*time.Millisecond, policy.AttemptBudget(50*time.Millisecond, 0))
+	require.Equal(t, 100*time.Millisecond, policy.AttemptBudget(100*time.Millisecond, 1))
+
+	client := &WmClient{}
+	require.NotNil(t, client.SetRetryPolicy(&RetryPolicy{}))
+	require.NotNil(t, client.SetRetryPolicy(&RetryPolicy{Retries: 1, FirstShare: 1}))
+	require.Nil(t, client.SetRetryPolicy(&RetryPolicy{Retries: 1}))
+	require.Equal(t, defaultFirstShare, client.retryPolicy.FirstShare)
+}
+
+func TestRetryBudgetSplitWithFakeClock(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"capabilities":{"wurfl_id":"generic"}}`))
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	require.Nil(t, client.SetRetryPolicy(&RetryPolicy{Retries: 2}))
+	var events []RetryEvent
+	client.SetStatsHook(func(event interface{}) {
+		if retry, ok := event.(RetryEvent); ok {
+			events = append(events, retry)
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	// the fake clock has 100ms left at the first attempt, 40ms at the second and 16ms at the third
+	left := []time.Duration{100 * time.Millisecond, 40 * time.Millisecond, 16 * time.Millisecond}
+	now = func() time.Time {
+		current := deadline.Add(-left[0])
+		left = left[1:]
+		return current
+	}
+	defer func() { now = time.Now }()
+
+	device, err := client.LookupDeviceID(ctx, "generic")
+	require.Nil(t, err)
+	require.Equal(t, "generic", device.DeviceID)
+	require.Equal(t, int32(3), atomic.LoadInt32(&requests))
+	require.Len(t, events, 2)
+	require.Equal(t, RetryEvent{Path: lookupDeviceIDPath, Attempt: 1, Budget: 24 * time.Millisecond, Status: http.StatusServiceUnavailable},
+		events[0])
+	require.Equal(t, 16*time.Millisecond, events[1].Budget)
+	require.False(t, events[1].Hedged)
+}
+
+func TestRetryCancelsSlowAttempt(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the body is read so that the server notices when the client closes the connection
+		ioutil.ReadAll(r.Body)
+		if atomic.AddInt32(&requests, 1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte(`{"capabilities":{"wurfl_id":"generic"}}`))
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	require.Nil(t, client.SetRetryPolicy(&RetryPolicy{Retries: 1}))
+
+	// without retries the first attempt would consume the whole budget
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	device, err := client.LookupDeviceID(ctx, "generic")
+	require.Nil(t, err)
+	require.Equal(t, "generic", device.DeviceID)
+	require.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestRetryHedgesSlowAttempt(t *testing.T) {
+	var requests int32
+	var mutex sync.Mutex
+	var hedged []bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		if atomic.AddInt32(&requests, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(time.Second):
+			}
+			w.Write([]byte(`{"capabilities":{"wurfl_id":"first"}}`))
+			return
+		}
+		w.Write([]byte(`{"capabilities":{"wurfl_id":"second"}}`))
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	require.Nil(t, client.SetRetryPolicy(&RetryPolicy{Retries: 1, FirstShare: 0.1, Hedge: true}))
+	client.SetStatsHook(func(event interface{}) {
+		if retry, ok := event.(RetryEvent); ok {
+			mutex.Lock()
+			hedged = append(hedged, retry.Hedged)
+			mutex.Unlock()
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	start := time.Now()
+	device, err := client.LookupDeviceID(ctx, "generic")
+	require.Nil(t, err)
+	require.Equal(t, "second", device.DeviceID)
+	require.True(t, time.Since(start) < time.Second)
+	require.Equal(t, []bool{true}, hedged)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	current := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	tests := map[string]struct {
+		wait time.Duration
+		ok   bool
+	}{
+		"":                              {0, false},
+		"120":                           {2 * time.Minute, true},
+		" 0 ":                           {0, true},
+		"-1":                            {0, false},
+		"Mon, 01 Jan 2024 00:00:30 GMT": {30 * time.Second, true},
+		"Sun, 31 Dec 2023 23:59:00 GMT": {0, true},
+		"soon":                          {0, false},
+	}
+	for value, expected := range tests {
+		header := http.Header{}
+		if value != "" {
+			header.Set("Retry-After", value)
+		}
+		wait, ok := parseRetryAfter(header)
+		require.Equal(t, expected.ok, ok, value)
+		require.Equal(t, expected.wait, wait, value)
+	}
+}
+
+func TestRetryHonoursRetryAfter(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&requests, 1) {
+		case 1:
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.Header().Set("Retry-After", "10")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("<html>Service Unavailable</html>"))
+		default:
+			w.Write([]byte(`{"capabilities":{"wurfl_id":"generic"}}`))
+		}
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	require.Nil(t, client.SetRetryPolicy(&RetryPolicy{Retries: 2}))
+	client.SetErrorPolicy(ErrorPolicy{ClientErrorTTL: time.Hour})
+	var waits []time.Duration
+	client.SetStatsHook(func(event interface{}) {
+		if retry, ok := event.(RetryEvent); ok {
+			waits = append(waits, retry.Wait)
+		}
+	})
+
+	// the first retry waits the requested second, the second retry is not sent since the delay is over the maximum
+	start := time.Now()
+	_, err := client.LookupDeviceID(context.Background(), "generic")
+	require.True(t, time.Since(start) >= time.Second)
+	require.Equal(t, []time.Duration{time.Second}, waits)
+	require.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	serverError, ok := err.(*ServerError)
+	require.True(t, ok)
+	require.Equal(t, http.StatusServiceUnavailable, serverError.StatusCode)
+	require.Equal(t, 10*time.Second, serverError.RetryAfter)
+
+	// rate limiting errors are not cached
+	require.Equal(t, time.Duration(0), client.errorCacheTTL(&ServerError{StatusCode: http.StatusTooManyRequests}))
+	require.Equal(t, time.Hour, client.errorCacheTTL(&ServerError{StatusCode: http.StatusBadRequest}))
+}
+
+func TestRetryOnlyTransportErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"capabilities":{"wurfl_id":"generic"}}`))
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	require.Nil(t, client.SetRetryPolicy(&RetryPolicy{Retries: 2}))
+	var retries int32
+	client.SetStatsHook(func(event interface{}) {
+		if _, ok := event.(RetryEvent); ok {
+			atomic.AddInt32(&retries, 1)
+		}
+	})
+
+	// requests failing before being sent are not retried
+	var decorated int32
+	decoratorErr := errors.New("no credentials")
+	client.SetRequestDecorator(func(*http.Request) error {
+		atomic.AddInt32(&decorated, 1)
+		return decoratorErr
+	})
+	_, err := client.LookupUserAgent(context.Background(), "ua")
+	require.Equal(t, decoratorErr, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&decorated))
+	require.Equal(t, int32(0), atomic.LoadInt32(&retries))
+
+	client.SetRequestDecorator(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.LookupUserAgent(ctx, "ua")
+	require.NotNil(t, err)
+	require.Equal(t, int32(0), atomic.LoadInt32(&retries))
+
+	// connection errors are
+	server.Close()
+	_, err = client.LookupUserAgent(context.Background(), "ua")
+	require.NotNil(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&retries))
+
+	require.False(t, isTransportError(context.DeadlineExceeded))
+	require.False(t, isTransportError(&url.Error{Op: "Post", URL: "http://wm", Err: context.Canceled}))
+	require.False(t, isTransportError(&url.Error{Op: "Post", URL: "http://wm", Err: ErrPublicKeyPinMismatch}))
+	require.True(t, isTransportError(&url.Error{Op: "Post", URL: "http://wm", Err: context.DeadlineExceeded}))
+	require.True(t, isTransportError(io.ErrUnexpectedEOF))
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"strings"
+
+	"github.com/golang/groupcache/lru"
+)
+
+// CacheRewarmEvent is sent to the stats hook when the background re-population of the caches, after a WURFL file reload, ends
+type CacheRewarmEvent struct {
+	Ltime     string // WURFL file load time that caused the caches to be cleared
+	UserAgent int    // number of UA cache entries looked up again
+	Device    int    // number of device cache entries looked up again
+	Errors    int    // number of lookups that failed
+}
+
+// SetCacheRewarm sets the number of the most recently used UA and device cache entries that, when WM server loads a new
+// WURFL file, are looked up again in background and added to the new, empty, caches. This bounds the burst of cache misses
+// that follows a reload. A value <= 0 (the default) disables re-population. This function should be called before
+// performing any lookup
+func (c *WmClient) SetCacheRewarm(entries int) {
+	if c == nil {
+		return
+	}
+	c.rewarmEntries = entries
+}
+
+// internalLookupKey is the context key marking the lookups made by the client itself, rather than on behalf of the caller
+type internalLookupKey struct{}
+
+// withInternalLookup returns a context marking the lookups it is passed to as internal: they are neither written to the
+// request mirror nor counted by the detection telemetry, which must only see production traffic
+func withInternalLookup(ctx context.Context) context.Context {
+	return context.WithValue(ctx, internalLookupKey{}, true)
+}
+
+// isInternalLookup returns true if the given context has been created by withInternalLookup
+func isInternalLookup(ctx context.Context) bool {
+	internal, _ := ctx.Value(internalLookupKey{}).(bool)
+	return internal
+}
+
+// rewarmItem is a cache entry to look up again
+type rewarmItem struct {
+	key   string
+	entry *cacheEntry
+}
+
+// startCacheRewarm re-populates the caches in background, using the hottest entries of the given old caches, which must no
+// longer be used by the client. A running re-population, started by a previous reload, is stopped
+func (c *WmClient) startCacheRewarm(ltime string, userAgentCache *lru.Cache, deviceCache *lru.Cache) {
+	c.rewarmMutex.Lock()
+	defer c.rewarmMutex.Unlock()
+	if c.rewarmCancel != nil {
+		c.rewarmCancel()
+		c.rewarmCancel = nil
+	}
+
+	// if the client is closed the caches are not re-populated
+	c.rewarmCancel, _ = c.getTasks().goTask(func(ctx context.Context) error {
+		ctx = withInternalLookup(ctx)
+		event := CacheRewarmEvent{Ltime: ltime}
+
+		for _, item := range hottestEntries(userAgentCache, c.rewarmEntries) {
+			if ctx.Err() != nil {
+				break
+			}
+			if item.entry.lookupHeaders == nil {
+				continue
+			}
+			request := Request{LookupHeaders: item.entry.lookupHeaders}
+			lookupCtx := withCapabilityScope(ctx, item.entry.lookupScope)
+			if _, err := c.headersLookup(lookupCtx, request, item.entry.lookupPath, true); err != nil {
+				event.Errors++
+			}
+			event.UserAgent++
+		}
+
+		for _, item := range hottestEntries(deviceCache, c.rewarmEntries) {
+			if ctx.Err() != nil {
+				break
+			}
+			if item.entry.err != nil {
+				continue
+			}
+			deviceID := item.key
+			if scope := item.entry.lookupScope; scope != nil {
+				deviceID = strings.TrimPrefix(deviceID, scope.namespace)
+			}
+			if _, err := c.lookupDeviceID(withCapabilityScope(ctx, item.entry.lookupScope), deviceID, true); err != nil {
+				event.Errors++
+			}
+			event.Device++
+		}
+
+		if ctx.Err() == nil {
+			c.emitStats(event)
+		}
+		return nil
+	})
+}
+
+// hottestEntries empties the given cache, returning its n most recently used entries, most recent first
+func hottestEntries(cache *lru.Cache, n int) []rewarmItem {
+	if cache == nil || n <= 0 {
+		return nil
+	}
+
+	// the cache does not support iteration: entries are removed from the oldest one, keeping the last n in a ring
+	ring := make([]rewarmItem, 0, n)
+	next := 0
+	cache.OnEvicted = func(key lru.Key, value interface{}) {
+		item := rewarmItem{key: key.(string), entry: value.(*cacheEntry)}
+		if len(ring) < n {
+			ring = append(ring, item)
+		} else {
+			ring[next] = item
+		}
+		next = (next + 1) % n
+	}
+	for cache.Len() > 0 {
+		cache.RemoveOldest()
+	}
+
+	items := make([]rewarmItem, 0, len(ring))
+	for i := 1; i <= len(ring); i++ {
+		items = append(items, ring[(next-i+len(ring))%len(ring)])
+	}
+	return items
+}
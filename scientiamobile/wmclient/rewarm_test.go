@@ -0,0 +1,127 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/groupcache/lru"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHottestEntries(t *testing.T) {
+	cache := lru.New(10)
+	for i := 0; i < 6; i++ {
+		cache.Add(fmt.Sprintf("key-%d", i), &cacheEntry{})
+	}
+	// key-0 becomes the most recently used entry
+	cache.Get("key-0")
+
+	keys := func(items []rewarmItem) []string {
+		result := make([]string, 0, len(items))
+		for _, item := range items {
+			result = append(result, item.key)
+		}
+		return result
+	}
+	require.Equal(t, []string{"key-0", "key-5", "key-4"}, keys(hottestEntries(cache, 3)))
+	require.Equal(t, 0, cache.Len())
+
+	cache = lru.New(10)
+	cache.Add("key-1", &cacheEntry{})
+	cache.Add("key-2", &cacheEntry{})
+	require.Equal(t, []string{"key-2", "key-1"}, keys(hottestEntries(cache, 5)))
+
+	require.Nil(t, hottestEntries(nil, 5))
+	require.Nil(t, hottestEntries(lru.New(10), 0))
+}
+
+func TestSwapCachesReturnsOldCaches(t *testing.T) {
+	client := &WmClient{}
+	client.setCacheSizes(10, 10)
+
+	// empty caches are not replaced
+	userAgentCache, deviceCache := client.swapCaches(CacheClearLtimeChange)
+	require.Nil(t, userAgentCache)
+	require.Nil(t, deviceCache)
+
+	client.addToUserAgentCache("ua", &JSONDeviceData{})
+	client.addToDeviceCache("generic", &JSONDeviceData{})
+	userAgentCache, deviceCache = client.swapCaches(CacheClearLtimeChange)
+	require.Equal(t, 1, userAgentCache.Len())
+	require.Equal(t, 1, deviceCache.Len())
+	require.NotEqual(t, userAgentCache, client.userAgentCache)
+	require.NotEqual(t, deviceCache, client.deviceCache)
+}
+
+func TestCacheRewarmIsNotProductionTraffic(t *testing.T) {
+	var ltime atomic.Value
+	ltime.Store("1")
+	var lookups int32
+	server := httptest.NewServer(newScopedTestHandler(&ltime, &lookups))
+	defer server.Close()
+	client := newTestClient(t, server)
+	defer client.Close()
+	client.ImportantHeaders = []string{userAgentHeader}
+	client.StaticCaps = []string{"brand_name", "model_name"}
+	client.VirtualCaps = []string{"form_factor"}
+	client.SetCacheSize(100)
+	client.SetRequestedCapabilities([]string{"brand_name"})
+	dir, err := ioutil.TempDir("", "wmclient")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	mirror, err := NewRequestMirror(filepath.Join(dir, "mirror.jsonl"), MirrorOptions{})
+	require.Nil(t, err)
+	defer mirror.Close()
+	client.SetRequestMirror(mirror)
+	client.SetTelemetrySampleRate(1)
+	client.SetCacheRewarm(10)
+	rewarmed := make(chan CacheRewarmEvent, 1)
+	client.SetStatsHook(func(event interface{}) {
+		if e, ok := event.(CacheRewarmEvent); ok {
+			rewarmed <- e
+		}
+	})
+
+	ctx := context.Background()
+	for _, userAgent := range []string{"ua 1", "ua 2"} {
+		_, err = client.LookupUserAgent(ctx, userAgent)
+		require.Nil(t, err)
+	}
+	// a WURFL file reload clears the caches, the re-population lookups are neither mirrored nor counted
+	ltime.Store("2")
+	_, err = client.LookupUserAgent(ctx, "ua 3")
+	require.Nil(t, err)
+	select {
+	case event := <-rewarmed:
+		require.Equal(t, 2, event.UserAgent)
+	case <-time.After(5 * time.Second):
+		t.Fatal("caches not re-populated")
+	}
+
+	written, err := mirror.Written()
+	require.Nil(t, err)
+	require.Equal(t, uint64(3), written)
+	require.Equal(t, uint64(3), client.GetTelemetryReport().Lookups)
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// capabilitySchemaPath is the WM server endpoint used by GetCapabilitySchema. Servers that do not support it reply with one
+// of the statuses in endpointUnsupported
+const capabilitySchemaPath = "/v2/capabilityschema/json"
+
+// CapabilityType is the type of the values of a capability, which are always returned as strings
+type CapabilityType string
+
+// Capability types
+const (
+	CapabilityBool   CapabilityType = "bool"   // "true" or "false"
+	CapabilityInt    CapabilityType = "int"    // an integer number
+	CapabilityEnum   CapabilityType = "enum"   // one of the values listed in the schema
+	CapabilityString CapabilityType = "string" // any other value
+)
+
+// CapabilitySchema describes a capability
+type CapabilitySchema struct {
+	Name     string         `json:"name"`
+	Type     CapabilityType `json:"type"`
+	Virtual  bool           `json:"virtual"`
+	Values   []string       `json:"values,omitempty"` // values of enum capabilities
+	Inferred bool           `json:"-"`                // true if the type has been inferred by the client from the capability name
+}
+
+// booleanCapabilityPrefixes and numericCapabilitySuffixes are used to infer the type of a capability from its name
+var booleanCapabilityPrefixes = []string{"is_", "has_", "can_", "supports_", "ajax_support_", "playback_", "streaming_"}
+var numericCapabilitySuffixes = []string{"_width", "_height", "_size", "_rate", "_length", "_limit", "_columns", "_rows"}
+
+// enumCapabilityValues holds the values of the enum capabilities known by the client
+var enumCapabilityValues = map[string][]string{
+	CapFormFactor: {FormFactorDesktop, FormFactorApp, FormFactorTablet, FormFactorSmartphone, FormFactorFeaturePhone,
+		FormFactorSmartTV, FormFactorRobot, FormFactorOtherNonMobile, FormFactorOtherMobile},
+}
+
+// GetCapabilitySchema returns the type of each capability supported by WM server and whether it is static or virtual, ie: to
+// build typed accessors or validation at run time. If WM server does not publish the capability schema, it is built from the
+// capabilities returned by GetInfo, with types inferred from their names (ie: is_* capabilities are booleans and *_width
+// ones are integers) and the Inferred flag set
+func (c *WmClient) GetCapabilitySchema(ctx context.Context) ([]CapabilitySchema, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	if atomic.LoadInt32(&c.schemaEndpointFallback) == 0 {
+		res, resbody, err := c.doRequest(ctx, "GET", capabilitySchemaPath, nil)
+		if err != nil {
+			return nil, err
+		}
+		if !endpointUnsupported[res.StatusCode] {
+			if res.StatusCode != http.StatusOK {
+				data := JSONDeviceData{Error: http.StatusText(res.StatusCode)}
+				return nil, newServerError(&data, res.StatusCode, false)
+			}
+			schema := make([]CapabilitySchema, 0)
+			if err = c.decodeResponse(res, resbody, &schema); err != nil {
+				return nil, err
+			}
+			return schema, nil
+		}
+		atomic.StoreInt32(&c.schemaEndpointFallback, 1)
+	}
+
+	info, err := c.GetInfoContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	schema := make([]CapabilitySchema, 0, len(info.StaticCaps)+len(info.VirtualCaps))
+	for _, name := range info.StaticCaps {
+		schema = append(schema, inferCapabilitySchema(name, false))
+	}
+	for _, name := range info.VirtualCaps {
+		schema = append(schema, inferCapabilitySchema(name, true))
+	}
+	return schema, nil
+}
+
+// inferCapabilitySchema returns the schema of the given capability, inferred from its name
+func inferCapabilitySchema(name string, virtual bool) CapabilitySchema {
+	schema := CapabilitySchema{Name: name, Type: inferCapabilityType(name), Virtual: virtual, Inferred: true}
+	if schema.Type == CapabilityEnum {
+		schema.Values = append([]string(nil), enumCapabilityValues[name]...)
+	}
+	return schema
+}
+
+// inferCapabilityType returns the type of the given capability, inferred from its name
+func inferCapabilityType(name string) CapabilityType {
+	if _, ok := enumCapabilityValues[name]; ok {
+		return CapabilityEnum
+	}
+	// suffixes are checked first, since numeric capabilities may have a boolean prefix, ie: playback_oma_size_limit
+	for _, suffix := range numericCapabilitySuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return CapabilityInt
+		}
+	}
+	for _, prefix := range booleanCapabilityPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return CapabilityBool
+		}
+	}
+	return CapabilityString
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCapabilitySchema(t *testing.T) {
+	supported := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == capabilitySchemaPath && supported:
+			w.Write([]byte(`[{"name":"brand_name","type":"string"},{"name":"is_mobile","type":"bool","virtual":true}]`))
+		case r.URL.Path == "/v2/getinfo/json":
+			w.Write([]byte(`{"wm_version":"2.1.0","wurfl_api_version":"1.12","wurfl_info":"wurfl.zip",` +
+				`"static_caps":["brand_name","resolution_width","playback_oma_size_limit"],"virtual_caps":["is_mobile","form_factor"]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	schema, err := client.GetCapabilitySchema(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, []CapabilitySchema{
+		{Name: "brand_name", Type: CapabilityString},
+		{Name: "is_mobile", Type: CapabilityBool, Virtual: true},
+	}, schema)
+
+	// schema inferred from the capability names
+	supported = false
+	schema, err = client.GetCapabilitySchema(context.Background())
+	require.Nil(t, err)
+	require.Len(t, schema, 5)
+	require.Equal(t, CapabilitySchema{Name: "brand_name", Type: CapabilityString, Inferred: true}, schema[0])
+	require.Equal(t, CapabilityInt, schema[1].Type)
+	require.Equal(t, CapabilityInt, schema[2].Type)
+	require.Equal(t, CapabilitySchema{Name: "is_mobile", Type: CapabilityBool, Virtual: true, Inferred: true}, schema[3])
+	require.Equal(t, CapabilityEnum, schema[4].Type)
+	require.Contains(t, schema[4].Values, FormFactorSmartphone)
+	require.Equal(t, int32(1), client.schemaEndpointFallback)
+}
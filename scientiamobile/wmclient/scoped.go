@@ -0,0 +1,159 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ScopedClient is a view of a WmClient whose lookups return its own set of capabilities, instead of the ones set with the
+// SetRequested[...] methods. It shares the client connections, caches and settings: libraries embedded in the same
+// application can each use a ScopedClient with the capabilities they need, without opening their own connections to WM
+// server. Unlike the WithCapabilities option, lookups use the client caches, where the devices of each set of capabilities
+// are kept apart, so that scopes with many distinct devices compete with the client lookups for the cache entries.
+// A ScopedClient is safe for concurrent use and has no resources of its own: it needs not be closed, and it must not be used
+// after the client has been closed
+type ScopedClient struct {
+	client *WmClient
+	scope  *capabilityScope
+}
+
+// capabilityScope holds the capabilities requested by the lookups of a ScopedClient
+type capabilityScope struct {
+	staticCaps  []string
+	virtualCaps []string
+	namespace   string // prefix of the cache keys of the scope lookups, derived from its capabilities
+}
+
+// capabilityScopeKey is the context key of the capability scope of a lookup
+type capabilityScopeKey struct{}
+
+// WithCaps returns a view of the client whose lookups return the given static and virtual capabilities. Capability names
+// unknown to WM server, or given in the wrong list, are discarded, as SetRequestedStaticCapabilities and
+// SetRequestedVirtualCapabilities do. An empty scope makes lookups return the capabilities chosen by WM server
+func (c *WmClient) WithCaps(staticCaps []string, virtualCaps []string) *ScopedClient {
+	scope := &capabilityScope{}
+	for _, name := range staticCaps {
+		if c.HasStaticCapability(name) && !sliceHasValue(scope.staticCaps, name) {
+			scope.staticCaps = append(scope.staticCaps, name)
+		}
+	}
+	for _, name := range virtualCaps {
+		if c.HasVirtualCapability(name) && !sliceHasValue(scope.virtualCaps, name) {
+			scope.virtualCaps = append(scope.virtualCaps, name)
+		}
+	}
+	scope.namespace = scopeNamespace(scope.staticCaps, scope.virtualCaps)
+	return &ScopedClient{client: c, scope: scope}
+}
+
+// scopeNamespace returns the cache key prefix of the given capabilities, which does not depend on their order
+func scopeNamespace(staticCaps []string, virtualCaps []string) string {
+	sortedStatic := append([]string(nil), staticCaps...)
+	sortedVirtual := append([]string(nil), virtualCaps...)
+	sort.Strings(sortedStatic)
+	sort.Strings(sortedVirtual)
+	return "scope:" + hashKey(strings.Join(sortedStatic, ",")+"|"+strings.Join(sortedVirtual, ",")) + ":"
+}
+
+// Client returns the client the view has been created from
+func (s *ScopedClient) Client() *WmClient {
+	if s == nil {
+		return nil
+	}
+	return s.client
+}
+
+// RequestedCapabilities returns the static and virtual capabilities returned by the lookups of the view
+func (s *ScopedClient) RequestedCapabilities() ([]string, []string) {
+	if s == nil {
+		return nil, nil
+	}
+	return append([]string(nil), s.scope.staticCaps...), append([]string(nil), s.scope.virtualCaps...)
+}
+
+// LookupUserAgent works like WmClient.LookupUserAgent, returning the capabilities of the view
+func (s *ScopedClient) LookupUserAgent(ctx context.Context, userAgent string, options ...LookupOption) (*JSONDeviceData, error) {
+	if s == nil {
+		return nil, ErrNilClient
+	}
+	return s.client.LookupUserAgent(s.context(ctx), userAgent, options...)
+}
+
+// LookupHeaders works like WmClient.LookupHeaders, returning the capabilities of the view
+func (s *ScopedClient) LookupHeaders(ctx context.Context, headers map[string]string, options ...LookupOption) (*JSONDeviceData, error) {
+	if s == nil {
+		return nil, ErrNilClient
+	}
+	return s.client.LookupHeaders(s.context(ctx), headers, options...)
+}
+
+// LookupRequest works like WmClient.LookupRequestContext, returning the capabilities of the view
+func (s *ScopedClient) LookupRequest(ctx context.Context, request *http.Request) (*JSONDeviceData, error) {
+	if s == nil {
+		return nil, ErrNilClient
+	}
+	return s.client.LookupRequestContext(s.context(ctx), request)
+}
+
+// LookupDeviceID works like WmClient.LookupDeviceID, returning the capabilities of the view
+func (s *ScopedClient) LookupDeviceID(ctx context.Context, deviceID string, options ...LookupOption) (*JSONDeviceData, error) {
+	if s == nil {
+		return nil, ErrNilClient
+	}
+	return s.client.LookupDeviceID(s.context(ctx), deviceID, options...)
+}
+
+// context returns a copy of ctx holding the view capability scope
+func (s *ScopedClient) context(ctx context.Context) context.Context {
+	return withCapabilityScope(ctx, s.scope)
+}
+
+// withCapabilityScope returns a copy of ctx holding the given capability scope, or ctx itself if the scope is nil
+func withCapabilityScope(ctx context.Context, scope *capabilityScope) context.Context {
+	if scope == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, capabilityScopeKey{}, scope)
+}
+
+// getCapabilityScope returns the capability scope of the lookup with the given context, nil if it has none
+func getCapabilityScope(ctx context.Context) *capabilityScope {
+	scope, _ := ctx.Value(capabilityScopeKey{}).(*capabilityScope)
+	return scope
+}
+
+// userAgentCacheKey returns the UA cache key of the given lookup headers in a lookup with the given context, which is
+// namespaced by the lookup capability scope, if any
+func (c *WmClient) userAgentCacheKey(ctx context.Context, headers map[string]string) string {
+	key := c.getUserAgentCacheKey(headers)
+	if scope := getCapabilityScope(ctx); scope != nil {
+		return scope.namespace + key
+	}
+	return key
+}
+
+// deviceCacheKey returns the device cache key of the given wurfl_id in a lookup with the given context, which is
+// namespaced by the lookup capability scope, if any
+func deviceCacheKey(ctx context.Context, deviceID string) string {
+	if scope := getCapabilityScope(ctx); scope != nil {
+		return scope.namespace + deviceID
+	}
+	return deviceID
+}
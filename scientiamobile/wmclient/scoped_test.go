@@ -0,0 +1,184 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newScopedTestHandler returns a WM server handler returning the requested capabilities and the WURFL load time held by
+// ltime, counting the lookups
+func newScopedTestHandler(ltime *atomic.Value, lookups *int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/getinfo/json" {
+			json.NewEncoder(w).Encode(JSONInfoData{WmVersion: "2.1.0", WurflAPIVersion: "1.12", WurflInfo: "wurfl.zip",
+				Ltime: ltime.Load().(string), ImportantHeaders: []string{userAgentHeader},
+				StaticCaps: []string{"brand_name", "model_name"}, VirtualCaps: []string{"form_factor"}})
+			return
+		}
+		atomic.AddInt32(lookups, 1)
+		request := Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+		caps := map[string]string{"wurfl_id": "generic"}
+		for _, name := range append(request.RequestedCaps, request.RequestedVCaps...) {
+			caps[name] = "value"
+		}
+		json.NewEncoder(w).Encode(JSONDeviceData{Capabilities: caps, Ltime: ltime.Load().(string)})
+	})
+}
+
+func capNames(device *JSONDeviceData) []string {
+	names := make([]string, 0, len(device.Capabilities))
+	for name := range device.Capabilities {
+		if name != "wurfl_id" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func TestScopedClient(t *testing.T) {
+	var ltime atomic.Value
+	ltime.Store("1")
+	var lookups int32
+	server := httptest.NewServer(newScopedTestHandler(&ltime, &lookups))
+	defer server.Close()
+	client := newTestClient(t, server)
+	defer client.Close()
+	client.ImportantHeaders = []string{userAgentHeader}
+	client.StaticCaps = []string{"brand_name", "model_name"}
+	client.VirtualCaps = []string{"form_factor"}
+	client.SetCacheSize(100)
+	client.SetRequestedCapabilities([]string{"brand_name"})
+
+	scoped := client.WithCaps([]string{"model_name", "unknown", "form_factor"}, []string{"form_factor"})
+	staticCaps, virtualCaps := scoped.RequestedCapabilities()
+	require.Equal(t, []string{"model_name"}, staticCaps)
+	require.Equal(t, []string{"form_factor"}, virtualCaps)
+	require.Equal(t, client, scoped.Client())
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		device, err := client.LookupUserAgent(ctx, "ua")
+		require.Nil(t, err)
+		require.Equal(t, []string{"brand_name"}, capNames(device))
+
+		device, err = scoped.LookupUserAgent(ctx, "ua")
+		require.Nil(t, err)
+		require.ElementsMatch(t, []string{"model_name", "form_factor"}, capNames(device))
+
+		device, err = scoped.LookupDeviceID(ctx, "generic")
+		require.Nil(t, err)
+		require.ElementsMatch(t, []string{"model_name", "form_factor"}, capNames(device))
+
+		device, err = client.LookupDeviceID(ctx, "generic")
+		require.Nil(t, err)
+		require.Equal(t, []string{"brand_name"}, capNames(device))
+	}
+	// the second round is served by the caches, where each scope has its own entries
+	require.Equal(t, int32(4), atomic.LoadInt32(&lookups))
+
+	// views with the same capabilities share the cache entries
+	device, err := client.WithCaps([]string{"model_name"}, []string{"form_factor", "form_factor"}).LookupUserAgent(ctx, "ua")
+	require.Nil(t, err)
+	require.ElementsMatch(t, []string{"model_name", "form_factor"}, capNames(device))
+	require.Equal(t, int32(4), atomic.LoadInt32(&lookups))
+
+	headers := map[string]string{"user-agent": "ua"}
+	device, err = scoped.LookupHeaders(ctx, headers)
+	require.Nil(t, err)
+	require.ElementsMatch(t, []string{"model_name", "form_factor"}, capNames(device))
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set(userAgentHeader, "ua")
+	_, err = scoped.LookupRequest(ctx, request)
+	require.Nil(t, err)
+	require.Equal(t, int32(4), atomic.LoadInt32(&lookups))
+
+	// lookup options take precedence over the view capabilities
+	device, err = scoped.LookupUserAgent(ctx, "ua", WithCapabilities("brand_name"))
+	require.Nil(t, err)
+	require.Equal(t, []string{"brand_name"}, capNames(device))
+	require.Equal(t, int32(5), atomic.LoadInt32(&lookups))
+}
+
+func TestScopeNamespace(t *testing.T) {
+	require.Equal(t, scopeNamespace([]string{"a", "b"}, []string{"c"}), scopeNamespace([]string{"b", "a"}, []string{"c"}))
+	require.NotEqual(t, scopeNamespace([]string{"a"}, []string{"b"}), scopeNamespace([]string{"a", "b"}, nil))
+	require.NotEqual(t, scopeNamespace(nil, nil), "")
+
+	var scoped *ScopedClient
+	_, err := scoped.LookupUserAgent(context.Background(), "ua")
+	require.Equal(t, ErrNilClient, err)
+	_, err = (*WmClient)(nil).WithCaps([]string{"brand_name"}, nil).LookupDeviceID(context.Background(), "generic")
+	require.Equal(t, ErrNilClient, err)
+}
+
+func TestScopedCacheRewarm(t *testing.T) {
+	var ltime atomic.Value
+	ltime.Store("1")
+	var lookups int32
+	server := httptest.NewServer(newScopedTestHandler(&ltime, &lookups))
+	defer server.Close()
+	client := newTestClient(t, server)
+	defer client.Close()
+	client.ImportantHeaders = []string{userAgentHeader}
+	client.StaticCaps = []string{"brand_name", "model_name"}
+	client.VirtualCaps = []string{"form_factor"}
+	client.SetCacheSize(100)
+	client.SetRequestedCapabilities([]string{"brand_name"})
+	client.SetCacheRewarm(10)
+	rewarmed := make(chan CacheRewarmEvent, 1)
+	client.SetStatsHook(func(event interface{}) {
+		if e, ok := event.(CacheRewarmEvent); ok {
+			rewarmed <- e
+		}
+	})
+
+	ctx := context.Background()
+	scoped := client.WithCaps(nil, []string{"form_factor"})
+	_, err := scoped.LookupUserAgent(ctx, "ua")
+	require.Nil(t, err)
+	_, err = scoped.LookupDeviceID(ctx, "generic")
+	require.Nil(t, err)
+
+	// a WURFL file reload clears the caches, which are re-populated with the scoped entries
+	ltime.Store("2")
+	_, err = client.LookupUserAgent(ctx, "other")
+	require.Nil(t, err)
+	select {
+	case event := <-rewarmed:
+		require.Equal(t, 0, event.Errors)
+	case <-time.After(5 * time.Second):
+		t.Fatal("caches not re-populated")
+	}
+
+	count := atomic.LoadInt32(&lookups)
+	device, err := scoped.LookupUserAgent(ctx, "ua")
+	require.Nil(t, err)
+	require.Equal(t, []string{"form_factor"}, capNames(device))
+	device, err = scoped.LookupDeviceID(ctx, "generic")
+	require.Nil(t, err)
+	require.Equal(t, []string{"form_factor"}, capNames(device))
+	require.Equal(t, count, atomic.LoadInt32(&lookups))
+}
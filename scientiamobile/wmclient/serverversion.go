@@ -0,0 +1,141 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VersionConstraint is a set of conditions on a version, all of which must hold, such as ">=2.1 <3". Versions are compared
+// with CompareVersions
+type VersionConstraint struct {
+	text       string
+	conditions []versionCondition
+}
+
+// versionCondition compares a version with a bound
+type versionCondition struct {
+	operator string
+	bound    string
+}
+
+// versionOperators are the comparison operators of a condition, longest first so that ">=" is not read as ">"
+var versionOperators = []string{">=", "<=", "!=", "==", ">", "<", "="}
+
+// ParseVersionConstraint parses a constraint made of conditions separated by spaces or commas, ie: ">=2.1 <3" or
+// ">=2.1, <3". Each condition is an operator among >=, >, <=, <, = (or ==) and != followed by a version; a version without
+// operator must be equal
+func ParseVersionConstraint(constraint string) (*VersionConstraint, error) {
+	fields := strings.FieldsFunc(constraint, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("invalid version constraint %q: no condition", constraint)
+	}
+
+	parsed := &VersionConstraint{}
+	var texts []string
+	for i := 0; i < len(fields); i++ {
+		operator := ""
+		for _, op := range versionOperators {
+			if strings.HasPrefix(fields[i], op) {
+				operator = op
+				break
+			}
+		}
+		bound := fields[i][len(operator):]
+		if bound == "" && operator != "" && i+1 < len(fields) {
+			// space between the operator and the version, ie: ">= 2.1"
+			i++
+			bound = fields[i]
+		}
+		if bound == "" || strings.ContainsAny(bound, "<>=!") {
+			return nil, fmt.Errorf("invalid version constraint %q: missing version after %s", constraint, operator)
+		}
+		if operator == "" || operator == "==" {
+			operator = "="
+		}
+		parsed.conditions = append(parsed.conditions, versionCondition{operator: operator, bound: bound})
+		texts = append(texts, operator+bound)
+	}
+	parsed.text = strings.Join(texts, " ")
+	return parsed, nil
+}
+
+// Allows tells whether the given version satisfies all the conditions of the constraint
+func (vc *VersionConstraint) Allows(version string) bool {
+	for _, condition := range vc.conditions {
+		result := CompareVersions(version, condition.bound)
+		var ok bool
+		switch condition.operator {
+		case ">=":
+			ok = result >= 0
+		case ">":
+			ok = result > 0
+		case "<=":
+			ok = result <= 0
+		case "<":
+			ok = result < 0
+		case "!=":
+			ok = result != 0
+		default:
+			ok = result == 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the conditions of the constraint, separated by spaces
+func (vc *VersionConstraint) String() string {
+	return vc.text
+}
+
+// ServerVersionError is returned when the client is created for a WM server whose version does not satisfy the constraint
+// given with WithRequireServerVersion
+type ServerVersionError struct {
+	Version    string // WM server version
+	Constraint string // required version
+}
+
+func (e *ServerVersionError) Error() string {
+	return fmt.Sprintf("WM server version %s does not satisfy the required version %s", e.Version, e.Constraint)
+}
+
+// WithRequireServerVersion makes client creation fail with a *ServerVersionError if the WM server version does not satisfy
+// the given constraint, ie: ">=2.1 <3", so that a client is not paired with a server it is not compatible with. See
+// ParseVersionConstraint for the constraint syntax
+func WithRequireServerVersion(constraint string) Option {
+	return func(options *clientOptions) {
+		parsed, err := ParseVersionConstraint(constraint)
+		if err != nil {
+			options.setError(err)
+			return
+		}
+		options.serverVersion = parsed
+	}
+}
+
+// checkServerVersion returns a *ServerVersionError if the given WM server version does not satisfy the given constraint
+func checkServerVersion(version string, constraint *VersionConstraint) error {
+	if constraint == nil || constraint.Allows(version) {
+		return nil
+	}
+	return &ServerVersionError{Version: version, Constraint: constraint.String()}
+}
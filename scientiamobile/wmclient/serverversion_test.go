@@ -0,0 +1,79 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		text       string
+		allowed    []string
+		rejected   []string
+	}{
+		{">=2.1 <3", ">=2.1 <3", []string{"2.1", "2.1.0", "2.10.4", "2.9"}, []string{"2.0.9", "3", "3.0.0", "2.1.0-beta"}},
+		{">= 2.1, < 3", ">=2.1 <3", []string{"2.5.1"}, []string{"1.9", "3.1"}},
+		{"2.1.0", "=2.1.0", []string{"2.1", "2.1.0"}, []string{"2.1.1"}},
+		{"==2.1 !=2.1.1", "=2.1 !=2.1.1", []string{"2.1.0"}, []string{"2.1.1", "2.2"}},
+		{">2 <=2.5", ">2 <=2.5", []string{"2.0.1", "2.5"}, []string{"2", "2.5.1"}},
+	}
+	for _, test := range tests {
+		constraint, err := ParseVersionConstraint(test.constraint)
+		require.Nil(t, err, test.constraint)
+		require.Equal(t, test.text, constraint.String())
+		for _, version := range test.allowed {
+			require.True(t, constraint.Allows(version), "%s %s", version, test.constraint)
+		}
+		for _, version := range test.rejected {
+			require.False(t, constraint.Allows(version), "%s %s", version, test.constraint)
+		}
+	}
+
+	for _, invalid := range []string{"", " , ", ">=", ">=2.1 <", "=>2.1", ">=<2"} {
+		_, err := ParseVersionConstraint(invalid)
+		require.NotNil(t, err, invalid)
+	}
+}
+
+func TestWithRequireServerVersion(t *testing.T) {
+	var lookups int32
+	server := httptest.NewServer(newOptionsTestHandler("", &lookups))
+	defer server.Close()
+
+	client, err := CreateFromURL(server.URL, WithRequireServerVersion(">=2.1 <3"))
+	require.Nil(t, err)
+	client.Close()
+
+	client, err = CreateFromURL(server.URL, WithRequireServerVersion(">=2.2"))
+	require.Nil(t, client)
+	var versionErr *ServerVersionError
+	require.True(t, errors.As(err, &versionErr))
+	require.Equal(t, ServerVersionError{Version: "2.1.0", Constraint: ">=2.2"}, *versionErr)
+	require.EqualError(t, err, "WM server version 2.1.0 does not satisfy the required version >=2.2")
+
+	_, err = CreateFromURL(server.URL, WithRequireServerVersion("latest <"))
+	require.NotNil(t, err)
+	require.False(t, errors.As(err, &versionErr))
+
+	_, err = NewFromConfig(Config{URL: server.URL, RequireServerVersion: "<2"})
+	require.True(t, errors.As(err, &versionErr))
+}
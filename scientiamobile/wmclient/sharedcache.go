@@ -0,0 +1,116 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// SharedCache is a cache shared by the clients of several processes, ie: the workers of a service running one process per
+// core, so that each host sends a user agent to WM server only once. It is used as a second level after the client UA cache:
+// the devices missing from the UA cache are looked for in the shared cache before being looked up on WM server, and the
+// devices returned by WM server are added to both. Keys include the WURFL file load time and the requested capabilities, so
+// that clients requesting different capabilities or connected to servers with different WURFL files do not share entries.
+// Implementations must be safe for concurrent use and should bound the time of their operations: errors must be handled
+// by the implementation, Get reporting them as misses. UnixSocketCache is the implementation provided by the client
+type SharedCache interface {
+	// Get returns the value stored for the given key, if any
+	Get(key string) ([]byte, bool)
+	// Set stores the given value for the given key
+	Set(key string, value []byte)
+}
+
+// SharedCacheStats holds the shared cache counters since the client creation
+type SharedCacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// SetSharedCache sets the cache shared with the clients of other processes, used when the UA cache is enabled. A nil cache
+// disables it, which is the default. The cache is not closed by the client. This function should be called before
+// performing any lookup
+func (c *WmClient) SetSharedCache(cache SharedCache) {
+	if c == nil {
+		return
+	}
+	c.sharedCache = cache
+}
+
+// WithSharedCache sets the cache shared with the clients of other processes, as SetSharedCache does
+func WithSharedCache(cache SharedCache) Option {
+	return func(options *clientOptions) {
+		options.sharedCache = cache
+	}
+}
+
+// GetSharedCacheStats returns the shared cache hits and misses counted since the client creation
+func (c *WmClient) GetSharedCacheStats() SharedCacheStats {
+	if c == nil {
+		return SharedCacheStats{}
+	}
+	c.lruUserAgentCS.Lock()
+	defer c.lruUserAgentCS.Unlock()
+	return SharedCacheStats{Hits: c.sharedCacheHits, Misses: c.sharedCacheMisses}
+}
+
+// sharedCacheKey returns the shared cache key of the given UA cache key, for a lookup requesting the given capabilities.
+// It returns false if the WURFL file load time is not known yet, in which case the shared cache is not used
+func (c *WmClient) sharedCacheKey(key string, staticCaps []string, virtualCaps []string) (string, bool) {
+	c.ltimeMutex.Lock()
+	ltime := c.clientLtime
+	c.ltimeMutex.Unlock()
+	if ltime == "" {
+		return "", false
+	}
+	return hashKey(ltime+"\x00"+strings.Join(staticCaps, ",")+"\x00"+strings.Join(virtualCaps, ",")) + ":" + key, true
+}
+
+// sharedCacheEntry is the value stored in the shared cache for a device
+type sharedCacheEntry struct {
+	Device   *JSONDeviceData `json:"device"`
+	DeviceID string          `json:"device_id"` // not marshalled with the device
+}
+
+// getFromSharedCache returns the device stored in the shared cache for the given key, if any
+func (c *WmClient) getFromSharedCache(key string) (*JSONDeviceData, bool) {
+	value, ok := c.sharedCache.Get(key)
+	var entry sharedCacheEntry
+	if ok && (json.Unmarshal(value, &entry) != nil || entry.Device == nil) {
+		ok = false
+	}
+
+	c.lruUserAgentCS.Lock()
+	if ok {
+		c.sharedCacheHits++
+	} else {
+		c.sharedCacheMisses++
+	}
+	c.lruUserAgentCS.Unlock()
+	if !ok {
+		return nil, false
+	}
+	entry.Device.DeviceID = entry.DeviceID
+	return entry.Device, true
+}
+
+// addToSharedCache stores the given device in the shared cache. As in the UA cache, the response metadata and raw body are
+// not kept
+func (c *WmClient) addToSharedCache(key string, device *JSONDeviceData) {
+	if value, err := json.Marshal(&sharedCacheEntry{Device: device, DeviceID: device.DeviceID}); err == nil {
+		c.sharedCache.Set(key, value)
+	}
+}
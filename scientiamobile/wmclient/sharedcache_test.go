@@ -0,0 +1,180 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnixSocketCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wmclient")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache.sock")
+
+	_, err = NewUnixSocketCache("", 10)
+	require.NotNil(t, err)
+
+	first, err := NewUnixSocketCache(path, 10)
+	require.Nil(t, err)
+	second, err := NewUnixSocketCache(path, 10)
+	require.Nil(t, err)
+	defer second.Close()
+	require.True(t, first.Serving())
+	require.False(t, second.Serving())
+
+	second.Set("key", []byte("value"))
+	value, ok := first.Get("key")
+	require.True(t, ok)
+	require.Equal(t, "value", string(value))
+	first.Set("other", []byte("other value"))
+	value, ok = second.Get("other")
+	require.True(t, ok)
+	require.Equal(t, "other value", string(value))
+	_, ok = second.Get("missing")
+	require.False(t, ok)
+
+	second.Set("large", make([]byte, unixCacheMaxValueSize+1))
+	_, ok = first.Get("large")
+	require.False(t, ok)
+
+	// the second cache takes the place of the closed one, with no entries
+	require.Nil(t, first.Close())
+	_, ok = first.Get("key")
+	require.False(t, ok)
+	_, ok = second.Get("key")
+	require.False(t, ok)
+	require.True(t, second.Serving())
+	second.Set("key", []byte("new value"))
+	third, err := NewUnixSocketCache(path, 10)
+	require.Nil(t, err)
+	defer third.Close()
+	require.False(t, third.Serving())
+	value, ok = third.Get("key")
+	require.True(t, ok)
+	require.Equal(t, "new value", string(value))
+}
+
+func TestUnixSocketCacheStaleSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wmclient")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache.sock")
+
+	// the socket file left by a process that has exited
+	stale, err := NewUnixSocketCache(path, 10)
+	require.Nil(t, err)
+	stale.mutex.Lock()
+	stale.socket = nil
+	stale.mutex.Unlock()
+	stale.listener.Close()
+	_, err = os.Lstat(path)
+	require.Nil(t, err)
+
+	cache, err := NewUnixSocketCache(path, 10)
+	require.Nil(t, err)
+	defer cache.Close()
+	require.True(t, cache.Serving())
+}
+
+func TestUnixSocketCacheMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wmclient")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// the socket is only accessible by its owner, whatever the umask
+	path := filepath.Join(dir, "cache.sock")
+	cache, err := NewUnixSocketCache(path, 10)
+	require.Nil(t, err)
+	info, err := os.Lstat(path)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	require.Nil(t, cache.Close())
+
+	path = filepath.Join(dir, "group.sock")
+	cache, err = NewUnixSocketCacheWithMode(path, 10, 0660)
+	require.Nil(t, err)
+	defer cache.Close()
+	info, err = os.Lstat(path)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0660), info.Mode().Perm())
+
+	// processes of the same user are allowed
+	conn, err := cache.dial()
+	require.Nil(t, err)
+	require.True(t, unixPeerAllowed(conn))
+	conn.Close()
+}
+
+func TestSharedCache(t *testing.T) {
+	var lookups int32
+	server := httptest.NewServer(newOptionsTestHandler("", &lookups))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "wmclient")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache.sock")
+
+	// clients of different processes
+	var clients []*WmClient
+	for i := 0; i < 2; i++ {
+		cache, err := NewUnixSocketCache(path, 100)
+		require.Nil(t, err)
+		defer cache.Close()
+		client, err := CreateFromURL(server.URL, WithCache(100), WithSharedCache(cache),
+			WithRequestedCapabilities("brand_name", "form_factor"))
+		require.Nil(t, err)
+		defer client.Close()
+		clients = append(clients, client)
+	}
+
+	for _, client := range clients {
+		device, err := client.LookupUserAgent(context.Background(), "ua")
+		require.Nil(t, err)
+		require.Equal(t, "generic", device.DeviceID)
+		require.Equal(t, "value", device.Capabilities["brand_name"])
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&lookups))
+	require.Equal(t, SharedCacheStats{Misses: 1}, clients[0].GetSharedCacheStats())
+	require.Equal(t, SharedCacheStats{Hits: 1}, clients[1].GetSharedCacheStats())
+
+	// the device is now in the UA cache of the second client
+	_, err = clients[1].LookupUserAgent(context.Background(), "ua")
+	require.Nil(t, err)
+	require.Equal(t, SharedCacheStats{Hits: 1}, clients[1].GetSharedCacheStats())
+
+	// clients requesting other capabilities do not share the entries
+	clients[1].SetRequestedCapabilities([]string{"brand_name"})
+	device, err := clients[1].LookupUserAgent(context.Background(), "ua")
+	require.Nil(t, err)
+	require.NotContains(t, device.Capabilities, "form_factor")
+	require.Equal(t, int32(2), atomic.LoadInt32(&lookups))
+
+	// uncached lookups do not use the shared cache
+	_, err = clients[0].LookupUserAgentUncached(context.Background(), "other ua")
+	require.Nil(t, err)
+	_, err = clients[1].LookupUserAgentUncached(context.Background(), "other ua")
+	require.Nil(t, err)
+	require.Equal(t, int32(4), atomic.LoadInt32(&lookups))
+}
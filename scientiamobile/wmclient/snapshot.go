@@ -0,0 +1,169 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// DeviceSnapshot holds the capabilities of a set of user-agents (usually the most frequent ones), exported to a file that
+// the client can use as a last resort source of device data when the WM server cannot be reached
+type DeviceSnapshot struct {
+	Ltime   string                       `json:"ltime"`   // load time of the WURFL data used to create the snapshot
+	Devices map[string]map[string]string `json:"devices"` // capabilities by user-agent
+}
+
+// deviceSnapshot is a loaded DeviceSnapshot, with its devices also indexed by wurfl_id
+type deviceSnapshot struct {
+	DeviceSnapshot
+	byDeviceID map[string]map[string]string
+}
+
+// ExportSnapshot detects the given user-agents and writes their capabilities, in the DeviceSnapshot JSON format,
+// to the file at the given path. Requested capabilities are honored, so the snapshot can be kept small
+func (c *WmClient) ExportSnapshot(ctx context.Context, userAgents []string, path string) error {
+	if c == nil {
+		return ErrNilClient
+	}
+	if c.httpClient == nil {
+		return ErrClientNotInitialized
+	}
+	if path == "" {
+		return errors.New("missing device snapshot path")
+	}
+	snapshot := DeviceSnapshot{Devices: make(map[string]map[string]string, len(userAgents))}
+	for _, ua := range userAgents {
+		device, err := c.LookupUserAgentUncached(ctx, ua)
+		if err != nil {
+			return err
+		}
+		caps := device.Capabilities
+		if _, ok := caps[wurflIDCapability]; !ok && device.DeviceID != "" {
+			// the snapshot is indexed by wurfl_id, which must be kept even if excluded from the device capabilities
+			caps = make(map[string]string, len(device.Capabilities)+1)
+			for name, value := range device.Capabilities {
+				caps[name] = value
+			}
+			caps[wurflIDCapability] = device.DeviceID
+		}
+		snapshot.Devices[ua] = caps
+		snapshot.Ltime = device.Ltime
+	}
+
+	data, err := json.Marshal(&snapshot)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so that a client loading the snapshot never reads a partial one
+	tmpPath := path + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// LoadSnapshot loads the DeviceSnapshot file at the given path. When a lookup fails because WM server cannot be reached,
+// devices are searched in the snapshot, by user-agent or wurfl_id, and returned without error; their Metadata has the
+// FromSnapshot flag set. Calling this function again replaces the previously loaded snapshot
+func (c *WmClient) LoadSnapshot(path string) error {
+	if c == nil {
+		return ErrNilClient
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	snapshot := &deviceSnapshot{}
+	if err = json.Unmarshal(data, &snapshot.DeviceSnapshot); err != nil {
+		return err
+	}
+	if len(snapshot.Devices) == 0 {
+		return errors.New("device snapshot " + path + " is empty")
+	}
+
+	snapshot.byDeviceID = make(map[string]map[string]string, len(snapshot.Devices))
+	for _, caps := range snapshot.Devices {
+		if id, ok := caps[wurflIDCapability]; ok {
+			snapshot.byDeviceID[id] = caps
+		}
+	}
+
+	c.snapshotMutex.Lock()
+	c.snapshot = snapshot
+	c.snapshotMutex.Unlock()
+	return nil
+}
+
+// getFromSnapshot searches the loaded snapshot for the given user-agent or, if it is empty, for the given wurfl_id
+func (c *WmClient) getFromSnapshot(userAgent string, deviceID string) (*JSONDeviceData, bool) {
+	c.snapshotMutex.RLock()
+	snapshot := c.snapshot
+	c.snapshotMutex.RUnlock()
+
+	if snapshot == nil {
+		return nil, false
+	}
+
+	var caps map[string]string
+	var ok bool
+	if userAgent != "" {
+		caps, ok = snapshot.Devices[userAgent]
+	} else {
+		caps, ok = snapshot.byDeviceID[deviceID]
+	}
+	if !ok {
+		return nil, false
+	}
+
+	device := &JSONDeviceData{
+		APIVersion:   "WURFL Microservice Client " + GetAPIVersion(),
+		Capabilities: c.projectCapabilities(caps),
+		Mtime:        time.Now().Unix(),
+		Ltime:        snapshot.Ltime,
+		Metadata:     &ResponseMetadata{FromSnapshot: true},
+	}
+	c.setDeviceID(device)
+	return device, true
+}
+
+// projectCapabilities returns a copy of the given capabilities, restricted to the requested ones (and wurfl_id), if any
+func (c *WmClient) projectCapabilities(caps map[string]string) map[string]string {
+	requested := len(c.requestedStaticCaps) + len(c.requestedVirtualCaps)
+	projected := make(map[string]string, len(caps))
+	for name, value := range caps {
+		if requested == 0 || name == wurflIDCapability || sliceContains(c.requestedStaticCaps, name) || sliceContains(c.requestedVirtualCaps, name) {
+			projected[name] = value
+		}
+	}
+	return projected
+}
+
+// sliceContains checks whether the given value is present in the given, not necessarily sorted, slice of strings
+func sliceContains(slist []string, value string) bool {
+	for _, v := range slist {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const snapshotUA = "Mozilla/5.0 (iPhone; CPU iPhone OS 10_2_1 like Mac OS X) AppleWebKit/602.4.6 (KHTML, like Gecko) Version/10.0 Mobile/14D27 Safari/602.1"
+
+func writeTestSnapshot(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "wmclient")
+	require.Nil(t, err)
+	path := filepath.Join(dir, "snapshot.json")
+	content := `{"ltime":"2020-01-01 10:00:00","devices":{"` + snapshotUA + `":{"wurfl_id":"apple_iphone_ver10_2_1","brand_name":"Apple","model_name":"iPhone","is_smartphone":"true"}}}`
+	require.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLookupFallsBackToSnapshot(t *testing.T) {
+	path := writeTestSnapshot(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	// client pointing to a server that is down
+	client := &WmClient{scheme: "http", host: "localhost", port: "18080", httpClient: createHTTPClient(defaultConnTimeout, defaultTransferTimeout)}
+
+	_, err := client.LookupUserAgent(context.Background(), snapshotUA)
+	require.NotNil(t, err)
+
+	require.Nil(t, client.LoadSnapshot(path))
+	// client has never reached the server, so it has no capability list to validate requested capabilities against
+	client.requestedStaticCaps = []string{"brand_name"}
+
+	d, err := client.LookupUserAgent(context.Background(), snapshotUA)
+	require.Nil(t, err)
+	require.True(t, d.Metadata.FromSnapshot)
+	require.Equal(t, "2020-01-01 10:00:00", d.Ltime)
+	// only requested capabilities and wurfl_id are returned
+	require.Equal(t, 2, len(d.Capabilities))
+	require.Equal(t, "Apple", d.Capabilities["brand_name"])
+
+	d, err = client.LookupDeviceID(context.Background(), "apple_iphone_ver10_2_1")
+	require.Nil(t, err)
+	require.Equal(t, "Apple", d.Capabilities["brand_name"])
+
+	require.Equal(t, "apple_iphone_ver10_2_1", d.DeviceID)
+
+	// wurfl_id can be excluded from capabilities
+	client.SetWurflIDInCapabilities(false)
+	d, err = client.LookupUserAgent(context.Background(), snapshotUA)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(d.Capabilities))
+	require.Equal(t, "apple_iphone_ver10_2_1", d.DeviceID)
+
+	// not in snapshot: the server error is returned
+	_, err = client.LookupUserAgent(context.Background(), "unknown user-agent")
+	require.NotNil(t, err)
+}
+
+func TestLoadSnapshotErrors(t *testing.T) {
+	client := &WmClient{}
+	require.NotNil(t, client.LoadSnapshot("/non/existent/snapshot.json"))
+
+	dir, err := ioutil.TempDir("", "wmclient")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "empty.json")
+	require.Nil(t, ioutil.WriteFile(path, []byte(`{"devices":{}}`), 0644))
+	require.NotNil(t, client.LoadSnapshot(path))
+}
+
+func TestExportSnapshot(t *testing.T) {
+	client := createTestClient(t)
+	client.SetRequestedCapabilities([]string{"brand_name", "model_name"})
+
+	dir, err := ioutil.TempDir("", "wmclient")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot.json")
+
+	require.Nil(t, client.ExportSnapshot(context.Background(), []string{snapshotUA}, path))
+	require.Nil(t, client.LoadSnapshot(path))
+	d, ok := client.getFromSnapshot(snapshotUA, "")
+	require.True(t, ok)
+	require.Equal(t, 3, len(d.Capabilities))
+	client.DestroyConnection()
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"errors"
+	"net"
+	"net/url"
+)
+
+// SetSOCKS5Proxy makes the client connect to WM server through the SOCKS5 proxy listening at the given address (host:port),
+// ie: a bastion host. Username and password are sent to proxies that require authentication, leave them empty otherwise.
+// The WM server host name is resolved by the proxy. It works like SetProxy with a socks5 URL: an empty address removes the
+// proxy, which applies to the default transport only, not to custom transports. This function should be called before
+// performing any lookup
+func (c *WmClient) SetSOCKS5Proxy(address string, username string, password string) error {
+	if c == nil {
+		return ErrNilClient
+	}
+	if address == "" {
+		return c.setProxy(nil)
+	}
+	if c.transport != nil {
+		return errors.New("SOCKS5 proxy is not applied to custom transports")
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return err
+	}
+
+	proxy := &url.URL{Scheme: "socks5", Host: address}
+	if username != "" {
+		proxy.User = url.UserPassword(username, password)
+	}
+	return c.setProxy(proxy)
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// socks5Server is a minimal SOCKS5 proxy, supporting username/password authentication and CONNECT to domain names only
+type socks5Server struct {
+	listener  net.Listener
+	username  string
+	password  string
+	connected int32 // number of CONNECT requests served
+}
+
+func newSOCKS5Server(t *testing.T, username string, password string) *socks5Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	s := &socks5Server{listener: listener, username: username, password: password}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *socks5Server) serve(conn net.Conn) {
+	defer conn.Close()
+	buf := make([]byte, 256)
+
+	// greeting: version, methods
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+		return
+	}
+	if s.username == "" {
+		conn.Write([]byte{5, 0})
+	} else {
+		conn.Write([]byte{5, 2})
+		// username/password sub-negotiation
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return
+		}
+		username := make([]byte, buf[1])
+		io.ReadFull(conn, username)
+		io.ReadFull(conn, buf[:1])
+		password := make([]byte, buf[0])
+		io.ReadFull(conn, password)
+		if string(username) != s.username || string(password) != s.password {
+			conn.Write([]byte{1, 1})
+			return
+		}
+		conn.Write([]byte{1, 0})
+	}
+
+	// request: version, command, reserved, address type 3 (domain name), length, name, port
+	if _, err := io.ReadFull(conn, buf[:5]); err != nil || buf[3] != 3 {
+		return
+	}
+	host := make([]byte, buf[4])
+	io.ReadFull(conn, host)
+	io.ReadFull(conn, buf[:2])
+	port := binary.BigEndian.Uint16(buf[:2])
+
+	target, err := net.Dial("tcp", net.JoinHostPort(string(host), strconv.Itoa(int(port))))
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	atomic.AddInt32(&s.connected, 1)
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+	go io.Copy(target, conn)
+	io.Copy(conn, target)
+}
+
+func TestSetSOCKS5Proxy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"wm_version":"2.1.0","wurfl_api_version":"1.12","wurfl_info":"wurfl.zip","static_caps":["brand_name"]}`))
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	// the host name is resolved by the proxy
+	client.host = "localhost"
+
+	proxy := newSOCKS5Server(t, "wm", "secret")
+	defer proxy.listener.Close()
+
+	require.Nil(t, client.SetSOCKS5Proxy(proxy.listener.Addr().String(), "wm", "secret"))
+	_, err := client.GetInfoContext(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&proxy.connected))
+
+	require.Nil(t, client.SetSOCKS5Proxy(proxy.listener.Addr().String(), "wm", "wrong"))
+	_, err = client.GetInfoContext(context.Background())
+	require.NotNil(t, err)
+
+	// the proxy is kept when the http client is created again
+	client.SetHTTPTimeout(5, 5)
+	_, err = client.GetInfoContext(context.Background())
+	require.NotNil(t, err)
+
+	require.Nil(t, client.SetSOCKS5Proxy("", "", ""))
+	_, err = client.GetInfoContext(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&proxy.connected))
+
+	require.NotNil(t, client.SetSOCKS5Proxy("no port", "", ""))
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// SetServeStaleOnTimeout enables or disables serving stale data on timeout. When enabled, if a cached lookup fails because
+// its context deadline or the HTTP transfer timeout is exceeded, and the cache holds an expired entry for the same lookup, the
+// expired device is returned without error; its Metadata has the Stale flag set. Entries expire only if a cache TTL has been
+// set with SetCacheTTL. This function should be called before performing any lookup
+func (c *WmClient) SetServeStaleOnTimeout(enabled bool) {
+	if c == nil {
+		return
+	}
+	c.serveStale = enabled
+}
+
+// isTimeout returns true if the given lookup error is due to a context deadline or a network timeout
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// getStaleFromUserAgentCache returns a stale copy of the device cached, even if expired, for the given key
+func (c *WmClient) getStaleFromUserAgentCache(key string) (*JSONDeviceData, bool) {
+	c.lruUserAgentCS.Lock()
+	defer c.lruUserAgentCS.Unlock()
+
+	value, ok := c.userAgentCache.Get(key)
+	if !ok || value.(*cacheEntry).err != nil {
+		return nil, false
+	}
+	return staleCopy(value.(*cacheEntry).device), true
+}
+
+// getStaleFromDeviceCache returns a stale copy of the device cached, even if expired, for the given wurfl_id
+func (c *WmClient) getStaleFromDeviceCache(deviceID string) (*JSONDeviceData, bool) {
+	c.lruDeviceCS.Lock()
+	defer c.lruDeviceCS.Unlock()
+
+	value, ok := c.deviceCache.Get(deviceID)
+	if !ok || value.(*cacheEntry).err != nil {
+		return nil, false
+	}
+	return staleCopy(value.(*cacheEntry).device), true
+}
+
+// staleCopy returns a copy of the given cached device with the Stale flag set, the cached device is shared and not modified
+func staleCopy(device *JSONDeviceData) *JSONDeviceData {
+	stale := *device
+	metadata := ResponseMetadata{}
+	if device.Metadata != nil {
+		metadata = *device.Metadata
+	}
+	metadata.Stale = true
+	stale.Metadata = &metadata
+	return &stale
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeStaleOnTimeout(t *testing.T) {
+	// the server replies to the first request of each endpoint, then it hangs until the test ends
+	var uaRequests, idRequests int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter := &uaRequests
+		if r.URL.Path == lookupDeviceIDPath {
+			counter = &idRequests
+		}
+		if atomic.AddInt32(counter, 1) > 1 {
+			<-release
+			return
+		}
+		w.Write([]byte(`{"capabilities":{"wurfl_id":"generic"}}`))
+	}))
+	defer server.Close()
+	defer close(release)
+	client := newTestClient(t, server)
+	client.ImportantHeaders = []string{userAgentHeader}
+	client.SetCacheSize(100)
+	require.Nil(t, client.SetCacheTTL(time.Millisecond, 0))
+
+	_, err := client.LookupUserAgent(context.Background(), "ua")
+	require.Nil(t, err)
+	_, err = client.LookupDeviceID(context.Background(), "generic")
+	require.Nil(t, err)
+	time.Sleep(5 * time.Millisecond)
+
+	lookupWithTimeout := func(lookup func(ctx context.Context) (*JSONDeviceData, error)) (*JSONDeviceData, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		return lookup(ctx)
+	}
+	lookupUserAgent := func(ctx context.Context) (*JSONDeviceData, error) { return client.LookupUserAgent(ctx, "ua") }
+	lookupDeviceID := func(ctx context.Context) (*JSONDeviceData, error) { return client.LookupDeviceID(ctx, "generic") }
+
+	// expired entries are not served by default
+	_, err = lookupWithTimeout(lookupUserAgent)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	client.SetServeStaleOnTimeout(true)
+	for _, lookup := range []func(ctx context.Context) (*JSONDeviceData, error){lookupUserAgent, lookupDeviceID} {
+		device, err := lookupWithTimeout(lookup)
+		require.Nil(t, err)
+		require.Equal(t, "generic", device.DeviceID)
+		require.True(t, device.Metadata.Stale)
+	}
+
+	// the cached device is not flagged
+	cached, ok := client.deviceCache.Get("generic")
+	require.True(t, ok)
+	metadata := cached.(*cacheEntry).device.Metadata
+	require.True(t, metadata == nil || !metadata.Stale)
+}
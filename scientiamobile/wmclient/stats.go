@@ -0,0 +1,65 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+// StatsHook receives the events generated by the client internals. Events are passed as values of the *Event types
+// declared in this package (ie: CacheTuningEvent), so that new event types can be added without changing the hook signature.
+// The hook may be called concurrently by multiple goroutines and must not block.
+type StatsHook func(event interface{})
+
+// CacheTuningEvent is sent to the stats hook every time the cache auto-tuning evaluates the UA cache usage
+type CacheTuningEvent struct {
+	PreviousSize int     // UA cache size before the evaluation
+	NewSize      int     // UA cache size after the evaluation. It's equal to PreviousSize if no change has been made
+	Entries      int     // number of entries in the UA cache at evaluation time
+	Hits         uint64  // UA cache hits since the previous evaluation
+	Misses       uint64  // UA cache misses since the previous evaluation
+	Evictions    uint64  // UA cache evictions since the previous evaluation
+	HitRatio     float64 // Hits / (Hits + Misses), 0 if no lookup has been done
+}
+
+// CacheStats holds the UA cache counters since the client creation
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// SetStatsHook sets the hook that receives the client internal events. A nil hook disables events.
+// This function should be called before performing any lookup
+func (c *WmClient) SetStatsHook(hook StatsHook) {
+	if c == nil {
+		return
+	}
+	c.statsHook = hook
+}
+
+// GetCacheStats returns the UA cache hits, misses and evictions counted since the client creation
+func (c *WmClient) GetCacheStats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.lruUserAgentCS.Lock()
+	defer c.lruUserAgentCS.Unlock()
+	return CacheStats{Hits: c.uaCacheHits, Misses: c.uaCacheMisses, Evictions: c.uaCacheEvictions}
+}
+
+// emitStats sends the given event to the stats hook, if one is set
+func (c *WmClient) emitStats(event interface{}) {
+	if c.statsHook != nil {
+		c.statsHook(event)
+	}
+}
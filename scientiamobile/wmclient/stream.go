@@ -0,0 +1,94 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// streamArray gets the JSON array returned by the given WM server path and decodes its elements one at a time, as they
+// are received, into the values returned by newEntry, passing each of them to yield. Decoding stops when yield returns
+// false. Unlike the other requests, the response is not read in full, so the configured response formats, retry policy and
+// concurrency limit do not apply
+func (c *WmClient) streamArray(ctx context.Context, path string, newEntry func() interface{}, yield func(entry interface{}) bool) error {
+	if c == nil {
+		return ErrNilClient
+	}
+	if c.httpClient == nil {
+		return ErrClientNotInitialized
+	}
+	httpreq, err := http.NewRequest("GET", c.createURL(path), nil)
+	if err != nil {
+		return err
+	}
+	httpreq.Header.Set("Accept", FormatJSON)
+	if bypassesCache(ctx) {
+		httpreq.Header.Set("Cache-Control", "no-cache")
+	}
+	if c.requestDecorator != nil {
+		if derr := c.requestDecorator(httpreq); derr != nil {
+			return derr
+		}
+	}
+
+	res, err := c.httpClient.Do(httpreq.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		data := JSONDeviceData{Error: http.StatusText(res.StatusCode)}
+		return newServerError(&data, res.StatusCode, false)
+	}
+
+	decoder := json.NewDecoder(res.Body)
+	token, err := decoder.Token()
+	if err != nil {
+		return c.streamDecodeError(res, decoder, err)
+	}
+	if token != json.Delim('[') {
+		return fmt.Errorf("unexpected %v at the start of the %s response, an array was expected", token, path)
+	}
+	for decoder.More() {
+		entry := newEntry()
+		if err = decoder.Decode(entry); err != nil {
+			return c.streamDecodeError(res, decoder, err)
+		}
+		if !yield(entry) {
+			return nil
+		}
+	}
+	if _, err = decoder.Token(); err != nil {
+		return c.streamDecodeError(res, decoder, err)
+	}
+	return nil
+}
+
+// streamDecodeError returns a *DecodeError, holding the data buffered by the given decoder, if the given decoding error is
+// due to the payload. Errors reading the response body, ie: a cancelled context, are returned unchanged
+func (c *WmClient) streamDecodeError(res *http.Response, decoder *json.Decoder, err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr) && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	return c.newDecodeError(res, bufferedSnippet(decoder.Buffered()), 0, err)
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import "strings"
+
+// CapabilitiesReport tells how the capability names given to SetRequestedCapabilitiesStrict have been handled
+type CapabilitiesReport struct {
+	Static   []string // names accepted as static capabilities
+	Virtual  []string // names accepted as virtual capabilities
+	Rejected []string // names unknown to WM server, which are not requested
+}
+
+// UnknownCapabilitiesError is returned by SetRequestedCapabilitiesStrict, in strict mode, when some of the given names are
+// unknown to WM server
+type UnknownCapabilitiesError struct {
+	Names []string
+}
+
+func (e *UnknownCapabilitiesError) Error() string {
+	return "capabilities unknown to WM server: " + strings.Join(e.Names, ", ")
+}
+
+// SetRequestedCapabilitiesStrict works like SetRequestedCapabilities, but it returns a report of the accepted and rejected
+// capability names instead of silently discarding the unknown ones. If strict is true and any name is rejected, the requested
+// capabilities are not changed and an *UnknownCapabilitiesError is returned together with the report
+func (c *WmClient) SetRequestedCapabilitiesStrict(CapsList []string, strict bool) (*CapabilitiesReport, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	report := &CapabilitiesReport{}
+	report.Static, report.Virtual = c.splitCapabilities(CapsList)
+
+	seen := make(map[string]bool, len(CapsList))
+	for _, name := range CapsList {
+		if !seen[name] && !c.HasStaticCapability(name) && !c.HasVirtualCapability(name) {
+			report.Rejected = append(report.Rejected, name)
+		}
+		seen[name] = true
+	}
+
+	if strict && len(report.Rejected) > 0 {
+		return report, &UnknownCapabilitiesError{Names: report.Rejected}
+	}
+	c.SetRequestedCapabilities(CapsList)
+	return report, nil
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetRequestedCapabilitiesStrict(t *testing.T) {
+	client := &WmClient{StaticCaps: []string{"brand_name", "model_name"}, VirtualCaps: []string{"form_factor", "is_mobile"}}
+
+	report, err := client.SetRequestedCapabilitiesStrict([]string{"brand_name", "is_mobile", "brnad_name", "brnad_name"}, true)
+	require.Equal(t, &CapabilitiesReport{Static: []string{"brand_name"}, Virtual: []string{"is_mobile"}, Rejected: []string{"brnad_name"}}, report)
+	var unknown *UnknownCapabilitiesError
+	require.True(t, errors.As(err, &unknown))
+	require.Equal(t, []string{"brnad_name"}, unknown.Names)
+	require.Equal(t, "capabilities unknown to WM server: brnad_name", err.Error())
+	// nothing changed
+	require.Nil(t, client.requestedStaticCaps)
+	require.Nil(t, client.requestedVirtualCaps)
+
+	report, err = client.SetRequestedCapabilitiesStrict([]string{"model_name", "form_factor", "unknown"}, false)
+	require.Nil(t, err)
+	require.Equal(t, []string{"unknown"}, report.Rejected)
+	require.Equal(t, []string{"model_name"}, client.requestedStaticCaps)
+	require.Equal(t, []string{"form_factor"}, client.requestedVirtualCaps)
+
+	report, err = client.SetRequestedCapabilitiesStrict([]string{"brand_name"}, true)
+	require.Nil(t, err)
+	require.Empty(t, report.Rejected)
+	require.Equal(t, []string{"brand_name"}, client.requestedStaticCaps)
+	require.Empty(t, client.requestedVirtualCaps)
+}
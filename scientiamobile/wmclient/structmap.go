@@ -0,0 +1,103 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// capabilityTag is the struct tag that maps a struct field to a capability, see JSONDeviceData.ToStruct
+const capabilityTag = "wurfl"
+
+// ToStruct sets the fields of the struct pointed by out to the device capabilities named by their `wurfl` tags, ie:
+//
+//	type Device struct {
+//		Brand        string `wurfl:"brand_name"`
+//		IsSmartphone bool   `wurfl:"is_smartphone"`
+//		Width        int    `wurfl:"resolution_width"`
+//	}
+//
+// Values are converted to the field type, which can be string, bool, any int, uint or float type. Fields without the tag
+// and fields whose capability is not in the device data are left unchanged. An error is returned if a value cannot be
+// converted to its field type
+func (d *JSONDeviceData) ToStruct(out interface{}) error {
+	value := reflect.ValueOf(out)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return errors.New("ToStruct requires a non nil pointer to a struct")
+	}
+
+	value = value.Elem()
+	structType := value.Type()
+	for i := 0; i < structType.NumField(); i++ {
+		name, ok := structType.Field(i).Tag.Lookup(capabilityTag)
+		if !ok || name == "" || name == "-" {
+			continue
+		}
+		capValue, ok := d.Capabilities[name]
+		if name == wurflIDCapability {
+			capValue, ok = deviceID(d), deviceID(d) != ""
+		}
+		if !ok {
+			continue
+		}
+		if err := setField(value.Field(i), capValue); err != nil {
+			return fmt.Errorf("cannot set field %s to capability %s: %v", structType.Field(i).Name, name, err)
+		}
+	}
+	return nil
+}
+
+// setField sets the given field to the given capability value, converted to the field type
+func setField(field reflect.Value, capValue string) error {
+	if !field.CanSet() {
+		return errors.New("field is not exported")
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(capValue)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(capValue)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(capValue, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(capValue, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(capValue, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testDevice struct {
+	ID           string  `wurfl:"wurfl_id"`
+	Brand        string  `wurfl:"brand_name"`
+	IsSmartphone bool    `wurfl:"is_smartphone"`
+	Width        int     `wurfl:"resolution_width"`
+	Height       uint16  `wurfl:"resolution_height"`
+	Density      float64 `wurfl:"density_class"`
+	Missing      string  `wurfl:"marketing_name"`
+	Untagged     string
+}
+
+func TestToStruct(t *testing.T) {
+	device := &JSONDeviceData{
+		DeviceID: "apple_iphone_ver16",
+		Capabilities: map[string]string{
+			"brand_name":        "Apple",
+			"is_smartphone":     "true",
+			"resolution_width":  "1170",
+			"resolution_height": "2532",
+			"density_class":     "3.0",
+		},
+	}
+
+	out := testDevice{Missing: "unchanged", Untagged: "unchanged"}
+	require.Nil(t, device.ToStruct(&out))
+	require.Equal(t, testDevice{ID: "apple_iphone_ver16", Brand: "Apple", IsSmartphone: true, Width: 1170, Height: 2532,
+		Density: 3.0, Missing: "unchanged", Untagged: "unchanged"}, out)
+
+	// values that cannot be converted
+	device.Capabilities["resolution_height"] = "100000"
+	require.NotNil(t, device.ToStruct(&out))
+	device.Capabilities["resolution_height"] = "2532"
+	device.Capabilities["is_smartphone"] = "maybe"
+	require.NotNil(t, device.ToStruct(&out))
+
+	require.NotNil(t, device.ToStruct(out))
+	require.NotNil(t, device.ToStruct((*testDevice)(nil)))
+	unsupported := struct {
+		Sizes []int `wurfl:"resolution_width"`
+	}{}
+	require.NotNil(t, device.ToStruct(&unsupported))
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+
+	"github.com/golang/groupcache/lru"
+)
+
+// lookupTACPath is the WM server endpoint used by LookupTAC
+const lookupTACPath = "/v2/lookuptac/json"
+
+const tacDefaultCacheSize = 20000
+
+// LookupTAC - Searches WURFL device data using the given TAC (Type Allocation Code, the first 8 digits of an IMEI)
+func (c *WmClient) LookupTAC(ctx context.Context, tac string) (*JSONDeviceData, error) {
+	return c.lookupTAC(ctx, tac, true)
+}
+
+// LookupTACUncached - works like LookupTAC, but it never reads from nor writes to the client cache
+func (c *WmClient) LookupTACUncached(ctx context.Context, tac string) (*JSONDeviceData, error) {
+	return c.lookupTAC(ctx, tac, false)
+}
+
+func (c *WmClient) lookupTAC(ctx context.Context, tac string, useCache bool) (*JSONDeviceData, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	c.lruTacCS.Lock()
+	useCache = useCache && c.tacCache != nil && !bypassesCache(ctx)
+	c.lruTacCS.Unlock()
+
+	if useCache {
+		if jdd, ok := c.getFromTacCache(tac); ok {
+			return jdd, nil
+		}
+	}
+
+	jsonRequest := Request{TacCode: tac, RequestedCaps: c.requestedStaticCaps, RequestedVCaps: c.requestedVirtualCaps}
+	deviceData, err := c.internalLookup(ctx, jsonRequest, lookupTACPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// check if server WURFL.xml has been updated and, if so, clear caches
+	c.clearCachesIfNeeded(deviceData.Ltime)
+	if useCache {
+		c.addToTacCache(tac, deviceData)
+	}
+	return deviceData, nil
+}
+
+// getFromTacCache returns the device cached for the given TAC, if any
+func (c *WmClient) getFromTacCache(tac string) (*JSONDeviceData, bool) {
+	c.lruTacCS.Lock()
+	defer c.lruTacCS.Unlock()
+
+	value, ok := c.tacCache.Get(tac)
+	if !ok || value.(*cacheEntry).expired() {
+		return nil, false
+	}
+	return value.(*cacheEntry).device, true
+}
+
+// addToTacCache adds the given device to the TAC cache
+func (c *WmClient) addToTacCache(tac string, device *JSONDeviceData) {
+	entry := c.newCacheEntry(device)
+	c.lruTacCS.Lock()
+	if c.tacCache != nil {
+		c.tacCache.Add(tac, entry)
+	}
+	c.lruTacCS.Unlock()
+}
+
+// clearTacCache swaps the TAC cache with an empty one of the same size
+func (c *WmClient) clearTacCache() {
+	c.lruTacCS.Lock()
+	if c.tacCache != nil && c.tacCache.Len() > 0 {
+		c.tacCache = lru.New(c.tacCache.MaxEntries)
+	}
+	c.lruTacCS.Unlock()
+}
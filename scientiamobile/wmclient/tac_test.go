@@ -0,0 +1,67 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupTAC(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		require.Equal(t, lookupTACPath, r.URL.Path)
+		var request Request
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&request))
+		if request.TacCode == "35332510" {
+			json.NewEncoder(w).Encode(JSONDeviceData{APIVersion: "2.1.0", Capabilities: map[string]string{"wurfl_id": "apple_iphone_ver13", "brand_name": "Apple"}})
+		} else {
+			json.NewEncoder(w).Encode(JSONDeviceData{APIVersion: "2.1.0", Error: "TAC not found"})
+		}
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.SetCacheSize(100)
+
+	for i := 0; i < 2; i++ {
+		device, err := client.LookupTAC(context.Background(), "35332510")
+		require.Nil(t, err)
+		require.Equal(t, "Apple", device.Capabilities["brand_name"])
+		require.Equal(t, "apple_iphone_ver13", device.DeviceID)
+	}
+	// the second lookup is read from the TAC cache
+	require.Equal(t, 1, requests)
+
+	_, err := client.LookupTACUncached(context.Background(), "35332510")
+	require.Nil(t, err)
+	require.Equal(t, 2, requests)
+
+	device, err := client.LookupTAC(context.Background(), "00000000")
+	require.Nil(t, device)
+	require.True(t, errors.Is(err, ErrDeviceNotFound))
+
+	client.clearCache(CacheClearManual)
+	_, err = client.LookupTAC(context.Background(), "35332510")
+	require.Nil(t, err)
+	require.Equal(t, 4, requests)
+}
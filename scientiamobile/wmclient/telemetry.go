@@ -0,0 +1,195 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// telemetryMaxDeviceIDs is the number of distinct wurfl_ids counted by the telemetry: the lookups of other devices are only
+// counted in TelemetryReport.OtherDevices, so that the report size is bounded
+const telemetryMaxDeviceIDs = 10000
+
+// TelemetryReport summarizes the outcome of a sample of the lookups, to review the detection accuracy, ie: to decide whether
+// a WURFL data update is needed, or to plan the capacity of the cache and WM server. It holds no user agent, header or
+// other request data and it is never sent anywhere by the client: operators can write it with WriteTelemetryReport and
+// forward it as they wish
+type TelemetryReport struct {
+	Since        time.Time       `json:"since"`         // telemetry start or last reset
+	Until        time.Time       `json:"until"`         // report time
+	SampleRate   float64         `json:"sample_rate"`   // fraction of the lookups sampled
+	Lookups      uint64          `json:"lookups"`       // lookups done, sampled or not
+	Sampled      uint64          `json:"sampled"`       // sampled lookups
+	Errors       uint64          `json:"errors"`        // sampled lookups that failed
+	Unknown      uint64          `json:"unknown"`       // sampled lookups detected as the generic root device
+	UnknownRate  float64         `json:"unknown_rate"`  // Unknown / (Sampled - Errors), 0 if no device has been sampled
+	Devices      []DeviceIDCount `json:"devices"`       // sampled lookups by wurfl_id, the most frequent first
+	OtherDevices uint64          `json:"other_devices"` // sampled lookups of the wurfl_ids beyond the first 10000
+	Ltime        string          `json:"ltime"`         // load time of the WURFL file used for the detections
+}
+
+// DeviceIDCount is the number of sampled lookups that detected a device
+type DeviceIDCount struct {
+	WurflID string `json:"wurfl_id"`
+	Count   uint64 `json:"count"`
+}
+
+// detectionTelemetry holds the telemetry counters
+type detectionTelemetry struct {
+	enabled      int32      // set to 1, atomically, when the telemetry is enabled, so that disabled telemetry costs no locking
+	mutex        sync.Mutex // protects the fields below
+	sampleRate   float64
+	since        time.Time
+	lookups      uint64
+	sampled      uint64
+	errors       uint64
+	unknown      uint64
+	devices      map[string]uint64
+	otherDevices uint64
+}
+
+// SetTelemetrySampleRate enables the detection telemetry, sampling the given fraction of the lookups, ie: 0.01 samples one
+// lookup out of 100. A rate <= 0, the default, disables it; rates above 1 sample every lookup. The counters are kept when
+// the rate changes and reset when the telemetry is disabled. Lookups done with LookupDeviceID are not counted, since they
+// do not detect a device. See GetTelemetryReport
+func (c *WmClient) SetTelemetrySampleRate(rate float64) {
+	if c == nil {
+		return
+	}
+	if rate > 1 {
+		rate = 1
+	}
+	c.telemetry.mutex.Lock()
+	defer c.telemetry.mutex.Unlock()
+	if rate <= 0 {
+		c.telemetry.reset(0)
+		return
+	}
+	if c.telemetry.sampleRate <= 0 {
+		c.telemetry.reset(rate)
+	}
+	c.telemetry.sampleRate = rate
+}
+
+// GetTelemetryReport returns the detection telemetry collected since it has been enabled or reset
+func (c *WmClient) GetTelemetryReport() TelemetryReport {
+	if c == nil {
+		return TelemetryReport{}
+	}
+	c.ltimeMutex.Lock()
+	ltime := c.clientLtime
+	c.ltimeMutex.Unlock()
+
+	t := &c.telemetry
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	report := TelemetryReport{Since: t.since, Until: time.Now(), SampleRate: t.sampleRate, Lookups: t.lookups, Sampled: t.sampled,
+		Errors: t.errors, Unknown: t.unknown, Devices: make([]DeviceIDCount, 0, len(t.devices)), OtherDevices: t.otherDevices,
+		Ltime: ltime}
+	if detected := t.sampled - t.errors; detected > 0 {
+		report.UnknownRate = float64(t.unknown) / float64(detected)
+	}
+	for id, count := range t.devices {
+		report.Devices = append(report.Devices, DeviceIDCount{WurflID: id, Count: count})
+	}
+	sort.Slice(report.Devices, func(i, j int) bool {
+		if report.Devices[i].Count != report.Devices[j].Count {
+			return report.Devices[i].Count > report.Devices[j].Count
+		}
+		return report.Devices[i].WurflID < report.Devices[j].WurflID
+	})
+	return report
+}
+
+// WriteTelemetryReport writes the detection telemetry report to w, as indented JSON
+func (c *WmClient) WriteTelemetryReport(w io.Writer) error {
+	if c == nil {
+		return ErrNilClient
+	}
+	if w == nil {
+		return errors.New("nil telemetry report writer")
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(c.GetTelemetryReport())
+}
+
+// ResetTelemetry clears the detection telemetry counters, ie: after a report has been forwarded
+func (c *WmClient) ResetTelemetry() {
+	if c == nil {
+		return
+	}
+	c.telemetry.mutex.Lock()
+	defer c.telemetry.mutex.Unlock()
+	c.telemetry.reset(c.telemetry.sampleRate)
+}
+
+// reset clears the counters and sets the sample rate. It must be called holding the mutex
+func (t *detectionTelemetry) reset(rate float64) {
+	t.sampleRate = rate
+	t.since = time.Now()
+	t.lookups, t.sampled, t.errors, t.unknown, t.otherDevices = 0, 0, 0, 0, 0
+	t.devices = nil
+	if rate > 0 {
+		atomic.StoreInt32(&t.enabled, 1)
+	} else {
+		atomic.StoreInt32(&t.enabled, 0)
+	}
+}
+
+// recordTelemetry counts the outcome of a lookup, if the telemetry is enabled and the lookup is sampled
+func (c *WmClient) recordTelemetry(device *JSONDeviceData, err error) {
+	t := &c.telemetry
+	if atomic.LoadInt32(&t.enabled) == 0 {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.sampleRate <= 0 {
+		return
+	}
+	t.lookups++
+	if t.sampleRate < 1 && c.rnd.float64() >= t.sampleRate {
+		return
+	}
+
+	t.sampled++
+	if err != nil || device == nil {
+		t.errors++
+		return
+	}
+	id := deviceID(device)
+	if id == "" || id == "generic" {
+		t.unknown++
+	}
+	if id == "" {
+		return
+	}
+	if _, ok := t.devices[id]; !ok && len(t.devices) >= telemetryMaxDeviceIDs {
+		t.otherDevices++
+		return
+	}
+	if t.devices == nil {
+		t.devices = make(map[string]uint64)
+	}
+	t.devices[id]++
+}
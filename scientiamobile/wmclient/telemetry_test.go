@@ -0,0 +1,122 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTelemetry(t *testing.T) {
+	// the user agent is the wurfl_id of the detected device
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/getinfo/json" {
+			json.NewEncoder(w).Encode(JSONInfoData{WmVersion: "2.1.0", WurflAPIVersion: "1.12", WurflInfo: "wurfl.zip", Ltime: "1",
+				ImportantHeaders: []string{userAgentHeader}, StaticCaps: []string{"brand_name"}})
+			return
+		}
+		if r.URL.Path == lookupUserAgentBatchPath {
+			batch := BatchRequest{}
+			json.NewDecoder(r.Body).Decode(&batch)
+			response := BatchResponse{}
+			for _, request := range batch.Requests {
+				response.Devices = append(response.Devices, JSONDeviceData{
+					Capabilities: map[string]string{"wurfl_id": request.LookupHeaders[userAgentHeader]}, Ltime: "1"})
+			}
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		request := Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+		json.NewEncoder(w).Encode(JSONDeviceData{Capabilities: map[string]string{"wurfl_id": request.LookupHeaders[userAgentHeader]},
+			Ltime: "1"})
+	}))
+	defer server.Close()
+	client, err := CreateFromURL(server.URL, WithCache(100))
+	require.Nil(t, err)
+	defer client.Close()
+
+	// disabled by default
+	_, err = client.LookupUserAgent(context.Background(), "generic")
+	require.Nil(t, err)
+	require.Equal(t, uint64(0), client.GetTelemetryReport().Lookups)
+
+	client.SetTelemetrySampleRate(1)
+	for _, userAgent := range []string{"apple_iphone_ver13", "generic", "apple_iphone_ver13", "samsung_sm_g991b", "apple_iphone_ver13"} {
+		_, err = client.LookupUserAgent(context.Background(), userAgent)
+		require.Nil(t, err)
+	}
+	for _, result := range client.LookupUserAgentBatch(context.Background(), []string{"samsung_sm_g991b", "google_pixel_6"}, 1) {
+		require.Nil(t, result.Err)
+	}
+	client.recordTelemetry(nil, ErrNilClient)
+
+	report := client.GetTelemetryReport()
+	require.Equal(t, uint64(8), report.Lookups)
+	require.Equal(t, uint64(8), report.Sampled)
+	require.Equal(t, uint64(1), report.Errors)
+	require.Equal(t, uint64(1), report.Unknown)
+	require.Equal(t, 1.0/7, report.UnknownRate)
+	require.Equal(t, []DeviceIDCount{{"apple_iphone_ver13", 3}, {"samsung_sm_g991b", 2}, {"generic", 1}, {"google_pixel_6", 1}},
+		report.Devices)
+	require.Equal(t, "1", report.Ltime)
+
+	// the report holds no user agent other than the wurfl_ids
+	var buffer bytes.Buffer
+	require.Nil(t, client.WriteTelemetryReport(&buffer))
+	var written TelemetryReport
+	require.Nil(t, json.Unmarshal(buffer.Bytes(), &written))
+	require.Equal(t, report.Devices, written.Devices)
+
+	client.ResetTelemetry()
+	report = client.GetTelemetryReport()
+	require.Equal(t, uint64(0), report.Lookups)
+	require.Empty(t, report.Devices)
+	require.Equal(t, 1.0, report.SampleRate)
+
+	// only a fraction of the lookups is sampled
+	client.SetRandSource(rand.NewSource(42))
+	client.SetTelemetrySampleRate(0.1)
+	for i := 0; i < 1000; i++ {
+		client.recordTelemetry(&JSONDeviceData{DeviceID: "apple_iphone_ver13"}, nil)
+	}
+	report = client.GetTelemetryReport()
+	require.Equal(t, uint64(1000), report.Lookups)
+	require.InDelta(t, 100, report.Sampled, 40)
+
+	client.SetTelemetrySampleRate(0)
+	client.recordTelemetry(&JSONDeviceData{DeviceID: "apple_iphone_ver13"}, nil)
+	require.Equal(t, uint64(0), client.GetTelemetryReport().Lookups)
+}
+
+func TestTelemetryDeviceLimit(t *testing.T) {
+	client := &WmClient{}
+	client.SetTelemetrySampleRate(1)
+	for i := 0; i < telemetryMaxDeviceIDs+5; i++ {
+		client.recordTelemetry(&JSONDeviceData{DeviceID: fmt.Sprintf("device_%d", i)}, nil)
+	}
+	report := client.GetTelemetryReport()
+	require.Len(t, report.Devices, telemetryMaxDeviceIDs)
+	require.Equal(t, uint64(5), report.OtherDevices)
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// sizecheck is a minimal program detecting a device, built by TestLiteBuildSize to check the size of the client binaries
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/wurfl/wurfl-microservice-client-golang/v2/scientiamobile/wmclient"
+)
+
+func main() {
+	client, err := wmclient.Create("http", "localhost", "8080", "")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer client.Close()
+
+	device, err := client.LookupUserAgent(context.Background(), "Mozilla/5.0")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(device.Capabilities["wurfl_id"])
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// The TLS options below build the TLS configuration used to connect to WM servers using a private PKI. They can be combined
+// with each other and applied after WithTLS, which sets the base configuration. Like WithTLS, they make the client use the
+// https scheme and cannot be used with WithHTTPClient
+
+// WithCAFile makes the client trust the CA certificates of the given PEM file, ie: the CA bundle of a private PKI, in
+// addition to the system ones
+func WithCAFile(path string) Option {
+	return func(options *clientOptions) {
+		pemCerts, err := ioutil.ReadFile(path)
+		if err != nil {
+			options.setError(fmt.Errorf("cannot read the CA file: %w", err))
+			return
+		}
+		if err = options.addCACertificates(pemCerts); err != nil {
+			options.setError(fmt.Errorf("invalid CA file %s: %w", path, err))
+		}
+	}
+}
+
+// WithCACertificates makes the client trust the given PEM encoded CA certificates, in addition to the system ones
+func WithCACertificates(pemCerts []byte) Option {
+	return func(options *clientOptions) {
+		if err := options.addCACertificates(pemCerts); err != nil {
+			options.setError(fmt.Errorf("invalid CA certificates: %w", err))
+		}
+	}
+}
+
+// WithClientCertificate makes the client present the certificate of the given PEM files to WM server, for deployments
+// requiring mutual TLS, ie: behind a gateway authenticating clients by their certificate
+func WithClientCertificate(certFile string, keyFile string) Option {
+	return func(options *clientOptions) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			options.setError(fmt.Errorf("cannot load the client certificate: %w", err))
+			return
+		}
+		options.addClientCertificate(cert)
+	}
+}
+
+// WithClientKeyPair makes the client present the given PEM encoded certificate and key to WM server, as WithClientCertificate
+// does, when they are not stored in files, ie: when they are read from a secret manager
+func WithClientKeyPair(certPEM []byte, keyPEM []byte) Option {
+	return func(options *clientOptions) {
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			options.setError(fmt.Errorf("invalid client certificate: %w", err))
+			return
+		}
+		options.addClientCertificate(cert)
+	}
+}
+
+// WithClientTLSCertificate makes the client present the given certificate to WM server, as WithClientCertificate does. Its
+// private key can be any crypto.Signer, ie: one kept in a hardware module
+func WithClientTLSCertificate(cert tls.Certificate) Option {
+	return func(options *clientOptions) {
+		options.addClientCertificate(cert)
+	}
+}
+
+// WithClientCertificateFunc makes the client ask the given function for the certificate to present to WM server on each
+// handshake, so that a certificate renewed while the client runs is used by the following connections. It replaces the
+// certificates given with the other client certificate options
+func WithClientCertificateFunc(getCertificate func(*tls.CertificateRequestInfo) (*tls.Certificate, error)) Option {
+	return func(options *clientOptions) {
+		options.tls().GetClientCertificate = getCertificate
+	}
+}
+
+// WithServerName sets the name verified in the WM server certificate and sent with SNI, instead of the host, ie: when WM
+// server is reached through its IP address or a tunnel
+func WithServerName(serverName string) Option {
+	return func(options *clientOptions) {
+		options.tls().ServerName = serverName
+	}
+}
+
+// WithInsecureSkipVerify disables the verification of the WM server certificate chain and name. Connections are then
+// exposed to man-in-the-middle attacks: it is meant for tests and development setups only, where the server uses a
+// self-signed certificate. Trusting the certificate with WithCAFile or WithCACertificates is preferable
+func WithInsecureSkipVerify() Option {
+	return func(options *clientOptions) {
+		options.tls().InsecureSkipVerify = true
+	}
+}
+
+// tls returns the TLS configuration being built by the options, creating it if needed, and makes the client use https
+func (options *clientOptions) tls() *tls.Config {
+	if options.tlsConfig == nil {
+		options.tlsConfig = &tls.Config{}
+	}
+	options.tlsSet = true
+	return options.tlsConfig
+}
+
+// addClientCertificate adds the given certificate to the ones presented by the client to WM server
+func (options *clientOptions) addClientCertificate(cert tls.Certificate) {
+	config := options.tls()
+	config.Certificates = append(config.Certificates, cert)
+}
+
+// addCACertificates adds the given PEM encoded CA certificates to the roots trusted by the TLS configuration being built
+func (options *clientOptions) addCACertificates(pemCerts []byte) error {
+	config := options.tls()
+	if config.RootCAs == nil {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			// ie: on systems where the roots cannot be read, only the given certificates are trusted
+			roots = x509.NewCertPool()
+		}
+		config.RootCAs = roots
+	}
+	if !config.RootCAs.AppendCertsFromPEM(pemCerts) {
+		return errors.New("no certificate found")
+	}
+	return nil
+}
+
+// setError records the first error found while applying the options, which is returned by CreateWithOptions
+func (options *clientOptions) setError(err error) {
+	if options.err == nil {
+		options.err = err
+	}
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testPKI is a private PKI: a CA and the certificates it has issued, as PEM files
+type testPKI struct {
+	dir    string
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	caFile string
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	dir, err := ioutil.TempDir("", "wmclient")
+	require.Nil(t, err)
+	pki := &testPKI{dir: dir}
+	pki.ca, pki.caKey, pki.caFile, _ = pki.issue(t, "ca", &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "WM test CA"},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	})
+	return pki
+}
+
+// issue creates the given certificate, signed by the CA (self-signed if the CA is not created yet), and writes it, with its
+// key, to PEM files
+func (p *testPKI) issue(t *testing.T, name string, template *x509.Certificate) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	parent, parentKey := template, key
+	if p.ca != nil {
+		parent, parentKey = p.ca, p.caKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+
+	certFile := filepath.Join(p.dir, name+".pem")
+	keyFile := filepath.Join(p.dir, name+"-key.pem")
+	require.Nil(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return cert, key, certFile, keyFile
+}
+
+func TestTLSOptions(t *testing.T) {
+	pki := newTestPKI(t)
+	defer os.RemoveAll(pki.dir)
+	_, _, serverCertFile, serverKeyFile := pki.issue(t, "server", &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "wm.internal"},
+		DNSNames:    []string{"wm.internal"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	_, _, clientCertFile, clientKeyFile := pki.issue(t, "client", &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "wm client"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	// WM server requiring a client certificate issued by the private CA
+	var lookups int32
+	server := httptest.NewUnstartedServer(newOptionsTestHandler("", &lookups))
+	serverCert, err := tls.LoadX509KeyPair(serverCertFile, serverKeyFile)
+	require.Nil(t, err)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(pki.ca)
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}, ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	// the failed handshakes below are expected
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.Nil(t, err)
+
+	// the server certificate is issued for wm.internal, not for the server IP address
+	_, err = CreateWithOptions(WithServer("", host, port), WithCAFile(pki.caFile), WithClientCertificate(clientCertFile, clientKeyFile))
+	require.NotNil(t, err)
+	// the client certificate is required
+	_, err = CreateWithOptions(WithServer("", host, port), WithCAFile(pki.caFile), WithServerName("wm.internal"))
+	require.NotNil(t, err)
+
+	client, err := CreateWithOptions(WithServer("", host, port), WithCAFile(pki.caFile), WithServerName("wm.internal"),
+		WithClientCertificate(clientCertFile, clientKeyFile))
+	require.Nil(t, err)
+	require.Equal(t, "https", client.scheme)
+	_, err = client.LookupUserAgent(context.Background(), "ua")
+	require.Nil(t, err)
+	client.Close()
+
+	caPEM, err := ioutil.ReadFile(pki.caFile)
+	require.Nil(t, err)
+	client, err = CreateWithOptions(WithServer("", host, port), WithTLS(&tls.Config{ServerName: "wm.internal"}),
+		WithCACertificates(caPEM), WithClientCertificate(clientCertFile, clientKeyFile))
+	require.Nil(t, err)
+	client.Close()
+
+	client, err = CreateWithOptions(WithServer("", host, port), WithInsecureSkipVerify(),
+		WithClientCertificate(clientCertFile, clientKeyFile))
+	require.Nil(t, err)
+	client.Close()
+
+	// client certificates not stored in files
+	clientCertPEM, err := ioutil.ReadFile(clientCertFile)
+	require.Nil(t, err)
+	clientKeyPEM, err := ioutil.ReadFile(clientKeyFile)
+	require.Nil(t, err)
+	clientCert, err := tls.X509KeyPair(clientCertPEM, clientKeyPEM)
+	require.Nil(t, err)
+	var handshakes int32
+	for _, option := range []Option{
+		WithClientKeyPair(clientCertPEM, clientKeyPEM),
+		WithClientTLSCertificate(clientCert),
+		WithClientCertificateFunc(func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			atomic.AddInt32(&handshakes, 1)
+			return &clientCert, nil
+		}),
+	} {
+		client, err = CreateWithOptions(WithServer("", host, port), WithCACertificates(caPEM), WithServerName("wm.internal"), option)
+		require.Nil(t, err)
+		_, err = client.LookupUserAgent(context.Background(), "ua")
+		require.Nil(t, err)
+		client.Close()
+	}
+	require.True(t, atomic.LoadInt32(&handshakes) > 0)
+}
+
+func TestTLSOptionsErrors(t *testing.T) {
+	pki := newTestPKI(t)
+	defer os.RemoveAll(pki.dir)
+	notPEM := filepath.Join(pki.dir, "not.pem")
+	require.Nil(t, ioutil.WriteFile(notPEM, []byte("not a certificate"), 0600))
+
+	tests := []Option{
+		WithCAFile(filepath.Join(pki.dir, "missing.pem")),
+		WithCAFile(notPEM),
+		WithCACertificates([]byte("not a certificate")),
+		WithClientCertificate(pki.caFile, notPEM),
+		WithClientKeyPair([]byte("not a certificate"), []byte("not a key")),
+	}
+	for _, option := range tests {
+		client, err := CreateWithOptions(option)
+		require.NotNil(t, err)
+		require.Nil(t, client)
+	}
+
+	_, err := CreateWithOptions(WithServerName("wm.internal"), WithHTTPClient(&http.Client{}))
+	require.EqualError(t, err, "WithTLS and the other TLS options cannot be used with WithHTTPClient")
+
+	// the configuration given to WithTLS is not changed by the following options
+	config := &tls.Config{}
+	options := clientOptions{}
+	WithTLS(config)(&options)
+	WithServerName("wm.internal")(&options)
+	WithInsecureSkipVerify()(&options)
+	require.Equal(t, "", config.ServerName)
+	require.False(t, config.InsecureSkipVerify)
+	require.Equal(t, "wm.internal", options.tlsConfig.ServerName)
+	require.True(t, options.tlsConfig.InsecureSkipVerify)
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import "strings"
+
+// TransferStats holds the size of the data exchanged with a WM server endpoint. Sizes are the ones of the request and
+// response bodies, as sent and read by the client: HTTP headers are not included and compressed responses are counted
+// after decompression
+type TransferStats struct {
+	Requests      uint64
+	BytesSent     uint64
+	BytesReceived uint64
+}
+
+// TransferEvent is sent to the stats hook after every request to WM server, ie: to relate the size of lookup responses to
+// the number of requested capabilities
+type TransferEvent struct {
+	Endpoint      string // WM server endpoint path, without the base URI
+	BytesSent     int    // size of the request body
+	BytesReceived int    // size of the response body
+}
+
+// GetTransferStats returns the size of the data exchanged with WM server since the client creation, by endpoint path.
+// The endpoints that take a parameter in the path (ie: the devices of a brand) are counted together
+func (c *WmClient) GetTransferStats() map[string]TransferStats {
+	if c == nil {
+		return nil
+	}
+	c.transferMutex.Lock()
+	defer c.transferMutex.Unlock()
+
+	stats := make(map[string]TransferStats, len(c.transfers))
+	for endpoint, transfer := range c.transfers {
+		stats[endpoint] = *transfer
+	}
+	return stats
+}
+
+// addTransfer accounts a request to the given WM server path
+func (c *WmClient) addTransfer(path string, sent int, received int) {
+	endpoint := path
+	if strings.HasPrefix(path, devicesForMakePath) {
+		endpoint = devicesForMakePath
+	}
+
+	c.transferMutex.Lock()
+	if c.transfers == nil {
+		c.transfers = make(map[string]*TransferStats)
+	}
+	transfer, ok := c.transfers[endpoint]
+	if !ok {
+		transfer = &TransferStats{}
+		c.transfers[endpoint] = transfer
+	}
+	transfer.Requests++
+	transfer.BytesSent += uint64(sent)
+	transfer.BytesReceived += uint64(received)
+	c.transferMutex.Unlock()
+
+	c.emitStats(TransferEvent{Endpoint: endpoint, BytesSent: sent, BytesReceived: received})
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferStats(t *testing.T) {
+	server := httptest.NewServer(newBatchTestHandler(false, make(map[string]int)))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.ImportantHeaders = []string{userAgentHeader}
+
+	var events []TransferEvent
+	client.SetStatsHook(func(event interface{}) {
+		if e, ok := event.(TransferEvent); ok {
+			events = append(events, e)
+		}
+	})
+
+	_, err := client.LookupUserAgent(context.Background(), "ua1")
+	require.Nil(t, err)
+	_, err = client.LookupUserAgent(context.Background(), "ua2")
+	require.Nil(t, err)
+	// the test server does not support the per-brand endpoint, the whole data is then requested
+	client.GetAllDevicesForMake("Apple")
+
+	require.Len(t, events, 4)
+	require.Equal(t, lookupUserAgentPath, events[0].Endpoint)
+	require.True(t, events[0].BytesSent > 0)
+	require.True(t, events[0].BytesReceived > 0)
+	require.Equal(t, devicesForMakePath, events[2].Endpoint)
+	require.Equal(t, 0, events[2].BytesSent)
+
+	stats := client.GetTransferStats()
+	require.Len(t, stats, 3)
+	lookups := stats[lookupUserAgentPath]
+	require.Equal(t, uint64(2), lookups.Requests)
+	require.Equal(t, uint64(events[0].BytesSent+events[1].BytesSent), lookups.BytesSent)
+	require.Equal(t, uint64(events[0].BytesReceived+events[1].BytesReceived), lookups.BytesReceived)
+	require.Equal(t, uint64(1), stats[devicesForMakePath].Requests)
+	require.Equal(t, uint64(1), stats["/v2/alldevices/json"].Requests)
+}
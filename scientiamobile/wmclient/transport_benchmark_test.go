@@ -0,0 +1,171 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// The transport benchmarks compare the transports to WM server in cache hit and cache miss scenarios, at several
+// concurrency levels, against a local server that replies to lookups with a fixed device. They measure the client and
+// transport overhead only, since the server does no detection: see BENCHMARKS.md to run them and for reference results.
+// gRPC is not benchmarked since WM server does not expose it, HTTP/3 is provided by the wmhttp3 module and requires a QUIC
+// server
+
+// benchmarkConcurrency lists the numbers of goroutines performing lookups at the same time
+var benchmarkConcurrency = []int{1, 8, 64}
+
+// benchmarkHitUserAgents is the number of distinct user agents looked up in the cache hit scenario
+const benchmarkHitUserAgents = 100
+
+// benchmarkTransport creates a server and a client connected to it with a given transport
+type benchmarkTransport struct {
+	name  string
+	proto int // expected HTTP major version
+	start func(server *httptest.Server) *http.Transport
+}
+
+var benchmarkTransports = []benchmarkTransport{
+	{"http1", 1, func(server *httptest.Server) *http.Transport {
+		server.Start()
+		return &http.Transport{MaxIdleConnsPerHost: 100}
+	}},
+	{"http1-tls", 1, func(server *httptest.Server) *http.Transport {
+		server.StartTLS()
+		return &http.Transport{MaxIdleConnsPerHost: 100, TLSClientConfig: benchmarkTLSConfig(server),
+			TLSNextProto: make(map[string]func(string, *tls.Conn) http.RoundTripper)}
+	}},
+	{"http2-tls", 2, func(server *httptest.Server) *http.Transport {
+		// negotiating h2 makes the test server use HTTP/2, as EnableHTTP2 does on Go >= 1.14
+		server.TLS = &tls.Config{NextProtos: []string{"h2"}}
+		server.StartTLS()
+		return &http.Transport{MaxIdleConnsPerHost: 100, TLSClientConfig: benchmarkTLSConfig(server), ForceAttemptHTTP2: true}
+	}},
+}
+
+// benchmarkTLSConfig returns a TLS configuration that trusts the certificate of the given test server
+func benchmarkTLSConfig(server *httptest.Server) *tls.Config {
+	return server.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+}
+
+func BenchmarkTransports(b *testing.B) {
+	response, err := json.Marshal(JSONDeviceData{APIVersion: "2.1.0", Ltime: "2024-01-01 00:00:00", Mtime: 1,
+		Capabilities: map[string]string{"wurfl_id": "generic_android", "brand_name": "Generic", "model_name": "Android",
+			"form_factor": "Smartphone", "is_mobile": "true", "is_smartphone": "true", "device_os": "Android"}})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, transport := range benchmarkTransports {
+		for _, scenario := range []string{"hit", "miss"} {
+			for _, concurrency := range benchmarkConcurrency {
+				name := fmt.Sprintf("transport=%s/cache=%s/concurrency=%d", transport.name, scenario, concurrency)
+				b.Run(name, func(b *testing.B) {
+					var proto int32
+					server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						atomic.StoreInt32(&proto, int32(r.ProtoMajor))
+						request := Request{}
+						json.NewDecoder(r.Body).Decode(&request)
+						w.Header().Set("Content-Type", FormatJSON)
+						w.Write(response)
+					}))
+					// handshakes interrupted when the server is closed are logged, mixing with the benchmark results
+					server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+					defer server.Close()
+					client := newBenchmarkClient(b, server, transport)
+					defer client.Close()
+
+					if scenario == "hit" {
+						for i := 0; i < benchmarkHitUserAgents; i++ {
+							if _, err := client.LookupUserAgent(context.Background(), benchmarkUserAgent(i)); err != nil {
+								b.Fatal(err)
+							}
+						}
+					}
+
+					var counter int64
+					b.ReportAllocs()
+					b.ResetTimer()
+					runConcurrently(b, concurrency, func() {
+						i := int(atomic.AddInt64(&counter, 1))
+						if scenario == "hit" {
+							i %= benchmarkHitUserAgents
+						}
+						if _, err := client.LookupUserAgent(context.Background(), benchmarkUserAgent(i)); err != nil {
+							b.Error(err)
+						}
+					})
+					b.StopTimer()
+					if got := atomic.LoadInt32(&proto); got != int32(transport.proto) {
+						b.Fatalf("requests were sent with HTTP/%d instead of HTTP/%d", got, transport.proto)
+					}
+				})
+			}
+		}
+	}
+}
+
+// newBenchmarkClient starts the given server and returns a client connected to it with the given transport
+func newBenchmarkClient(b *testing.B, server *httptest.Server, transport benchmarkTransport) *WmClient {
+	httpTransport := transport.start(server)
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	scheme := "http"
+	if server.TLS != nil {
+		scheme = "https"
+	}
+	client := &WmClient{scheme: scheme, host: host, port: port, httpClient: createHTTPClient(defaultConnTimeout, defaultTransferTimeout),
+		ImportantHeaders: []string{userAgentHeader}}
+	client.httpClient.Transport = httpTransport
+	client.transport = httpTransport
+	client.SetCacheSize(benchmarkHitUserAgents * 10)
+	return client
+}
+
+// benchmarkUserAgent returns a distinct user agent for each index
+func benchmarkUserAgent(i int) string {
+	return "Mozilla/5.0 (Linux; Android 13; Benchmark " + strconv.Itoa(i) + ") AppleWebKit/537.36 (KHTML, like Gecko) Mobile Safari/537.36"
+}
+
+// runConcurrently calls f b.N times from the given number of goroutines
+func runConcurrently(b *testing.B, concurrency int, f func()) {
+	var remaining int64 = int64(b.N)
+	var wg sync.WaitGroup
+	for g := 0; g < concurrency; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for atomic.AddInt64(&remaining, -1) >= 0 {
+				f()
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,462 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/golang/groupcache/lru"
+)
+
+const (
+	// unixCacheDefaultSize is the maximum number of entries of a UnixSocketCache created with a size <= 0
+	unixCacheDefaultSize = 100000
+	// unixCacheMaxValueSize is the size of the largest value stored by a UnixSocketCache
+	unixCacheMaxValueSize = 1 << 20
+	// unixCacheTimeout bounds each request sent to the serving process: a slow shared cache must not slow lookups down
+	unixCacheTimeout = 50 * time.Millisecond
+	// unixCacheMaxIdleConns is the number of connections to the serving process kept open for the following requests
+	unixCacheMaxIdleConns = 16
+	// unixCacheDefaultMode is the permission mode of the socket of a UnixSocketCache created by NewUnixSocketCache
+	unixCacheDefaultMode os.FileMode = 0600
+)
+
+// errUnixCachePeer is returned when the process serving a UnixSocketCache runs as a user that is not allowed
+var errUnixCachePeer = errors.New("serving process runs as another user")
+
+// unix cache protocol operations
+const (
+	unixCacheGet = 'G'
+	unixCacheSet = 'S'
+)
+
+// UnixSocketCache is a SharedCache held by one of the processes of a host and reached by the others through a unix socket.
+// The first process creating the cache on a socket path serves an in-memory LRU cache on it, the other ones send their
+// requests to it. When the serving process exits, the first process failing to reach it takes its place, starting with
+// an empty cache. Requests failing or taking longer than 50ms are misses, so a busy or dead serving process only costs
+// lookups on WM server. Values larger than 1MB are not stored.
+//
+// Entries are neither authenticated nor encrypted: any process that can connect to the socket can read them and store
+// forged devices that the other processes return as lookup results. The socket is therefore only reachable by the users
+// allowed by its permission mode, by default its owner, and on Linux the connections of processes running as another user
+// (but root) are rejected on both sides. The socket path must be in a directory that other users cannot write, so that they
+// cannot create the socket first
+type UnixSocketCache struct {
+	path       string
+	maxEntries int
+	mode       os.FileMode
+
+	mutex    sync.Mutex // protects the fields below
+	listener *net.UnixListener
+	socket   os.FileInfo // socket file created by the listener
+	cache    *lru.Cache
+	conns    map[net.Conn]struct{} // connections accepted by the listener
+	closed   bool
+
+	idleConns chan net.Conn // connections to the serving process
+}
+
+// NewUnixSocketCache creates a shared cache on the unix socket at the given path, holding at most the given number of
+// entries when the process serves it. A size <= 0 uses the default, 100000 entries. The socket is only accessible by
+// its owner. The cache must be closed when no longer used
+func NewUnixSocketCache(path string, maxEntries int) (*UnixSocketCache, error) {
+	return NewUnixSocketCacheWithMode(path, maxEntries, unixCacheDefaultMode)
+}
+
+// NewUnixSocketCacheWithMode works like NewUnixSocketCache, the socket created when the process serves the cache has the
+// given permission mode, ie: 0660 to share the cache among the processes of a group
+func NewUnixSocketCacheWithMode(path string, maxEntries int, mode os.FileMode) (*UnixSocketCache, error) {
+	if path == "" {
+		return nil, errors.New("missing unix socket path")
+	}
+	if maxEntries <= 0 {
+		maxEntries = unixCacheDefaultSize
+	}
+	cache := &UnixSocketCache{path: path, maxEntries: maxEntries, mode: mode.Perm(), idleConns: make(chan net.Conn, unixCacheMaxIdleConns)}
+	conn, err := cache.connect()
+	if err != nil {
+		return nil, err
+	}
+	if conn != nil {
+		cache.release(conn)
+	}
+	return cache, nil
+}
+
+// Serving tells whether the cache entries are held by this process
+func (s *UnixSocketCache) Serving() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.listener != nil
+}
+
+// Get returns the value stored for the given key, if any
+func (s *UnixSocketCache) Get(key string) ([]byte, bool) {
+	if len(key) > 0xffff {
+		return nil, false
+	}
+	if value, ok, local := s.localGet(key); local {
+		return value, ok
+	}
+	var value []byte
+	found := false
+	s.request(func(rw *bufio.ReadWriter) error {
+		if err := writeUnixCacheKey(rw, unixCacheGet, key); err != nil {
+			return err
+		}
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+		var err error
+		value, found, err = readUnixCacheValue(rw.Reader)
+		return err
+	})
+	return value, found
+}
+
+// Set stores the given value for the given key
+func (s *UnixSocketCache) Set(key string, value []byte) {
+	if len(key) > 0xffff || len(value) > unixCacheMaxValueSize {
+		return
+	}
+	if s.localSet(key, value) {
+		return
+	}
+	s.request(func(rw *bufio.ReadWriter) error {
+		if err := writeUnixCacheKey(rw, unixCacheSet, key); err != nil {
+			return err
+		}
+		if err := writeUnixCacheBytes(rw, value); err != nil {
+			return err
+		}
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+		_, err := rw.ReadByte()
+		return err
+	})
+}
+
+// Close stops serving the cache, if this process does, and closes the connections to the serving process
+func (s *UnixSocketCache) Close() error {
+	s.mutex.Lock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.stopServing()
+	}
+	s.mutex.Unlock()
+
+	for {
+		select {
+		case conn := <-s.idleConns:
+			conn.Close()
+		default:
+			return err
+		}
+	}
+}
+
+// localGet reads the given key from the in-memory cache when this process serves it, which the last result tells
+func (s *UnixSocketCache) localGet(key string) ([]byte, bool, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.cache == nil {
+		return nil, false, s.closed
+	}
+	value, ok := s.cache.Get(key)
+	if !ok {
+		return nil, false, true
+	}
+	return value.([]byte), true, true
+}
+
+// localSet stores the given value in the in-memory cache when this process serves it, which the result tells
+func (s *UnixSocketCache) localSet(key string, value []byte) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.cache == nil {
+		return s.closed
+	}
+	// the value is copied, since the caller may reuse it
+	s.cache.Add(key, append([]byte(nil), value...))
+	return true
+}
+
+// request sends a request to the serving process with the given function, taking its place if it cannot be reached
+func (s *UnixSocketCache) request(send func(rw *bufio.ReadWriter) error) {
+	select {
+	case conn := <-s.idleConns:
+		err := s.send(conn, send)
+		var netErr net.Error
+		if err == nil || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return
+		}
+		// the serving process may have exited, closing the idle connections
+	default:
+	}
+
+	conn, err := s.connect()
+	if err != nil || conn == nil {
+		// this process is now serving the cache, which is empty
+		return
+	}
+	s.send(conn, send)
+}
+
+// send sends a request on the given connection, which is kept for the following requests if it succeeds
+func (s *UnixSocketCache) send(conn net.Conn, send func(rw *bufio.ReadWriter) error) error {
+	conn.SetDeadline(time.Now().Add(unixCacheTimeout))
+	if err := send(bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))); err != nil {
+		// the connection state is unknown
+		conn.Close()
+		return err
+	}
+	s.release(conn)
+	return nil
+}
+
+// release keeps the given connection for the following requests
+func (s *UnixSocketCache) release(conn net.Conn) {
+	select {
+	case s.idleConns <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// connect returns a connection to the serving process or, if no process serves the cache, starts serving it and returns
+// a nil connection
+func (s *UnixSocketCache) connect() (net.Conn, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return nil, errors.New("unix socket cache closed")
+	}
+	if s.listener != nil {
+		return nil, nil
+	}
+
+	conn, dialErr := s.dial()
+	if dialErr == nil {
+		return conn, nil
+	}
+	if errors.Is(dialErr, errUnixCachePeer) {
+		return nil, dialErr
+	}
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: s.path, Net: "unix"})
+	if err != nil {
+		// the socket file of a process that has exited without removing it: a busy serving process makes the dial time
+		// out instead, and its socket is kept
+		info, serr := os.Lstat(s.path)
+		if errors.Is(dialErr, syscall.ECONNREFUSED) && serr == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(s.path)
+			listener, err = net.ListenUnix("unix", &net.UnixAddr{Name: s.path, Net: "unix"})
+		}
+		if err != nil {
+			// another process may have started serving the cache in the meanwhile
+			if conn, derr := s.dial(); derr == nil {
+				return conn, nil
+			}
+			return nil, fmt.Errorf("unix socket cache %s: %w", s.path, err)
+		}
+	}
+	// the socket is created with the process umask: it is restricted before the other processes use it, connections
+	// accepted in the meanwhile are checked by serve
+	if err = os.Chmod(s.path, s.mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("unix socket cache %s: %w", s.path, err)
+	}
+	// the socket file is removed by Close only if it has not been replaced by another process
+	listener.SetUnlinkOnClose(false)
+	s.socket, _ = os.Lstat(s.path)
+	s.listener = listener
+	s.cache = lru.New(s.maxEntries)
+	s.conns = make(map[net.Conn]struct{})
+	go s.serve(listener)
+	return nil, nil
+}
+
+// dial connects to the serving process, which must run as an allowed user
+func (s *UnixSocketCache) dial() (net.Conn, error) {
+	conn, err := net.DialTimeout("unix", s.path, unixCacheTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if !unixPeerAllowed(conn) {
+		conn.Close()
+		return nil, fmt.Errorf("unix socket cache %s: %w", s.path, errUnixCachePeer)
+	}
+	return conn, nil
+}
+
+// stopServing closes the listener and the connections it has accepted. It must be called holding the mutex
+func (s *UnixSocketCache) stopServing() error {
+	err := s.listener.Close()
+	if info, serr := os.Lstat(s.path); serr == nil && s.socket != nil && os.SameFile(info, s.socket) {
+		os.Remove(s.path)
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.listener = nil
+	s.cache = nil
+	s.conns = nil
+	return err
+}
+
+// serve accepts the connections of the other processes
+func (s *UnixSocketCache) serve(listener *net.UnixListener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return
+		}
+		if !unixPeerAllowed(conn) {
+			conn.Close()
+			continue
+		}
+		s.mutex.Lock()
+		if s.listener != listener {
+			s.mutex.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mutex.Unlock()
+		go s.serveConn(listener, conn)
+	}
+}
+
+// serveConn answers the requests sent on the given connection until it is closed or a request is invalid
+func (s *UnixSocketCache) serveConn(listener *net.UnixListener, conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mutex.Lock()
+		if s.listener == listener {
+			delete(s.conns, conn)
+		}
+		s.mutex.Unlock()
+	}()
+
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	for {
+		op, key, err := readUnixCacheKey(rw.Reader)
+		if err != nil {
+			return
+		}
+		switch op {
+		case unixCacheGet:
+			value, ok, _ := s.localGet(key)
+			if ok {
+				err = rw.WriteByte(1)
+				if err == nil {
+					err = writeUnixCacheBytes(rw, value)
+				}
+			} else {
+				err = rw.WriteByte(0)
+			}
+		case unixCacheSet:
+			var value []byte
+			if value, err = readUnixCacheBytes(rw.Reader); err == nil {
+				s.localSet(key, value)
+				err = rw.WriteByte(1)
+			}
+		default:
+			return
+		}
+		if err != nil || rw.Flush() != nil {
+			return
+		}
+	}
+}
+
+// writeUnixCacheKey writes the given operation and key
+func writeUnixCacheKey(w *bufio.ReadWriter, op byte, key string) error {
+	var header [3]byte
+	header[0] = op
+	binary.BigEndian.PutUint16(header[1:], uint16(len(key)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.WriteString(key)
+	return err
+}
+
+// readUnixCacheKey reads the operation and key written by writeUnixCacheKey
+func readUnixCacheKey(r *bufio.Reader) (byte, string, error) {
+	var header [3]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, "", err
+	}
+	key := make([]byte, binary.BigEndian.Uint16(header[1:]))
+	if _, err := io.ReadFull(r, key); err != nil {
+		return 0, "", err
+	}
+	return header[0], string(key), nil
+}
+
+// writeUnixCacheBytes writes the given value preceded by its length
+func writeUnixCacheBytes(w *bufio.ReadWriter, value []byte) error {
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(value)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(value)
+	return err
+}
+
+// readUnixCacheBytes reads the value written by writeUnixCacheBytes
+func readUnixCacheBytes(r *bufio.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > unixCacheMaxValueSize {
+		return nil, fmt.Errorf("unix socket cache value of %d bytes", size)
+	}
+	value := make([]byte, size)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// readUnixCacheValue reads the answer to a get request
+func readUnixCacheValue(r *bufio.Reader) ([]byte, bool, error) {
+	found, err := r.ReadByte()
+	if err != nil || found == 0 {
+		return nil, false, err
+	}
+	value, err := readUnixCacheBytes(r)
+	return value, err == nil, err
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+// +build !linux
+
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import "net"
+
+// unixPeerAllowed returns true: peer credentials are only checked on Linux, elsewhere the access to the socket is only
+// restricted by its permission mode
+func unixPeerAllowed(conn net.Conn) bool {
+	return true
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// VaryHeaders returns the names of the request headers that detection depends on, in canonical form and without duplicates:
+// User-Agent first, then the other important headers (ie: client hints and the headers holding the original user agent
+// of proxied browsers) in the order WM server reports them. Responses whose content depends on the detected device must vary
+// on all of them, otherwise CDNs and other shared caches serve a variant to devices it was not built for.
+// Headers read by a lookup headers hook (see SetLookupHeadersHook) are not known by the client and must be added by the caller
+func (c *WmClient) VaryHeaders() []string {
+	names := []string{userAgentHeader}
+	if c == nil {
+		return names
+	}
+	seen := map[string]bool{userAgentHeader: true}
+	for _, name := range c.ImportantHeaders {
+		canonical := textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))
+		if canonical != "" && !seen[canonical] {
+			seen[canonical] = true
+			names = append(names, canonical)
+		}
+	}
+	return names
+}
+
+// VaryHeader returns the value of the Vary header for responses whose content depends on the detected device, see VaryHeaders
+func (c *WmClient) VaryHeader() string {
+	return strings.Join(c.VaryHeaders(), ", ")
+}
+
+// AddVaryHeader adds the headers returned by VaryHeaders to the Vary header of the given response headers, keeping the
+// header names already there, ie: Accept-Encoding, and not adding duplicates. A Vary header of "*" is left unchanged
+func (c *WmClient) AddVaryHeader(header http.Header) {
+	addHeaderList(header, "Vary", c.VaryHeaders())
+}
+
+// addHeaderList adds the given header names to the comma separated list of header names held by the given response header,
+// ie: Vary or Accept-CH, keeping the names already there and not adding duplicates. A list of "*" is left unchanged
+func addHeaderList(header http.Header, list string, names []string) {
+	merged := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, value := range header[textproto.CanonicalMIMEHeaderKey(list)] {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return
+			}
+			canonical := textproto.CanonicalMIMEHeaderKey(name)
+			if name != "" && !seen[canonical] {
+				seen[canonical] = true
+				merged = append(merged, name)
+			}
+		}
+	}
+	for _, name := range names {
+		canonical := textproto.CanonicalMIMEHeaderKey(name)
+		if !seen[canonical] {
+			seen[canonical] = true
+			merged = append(merged, name)
+		}
+	}
+	header.Set(list, strings.Join(merged, ", "))
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVaryHeader(t *testing.T) {
+	client := &WmClient{ImportantHeaders: []string{"X-UCBrowser-Device-UA", "User-Agent", "sec-ch-ua-model", "Sec-CH-UA-Model",
+		"Device-Stock-UA"}}
+	require.Equal(t, []string{"User-Agent", "X-Ucbrowser-Device-Ua", "Sec-Ch-Ua-Model", "Device-Stock-Ua"}, client.VaryHeaders())
+	require.Equal(t, "User-Agent, X-Ucbrowser-Device-Ua, Sec-Ch-Ua-Model, Device-Stock-Ua", client.VaryHeader())
+
+	// without important headers, detection depends on User-Agent only
+	require.Equal(t, "User-Agent", (&WmClient{}).VaryHeader())
+
+	header := http.Header{}
+	header.Add("Vary", "Accept-Encoding, user-agent")
+	header.Add("Vary", "Origin")
+	client.AddVaryHeader(header)
+	require.Equal(t, []string{"Accept-Encoding, user-agent, Origin, X-Ucbrowser-Device-Ua, Sec-Ch-Ua-Model, Device-Stock-Ua"}, header["Vary"])
+
+	header = http.Header{}
+	client.AddVaryHeader(header)
+	require.Equal(t, client.VaryHeader(), header.Get("Vary"))
+
+	header = http.Header{"Vary": []string{"*"}}
+	client.AddVaryHeader(header)
+	require.Equal(t, []string{"*"}, header["Vary"])
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Names of the checks done by Verify, endpoint checks are named after the endpoint path
+const (
+	VerifyConnectivity  = "connectivity"
+	VerifyAuthorization = "authorization"
+	VerifyDataFreshness = "data freshness"
+)
+
+// verifyUserAgent is the user agent looked up by Verify
+const verifyUserAgent = "Mozilla/5.0 (iPhone; CPU iPhone OS 16_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.0 Mobile/15E148 Safari/604.1"
+
+// VerifyCheck is the outcome of a single check done by Verify
+type VerifyCheck struct {
+	Name        string        // check name, one of the Verify* constants or an endpoint path
+	Required    bool          // false for the endpoints that only some WM server versions support
+	Passed      bool          // true if the check succeeded, or if an optional endpoint is not supported
+	Unsupported bool          // true if the endpoint is optional and the WM server version does not support it
+	Message     string        // reason of the failure, or details on the check outcome
+	Duration    time.Duration // time spent by the check
+}
+
+// VerifyReport is the result of Verify
+type VerifyReport struct {
+	ServerVersion string // WM server version, empty if WM server could not be reached
+	APIVersion    string // WURFL API version used by WM server
+	Ltime         string // time of last wurfl.xml file load
+	Passed        bool   // true if all checks passed
+	Checks        []VerifyCheck
+}
+
+// Failed returns the checks that did not pass
+func (r *VerifyReport) Failed() []VerifyCheck {
+	var failed []VerifyCheck
+	for _, check := range r.Checks {
+		if !check.Passed {
+			failed = append(failed, check)
+		}
+	}
+	return failed
+}
+
+// verifyProbe is a request sent by Verify to check an endpoint
+type verifyProbe struct {
+	method   string
+	path     string
+	body     interface{}
+	required bool
+	lookup   bool // true if the endpoint returns device data, which may hold an error message instead of a device
+}
+
+// SetMaxDataAge sets the maximum age of the WURFL file loaded by WM server: Verify fails the data freshness check if the
+// file has been loaded earlier. A value <= 0 (the default) only checks that WM server reports a load time
+func (c *WmClient) SetMaxDataAge(age time.Duration) {
+	if c == nil {
+		return
+	}
+	c.maxDataAge = age
+}
+
+// Verify checks that the client can work with WM server, ie: before deploying a service that uses it. It checks, in order,
+// that WM server can be reached, that requests are authorized, that the endpoints used by the client are available (the
+// optional ones are reported as unsupported by older WM server versions) and that the WURFL data is fresh. Checks bypass
+// the client caches and do not change the client state: the report holds the outcome of each check, which is also
+// bound by the context deadline
+func (c *WmClient) Verify(ctx context.Context) *VerifyReport {
+	report := &VerifyReport{Passed: true}
+	ctx = WithCacheBypass(ctx)
+
+	start := time.Now()
+	info := JSONInfoData{}
+	res, status, err := c.verifyRequest(ctx, verifyProbe{method: "GET", path: "/v2/getinfo/json", required: true}, &info)
+	if err != nil {
+		report.addCheck(VerifyCheck{Name: VerifyConnectivity, Required: true, Message: err.Error(), Duration: time.Since(start)})
+		return report
+	}
+	report.addCheck(VerifyCheck{Name: VerifyConnectivity, Required: true, Passed: true, Duration: time.Since(start)})
+	if isUnauthorized(status) {
+		report.addCheck(VerifyCheck{Name: VerifyAuthorization, Required: true, Message: fmt.Sprintf("WM server replied with status %d", status)})
+		return report
+	}
+	report.ServerVersion = info.WmVersion
+	report.APIVersion = info.WurflAPIVersion
+	report.Ltime = info.Ltime
+	if res.Message != "" {
+		report.addCheck(VerifyCheck{Name: "/v2/getinfo/json", Required: true, Message: res.Message, Duration: res.Duration})
+		return report
+	}
+
+	request := Request{LookupHeaders: map[string]string{"User-Agent": verifyUserAgent}}
+	probes := []verifyProbe{
+		{method: "POST", path: lookupUserAgentPath, body: request, required: true, lookup: true},
+		{method: "POST", path: "/v2/lookuprequest/json", body: request, required: true, lookup: true},
+		{method: "POST", path: lookupDeviceIDPath, body: Request{WurflID: "generic"}, required: true, lookup: true},
+		{method: "GET", path: "/v2/alldevices/json", required: true},
+		{method: "GET", path: "/v2/alldeviceosversions/json", required: true},
+		{method: "POST", path: lookupUserAgentBatchPath, body: BatchRequest{Requests: []Request{request}}},
+		{method: "POST", path: lookupUserAgentExplainPath, body: request, lookup: true},
+		{method: "POST", path: queryDevicesPath, body: DeviceQuery{Filters: map[string]string{"brand_name": "Apple"}}},
+		{method: "GET", path: allDeviceIDsPath},
+		{method: "GET", path: capabilitySchemaPath},
+	}
+
+	unauthorized := 0
+	for _, probe := range probes {
+		var data interface{} = new(interface{})
+		if probe.lookup {
+			data = &JSONDeviceData{}
+		}
+		check, status, err := c.verifyRequest(ctx, probe, data)
+		if err != nil {
+			check.Message = err.Error()
+		}
+		if isUnauthorized(status) {
+			unauthorized++
+		}
+		report.addCheck(check)
+	}
+
+	authorization := VerifyCheck{Name: VerifyAuthorization, Required: true, Passed: unauthorized == 0}
+	if unauthorized > 0 {
+		authorization.Message = fmt.Sprintf("%d endpoints rejected the requests as unauthorized", unauthorized)
+	}
+	report.addCheck(authorization)
+	report.addCheck(c.verifyDataFreshness(info.Ltime))
+	return report
+}
+
+// verifyRequest sends the given probe and decodes the response in v. The returned check holds the outcome of the probe,
+// the error is not nil only if WM server could not be reached
+func (c *WmClient) verifyRequest(ctx context.Context, probe verifyProbe, v interface{}) (VerifyCheck, int, error) {
+	check := VerifyCheck{Name: probe.path, Required: probe.required}
+	start := time.Now()
+
+	var reqbody []byte
+	if probe.body != nil {
+		var err error
+		if reqbody, err = json.Marshal(probe.body); err != nil {
+			return check, 0, err
+		}
+	}
+	res, body, err := c.doRequest(ctx, probe.method, probe.path, reqbody)
+	check.Duration = time.Since(start)
+	if err != nil {
+		return check, 0, err
+	}
+
+	switch {
+	case isUnauthorized(res.StatusCode):
+		check.Message = fmt.Sprintf("request not authorized, status %d", res.StatusCode)
+	case !probe.required && endpointUnsupported[res.StatusCode]:
+		check.Passed = true
+		check.Unsupported = true
+		check.Message = fmt.Sprintf("not supported by this WM server version, status %d", res.StatusCode)
+	case res.StatusCode != http.StatusOK:
+		check.Message = fmt.Sprintf("unexpected status %d", res.StatusCode)
+	default:
+		if derr := c.decodeResponse(res, body, v); derr != nil {
+			check.Message = "cannot decode response: " + derr.Error()
+		} else if device, ok := v.(*JSONDeviceData); ok && device.Error != "" {
+			check.Message = "WM server error: " + device.Error
+		} else {
+			check.Passed = true
+		}
+	}
+	return check, res.StatusCode, nil
+}
+
+// verifyDataFreshness checks the WURFL file load time reported by WM server against the maximum data age
+func (c *WmClient) verifyDataFreshness(ltime string) VerifyCheck {
+	check := VerifyCheck{Name: VerifyDataFreshness, Required: true}
+	if ltime == "" {
+		check.Message = "WM server did not report the WURFL file load time"
+		return check
+	}
+	if c.maxDataAge <= 0 {
+		check.Passed = true
+		check.Message = "WURFL file loaded at " + ltime
+		return check
+	}
+
+	loaded, err := c.parseLtime(ltime)
+	if err != nil {
+		check.Message = "cannot parse the WURFL file load time " + ltime
+		return check
+	}
+	age := time.Since(loaded).Truncate(time.Second)
+	check.Passed = age <= c.maxDataAge
+	check.Message = fmt.Sprintf("WURFL file loaded %s ago, maximum age is %s", age, c.maxDataAge)
+	return check
+}
+
+func (r *VerifyReport) addCheck(check VerifyCheck) {
+	r.Checks = append(r.Checks, check)
+	r.Passed = r.Passed && check.Passed
+}
+
+// isUnauthorized returns true for the statuses of requests rejected by WM server, or by a proxy in front of it, due to
+// missing or wrong credentials
+func isUnauthorized(status int) bool {
+	return status == http.StatusUnauthorized || status == http.StatusForbidden
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	ltime := time.Now().Add(-2 * time.Hour).UTC().Format("2006-01-02 15:04:05")
+	optional := true
+	authorized := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorized {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/getinfo/json":
+			w.Write([]byte(`{"wm_version":"2.1.0","wurfl_api_version":"1.12","ltime":"` + ltime + `"}`))
+		case lookupUserAgentPath, "/v2/lookuprequest/json", lookupDeviceIDPath:
+			w.Write([]byte(`{"capabilities":{"wurfl_id":"generic"},"ltime":"` + ltime + `"}`))
+		case "/v2/alldevices/json", "/v2/alldeviceosversions/json":
+			w.Write([]byte(`[]`))
+		case lookupUserAgentBatchPath, queryDevicesPath, lookupUserAgentExplainPath:
+			if !optional {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if r.URL.Path == lookupUserAgentExplainPath {
+				w.Write([]byte(`{"error":"explain mode is disabled"}`))
+				return
+			}
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	// the explain endpoint replies with an error
+	report := client.Verify(context.Background())
+	require.False(t, report.Passed)
+	require.Equal(t, "2.1.0", report.ServerVersion)
+	require.Equal(t, ltime, report.Ltime)
+	failed := report.Failed()
+	require.Len(t, failed, 1)
+	require.Equal(t, lookupUserAgentExplainPath, failed[0].Name)
+	require.Equal(t, "WM server error: explain mode is disabled", failed[0].Message)
+
+	// optional endpoints not supported
+	optional = false
+	report = client.Verify(context.Background())
+	require.True(t, report.Passed)
+	require.Len(t, report.Checks, 13)
+	unsupported := 0
+	for _, check := range report.Checks {
+		if check.Unsupported {
+			require.False(t, check.Required)
+			unsupported++
+		}
+	}
+	require.Equal(t, 5, unsupported)
+
+	// data freshness
+	client.SetMaxDataAge(time.Hour)
+	report = client.Verify(context.Background())
+	require.False(t, report.Passed)
+	require.Equal(t, VerifyDataFreshness, report.Failed()[0].Name)
+	client.SetMaxDataAge(3 * time.Hour)
+	require.True(t, client.Verify(context.Background()).Passed)
+
+	// authorization
+	authorized = false
+	report = client.Verify(context.Background())
+	require.False(t, report.Passed)
+	require.Len(t, report.Checks, 2)
+	require.Equal(t, VerifyAuthorization, report.Failed()[0].Name)
+
+	// connectivity
+	server.Close()
+	report = client.Verify(context.Background())
+	require.False(t, report.Passed)
+	require.Len(t, report.Checks, 1)
+	require.Equal(t, VerifyConnectivity, report.Failed()[0].Name)
+	require.Equal(t, "", report.ServerVersion)
+}
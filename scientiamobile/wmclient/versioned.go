@@ -0,0 +1,142 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Versions of the VersionedResponse layout. A new version is added every time fields are added to, or changed in, the
+// device data, together with the migrations from and to the previous version
+const (
+	// ResponseVersion1 is the layout of JSONDeviceData as returned by WM server: api version, capabilities, mtime and ltime
+	ResponseVersion1 = 1
+	// ResponseVersion2 adds the device ID and the response metadata
+	ResponseVersion2 = 2
+	// CurrentResponseVersion is the version of the responses created by NewVersionedResponse
+	CurrentResponseVersion = ResponseVersion2
+)
+
+// VersionedResponse is the serializable form of device data, tagged with the version of its layout, so that consumers
+// that store or forward device data (ie: to other services or caches) can read data written by older or newer clients.
+// Fields added after version 1 are empty in responses of older versions
+type VersionedResponse struct {
+	Version      int               `json:"version"`
+	APIVersion   string            `json:"apiVersion"`
+	Capabilities map[string]string `json:"capabilities"`
+	Mtime        int64             `json:"mtime"`
+	Ltime        string            `json:"ltime"`
+	DeviceID     string            `json:"deviceId,omitempty"` // since version 2
+	Metadata     *ResponseMetadata `json:"metadata,omitempty"` // since version 2
+}
+
+// responseMigration converts a response, in place, between two consecutive versions
+type responseMigration func(response *VersionedResponse)
+
+// upgrades[i] converts a response from version i+1 to version i+2, downgrades[i] does the opposite
+var upgrades = []responseMigration{
+	func(response *VersionedResponse) {
+		response.DeviceID = response.Capabilities[wurflIDCapability]
+	},
+}
+
+var downgrades = []responseMigration{
+	func(response *VersionedResponse) {
+		if _, ok := response.Capabilities[wurflIDCapability]; !ok && response.DeviceID != "" {
+			// version 1 consumers read wurfl_id from capabilities only
+			caps := make(map[string]string, len(response.Capabilities)+1)
+			for name, value := range response.Capabilities {
+				caps[name] = value
+			}
+			caps[wurflIDCapability] = response.DeviceID
+			response.Capabilities = caps
+		}
+		response.DeviceID = ""
+		response.Metadata = nil
+	},
+}
+
+// NewVersionedResponse wraps the given device data in a response of the current version
+func NewVersionedResponse(device *JSONDeviceData) *VersionedResponse {
+	return &VersionedResponse{
+		Version:      CurrentResponseVersion,
+		APIVersion:   device.APIVersion,
+		Capabilities: device.Capabilities,
+		Mtime:        device.Mtime,
+		Ltime:        device.Ltime,
+		DeviceID:     deviceID(device),
+		Metadata:     device.Metadata,
+	}
+}
+
+// Device returns the device data held by the response, whatever its version
+func (r *VersionedResponse) Device() *JSONDeviceData {
+	device := &JSONDeviceData{
+		APIVersion:   r.APIVersion,
+		Capabilities: r.Capabilities,
+		DeviceID:     r.DeviceID,
+		Mtime:        r.Mtime,
+		Ltime:        r.Ltime,
+		Metadata:     r.Metadata,
+	}
+	if device.DeviceID == "" {
+		device.DeviceID = r.Capabilities[wurflIDCapability]
+	}
+	return device
+}
+
+// Migrate returns a copy of the response converted to the given version, which can be older or newer than the response one
+func (r *VersionedResponse) Migrate(version int) (*VersionedResponse, error) {
+	if err := checkResponseVersion(version); err != nil {
+		return nil, err
+	}
+	if err := checkResponseVersion(r.Version); err != nil {
+		return nil, err
+	}
+
+	migrated := *r
+	for migrated.Version < version {
+		upgrades[migrated.Version-1](&migrated)
+		migrated.Version++
+	}
+	for migrated.Version > version {
+		downgrades[migrated.Version-2](&migrated)
+		migrated.Version--
+	}
+	return &migrated, nil
+}
+
+// UnmarshalVersionedResponse reads a response of any known version and migrates it to the current one. Data without a
+// version, such as a JSONDeviceData serialized with encoding/json, is read as version 1
+func UnmarshalVersionedResponse(data []byte) (*VersionedResponse, error) {
+	response := &VersionedResponse{}
+	if err := json.Unmarshal(data, response); err != nil {
+		return nil, err
+	}
+	if response.Version == 0 {
+		response.Version = ResponseVersion1
+	}
+	return response.Migrate(CurrentResponseVersion)
+}
+
+// checkResponseVersion returns an error if the given version is not known by this client
+func checkResponseVersion(version int) error {
+	if version < ResponseVersion1 || version > CurrentResponseVersion {
+		return fmt.Errorf("unsupported response version %d, supported versions are %d to %d", version, ResponseVersion1, CurrentResponseVersion)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionedResponseRoundTrip(t *testing.T) {
+	device := &JSONDeviceData{
+		APIVersion:   "WM server 2.1",
+		Capabilities: map[string]string{"brand_name": "Apple"},
+		DeviceID:     "apple_iphone_ver10",
+		Mtime:        1577872800,
+		Ltime:        "2020-01-01 10:00:00",
+		Metadata:     &ResponseMetadata{RequestID: "req-1"},
+	}
+
+	data, err := json.Marshal(NewVersionedResponse(device))
+	require.Nil(t, err)
+	response, err := UnmarshalVersionedResponse(data)
+	require.Nil(t, err)
+	require.Equal(t, CurrentResponseVersion, response.Version)
+	require.Equal(t, device, response.Device())
+}
+
+func TestVersionedResponseMigrate(t *testing.T) {
+	// a JSONDeviceData serialized by older clients is read as version 1 and upgraded
+	response, err := UnmarshalVersionedResponse([]byte(`{"apiVersion":"WM server 2.1","capabilities":{"wurfl_id":"generic","brand_name":"Generic"},"mtime":1,"ltime":"x"}`))
+	require.Nil(t, err)
+	require.Equal(t, ResponseVersion2, response.Version)
+	require.Equal(t, "generic", response.DeviceID)
+
+	// downgrade puts wurfl_id back in capabilities, without changing the original response
+	response = &VersionedResponse{Version: ResponseVersion2, Capabilities: map[string]string{"brand_name": "Generic"}, DeviceID: "generic", Metadata: &ResponseMetadata{}}
+	v1, err := response.Migrate(ResponseVersion1)
+	require.Nil(t, err)
+	require.Equal(t, ResponseVersion1, v1.Version)
+	require.Equal(t, map[string]string{"brand_name": "Generic", "wurfl_id": "generic"}, v1.Capabilities)
+	require.Empty(t, v1.DeviceID)
+	require.Nil(t, v1.Metadata)
+	require.Equal(t, 1, len(response.Capabilities))
+	require.NotNil(t, response.Metadata)
+
+	_, err = response.Migrate(CurrentResponseVersion + 1)
+	require.NotNil(t, err)
+	_, err = UnmarshalVersionedResponse([]byte(`{"version":99}`))
+	require.NotNil(t, err)
+}
@@ -18,14 +18,15 @@ package wmclient
 import (
 	"bytes"
 	"context"
-	"crypto/md5"
-	"encoding/hex"
-	"encoding/json"
-	"errors"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"net/url"
 	"sort"
 	"strings"
 	"sync"
@@ -36,13 +37,27 @@ import (
 
 // userAgentHeader is the User-Agent header name
 const userAgentHeader = "User-Agent"
+
+// diagnostic response headers that are mapped to ResponseMetadata fields
+const serverHeader = "Server"
+const requestIDHeader = "X-Request-Id"
+const processingTimeHeader = "X-Processing-Time"
 const deviceDefaultCacheSize = 20000
 
+// lookupUserAgentPath is the WM server endpoint used by LookupUserAgent
+const lookupUserAgentPath = "/v2/lookupuseragent/json"
+
+// lookupDeviceIDPath is the WM server endpoint used by LookupDeviceID
+const lookupDeviceIDPath = "/v2/lookupdeviceid/json"
+
 //default timeouts
 const defaultConnTimeout = time.Duration(10 * time.Second)
 const defaultTransferTimeout = time.Duration(60 * time.Second)
 
 // WmClient holds http connection data to  WM server and the list of static and virtual capabilities it must return in response.
+// Clients must be created with Create. Methods never panic when called on a nil *WmClient, ie: the one returned by a failed
+// Create: those returning an error return ErrNilClient, the others do nothing and return zero values. On a zero value
+// WmClient, the methods sending requests to WM server return ErrClientNotInitialized
 type WmClient struct {
 	scheme      string
 	host        string
@@ -54,11 +69,23 @@ type WmClient struct {
 	requestedStaticCaps  []string
 	requestedVirtualCaps []string
 	httpClient           *http.Client
+	transport            http.RoundTripper // custom transport (ie: HTTP/3), it replaces the default one when set
 	ImportantHeaders     []string
 	deviceCache          *lru.Cache
 	userAgentCache       *lru.Cache
 	lruDeviceCS          sync.Mutex
 	lruUserAgentCS       sync.Mutex
+	tacCache             *lru.Cache // devices by TAC code
+	lruTacCS             sync.Mutex
+	uaCacheHits          uint64 // UA cache counters are protected by lruUserAgentCS
+	uaCacheMisses        uint64
+	uaCacheEvictions     uint64
+	sharedCacheHits      uint64 // shared cache counters are protected by lruUserAgentCS
+	sharedCacheMisses    uint64
+	cacheTTL             time.Duration
+	cacheTTLJitter       float64
+	serveStale           bool // if true, expired cache entries are returned when a lookup times out
+	errorPolicy          ErrorPolicy
 	connTimeout          time.Duration
 	transferTimeout      time.Duration
 	mkMdMutex            sync.Mutex // protects the data shared data structure below
@@ -66,12 +93,99 @@ type WmClient struct {
 	deviceMakesMutex     sync.Mutex // protects the data shared data structure below
 	deviceMakes          []string
 	deviceMakesMap       map[string][]JSONModelMktName
+	brandDevices         map[string][]JSONModelMktName // devices of the brands fetched one by one, when the whole data is not loaded
+	modelIndexEnabled    bool
+	modelIndex           map[string][]JSONMakeModel // devices by model_name, built with the device makes data if enabled
+	// set to 1, atomically, when the server does not support fetching the devices of a single brand
+	brandEndpointFallback int32
+	// set to 1, atomically, when the server does not support batch lookups
+	batchEndpointFallback int32
+	// set to 1, atomically, when the server does not support device queries
+	queryEndpointFallback int32
+	// set to 1, atomically, when the server does not publish the capability schema
+	schemaEndpointFallback int32
+	// set to 1, atomically, when the server rejects lookup payloads without the empty fields
+	legacyPayloadFallback int32
 
 	deviceOsesMutex sync.Mutex // protects the data shared data structure below
 	deviceOses      []string
 	deviceOsVerMap  map[string][]string
 
+	ltimeMutex  sync.Mutex // protects clientLtime
 	clientLtime string
+	ltimeParser LtimeParser // orders the ltimes, ParseLtime if nil
+
+	statsHook StatsHook
+
+	rnd randomSource
+
+	telemetry     detectionTelemetry // detection outcomes, sampled when enabled
+	requestMirror *RequestMirror     // writes a sample of the lookup inputs, nil if disabled
+
+	diagnosticHeaders []string
+
+	acceptFormats  []string
+	formatFallback int32 // set to 1, atomically, when the server does not accept the preferred formats
+
+	snapshotMutex sync.RWMutex // protects snapshot, which can be reloaded while lookups are running
+	snapshot      *deviceSnapshot
+
+	requestDecorator RequestDecorator
+
+	tasksMutex sync.Mutex         // protects tasks and stopTuning
+	tasks      *taskGroup         // background tasks, created on first use
+	stopTuning context.CancelFunc // stops the cache auto-tuning task, if running
+
+	conns *connTracker // tracks the connections of the default transport, used by GetConnectionStats
+
+	prefetchMutex sync.Mutex // protects prefetch
+	prefetch      *prefetchState
+
+	memoMutex sync.Mutex // protects memoCache
+	memoCache *lru.Cache
+
+	headerDiagnostics   bool
+	headerMismatchMutex sync.Mutex // protects headerMismatches
+	headerMismatches    map[string]uint64
+
+	rewarmEntries int
+	rewarmMutex   sync.Mutex // protects rewarmCancel
+	rewarmCancel  context.CancelFunc
+
+	excludeWurflID bool // if true, wurfl_id is only returned in JSONDeviceData.DeviceID
+
+	lookupHeadersHook LookupHeadersHook
+
+	serverDeprecatedCaps []string          // capabilities declared deprecated by WM server
+	deprecatedCaps       map[string]string // capabilities declared deprecated by the user, with their replacement
+
+	transferMutex sync.Mutex // protects transfers
+	transfers     map[string]*TransferStats
+
+	cacheClearMutex sync.Mutex // protects cacheClears
+	cacheClears     map[CacheClearReason]uint64
+
+	limiter *concurrencyLimiter // adaptive limit of the requests in flight to WM server, nil if disabled
+
+	retryPolicy *RetryPolicy // retries of the failed requests to WM server, nil if disabled
+
+	repairCaps      bool              // if true, requested capabilities missing from lookup responses are added
+	repairZeroValue map[string]string // values of the repaired capabilities, overriding the default zero values
+
+	maxDataAge time.Duration // maximum age of the WURFL data accepted by Verify, 0 for no limit
+
+	pinVerifier PeerCertificateVerifier // checks the WM server public key pins, nil if pinning is disabled
+
+	proxyURL             *url.URL // proxy used to reach WM server, nil to connect directly
+	proxyFromEnvironment bool     // honor the proxy environment variables when proxyURL is nil
+
+	tlsConfig *tls.Config // TLS configuration of the default transport, set with WithTLS, nil for the defaults
+
+	infoValidation InfoValidation // checks done on the WM server information
+
+	maxIdleTime time.Duration // idle connections to WM server are closed after this time, if > 0
+
+	sharedCache SharedCache // second level UA cache, shared with the clients of other processes
 }
 
 // GetAPIVersion returns the version number of WM Client API
@@ -98,41 +212,20 @@ func createHTTPClient(connTimeout time.Duration, transferTimeout time.Duration)
 	return cl
 }
 
-// Create : creates object, checks for server visibility
+// Create : creates object, checks for server visibility. It works like CreateWithOptions with the given server address.
+// Using https, the server certificate must be trusted by the system: for private PKIs use CreateWithOptions with WithCAFile
 func Create(Scheme string, Host string, Port string, BaseURI string) (*WmClient, error) {
-	client := &WmClient{}
-	if len(Scheme) > 0 {
-		client.scheme = Scheme
-	} else {
-		client.scheme = "http"
-	}
-
-	client.host = Host
-	client.port = Port
-
-	client.baseURI = BaseURI
-	client.httpClient = createHTTPClient(defaultConnTimeout, defaultTransferTimeout)
-
-	// Test server connection and save important headers taken using getInfo function
-	data, err := client.GetInfo()
-	if err != nil {
-		return nil, err
-	}
-
-	client.ImportantHeaders = data.ImportantHeaders
-	client.StaticCaps = data.StaticCaps
-	client.VirtualCaps = data.VirtualCaps
-	sort.Strings(client.StaticCaps)
-	sort.Strings(client.VirtualCaps)
-	return client, nil
+	return CreateWithOptions(WithServer(Scheme, Host, Port), WithBaseURI(BaseURI))
 }
 
 // SetRequestedStaticCapabilities - set list of standard static capabilities to return
 func (c *WmClient) SetRequestedStaticCapabilities(CapsList []string) {
-
+	if c == nil {
+		return
+	}
 	if CapsList == nil {
 		c.requestedStaticCaps = nil
-		c.clearCache()
+		c.clearCache(CacheClearCapabilitiesChange)
 		return
 	}
 
@@ -145,16 +238,20 @@ func (c *WmClient) SetRequestedStaticCapabilities(CapsList []string) {
 	}
 
 	if capNames != nil && len(capNames) > 0 {
+		c.warnDeprecatedCapabilities(capNames)
 		c.requestedStaticCaps = capNames
-		c.clearCache()
+		c.clearCache(CacheClearCapabilitiesChange)
 	}
 }
 
 // SetRequestedVirtualCapabilities - set list of virtual capabilities to return
 func (c *WmClient) SetRequestedVirtualCapabilities(CapsList []string) {
+	if c == nil {
+		return
+	}
 	if CapsList == nil {
 		c.requestedVirtualCaps = nil
-		c.clearCache()
+		c.clearCache(CacheClearCapabilitiesChange)
 		return
 	}
 
@@ -166,20 +263,34 @@ func (c *WmClient) SetRequestedVirtualCapabilities(CapsList []string) {
 	}
 
 	if vcapNames != nil && len(vcapNames) > 0 {
+		c.warnDeprecatedCapabilities(vcapNames)
 		c.requestedVirtualCaps = vcapNames
-		c.clearCache()
+		c.clearCache(CacheClearCapabilitiesChange)
 	}
 }
 
 // SetRequestedCapabilities - set the given capability names to the set they belong
 func (c *WmClient) SetRequestedCapabilities(CapsList []string) {
+	if c == nil {
+		return
+	}
 	if CapsList == nil {
 		c.requestedVirtualCaps = nil
 		c.requestedStaticCaps = nil
-		c.clearCache()
+		c.clearCache(CacheClearCapabilitiesChange)
 		return
 	}
 
+	capNames, vcapNames := c.splitCapabilities(CapsList)
+	c.warnDeprecatedCapabilities(capNames)
+	c.warnDeprecatedCapabilities(vcapNames)
+	c.requestedStaticCaps = capNames
+	c.requestedVirtualCaps = vcapNames
+	c.clearCache(CacheClearCapabilitiesChange)
+}
+
+// splitCapabilities returns the static and the virtual capabilities among the given ones, unknown names are discarded
+func (c *WmClient) splitCapabilities(CapsList []string) ([]string, []string) {
 	capNames := make([]string, 0, 16)
 	vcapNames := make([]string, 0, 4)
 	for _, name := range CapsList {
@@ -189,32 +300,192 @@ func (c *WmClient) SetRequestedCapabilities(CapsList []string) {
 			vcapNames = append(vcapNames, name)
 		}
 	}
-	c.requestedStaticCaps = capNames
-	c.requestedVirtualCaps = vcapNames
-	c.clearCache()
+	return capNames, vcapNames
 }
 
 // SetCacheSize : set UA cache size
 func (c *WmClient) SetCacheSize(uaMaxEntries int) {
-	c.userAgentCache = lru.New(uaMaxEntries)
-	c.deviceCache = lru.New(deviceDefaultCacheSize)
+	if c == nil {
+		return
+	}
+	c.setCacheSizes(uaMaxEntries, deviceDefaultCacheSize)
 }
 
-// clearCache Removes all entries from WM client cache, every cache is cleared using its own mutex, to avoid goroutines to use it while we are clearing it
-func (c *WmClient) clearCache() {
+// setCacheSizes replaces UA and device caches with new ones of the given sizes
+func (c *WmClient) setCacheSizes(uaMaxEntries int, deviceMaxEntries int) {
+	var oldUserAgentCache, oldDeviceCache *lru.Cache
 
 	c.lruUserAgentCS.Lock()
+	oldUserAgentCache = c.userAgentCache
+	c.userAgentCache = c.newUserAgentCache(uaMaxEntries)
+	c.lruUserAgentCS.Unlock()
+
+	c.lruDeviceCS.Lock()
+	oldDeviceCache = c.deviceCache
+	c.deviceCache = lru.New(deviceMaxEntries)
+	c.lruDeviceCS.Unlock()
+
+	c.lruTacCS.Lock()
+	c.tacCache = lru.New(tacDefaultCacheSize)
+	c.lruTacCS.Unlock()
+
+	if oldUserAgentCache != nil || oldDeviceCache != nil {
+		c.recordCacheClear(CacheClearResize, oldUserAgentCache, oldDeviceCache)
+	}
+}
+
+// newUserAgentCache creates a UA cache that keeps track of its evictions. It must be called holding the UA cache mutex
+func (c *WmClient) newUserAgentCache(maxEntries int) *lru.Cache {
+	cache := lru.New(maxEntries)
+	// OnEvicted is always called by the cache while the UA cache mutex is held
+	cache.OnEvicted = func(key lru.Key, value interface{}) {
+		c.uaCacheEvictions++
+	}
+	return cache
+}
+
+// SetCacheTTL sets the time to live of UA and device cache entries. Expired entries are treated as cache misses and refreshed
+// from WM server. To avoid entries cached at the same time (ie: after a cache clear) to expire all together, each entry TTL is
+// randomly spread by the given jitter fraction (ie: a jitter of 0.1 makes entries expire between 90% and 110% of ttl).
+// A ttl <= 0 disables expiration. This function should be called before performing any lookup
+func (c *WmClient) SetCacheTTL(ttl time.Duration, jitter float64) error {
+	if c == nil {
+		return ErrNilClient
+	}
+	if jitter < 0 || jitter >= 1 {
+		return fmt.Errorf("invalid cache TTL jitter %.2f: it must be greater than or equal to 0 and less than 1", jitter)
+	}
+	c.cacheTTL = ttl
+	c.cacheTTLJitter = jitter
+	return nil
+}
+
+// cacheEntry wraps the cached device data with its expiration time
+type cacheEntry struct {
+	device    *JSONDeviceData
+	err       error     // error of the lookup, cached according to the client ErrorPolicy. device is nil if set
+	expiresAt time.Time // zero value means that the entry never expires
+	// lookup data of UA cache entries, kept only when cache re-population is enabled
+	lookupHeaders map[string]string
+	lookupPath    string
+	lookupScope   *capabilityScope // capability scope of the lookup, nil for the client requested capabilities
+}
+
+// newCacheEntry wraps the given device in a cache entry, computing its (jittered) expiration time
+func (c *WmClient) newCacheEntry(device *JSONDeviceData) *cacheEntry {
+	entry := &cacheEntry{device: device}
+	if c.cacheTTL > 0 {
+		ttl := float64(c.cacheTTL)
+		if c.cacheTTLJitter > 0 {
+			// random factor in [1 - jitter, 1 + jitter)
+			ttl *= 1 + c.cacheTTLJitter*(2*c.rnd.float64()-1)
+		}
+		entry.expiresAt = time.Now().Add(time.Duration(ttl))
+	}
+	return entry
+}
+
+// expired returns true if the entry time to live has elapsed
+func (e *cacheEntry) expired() bool {
+	return !e.expiresAt.IsZero() && time.Now().After(e.expiresAt)
+}
+
+// getFromUserAgentCache returns the device, or the lookup error, cached for the given key, if any
+func (c *WmClient) getFromUserAgentCache(key string) (*JSONDeviceData, bool, error) {
+	c.lruUserAgentCS.Lock()
+	defer c.lruUserAgentCS.Unlock()
+
+	// Expired entries are left in the cache, they will be replaced by the device data fetched from the server
+	value, ok := c.userAgentCache.Get(key)
+	if !ok || value.(*cacheEntry).expired() {
+		c.uaCacheMisses++
+		return nil, false, nil
+	}
+	c.uaCacheHits++
+	return value.(*cacheEntry).device, true, value.(*cacheEntry).err
+}
+
+// addToUserAgentCache adds the given device to the UA cache. We need to lock when writing since cache is not thread safe
+func (c *WmClient) addToUserAgentCache(key string, device *JSONDeviceData) {
+	c.addEntryToUserAgentCache(key, c.newCacheEntry(device))
+}
+
+// addLookupToUserAgentCache adds the device detected from the given headers, in a lookup with the given context, keeping the
+// request if the cache is re-populated after WURFL file reloads
+func (c *WmClient) addLookupToUserAgentCache(ctx context.Context, headers map[string]string, path string, device *JSONDeviceData) {
+	entry := c.newCacheEntry(device)
+	if c.rewarmEntries > 0 {
+		entry.lookupHeaders = headers
+		entry.lookupPath = path
+		entry.lookupScope = getCapabilityScope(ctx)
+	}
+	c.addEntryToUserAgentCache(c.userAgentCacheKey(ctx, headers), entry)
+}
+
+// addEntryToUserAgentCache adds the given entry to the UA cache
+func (c *WmClient) addEntryToUserAgentCache(key string, entry *cacheEntry) {
+	c.lruUserAgentCS.Lock()
+	c.userAgentCache.Add(key, entry)
+	c.lruUserAgentCS.Unlock()
+}
+
+// getFromDeviceCache returns the device, or the lookup error, cached for the given wurfl_id, if any
+func (c *WmClient) getFromDeviceCache(deviceID string) (*JSONDeviceData, bool, error) {
+	c.lruDeviceCS.Lock()
+	defer c.lruDeviceCS.Unlock()
+
+	value, ok := c.deviceCache.Get(deviceID)
+	if !ok || value.(*cacheEntry).expired() {
+		return nil, false, nil
+	}
+	return value.(*cacheEntry).device, true, value.(*cacheEntry).err
+}
+
+// addToDeviceCache adds the given device to the device cache. We need to lock when writing since cache is not thread safe
+func (c *WmClient) addToDeviceCache(deviceID string, device *JSONDeviceData) {
+	c.addEntryToDeviceCache(deviceID, c.newCacheEntry(device))
+}
+
+// addEntryToDeviceCache adds the given entry to the device cache
+func (c *WmClient) addEntryToDeviceCache(deviceID string, entry *cacheEntry) {
+	c.lruDeviceCS.Lock()
+	c.deviceCache.Add(deviceID, entry)
+	c.lruDeviceCS.Unlock()
+}
+
+// clearCache Removes all entries from WM client cache, for the given reason. Caches are not cleared in place: each one is swapped,
+// holding its own mutex, with a fresh empty cache of the same size, so that the mutexes are held only for the time of the swap and
+// in-flight lookups are not delayed by the clearing of large caches. Old caches are left to the garbage collector, which reclaims
+// them in background
+func (c *WmClient) clearCache(reason CacheClearReason) {
+	c.swapCaches(reason)
+}
+
+// swapCaches does the work of clearCache, returning the replaced UA and device caches, if any, which are no longer used by the client
+func (c *WmClient) swapCaches(reason CacheClearReason) (*lru.Cache, *lru.Cache) {
+	var oldUserAgentCache, oldDeviceCache *lru.Cache
+	var enabled bool // false if caching is disabled, in that case there is nothing to clear
+
+	c.lruUserAgentCS.Lock()
+	enabled = c.userAgentCache != nil
 	if c.userAgentCache != nil && c.userAgentCache.Len() > 0 {
-		c.userAgentCache.Clear()
+		// replacing the cache, instead of clearing it, does not count removed entries as evictions
+		oldUserAgentCache = c.userAgentCache
+		c.userAgentCache = c.newUserAgentCache(c.userAgentCache.MaxEntries)
 	}
 	c.lruUserAgentCS.Unlock()
 
 	c.lruDeviceCS.Lock()
+	enabled = enabled || c.deviceCache != nil
 	if c.deviceCache != nil && c.deviceCache.Len() > 0 {
-		c.deviceCache.Clear()
+		oldDeviceCache = c.deviceCache
+		c.deviceCache = lru.New(c.deviceCache.MaxEntries)
 	}
 	c.lruDeviceCS.Unlock()
 
+	c.clearTacCache()
+	c.clearMemoCache()
+
 	c.mkMdMutex.Lock()
 	c.mkModels = nil
 	c.mkMdMutex.Unlock()
@@ -222,17 +493,27 @@ func (c *WmClient) clearCache() {
 	c.deviceMakesMutex.Lock()
 	c.deviceMakes = nil
 	c.deviceMakesMap = nil
+	c.brandDevices = nil
+	c.modelIndex = nil
 	c.deviceMakesMutex.Unlock()
 
 	c.deviceOsesMutex.Lock()
 	c.deviceOses = nil
 	c.deviceOsVerMap = nil
 	c.deviceOsesMutex.Unlock()
+
+	if enabled {
+		c.recordCacheClear(reason, oldUserAgentCache, oldDeviceCache)
+	}
+	return oldUserAgentCache, oldDeviceCache
 }
 
 // GetActualCacheSizes return the values of cache size. The first value being the device-id based cache, the second value being
 // the size of the headers-based one
 func (c *WmClient) GetActualCacheSizes() (int, int) {
+	if c == nil {
+		return 0, 0
+	}
 	var dSize int
 	var uaSize int
 
@@ -254,11 +535,17 @@ func (c *WmClient) GetActualCacheSizes() (int, int) {
 
 // HasStaticCapability - returns true if the given CapName exist in this client' static capability set, false otherwise
 func (c *WmClient) HasStaticCapability(CapName string) bool {
+	if c == nil {
+		return false
+	}
 	return sliceHasValue(c.StaticCaps, CapName)
 }
 
 // HasVirtualCapability - returns true if the given CapName exist in this client' virtual capability set, false otherwise
 func (c *WmClient) HasVirtualCapability(CapName string) bool {
+	if c == nil {
+		return false
+	}
 	return sliceHasValue(c.VirtualCaps, CapName)
 }
 
@@ -274,9 +561,27 @@ func sliceHasValue(slist []string, value string) bool {
 	return index < len(slist) && value == slist[index]
 }
 
-// LookupRequest - detects a device and returns its data in JSON format
+// LookupRequest - detects a device and returns its data in JSON format. The request to WM server is bound to the request
+// context. LookupRequestContext should be preferred, since it does not copy the request
 func (c *WmClient) LookupRequest(request http.Request) (*JSONDeviceData, error) {
+	return c.lookupRequest(request.Context(), &request, true)
+}
+
+// LookupRequestContext - works like LookupRequest, the request to WM server is bound to the given context, which is usually
+// the request context or one derived from it
+func (c *WmClient) LookupRequestContext(ctx context.Context, request *http.Request) (*JSONDeviceData, error) {
+	return c.lookupRequest(ctx, request, true)
+}
 
+// LookupRequestUncached - works like LookupRequest, but it never reads from nor writes to the client cache
+func (c *WmClient) LookupRequestUncached(request http.Request) (*JSONDeviceData, error) {
+	return c.lookupRequest(request.Context(), &request, false)
+}
+
+func (c *WmClient) lookupRequest(ctx context.Context, request *http.Request, useCache bool) (*JSONDeviceData, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
 	jrequest := Request{LookupHeaders: make(map[string]string)}
 
 	// copy headers
@@ -288,42 +593,36 @@ func (c *WmClient) LookupRequest(request http.Request) (*JSONDeviceData, error)
 		}
 	}
 
-	// Do a cache lookup
-	if c.userAgentCache != nil {
-
-		c.lruUserAgentCS.Lock()
-		value, ok := c.userAgentCache.Get(c.getUserAgentCacheKey(jrequest.LookupHeaders))
-		c.lruUserAgentCS.Unlock()
-
-		if ok {
-			jdd := value.(*JSONDeviceData)
-			return jdd, nil
+	if c.headerDiagnostics {
+		received := make([]string, 0, len(request.Header))
+		for name, values := range request.Header {
+			if len(values) > 0 && values[0] != "" {
+				received = append(received, name)
+			}
 		}
+		c.checkHeaderMismatches(received, jrequest.LookupHeaders)
 	}
 
-	jrequest.RequestedCaps = c.requestedStaticCaps
-	jrequest.RequestedVCaps = c.requestedVirtualCaps
-
-	deviceData, err := c.internalLookup(request.Context(), jrequest, "/v2/lookuprequest/json")
-
-	if err == nil {
-		// check if server WURFL.xml has been updated and, if so, clear caches
-		c.clearCachesIfNeeded(deviceData.Ltime)
-
-		// lock and add element
-		if c.userAgentCache != nil {
-			c.lruUserAgentCS.Lock()
-			c.userAgentCache.Add(c.getUserAgentCacheKey(jrequest.LookupHeaders), deviceData)
-			c.lruUserAgentCS.Unlock()
-		}
-	}
+	c.applyLookupHeadersHook(jrequest.LookupHeaders, request.Header)
+	return c.headersLookup(ctx, jrequest, "/v2/lookuprequest/json", useCache)
+}
 
-	return deviceData, err
+// LookupHeaders - detects a device and returns its data in JSON format, with the given lookup options
+func (c *WmClient) LookupHeaders(ctx context.Context, headers map[string]string, options ...LookupOption) (*JSONDeviceData, error) {
+	ctx, cancel := withLookupOptions(ctx, options)
+	defer cancel()
+	return c.lookupHeaders(ctx, headers, true)
 }
 
-// LookupHeaders - detects a device and returns its data in JSON format
-func (c *WmClient) LookupHeaders(ctx context.Context, headers map[string]string) (*JSONDeviceData, error) {
+// LookupHeadersUncached - works like LookupHeaders, but it never reads from nor writes to the client cache
+func (c *WmClient) LookupHeadersUncached(ctx context.Context, headers map[string]string) (*JSONDeviceData, error) {
+	return c.lookupHeaders(ctx, headers, false)
+}
 
+func (c *WmClient) lookupHeaders(ctx context.Context, headers map[string]string, useCache bool) (*JSONDeviceData, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
 	jrequest := Request{LookupHeaders: make(map[string]string)}
 
 	// first: make all headers lowercase
@@ -341,111 +640,257 @@ func (c *WmClient) LookupHeaders(ctx context.Context, headers map[string]string)
 		}
 	}
 
-	// Do a cache lookup
-	if c.userAgentCache != nil {
+	if c.headerDiagnostics {
+		received := make([]string, 0, len(headers))
+		for name, value := range headers {
+			if value != "" {
+				received = append(received, name)
+			}
+		}
+		c.checkHeaderMismatches(received, jrequest.LookupHeaders)
+	}
 
-		c.lruUserAgentCS.Lock()
-		value, ok := c.userAgentCache.Get(c.getUserAgentCacheKey(jrequest.LookupHeaders))
-		c.lruUserAgentCS.Unlock()
+	c.applyLookupHeadersHook(jrequest.LookupHeaders, lowerCaseHeaders(lowerKeyMap))
+	return c.headersLookup(ctx, jrequest, "/v2/lookuprequest/json", useCache)
+}
 
-		if ok {
-			jdd := value.(*JSONDeviceData)
-			return jdd, nil
+// LookupMultiValueHeaders - detects a device from headers in multi-value form, such as http.Header or the header maps
+// handed over by many middlewares. Header names are matched case insensitively; when a header has more than one value,
+// or it is present under more than one casing, the first non empty value is used, looking first at the canonical
+// form of the name (ie: "User-Agent") and then at the other forms in lexical order
+func (c *WmClient) LookupMultiValueHeaders(ctx context.Context, headers map[string][]string) (*JSONDeviceData, error) {
+	return c.lookupHeaders(ctx, flattenHeaders(headers), true)
+}
+
+// LookupMIMEHeader - works like LookupMultiValueHeaders, for headers read with net/textproto
+func (c *WmClient) LookupMIMEHeader(ctx context.Context, headers textproto.MIMEHeader) (*JSONDeviceData, error) {
+	return c.LookupMultiValueHeaders(ctx, headers)
+}
+
+// LookupHTTPHeaders - detects a device from the headers of an HTTP request, following the HTTP rules for repeated headers:
+// the values of a header, including those found under other casings of its name, are joined with ", ", the values of the
+// canonical form of the name (ie: "Accept") first, then those of the other forms in lexical order. Headers that hold a user
+// agent string (User-Agent, X-Original-User-Agent, Device-Stock-UA, X-UCBrowser-Device-UA...) cannot be combined, since
+// user agents contain commas: for them the first non empty value is used, as in LookupMultiValueHeaders
+func (c *WmClient) LookupHTTPHeaders(ctx context.Context, headers http.Header) (*JSONDeviceData, error) {
+	return c.lookupHeaders(ctx, joinHeaders(headers), true)
+}
+
+// joinHeaders converts HTTP headers to the single value form used by lookupHeaders, as documented in LookupHTTPHeaders
+func joinHeaders(headers http.Header) map[string]string {
+	joined := make(map[string]string, len(headers))
+	for _, name := range sortedHeaderNames(headers) {
+		lowerName := strings.ToLower(name)
+		userAgent := isUserAgentHeader(lowerName)
+		for _, value := range headers[name] {
+			if value == "" {
+				continue
+			}
+			if joined[lowerName] == "" {
+				joined[lowerName] = value
+			} else if !userAgent {
+				joined[lowerName] += ", " + value
+			}
 		}
 	}
+	return joined
+}
 
-	jrequest.RequestedCaps = c.requestedStaticCaps
-	jrequest.RequestedVCaps = c.requestedVirtualCaps
-
-	deviceData, err := c.internalLookup(ctx, jrequest, "/v2/lookuprequest/json")
+// isUserAgentHeader returns true if the header with the given lowercase name holds a user agent string. Client hints
+// (ie: Sec-CH-UA) are structured lists, which can be combined
+func isUserAgentHeader(lowerName string) bool {
+	if strings.HasPrefix(lowerName, "sec-ch-") {
+		return false
+	}
+	return lowerName == "user-agent" || strings.HasSuffix(lowerName, "-user-agent") || strings.HasSuffix(lowerName, "-ua")
+}
 
-	if err == nil {
-		// check if server WURFL.xml has been updated and, if so, clear caches
-		c.clearCachesIfNeeded(deviceData.Ltime)
+// sortedHeaderNames returns the names of the given headers, canonical forms first, then the other forms in lexical order
+func sortedHeaderNames(headers map[string][]string) []string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		iCanonical := names[i] == textproto.CanonicalMIMEHeaderKey(names[i])
+		jCanonical := names[j] == textproto.CanonicalMIMEHeaderKey(names[j])
+		if iCanonical != jCanonical {
+			return iCanonical
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
 
-		// lock and add element
-		if c.userAgentCache != nil {
-			c.lruUserAgentCS.Lock()
-			c.userAgentCache.Add(c.getUserAgentCacheKey(jrequest.LookupHeaders), deviceData)
-			c.lruUserAgentCS.Unlock()
+// flattenHeaders converts multi-value headers to the single value form used by lookupHeaders, keeping, for each header,
+// the first non empty value according to the precedence documented in LookupMultiValueHeaders
+func flattenHeaders(headers map[string][]string) map[string]string {
+	flat := make(map[string]string, len(headers))
+	for _, name := range sortedHeaderNames(headers) {
+		lowerName := strings.ToLower(name)
+		if flat[lowerName] != "" {
+			continue
+		}
+		for _, value := range headers[name] {
+			if value != "" {
+				flat[lowerName] = value
+				break
+			}
 		}
 	}
+	return flat
+}
 
-	return deviceData, err
+// LookupUserAgent - Searches WURFL device data using the given user-agent for detection, with the given lookup options
+func (c *WmClient) LookupUserAgent(ctx context.Context, userAgent string, options ...LookupOption) (*JSONDeviceData, error) {
+	ctx, cancel := withLookupOptions(ctx, options)
+	defer cancel()
+	return c.lookupUserAgent(ctx, userAgent, true)
 }
 
-// LookupUserAgent - Searches WURFL device data using the given user-agent for detection
-func (c *WmClient) LookupUserAgent(ctx context.Context, userAgent string) (*JSONDeviceData, error) {
+// LookupUserAgentUncached - works like LookupUserAgent, but it never reads from nor writes to the client cache
+func (c *WmClient) LookupUserAgentUncached(ctx context.Context, userAgent string) (*JSONDeviceData, error) {
+	return c.lookupUserAgent(ctx, userAgent, false)
+}
 
-	// First: cache lookup
-	headers := map[string]string{userAgentHeader: userAgent}
+func (c *WmClient) lookupUserAgent(ctx context.Context, userAgent string, useCache bool) (*JSONDeviceData, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	var jsonRequest = Request{LookupHeaders: c.userAgentLookupHeaders(userAgent)}
 
-	if c.userAgentCache != nil {
+	return c.headersLookup(ctx, jsonRequest, lookupUserAgentPath, useCache)
+}
 
-		c.lruUserAgentCS.Lock()
-		value, ok := c.userAgentCache.Get(c.getUserAgentCacheKey(headers))
-		c.lruUserAgentCS.Unlock()
+// headersLookup performs a lookup of the given request, whose headers are also used to build the UA cache key. Internal
+// lookups, ie: the cache re-population ones, are not mirrored nor counted by the telemetry
+func (c *WmClient) headersLookup(ctx context.Context, jrequest Request, path string, useCache bool) (*JSONDeviceData, error) {
+	if isInternalLookup(ctx) {
+		return c.cachedHeadersLookup(ctx, jrequest, path, useCache)
+	}
+	c.mirrorLookup(path, jrequest.LookupHeaders)
+	device, err := c.cachedHeadersLookup(ctx, jrequest, path, useCache)
+	c.recordTelemetry(device, err)
+	return device, err
+}
 
-		if ok {
-			jdd := value.(*JSONDeviceData)
-			return jdd, nil
+// cachedHeadersLookup performs a lookup of the given request, using the UA cache if useCache is true
+func (c *WmClient) cachedHeadersLookup(ctx context.Context, jrequest Request, path string, useCache bool) (*JSONDeviceData, error) {
+	var overridden bool
+	jrequest.LookupHeaders = c.addExtraHeaders(ctx, jrequest.LookupHeaders)
+	jrequest.RequestedCaps, jrequest.RequestedVCaps, overridden = c.requestedCapabilities(ctx)
+	useCache = useCache && c.userAgentCache != nil && !bypassesCache(ctx) && !overridden && !wantsRawBody(ctx) && !wantsNoCache(ctx)
+
+	// Do a cache lookup
+	var sharedKey string
+	useSharedCache := false
+	if useCache {
+		key := c.userAgentCacheKey(ctx, jrequest.LookupHeaders)
+		if jdd, ok, err := c.getFromUserAgentCache(key); ok {
+			return jdd, err
+		}
+		if c.sharedCache != nil {
+			sharedKey, useSharedCache = c.sharedCacheKey(key, jrequest.RequestedCaps, jrequest.RequestedVCaps)
+		}
+		if useSharedCache {
+			if jdd, ok := c.getFromSharedCache(sharedKey); ok {
+				c.addLookupToUserAgentCache(ctx, jrequest.LookupHeaders, path, jdd)
+				return jdd, nil
+			}
 		}
 	}
 
-	var jsonRequest = Request{LookupHeaders: make(map[string]string)}
+	deviceData, err := c.internalLookup(ctx, jrequest, path)
 
-	// Add user-agent to the Request object
-	jsonRequest.LookupHeaders[userAgentHeader] = userAgent
-	jsonRequest.RequestedCaps = c.requestedStaticCaps
-	jsonRequest.RequestedVCaps = c.requestedVirtualCaps
-
-	deviceData, err := c.internalLookup(ctx, jsonRequest, "/v2/lookupuseragent/json")
 	if err == nil {
 		// check if server WURFL.xml has been updated and, if so, clear caches
 		c.clearCachesIfNeeded(deviceData.Ltime)
 
-		// we need to lock when writing since cache is not thread safe
-		if c.userAgentCache != nil {
-			c.lruUserAgentCS.Lock()
-			c.userAgentCache.Add(c.getUserAgentCacheKey(headers), deviceData)
-			c.lruUserAgentCS.Unlock()
+		// lock and add element
+		if useCache {
+			c.addLookupToUserAgentCache(ctx, jrequest.LookupHeaders, path, deviceData)
+		}
+		if useSharedCache && deviceData.Ltime != "" {
+			// the key is built again, since the lookup may have changed the WURFL file load time
+			if key, ok := c.sharedCacheKey(c.userAgentCacheKey(ctx, jrequest.LookupHeaders), jrequest.RequestedCaps, jrequest.RequestedVCaps); ok {
+				c.addToSharedCache(key, deviceData)
+			}
+		}
+	} else if isServerError(err) {
+		if ttl := c.errorCacheTTL(err); useCache && ttl > 0 {
+			c.addEntryToUserAgentCache(c.userAgentCacheKey(ctx, jrequest.LookupHeaders), newErrorCacheEntry(err, ttl))
+		}
+	} else {
+		if useCache && c.serveStale && isTimeout(err) {
+			if jdd, ok := c.getStaleFromUserAgentCache(c.userAgentCacheKey(ctx, jrequest.LookupHeaders)); ok {
+				return jdd, nil
+			}
+		}
+		// server cannot be reached, last resort is the device snapshot (if loaded)
+		if jdd, ok := c.getFromSnapshot(jrequest.LookupHeaders[userAgentHeader], ""); ok {
+			return jdd, nil
 		}
 	}
 
 	return deviceData, err
 }
 
-// LookupDeviceID - Searches WURFL device data using its wurfl_id value
-func (c *WmClient) LookupDeviceID(ctx context.Context, deviceID string) (*JSONDeviceData, error) {
+// LookupDeviceID - Searches WURFL device data using its wurfl_id value, with the given lookup options
+func (c *WmClient) LookupDeviceID(ctx context.Context, deviceID string, options ...LookupOption) (*JSONDeviceData, error) {
+	ctx, cancel := withLookupOptions(ctx, options)
+	defer cancel()
+	return c.lookupDeviceID(ctx, deviceID, true)
+}
 
-	// First: cache lookup
-	if c.deviceCache != nil {
-		c.lruDeviceCS.Lock()
-		value, ok := c.deviceCache.Get(deviceID)
-		c.lruDeviceCS.Unlock()
+// LookupDeviceIDUncached - works like LookupDeviceID, but it never reads from nor writes to the client cache
+func (c *WmClient) LookupDeviceIDUncached(ctx context.Context, deviceID string) (*JSONDeviceData, error) {
+	return c.lookupDeviceID(ctx, deviceID, false)
+}
 
-		if ok {
-			jdd := value.(*JSONDeviceData)
-			return jdd, nil
+func (c *WmClient) lookupDeviceID(ctx context.Context, deviceID string, useCache bool) (*JSONDeviceData, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	staticCaps, virtualCaps, overridden := c.requestedCapabilities(ctx)
+	useCache = useCache && c.deviceCache != nil && !bypassesCache(ctx) && !overridden && !wantsRawBody(ctx) && !wantsNoCache(ctx)
+	cacheKey := deviceCacheKey(ctx, deviceID)
+
+	// First: cache lookup
+	if useCache {
+		if jdd, ok, err := c.getFromDeviceCache(cacheKey); ok {
+			return jdd, err
 		}
 	}
 
 	var jsonRequest = Request{}
 	jsonRequest.WurflID = deviceID
-	jsonRequest.RequestedCaps = c.requestedStaticCaps
-	jsonRequest.RequestedVCaps = c.requestedVirtualCaps
+	jsonRequest.RequestedCaps = staticCaps
+	jsonRequest.RequestedVCaps = virtualCaps
 
-	deviceData, err := c.internalLookup(ctx, jsonRequest, "/v2/lookupdeviceid/json")
+	deviceData, err := c.internalLookup(ctx, jsonRequest, lookupDeviceIDPath)
 	if err == nil {
 
 		// check if server WURFL.xml has been updated and, if so, clear caches
 		c.clearCachesIfNeeded(deviceData.Ltime)
 
-		if c.deviceCache != nil {
-			// we need to lock when writing since cache is not thread safe
-			c.lruDeviceCS.Lock()
-			c.deviceCache.Add(deviceID, deviceData)
-			c.lruDeviceCS.Unlock()
+		if useCache {
+			entry := c.newCacheEntry(deviceData)
+			entry.lookupScope = getCapabilityScope(ctx)
+			c.addEntryToDeviceCache(cacheKey, entry)
+		}
+	} else if isServerError(err) {
+		if ttl := c.errorCacheTTL(err); useCache && ttl > 0 {
+			c.addEntryToDeviceCache(cacheKey, newErrorCacheEntry(err, ttl))
+		}
+	} else {
+		if useCache && c.serveStale && isTimeout(err) {
+			if jdd, ok := c.getStaleFromDeviceCache(cacheKey); ok {
+				return jdd, nil
+			}
+		}
+		// server cannot be reached, last resort is the device snapshot (if loaded)
+		if jdd, ok := c.getFromSnapshot("", deviceID); ok {
+			return jdd, nil
 		}
 	}
 
@@ -455,21 +900,20 @@ func (c *WmClient) LookupDeviceID(ctx context.Context, deviceID string) (*JSONDe
 
 // GetInfo - Returns information about the running WM server and API
 func (c *WmClient) GetInfo() (*JSONInfoData, error) {
+	return c.GetInfoContext(context.Background())
+}
+
+// GetInfoContext - works like GetInfo, the request to WM server is bound to the given context
+func (c *WmClient) GetInfoContext(ctx context.Context) (*JSONInfoData, error) {
 	var info = JSONInfoData{}
 
-	var body, berr = c.internalGet("/v2/getinfo/json")
+	var berr = c.internalGet(ctx, "/v2/getinfo/json", &info)
 	if berr != nil {
 		return nil, berr
 	}
 
-	var merror = json.Unmarshal(body, &info)
-	if merror != nil {
-
-		return nil, merror
-	}
-
-	if !checkData(&info) {
-		return nil, errors.New("server returned empty data or a wrong json format")
+	if err := validateInfo(&info, c.infoValidation); err != nil {
+		return nil, err
 	}
 
 	// check if server WURFL.xml has been updated and, if so, clear caches
@@ -478,11 +922,13 @@ func (c *WmClient) GetInfo() (*JSONInfoData, error) {
 	return &info, nil
 }
 
-// DestroyConnection - Disposes resources used in connection to server and clears cache and other shared data structures
+// DestroyConnection - Disposes resources used in connection to server and clears cache and other shared data structures.
+// It works like Close, ignoring the errors of background tasks
 func (c *WmClient) DestroyConnection() {
 	if c != nil {
 
-		c.clearCache()
+		c.DisableCacheAutoTuning()
+		c.Close()
 		c.mkModels = nil
 		c.httpClient = nil
 		c = nil
@@ -502,69 +948,157 @@ func (c *WmClient) createURL(path string) string {
 	return url + path
 }
 
-// Performs a GET request and returns the response body as a byte array JSON that can be unmarshalled
-func (c *WmClient) internalGet(endpoint string) ([]byte, error) {
-	url := c.createURL(endpoint)
-	request, err := http.NewRequest("GET", url, nil)
+// Performs a GET request and decodes the response body into v
+func (c *WmClient) internalGet(ctx context.Context, endpoint string, v interface{}) error {
+	res, body, err := c.doRequest(ctx, "GET", endpoint, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	res, reserr := c.httpClient.Do(request)
-	if reserr != nil {
-		return nil, reserr
+
+	return c.decodeResponse(res, body, v)
+}
+
+func (c *WmClient) internalLookup(ctx context.Context, request Request, path string) (*JSONDeviceData, error) {
+	var deviceData = JSONDeviceData{}
+
+	res, resbody, err := c.postLookup(ctx, path, func(legacy bool) interface{} {
+		return lookupPayload(request, legacy)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	defer res.Body.Close()
+	var umerr = c.decodeResponse(res, resbody, &deviceData)
+	if umerr != nil {
+		if res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusServiceUnavailable {
+			return nil, umerr
+		}
+		// an overloaded WM server, or a gateway in front of it, does not reply with device data
+		deviceData = JSONDeviceData{Error: http.StatusText(res.StatusCode)}
+	}
+	deviceData.Metadata = c.getResponseMetadata(res.Header)
+	if wantsRawBody(ctx) {
+		deviceData.RawBody = resbody
+	}
+	c.setDeviceID(&deviceData)
+	if c.repairCaps && len(deviceData.Error) == 0 {
+		c.repairCapabilities(&deviceData, request)
+	}
 
-	var body, berr = ioutil.ReadAll(res.Body)
-	if berr != nil {
-		return nil, berr
+	// error messages in json are returned as errors, without device data. Only the errors of lookups by id decoded from
+	// responses of a server that is not overloaded or failing report an unknown id
+	if len(deviceData.Error) > 0 {
+		notFound := umerr == nil && res.StatusCode != http.StatusTooManyRequests && res.StatusCode < http.StatusInternalServerError &&
+			(path == lookupDeviceIDPath || path == lookupTACPath)
+		serverError := newServerError(&deviceData, res.StatusCode, notFound)
+		serverError.RetryAfter, _ = parseRetryAfter(res.Header)
+		return nil, serverError
 	}
 
-	return body, nil
+	return &deviceData, nil
 }
 
-func (c *WmClient) internalLookup(ctx context.Context, request Request, path string) (*JSONDeviceData, error) {
-	var deviceData = JSONDeviceData{}
-	url := c.createURL(path)
+// doRequest sends a request with the given method and (optional) JSON body to the given WM server path, and returns the
+// response together with its fully read body. If the server does not accept the preferred response formats, the request
+// is sent again accepting JSON only
+func (c *WmClient) doRequest(ctx context.Context, method string, path string, reqbody []byte) (*http.Response, []byte, error) {
+	if c == nil {
+		return nil, nil, ErrNilClient
+	}
+	if c.httpClient == nil {
+		return nil, nil, ErrClientNotInitialized
+	}
+	res, body, err := c.sendWithRetries(ctx, method, path, reqbody, c.acceptHeader())
+	if err == nil && res.StatusCode == http.StatusNotAcceptable && c.negotiatesFormat() {
+		c.disableFormatNegotiation()
+		res, body, err = c.sendWithRetries(ctx, method, path, reqbody, FormatJSON)
+	}
+	return res, body, err
+}
 
-	reqbody, merr := json.Marshal(request)
-	if merr != nil {
-		return nil, merr
+func (c *WmClient) sendRequest(ctx context.Context, method string, path string, reqbody []byte, accept string) (*http.Response, []byte, error) {
+	var bodyReader io.Reader
+	if reqbody != nil {
+		bodyReader = bytes.NewBuffer(reqbody)
 	}
 
-	httpreq, herr := http.NewRequest("POST", url, bytes.NewBuffer(reqbody))
+	httpreq, herr := http.NewRequest(method, c.createURL(path), bodyReader)
 	if herr != nil {
-		return nil, herr
+		return nil, nil, herr
+	}
+
+	httpreq.Header.Set("Accept", accept)
+	if bypassesCache(ctx) {
+		httpreq.Header.Set("Cache-Control", "no-cache")
+	}
+	if method == "POST" {
+		httpreq.Header.Set("User-Agent", getWmClientUserAgent(httpreq.UserAgent()))
+	}
+
+	if c.requestDecorator != nil {
+		if derr := c.requestDecorator(httpreq); derr != nil {
+			return nil, nil, derr
+		}
+	}
+
+	if c.conns != nil {
+		trace, done := c.conns.trace()
+		defer done()
+		ctx = httptrace.WithClientTrace(ctx, trace)
 	}
 
-	httpreq.Header.Set("User-Agent", getWmClientUserAgent(httpreq.UserAgent()))
+	limiter := c.limiter
+	if limiter != nil {
+		if lerr := limiter.acquire(ctx); lerr != nil {
+			return nil, nil, lerr
+		}
+	}
+	start := time.Now()
 
 	res, err := c.httpClient.Do(httpreq.WithContext(ctx))
 	if err != nil {
-		return nil, err
+		c.releaseLimiter(ctx, limiter, start, 0, err)
+		return nil, nil, err
 	}
 
 	defer res.Body.Close()
 
-	var resbody, berr = ioutil.ReadAll(res.Body)
+	var body, berr = ioutil.ReadAll(res.Body)
+	c.releaseLimiter(ctx, limiter, start, res.StatusCode, berr)
 	if berr != nil {
-		return nil, berr
+		return nil, nil, berr
 	}
 
-	var umerr = json.Unmarshal(resbody, &deviceData)
-	if umerr != nil {
-		return nil, umerr
+	c.addTransfer(path, len(reqbody), len(body))
+	return res, body, nil
+}
+
+// SetDiagnosticHeaders sets the names of the WM server response headers that are copied in the Metadata of the returned
+// device data, in addition to Server, X-Request-Id and X-Processing-Time.
+// This function should be called before performing any lookup
+func (c *WmClient) SetDiagnosticHeaders(headerNames []string) {
+	if c == nil {
+		return
 	}
+	c.diagnosticHeaders = headerNames
+}
 
-	// check for error messages in json and return it with data from device
-	if len(deviceData.Error) > 0 {
-		errMsg := deviceData.Error
-		deviceData.Error = ""
-		return &deviceData, errors.New("Received error from WM server: " + errMsg)
+// getResponseMetadata extracts the diagnostic headers from the given WM server response headers
+func (c *WmClient) getResponseMetadata(header http.Header) *ResponseMetadata {
+	metadata := &ResponseMetadata{
+		ServerVersion:  header.Get(serverHeader),
+		RequestID:      header.Get(requestIDHeader),
+		ProcessingTime: header.Get(processingTimeHeader),
+		Headers:        make(http.Header),
 	}
 
-	return &deviceData, nil
+	names := append([]string{serverHeader, requestIDHeader, processingTimeHeader}, c.diagnosticHeaders...)
+	for _, name := range names {
+		if values, ok := header[http.CanonicalHeaderKey(name)]; ok {
+			metadata.Headers[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	return metadata
 }
 
 func getWmClientUserAgent(userAgent string) string {
@@ -577,19 +1111,15 @@ func (c *WmClient) getUserAgentCacheKey(headers map[string]string) string {
 	for _, hname := range c.ImportantHeaders {
 		key += headers[hname]
 	}
-	md5Sum := md5.Sum([]byte(key))
-	return hex.EncodeToString(md5Sum[:])
-}
-
-func checkData(data *JSONInfoData) bool {
-	// These check ensure received data is OK
-	return len(data.WmVersion) > 0 && len(data.WurflAPIVersion) > 0 && len(data.WurflInfo) > 0 &&
-		(len(data.StaticCaps) > 0 || len(data.VirtualCaps) > 0)
+	return hashKey(key)
 }
 
 // SetHTTPTimeout sets the connection and transfer timeouts for this client in seconds.
 // This function should be called before performing any connection to WM server
 func (c *WmClient) SetHTTPTimeout(connection int, transfer int) {
+	if c == nil {
+		return
+	}
 	if connection <= 0 {
 		c.connTimeout = defaultConnTimeout
 	} else {
@@ -603,15 +1133,31 @@ func (c *WmClient) SetHTTPTimeout(connection int, transfer int) {
 	}
 
 	c.httpClient = createHTTPClient(c.connTimeout, c.transferTimeout)
-
+	if c.transport != nil {
+		// connection timeout is handled by the custom transport
+		c.httpClient.Transport = c.transport
+	} else {
+		c.trackConnections()
+		c.applyTLSConfig()
+		c.applyMaxIdleTime()
+		c.applyPinning()
+		c.applyProxy()
+	}
 }
 
 // GetAllOSes returns a slice of all devices device_os capabilities in WM server
 func (c *WmClient) GetAllOSes() ([]string, error) {
+	return c.GetAllOSesContext(context.Background())
+}
 
-	err := c.loadDeviceOsesData()
+// GetAllOSesContext works like GetAllOSes, the request to WM server, if needed, is bound to the given context
+func (c *WmClient) GetAllOSesContext(ctx context.Context) ([]string, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	err := c.loadDeviceOsesData(ctx)
 
-	if err != nil && len(c.deviceOses) > 0 {
+	if err != nil {
 		return nil, err
 	}
 
@@ -621,17 +1167,26 @@ func (c *WmClient) GetAllOSes() ([]string, error) {
 	return retVal, nil
 }
 
-// GetAllVersionsForOS returns a slice of an aggregate containing device_os_version for the given os_name
+// GetAllVersionsForOS returns a slice of an aggregate containing device_os_version for the given os_name. OS names are
+// matched ignoring letter case and white spaces. If no OS matches, an *UnknownNameError is returned
 func (c *WmClient) GetAllVersionsForOS(osName string) ([]string, error) {
+	return c.GetAllVersionsForOSContext(context.Background(), osName)
+}
 
-	err := c.loadDeviceOsesData()
+// GetAllVersionsForOSContext works like GetAllVersionsForOS, the request to WM server, if needed, is bound to the given context
+func (c *WmClient) GetAllVersionsForOSContext(ctx context.Context, osName string) ([]string, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	err := c.loadDeviceOsesData(ctx)
 
-	if err != nil && len(c.deviceOses) > 0 {
+	if err != nil {
 		return nil, err
 	}
 
 	c.deviceOsesMutex.Lock()
-	if val, ok := c.deviceOsVerMap[osName]; ok {
+	if name, ok := matchEnumName(c.deviceOses, osName); ok {
+		val := c.deviceOsVerMap[name]
 		c.deviceOsesMutex.Unlock()
 		// Now, remove all empty version fields
 		osval := make([]string, 0)
@@ -642,12 +1197,12 @@ func (c *WmClient) GetAllVersionsForOS(osName string) ([]string, error) {
 		}
 		return osval, nil
 	}
-	c.deviceOsesMutex.Unlock() // unlock here is if block is not traversed
+	defer c.deviceOsesMutex.Unlock()
 
-	return nil, errors.New(fmt.Sprintf("Error getting data from WM server: %s does not exist", osName))
+	return nil, newUnknownNameError(c.deviceOses, osName)
 }
 
-func (c *WmClient) loadDeviceOsesData() error {
+func (c *WmClient) loadDeviceOsesData(ctx context.Context) error {
 	// We lock the shared makeModel cache
 	c.deviceOsesMutex.Lock()
 	if c.deviceOses != nil && len(c.deviceOses) > 0 {
@@ -659,15 +1214,11 @@ func (c *WmClient) loadDeviceOsesData() error {
 	c.deviceOsesMutex.Unlock()
 
 	osVersionModels := make([]JSONDeviceOsVersions, 1000)
-	var body, berr = c.internalGet("/v2/alldeviceosversions/json")
+	var berr = c.internalGet(ctx, "/v2/alldeviceosversions/json", &osVersionModels)
 	if berr != nil {
 		return berr
 	}
 
-	var merror = json.Unmarshal(body, &osVersionModels)
-	if merror != nil {
-		return merror
-	}
 	var ovMap = make(map[string][]string, 0)
 	var ov = make([]string, 0)
 
@@ -689,35 +1240,67 @@ func (c *WmClient) loadDeviceOsesData() error {
 
 // GetAllDeviceMakes returns a slice of all devices brand_name capabilities in WM server
 func (c *WmClient) GetAllDeviceMakes() ([]string, error) {
+	return c.GetAllDeviceMakesContext(context.Background())
+}
 
-	err := c.loadDeviceMakesData()
+// GetAllDeviceMakesContext works like GetAllDeviceMakes, the request to WM server, if needed, is bound to the given context
+func (c *WmClient) GetAllDeviceMakesContext(ctx context.Context) ([]string, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	err := c.loadDeviceMakesData(ctx)
 
-	if err != nil && len(c.deviceMakes) > 0 {
+	if err != nil {
 		return nil, err
 	}
 
-	return c.deviceMakes, nil
+	c.deviceMakesMutex.Lock()
+	retVal := c.deviceMakes
+	c.deviceMakesMutex.Unlock()
+	return retVal, nil
 }
 
-// GetAllDevicesForMake returns a slice of an aggregate containing model_names and marketing_names for the given brand_name
+// GetAllDevicesForMake returns a slice of an aggregate containing model_names and marketing_names for the given brand_name.
+// If the whole device makes data has not been loaded yet and WM server supports it, only the given brand is fetched.
+// Brand names are matched ignoring letter case and white spaces: if WM server does not know the brand as given, the whole
+// device makes data is loaded to find it. If no brand matches, an *UnknownNameError is returned
 func (c *WmClient) GetAllDevicesForMake(brandName string) ([]JSONModelMktName, error) {
+	return c.GetAllDevicesForMakeContext(context.Background(), brandName)
+}
+
+// GetAllDevicesForMakeContext works like GetAllDevicesForMake, the request to WM server, if needed, is bound to the given context
+func (c *WmClient) GetAllDevicesForMakeContext(ctx context.Context, brandName string) ([]JSONModelMktName, error) {
+	if c == nil {
+		return nil, ErrNilClient
+	}
+	c.deviceMakesMutex.Lock()
+	loaded := len(c.deviceMakes) > 0
+	c.deviceMakesMutex.Unlock()
+	if !loaded {
+		devices, supported, err := c.loadDevicesForMake(ctx, brandName)
+		if err != nil {
+			return nil, err
+		}
+		if supported && len(devices) > 0 {
+			return devices, nil
+		}
+	}
 
-	err := c.loadDeviceMakesData()
+	err := c.loadDeviceMakesData(ctx)
 
-	if err != nil && len(c.deviceMakes) > 0 {
+	if err != nil {
 		return nil, err
 	}
 	c.deviceMakesMutex.Lock()
-	if val, ok := c.deviceMakesMap[brandName]; ok {
-		c.deviceMakesMutex.Unlock()
-		return val, nil
+	defer c.deviceMakesMutex.Unlock()
+	if name, ok := matchEnumName(c.deviceMakes, brandName); ok {
+		return c.deviceMakesMap[name], nil
 	}
-	c.deviceMakesMutex.Unlock()
 
-	return nil, errors.New(fmt.Sprintf("Error getting data from WM server: %s does not exist", brandName))
+	return nil, newUnknownNameError(c.deviceMakes, brandName)
 }
 
-func (c *WmClient) loadDeviceMakesData() error {
+func (c *WmClient) loadDeviceMakesData(ctx context.Context) error {
 	// We lock the shared makeModel cache
 	c.deviceMakesMutex.Lock()
 	if c.deviceMakes != nil && len(c.deviceMakes) > 0 {
@@ -729,39 +1312,59 @@ func (c *WmClient) loadDeviceMakesData() error {
 	c.deviceMakesMutex.Unlock()
 
 	mkModels := make([]JSONMakeModel, 1000)
-	var body, berr = c.internalGet("/v2/alldevices/json")
+	var berr = c.internalGet(ctx, "/v2/alldevices/json", &mkModels)
 	if berr != nil {
 		return berr
 	}
 
-	var merror = json.Unmarshal(body, &mkModels)
-	if merror != nil {
-		return merror
-	}
-
 	var dmMap = make(map[string][]JSONModelMktName, 0)
 	var dm = make([]string, 0)
+	var modelIndex map[string][]JSONMakeModel
+	if c.modelIndexEnabled {
+		modelIndex = make(map[string][]JSONMakeModel, len(mkModels))
+	}
 
 	for _, mkModel := range mkModels {
 		if _, ok := dmMap[mkModel.BrandName]; !ok {
 			dm = append(dm, mkModel.BrandName)
 		}
 		dmMap[mkModel.BrandName] = append(dmMap[mkModel.BrandName], JSONModelMktName{mkModel.ModelName, mkModel.MarketingName})
+		if modelIndex != nil {
+			modelIndex[mkModel.ModelName] = append(modelIndex[mkModel.ModelName], mkModel)
+		}
 	}
 
 	c.deviceMakesMutex.Lock()
 	c.deviceMakesMap = dmMap
 	c.deviceMakes = dm
+	c.modelIndex = modelIndex
 	c.deviceMakesMutex.Unlock()
 	return nil
 }
 
-// If given ltime is different from client internal one, all caches are cleared and client last load time is updated
+// If given ltime is later than the client internal one, all caches are cleared and client last load time is updated
 func (c *WmClient) clearCachesIfNeeded(ltime string) {
 
-	if len(ltime) > 0 && c.clientLtime != ltime {
+	if len(ltime) == 0 {
+		return
+	}
+
+	// only the first of the concurrent lookups that see a new ltime clears the caches. Ltimes older than the client one, ie:
+	// reported by a server that has not loaded the latest WURFL file yet, are ignored
+	c.ltimeMutex.Lock()
+	changed := c.isNewerLtime(ltime)
+	if changed {
 		c.clientLtime = ltime
-		c.clearCache()
+	}
+	c.ltimeMutex.Unlock()
+
+	if !changed {
+		return
+	}
+
+	userAgentCache, deviceCache := c.swapCaches(CacheClearLtimeChange)
+	if c.rewarmEntries > 0 && (userAgentCache != nil || deviceCache != nil) {
+		c.startCacheRewarm(ltime, userAgentCache, deviceCache)
 	}
 }
 
@@ -18,9 +18,12 @@ package wmclient
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"net/http"
+	"net/http/httptest"
+	"net/textproto"
 	"os"
 	"strings"
 	"testing"
@@ -400,6 +403,21 @@ func internalTestLookupDeviceID(t *testing.T, client *WmClient) {
 
 }
 
+func TestLookupDeviceIdWithoutWurflIDInCapabilities(t *testing.T) {
+	client := createTestClient(t)
+	client.SetWurflIDInCapabilities(false)
+	client.SetRequestedStaticCapabilities([]string{"brand_name", "is_smarttv"})
+	client.SetRequestedVirtualCapabilities([]string{"form_factor"})
+	jsonData, err := client.LookupDeviceID(context.Background(), "generic_opera_mini_version1")
+	require.Nil(t, err)
+	require.Equal(t, "generic_opera_mini_version1", jsonData.DeviceID)
+	// only the requested capabilities are returned
+	require.Equal(t, 3, len(jsonData.Capabilities))
+	_, ok := jsonData.Capabilities["wurfl_id"]
+	require.False(t, ok)
+	client.DestroyConnection()
+}
+
 func TestLookupDeviceIdWithSpecificCaps(t *testing.T) {
 	client := createTestClient(t)
 	reqCaps := []string{"brand_name", "is_smarttv"}
@@ -414,6 +432,7 @@ func TestLookupDeviceIdWithSpecificCaps(t *testing.T) {
 	require.Equal(t, "Opera", did["brand_name"])
 	require.Equal(t, "false", did["is_smarttv"])
 	require.Equal(t, 4, len(did))
+	require.Equal(t, "generic_opera_mini_version1", jsonData.DeviceID)
 	client.DestroyConnection()
 }
 
@@ -451,32 +470,29 @@ func TestLookupDeviceIdWithWrongSpecificCaps(t *testing.T) {
 func TestLookupDeviceIdWithWrongId(t *testing.T) {
 	client := createTestClient(t)
 	jsonData, err := client.LookupDeviceID(context.Background(), "nokia_generic_series40_wrong")
-	require.NotNil(t, jsonData)
-	require.NotNil(t, err)
-	did := jsonData.Capabilities
-	require.Nil(t, did)
-	require.True(t, len(jsonData.APIVersion) > 0)
-	require.True(t, len(jsonData.Error) == 0)
+	require.Nil(t, jsonData)
 	require.NotNil(t, err)
-	require.Equal(t, 0, len(did))
-	require.True(t, jsonData.Mtime > 0)
+	require.True(t, errors.Is(err, ErrDeviceNotFound))
+	serverError, ok := err.(*ServerError)
+	require.True(t, ok)
+	require.True(t, len(serverError.Message) > 0)
+	require.True(t, len(serverError.APIVersion) > 0)
+	require.True(t, serverError.Mtime > 0)
 	client.DestroyConnection()
 }
 
 func TestLookupDeviceIdWithEmptyId(t *testing.T) {
 	client := createTestClient(t)
 	jsonData, err := client.LookupDeviceID(context.Background(), "")
-	require.NotNil(t, jsonData)
-	require.NotNil(t, err)
-	did := jsonData.Capabilities
-	require.Nil(t, did)
-	require.True(t, len(jsonData.APIVersion) > 0)
-	require.True(t, len(jsonData.Error) == 0)
+	require.Nil(t, jsonData)
 	require.NotNil(t, err)
-	require.Equal(t, 0, len(did))
-	require.True(t, jsonData.Mtime > 0)
+	require.True(t, errors.Is(err, ErrDeviceNotFound))
+	serverError, ok := err.(*ServerError)
+	require.True(t, ok)
+	require.True(t, len(serverError.Message) > 0)
+	require.True(t, len(serverError.APIVersion) > 0)
+	require.True(t, serverError.Mtime > 0)
 	client.DestroyConnection()
-
 }
 
 func TestLookupDeviceEmptyUseragent(t *testing.T) {
@@ -604,6 +620,30 @@ func TestLookupRequestWithCache(t *testing.T) {
 	client.DestroyConnection()
 }
 
+func TestLookupRequestContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"capabilities":{"wurfl_id":"generic"}}`))
+	}))
+	defer server.Close()
+	client := newTestClient(t, server)
+	client.ImportantHeaders = []string{"User-Agent"}
+
+	request, err := http.NewRequest("GET", "http://mysite.com/", nil)
+	require.Nil(t, err)
+	request.Header.Set("User-Agent", "Mozilla/5.0")
+	device, err := client.LookupRequestContext(context.Background(), request)
+	require.Nil(t, err)
+	require.Equal(t, "generic", device.DeviceID)
+
+	// the given context is used, as well as the request one by LookupRequest
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.LookupRequestContext(cancelled, request)
+	require.True(t, errors.Is(err, context.Canceled))
+	_, err = client.LookupRequest(*request.WithContext(cancelled))
+	require.True(t, errors.Is(err, context.Canceled))
+}
+
 func TestLookupHeadersOk(t *testing.T) {
 	client := createTestClient(t)
 
@@ -631,6 +671,63 @@ func TestLookupHeadersOk(t *testing.T) {
 	client.DestroyConnection()
 }
 
+func TestLookupMultiValueHeadersOk(t *testing.T) {
+	client := createTestClient(t)
+
+	headers := textproto.MIMEHeader{
+		"X-Ucbrowser-Device-Ua": {"", "Mozilla/5.0 (SAMSUNG; SAMSUNG-GT-S5253/S5253DDJI7; U; Bada/1.0; en-us) AppleWebKit/533.1 (KHTML, like Gecko) Dolfin/2.0 Mobile WQVGA SMM-MMS/1.2.0 OPN-B"},
+		"User-Agent":            {"Mozilla/5.0 (Nintendo Switch; WebApplet) AppleWebKit/601.6 (KHTML, like Gecko) NF/4.0.0.5.9 NintendoBrowser/5.1.0.13341"},
+	}
+	jsonData, derr := client.LookupMIMEHeader(context.Background(), headers)
+	require.Nil(t, derr)
+	require.NotNil(t, jsonData)
+	require.Equal(t, "Samsung", jsonData.Capabilities["brand_name"])
+	require.Equal(t, "GT-S5253", jsonData.Capabilities["model_name"])
+
+	jsonData, derr = client.LookupMultiValueHeaders(context.Background(), http.Header(headers))
+	require.Nil(t, derr)
+	require.Equal(t, "GT-S5253", jsonData.Capabilities["model_name"])
+
+	jsonData, derr = client.LookupHTTPHeaders(context.Background(), http.Header(headers))
+	require.Nil(t, derr)
+	require.Equal(t, "GT-S5253", jsonData.Capabilities["model_name"])
+
+	client.DestroyConnection()
+}
+
+func TestFlattenHeaders(t *testing.T) {
+	flat := flattenHeaders(map[string][]string{
+		"user-agent":    {"lower"},
+		"USER-AGENT":    {"upper"},
+		"User-Agent":    {"", "canonical"},
+		"x-wap-profile": {"", ""},
+		"Accept":        {"text/html", "application/json"},
+	})
+	require.Equal(t, map[string]string{"user-agent": "canonical", "accept": "text/html"}, flat)
+
+	// without the canonical form, the lexically first non empty form wins
+	flat = flattenHeaders(map[string][]string{"user-agent": {"lower"}, "USER-AGENT": {"upper"}})
+	require.Equal(t, "upper", flat["user-agent"])
+}
+
+func TestJoinHeaders(t *testing.T) {
+	joined := joinHeaders(http.Header{
+		"Accept":                {"text/html", "", "application/json"},
+		"accept":                {"*/*"},
+		"User-Agent":            {"", "Mozilla/5.0 (Linux; Android 10; SM-G975F)", "other"},
+		"user-agent":            {"lower"},
+		"X-Ucbrowser-Device-Ua": {"first", "second"},
+		"Sec-Ch-Ua":             {`"Chromium";v="110"`, `"Not A(Brand";v="24"`},
+		"X-Wap-Profile":         {"", ""},
+	})
+	require.Equal(t, map[string]string{
+		"accept":                "text/html, application/json, */*",
+		"user-agent":            "Mozilla/5.0 (Linux; Android 10; SM-G975F)",
+		"x-ucbrowser-device-ua": "first",
+		"sec-ch-ua":             `"Chromium";v="110", "Not A(Brand";v="24"`,
+	}, joined)
+}
+
 func TestLookupHeadersWithMixedCase(t *testing.T) {
 	client := createTestClient(t)
 
@@ -949,3 +1046,114 @@ func TestCacheUsage(t *testing.T) {
 	assert.True(t, avgDetectionTime > avgCacheTime*10)
 
 }
+
+func TestCacheTTLWithJitter(t *testing.T) {
+	client := &WmClient{}
+	require.NotNil(t, client.SetCacheTTL(time.Minute, 1))
+	require.NotNil(t, client.SetCacheTTL(time.Minute, -0.1))
+	require.Nil(t, client.SetCacheTTL(time.Minute, 0.2))
+
+	// expiration times must be spread within [0.8 * ttl, 1.2 * ttl]
+	start := time.Now()
+	spread := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		entry := client.newCacheEntry(&JSONDeviceData{})
+		ttl := entry.expiresAt.Sub(start)
+		require.True(t, ttl >= 48*time.Second, "ttl %s is too short", ttl)
+		require.True(t, ttl <= 72*time.Second+time.Second, "ttl %s is too long", ttl)
+		spread[ttl.Truncate(time.Second)] = true
+	}
+	require.True(t, len(spread) > 1)
+
+	// without TTL entries never expire
+	require.Nil(t, client.SetCacheTTL(0, 0))
+	require.False(t, client.newCacheEntry(&JSONDeviceData{}).expired())
+}
+
+func TestCacheTTLExpiration(t *testing.T) {
+	client := &WmClient{}
+	client.SetCacheSize(10)
+	require.Nil(t, client.SetCacheTTL(20*time.Millisecond, 0))
+
+	client.addToUserAgentCache("ua", &JSONDeviceData{})
+	client.addToDeviceCache("generic", &JSONDeviceData{})
+	_, ok, _ := client.getFromUserAgentCache("ua")
+	require.True(t, ok)
+	_, ok, _ = client.getFromDeviceCache("generic")
+	require.True(t, ok)
+
+	time.Sleep(30 * time.Millisecond)
+	_, ok, _ = client.getFromUserAgentCache("ua")
+	require.False(t, ok)
+	_, ok, _ = client.getFromDeviceCache("generic")
+	require.False(t, ok)
+}
+
+func TestUncachedLookups(t *testing.T) {
+	client := createTestCachedClient(t)
+	ua := "Mozilla/5.0 (iPhone; CPU iPhone OS 10_2_1 like Mac OS X) AppleWebKit/602.4.6 (KHTML, like Gecko) Version/10.0 Mobile/14D27 Safari/602.1"
+
+	d, err := client.LookupUserAgentUncached(context.Background(), ua)
+	require.Nil(t, err)
+	require.NotNil(t, d)
+
+	headers := map[string]string{"User-Agent": ua}
+	d, err = client.LookupHeadersUncached(context.Background(), headers)
+	require.Nil(t, err)
+	require.NotNil(t, d)
+
+	request, err := http.NewRequest("GET", "http://mysite.com/api/v2/foo/info.json", nil)
+	require.Nil(t, err)
+	request.Header.Add("User-Agent", ua)
+	d, err = client.LookupRequestUncached(*request)
+	require.Nil(t, err)
+	require.NotNil(t, d)
+
+	d, err = client.LookupDeviceIDUncached(context.Background(), d.Capabilities["wurfl_id"])
+	require.Nil(t, err)
+	require.NotNil(t, d)
+
+	// nothing has been written to the caches...
+	dc, uac := client.GetActualCacheSizes()
+	require.Equal(t, 0, dc)
+	require.Equal(t, 0, uac)
+
+	// ... and nothing is read from them
+	_, err = client.LookupUserAgent(context.Background(), ua)
+	require.Nil(t, err)
+	_, err = client.LookupUserAgentUncached(context.Background(), ua)
+	require.Nil(t, err)
+	stats := client.GetCacheStats()
+	require.Equal(t, uint64(0), stats.Hits)
+	require.Equal(t, uint64(1), stats.Misses)
+
+	client.DestroyConnection()
+}
+
+func TestGetResponseMetadata(t *testing.T) {
+	client := &WmClient{}
+	client.SetDiagnosticHeaders([]string{"x-trace-id"})
+
+	header := make(http.Header)
+	header.Set("Server", "WURFL Microservice/2.1.0")
+	header.Set("X-Request-Id", "a1b2c3")
+	header.Set("X-Trace-Id", "trace-1")
+	header.Set("Content-Type", "application/json")
+
+	metadata := client.getResponseMetadata(header)
+	require.Equal(t, "WURFL Microservice/2.1.0", metadata.ServerVersion)
+	require.Equal(t, "a1b2c3", metadata.RequestID)
+	require.Equal(t, "", metadata.ProcessingTime)
+	require.Equal(t, "trace-1", metadata.Headers.Get("X-Trace-Id"))
+	// only diagnostic headers are kept
+	require.Equal(t, 3, len(metadata.Headers))
+}
+
+func TestLookupResponseMetadata(t *testing.T) {
+	client := createTestClient(t)
+	d, err := client.LookupDeviceID(context.Background(), "generic")
+	require.Nil(t, err)
+	require.NotNil(t, d.Metadata)
+	require.NotNil(t, d.Metadata.Headers)
+	client.DestroyConnection()
+}
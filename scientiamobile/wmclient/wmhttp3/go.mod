@@ -0,0 +1,23 @@
+module github.com/wurfl/wurfl-microservice-client-golang/scientiamobile/wmclient/wmhttp3
+
+go 1.26.0
+
+require (
+	github.com/quic-go/quic-go v0.63.0
+	github.com/stretchr/testify v1.12.1
+	github.com/wurfl/wurfl-microservice-client-golang/v2 v2.0.0
+)
+
+require (
+	github.com/golang/groupcache v0.0.0-20190702054246-869f871628b6 // indirect
+	github.com/quic-go/qpack v0.6.0 // indirect
+	go.yaml.in/yaml/v3 v3.0.5 // indirect
+	golang.org/x/crypto v0.54.0 // indirect
+	golang.org/x/net v0.56.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/text v0.40.0 // indirect
+	gopkg.in/yaml.v2 v2.2.2 // indirect
+)
+
+// the client is developed in the same repository
+replace github.com/wurfl/wurfl-microservice-client-golang/v2 => ../../..
@@ -0,0 +1,53 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package wmhttp3 makes the WM client connect to WM server using HTTP/3 over QUIC. It is EXPERIMENTAL and it is a separate
+// module, so that applications not using it do not depend on quic-go, which also requires a more recent Go version than the
+// client.
+package wmhttp3
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/wurfl/wurfl-microservice-client-golang/v2/scientiamobile/wmclient"
+)
+
+// defaultTransferTimeout is the timeout of the requests when none is given, the client default one
+const defaultTransferTimeout = 60 * time.Second
+
+// WithHTTP3 makes a client created with wmclient.CreateWithOptions connect to WM server using HTTP/3 over QUIC, which
+// reduces connection setup time and head-of-line blocking when the server is remote. The WM server (or the proxy in front
+// of it) must support HTTP/3 and the client must use the https scheme. A nil tlsConfig uses the system defaults, a transfer
+// timeout <= 0 keeps the client default, 60 seconds.
+// Like the other clients given with wmclient.WithHTTPClient, it cannot be used with the TLS and proxy options
+func WithHTTP3(tlsConfig *tls.Config, transferTimeout time.Duration) wmclient.Option {
+	return wmclient.WithHTTPClient(NewHTTPClient(tlsConfig, transferTimeout))
+}
+
+// NewHTTPClient returns an http.Client sending its requests using HTTP/3, with the given TLS configuration and timeout
+// as WithHTTP3 does, ie: to share it with other services
+func NewHTTPClient(tlsConfig *tls.Config, transferTimeout time.Duration) *http.Client {
+	if transferTimeout <= 0 {
+		transferTimeout = defaultTransferTimeout
+	}
+	return &http.Client{
+		Timeout:   transferTimeout,
+		Transport: &http3.Transport{TLSClientConfig: tlsConfig},
+	}
+}
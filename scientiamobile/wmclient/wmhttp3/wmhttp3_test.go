@@ -0,0 +1,78 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmhttp3
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/require"
+	"github.com/wurfl/wurfl-microservice-client-golang/v2/scientiamobile/wmclient"
+)
+
+func TestWithHTTP3(t *testing.T) {
+	var proto int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.StoreInt32(&proto, int32(r.ProtoMajor))
+		var data interface{}
+		switch r.URL.Path {
+		case "/v2/getinfo/json":
+			data = wmclient.JSONInfoData{WmVersion: "2.1.0", WurflAPIVersion: "1.12", WurflInfo: "wurfl.zip", Ltime: "2020-01-01 10:00:00",
+				ImportantHeaders: []string{"User-Agent"}, StaticCaps: []string{"brand_name"}, VirtualCaps: []string{"is_mobile"}}
+		default:
+			data = wmclient.JSONDeviceData{APIVersion: "2.1.0", Ltime: "2020-01-01 10:00:00",
+				Capabilities: map[string]string{"wurfl_id": "generic", "brand_name": "Generic"}}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(data)
+	})
+
+	// the TLS test server provides a certificate for 127.0.0.1 and a client configuration trusting it
+	tlsServer := httptest.NewTLSServer(handler)
+	defer tlsServer.Close()
+	clientTLS := tlsServer.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	server := &http3.Server{Handler: handler, TLSConfig: http3.ConfigureTLSConfig(tlsServer.TLS.Clone())}
+	go server.Serve(conn)
+	defer server.Close()
+
+	port := strconv.Itoa(conn.LocalAddr().(*net.UDPAddr).Port)
+	client, err := wmclient.CreateWithOptions(wmclient.WithServer("https", "127.0.0.1", port), WithHTTP3(clientTLS, 0))
+	require.Nil(t, err)
+	defer client.Close()
+	require.Equal(t, int32(3), atomic.LoadInt32(&proto))
+
+	atomic.StoreInt32(&proto, 0)
+	device, err := client.LookupDeviceID(context.Background(), "generic")
+	require.Nil(t, err)
+	require.Equal(t, "Generic", device.Capabilities["brand_name"])
+	require.Equal(t, int32(3), atomic.LoadInt32(&proto))
+
+	// without HTTP/3 the client cannot reach a server listening only on UDP
+	_, err = wmclient.CreateWithOptions(wmclient.WithServer("https", "127.0.0.1", port), wmclient.WithTLS(clientTLS),
+		wmclient.WithHTTPTimeout(100*time.Millisecond, 100*time.Millisecond))
+	require.NotNil(t, err)
+}
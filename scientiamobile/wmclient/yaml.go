@@ -0,0 +1,82 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// yamlScalar is a scalar of a YAML document, holding its text as written, whose type is resolved when it is converted to
+// the type of its destination: the YAML resolution rules are not applied, so that a port written as 8080 is a string and
+// yes is not a boolean
+type yamlScalar struct {
+	value string
+}
+
+// yamlNode captures a YAML value as nested map[string]interface{}, []interface{} and yamlScalar values
+type yamlNode struct {
+	value interface{}
+}
+
+func (n *yamlNode) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw interface{}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	switch raw.(type) {
+	case nil:
+		n.value = nil
+	case map[interface{}]interface{}:
+		var mapping map[string]yamlNode
+		if err := unmarshal(&mapping); err != nil {
+			return err
+		}
+		values := make(map[string]interface{}, len(mapping))
+		for key, node := range mapping {
+			values[key] = node.value
+		}
+		n.value = values
+	case []interface{}:
+		var sequence []yamlNode
+		if err := unmarshal(&sequence); err != nil {
+			return err
+		}
+		values := make([]interface{}, 0, len(sequence))
+		for _, node := range sequence {
+			values = append(values, node.value)
+		}
+		n.value = values
+	default:
+		var text string
+		if err := unmarshal(&text); err != nil {
+			return err
+		}
+		n.value = yamlScalar{value: text}
+	}
+	return nil
+}
+
+// parseYAML parses the given YAML document into nested map[string]interface{}, []interface{} and yamlScalar values.
+// Duplicate keys are rejected. An empty document is parsed as nil
+func parseYAML(data []byte) (interface{}, error) {
+	var document yamlNode
+	if err := yaml.UnmarshalStrict(data, &document); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+	return document.value, nil
+}
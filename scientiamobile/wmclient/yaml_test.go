@@ -0,0 +1,126 @@
+/*
+Copyright 2019 ScientiaMobile Inc. http://www.scientiamobile.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wmclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseYAML(t *testing.T) {
+	document := `
+# WM client
+---
+url: "https://wm.internal:8443/wm" # endpoint
+port: 8080
+empty:
+name: 'it''s # not a comment'
+caps: [brand_name, "form_factor", 'is_mobile']
+no_caps: []
+list:
+- a
+- "b: c"
+nested:
+  key: value
+  deeper:
+    list:
+      - 1
+      -
+      - 2
+`
+	value, err := parseYAML([]byte(document))
+	require.Nil(t, err)
+	s := func(value string) yamlScalar {
+		return yamlScalar{value: value}
+	}
+	require.Equal(t, map[string]interface{}{
+		"url":     s("https://wm.internal:8443/wm"),
+		"port":    s("8080"),
+		"empty":   nil,
+		"name":    s("it's # not a comment"),
+		"caps":    []interface{}{s("brand_name"), s("form_factor"), s("is_mobile")},
+		"no_caps": []interface{}{},
+		"list":    []interface{}{s("a"), s("b: c")},
+		"nested": map[string]interface{}{
+			"key": s("value"),
+			"deeper": map[string]interface{}{
+				"list": []interface{}{s("1"), nil, s("2")},
+			},
+		},
+	}, value)
+
+	value, err = parseYAML([]byte("# only comments\n\n"))
+	require.Nil(t, err)
+	require.Nil(t, value)
+}
+
+func TestParseYAMLFullSyntax(t *testing.T) {
+	document := `
+defaults: &defaults
+  ca_file: /etc/wm/ca.pem
+tls:
+  <<: *defaults
+  insecure_skip_verify: false
+flow: {a: 1, b: [x, y]}
+tagged: !!str 10
+literal: |
+  first
+  second
+folded: >
+  one
+  two
+entries:
+  - name: a
+    value: yes
+  - [1, 2]
+`
+	value, err := parseYAML([]byte(document))
+	require.Nil(t, err)
+	s := func(value string) yamlScalar {
+		return yamlScalar{value: value}
+	}
+	require.Equal(t, map[string]interface{}{
+		"defaults": map[string]interface{}{"ca_file": s("/etc/wm/ca.pem")},
+		"tls":      map[string]interface{}{"ca_file": s("/etc/wm/ca.pem"), "insecure_skip_verify": s("false")},
+		"flow":     map[string]interface{}{"a": s("1"), "b": []interface{}{s("x"), s("y")}},
+		"tagged":   s("10"),
+		"literal":  s("first\nsecond\n"),
+		"folded":   s("one two\n"),
+		"entries": []interface{}{
+			// scalars are kept as written, yes is not resolved as a boolean
+			map[string]interface{}{"name": s("a"), "value": s("yes")},
+			[]interface{}{s("1"), s("2")},
+		},
+	}, value)
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	invalid := []string{
+		"a: 1\n  b: 2",
+		"a:\n  b: 1\n c: 2",
+		"a: 1\na: 2",
+		"a: [1, 2",
+		"a: \"unterminated",
+		"a: *undefined",
+		"a:\n\t- 1",
+		"a:\n  - 1\n  b: 2",
+	}
+	for _, document := range invalid {
+		_, err := parseYAML([]byte(document))
+		require.NotNil(t, err, document)
+	}
+}